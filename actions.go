@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	outputText          = "text"
+	outputGitHubActions = "github-actions"
+	outputGitHubCheck   = "github-check"
+
+	stepSummaryEnv = "GITHUB_STEP_SUMMARY"
+)
+
+// outputFlags are the -output flags of the commands that can report to a
+// CI system on top of printing.
+type outputFlags struct {
+	format    outputFormat
+	api       *string
+	checkName *string
+	checkSHA  *string
+}
+
+type outputFormat string
+
+func addOutputFlags(flags *flag.FlagSet) *outputFlags {
+	o := &outputFlags{format: outputText}
+	flags.Var(&o.format, "output", "output `format`: text, github-actions to also emit annotations and a job summary, or github-check to also post a check run")
+	o.api = flags.String("api", defaultForgeAPI, "forge API `url` of -output github-check, for GitHub Enterprise")
+	o.checkName = flags.String("check-name", "gitility "+flags.Name(), "`name` of the check run")
+	o.checkSHA = flags.String("check-sha", "", "`commit` the check run is for (default the head of the pull request, or HEAD)")
+	return o
+}
+
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+func (f *outputFormat) Set(value string) error {
+	switch value {
+	case outputText, outputGitHubActions, outputGitHubCheck:
+		*f = outputFormat(value)
+		return nil
+	}
+	return fmt.Errorf("unknown output %q, want text, github-actions or github-check", value)
+}
+
+// annotated tells whether the command should collect annotations and a
+// summary for report.
+func (o *outputFlags) annotated() bool {
+	return o.format != outputText
+}
+
+// report hands the findings of a command to the CI system: failed is
+// whether the command fails the run.
+func (o *outputFlags) report(ctx context.Context, title string, failed bool, annotations []annotation, summary string) error {
+	switch o.format {
+	case outputGitHubActions:
+		return emitGitHubActions(annotations, summary)
+	case outputGitHubCheck:
+		return o.postCheckRun(ctx, title, failed, annotations, summary)
+	}
+	return nil
+}
+
+// annotation is a finding GitHub shows inline in the checks of a pull
+// request, on File when it is set.
+type annotation struct {
+	Level   string // notice, warning or error
+	File    string
+	Title   string
+	Message string
+}
+
+// String formats the annotation as a workflow command.
+func (a annotation) String() string {
+	var props []string
+	if a.File != "" {
+		props = append(props, "file="+escapeProperty(a.File))
+	}
+	if a.Title != "" {
+		props = append(props, "title="+escapeProperty(a.Title))
+	}
+	return "::" + a.Level + " " + strings.Join(props, ",") + "::" + escapeData(a.Message)
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// emitGitHubActions prints the annotations, which the runner picks up from
+// the log, and appends the Markdown summary to the job summary of the step
+// when the runner set one up.
+func emitGitHubActions(annotations []annotation, summary string) error {
+	for _, a := range annotations {
+		fmt.Println(a)
+	}
+	path := os.Getenv(stepSummaryEnv)
+	if path == "" || summary == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("job summary: %w", err)
+	}
+	if _, err := f.WriteString(summary + "\n"); err != nil {
+		f.Close()
+		return fmt.Errorf("job summary: %w", err)
+	}
+	return f.Close()
+}
+
+var markdownCell = strings.NewReplacer("|", `\|`, "<", "&lt;", "\n", " ")
+
+// markdownTable formats rows as a Markdown table under the header.
+func markdownTable(header []string, rows [][]string) string {
+	var b strings.Builder
+	line := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" " + markdownCell.Replace(cell) + " |")
+		}
+		b.WriteString("\n")
+	}
+	line(header)
+	b.WriteString(strings.Repeat("| --- ", len(header)) + "|\n")
+	for _, row := range rows {
+		line(row)
+	}
+	return b.String()
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// alertMetrics are the per-file figures alert rules compare, next to the
+// file and commit fields of filter expressions.
+var alertMetrics = []string{"changes", "authors", "hotspot_score", "age_days"}
+
+// metricFile is a file with its newest change and its metrics over the
+// walk.
+type metricFile struct {
+	File
+	metrics map[string]float64
+}
+
+// metricVars are the variables of alert rules: the built-in metrics and
+// the custom ones of names.
+func metricVars(names []string) map[string]exprVar {
+	vars := make(map[string]exprVar, len(alertMetrics)+len(names))
+	for _, name := range append(append([]string{}, alertMetrics...), names...) {
+		name := name
+		vars[name] = exprVar{exprNumber, func(f File) interface{} {
+			if mf, ok := f.(*metricFile); ok {
+				return mf.metrics[name]
+			}
+			return 0.0
+		}}
+	}
+	return vars
+}
+
+// fileMetrics walks the query and measures the files it keeps: changes is
+// the number of commits touching a file, authors the distinct authors of
+// those, hotspot_score the changes relative to the most changed file and
+// age_days the days since the last change, then the custom metrics.
+func fileMetrics(ctx context.Context, q *query, now time.Time, custom []Metric) ([]*metricFile, error) {
+	commits, err := q.backend.commits(ctx, q.opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := Preload(ctx, commits, CommitFieldFiles, CommitFieldTime); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*metricFile)
+	authors := make(map[string]map[string]bool)
+	order := make([]string, 0)
+	for _, commit := range commits {
+		changed, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range changed {
+			if !satisfyFilters(file, q.filters) {
+				continue
+			}
+			mf, ok := files[file.Name()]
+			if !ok {
+				commitTime, err := commit.CommitTime(ctx)
+				if err != nil {
+					return nil, err
+				}
+				mf = &metricFile{File: file, metrics: map[string]float64{"age_days": now.Sub(commitTime).Hours() / 24}}
+				files[file.Name()] = mf
+				authors[file.Name()] = make(map[string]bool)
+				order = append(order, file.Name())
+			}
+			mf.metrics["changes"]++
+			authors[file.Name()][authorKey(commit.Author())] = true
+		}
+	}
+
+	maxChanges := 1.0
+	for _, mf := range files {
+		if mf.metrics["changes"] > maxChanges {
+			maxChanges = mf.metrics["changes"]
+		}
+	}
+	res := make([]*metricFile, 0, len(order))
+	listed := make([]File, 0, len(order))
+	for _, name := range order {
+		mf := files[name]
+		mf.metrics["authors"] = float64(len(authors[name]))
+		mf.metrics["hotspot_score"] = mf.metrics["changes"] / maxChanges
+		res = append(res, mf)
+		listed = append(listed, mf.File)
+	}
+	for _, m := range custom {
+		if err := m.Collect(ctx, commits, listed); err != nil {
+			return nil, fmt.Errorf("metric %s: %w", m.Name(), err)
+		}
+		for _, mf := range res {
+			if v, ok := m.Value(mf.Name()); ok {
+				mf.metrics[m.Name()] = v
+			}
+		}
+	}
+	return res, q.err()
+}
+
+// alertHit is a rule and the files crossing it, worst first.
+type alertHit struct {
+	Rule  string        `json:"rule"`
+	Files []alertedFile `json:"files"`
+}
+
+type alertedFile struct {
+	Name    string             `json:"name"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// compileRules compiles the rules, and returns the custom metrics they
+// compare.
+func compileRules(rules []string, custom []Metric) ([]Filters, []Metric, error) {
+	names := make([]string, 0, len(custom))
+	for _, m := range custom {
+		names = append(names, m.Name())
+	}
+	vars := metricVars(names)
+	compiled := make([]Filters, 0, len(rules))
+	used := make(map[string]bool)
+	for _, rule := range rules {
+		match, err := whereVars(rule, vars)
+		if err != nil {
+			return nil, nil, fmt.Errorf("-rule %q: %w", rule, err)
+		}
+		compiled = append(compiled, match)
+		tokens, _ := tokenizeExpr(rule)
+		for _, tok := range tokens {
+			if tok.kind == tokIdent {
+				used[tok.text] = true
+			}
+		}
+	}
+	// Only the metrics the rules compare are worth collecting.
+	compared := make([]Metric, 0)
+	for _, m := range custom {
+		if used[m.Name()] {
+			compared = append(compared, m)
+		}
+	}
+	return compiled, compared, nil
+}
+
+func evaluateRules(rules []string, compiled []Filters, files []*metricFile) []alertHit {
+	hits := make([]alertHit, 0)
+	for i, rule := range rules {
+		match := compiled[i]
+		hit := alertHit{Rule: rule}
+		for _, mf := range files {
+			if match(mf) {
+				hit.Files = append(hit.Files, alertedFile{Name: mf.Name(), Metrics: mf.metrics})
+			}
+		}
+		if len(hit.Files) > 0 {
+			sort.SliceStable(hit.Files, func(i, j int) bool {
+				return hit.Files[i].Metrics["hotspot_score"] > hit.Files[j].Metrics["hotspot_score"]
+			})
+			hits = append(hits, hit)
+		}
+	}
+	return hits
+}
+
+func formatAlert(ctx context.Context, hits []alertHit, limit int) string {
+	var b strings.Builder
+	for _, hit := range hits {
+		noun := "files"
+		if _, ok := hit.Files[0].Metrics["score"]; ok {
+			noun = "directories"
+		}
+		fmt.Fprintf(&b, "%s: %d %s\n", hit.Rule, len(hit.Files), noun)
+		for i, f := range hit.Files {
+			if i == limit {
+				fmt.Fprintf(&b, "  and %d more\n", len(hit.Files)-limit)
+				break
+			}
+			if score, ok := f.Metrics["score"]; ok {
+				fmt.Fprintf(&b, "  %-50s changes %3.0f  baseline %5.1f  score %.1f\n", displayName(ctx, f.Name+"/"), f.Metrics["latest"], f.Metrics["baseline"], score)
+				continue
+			}
+			fmt.Fprintf(&b, "  %-50s changes %3.0f  authors %2.0f  hotspot %.2f  age %.0fd\n",
+				displayName(ctx, f.Name), f.Metrics["changes"], f.Metrics["authors"], f.Metrics["hotspot_score"], f.Metrics["age_days"])
+		}
+	}
+	return b.String()
+}
+
+// alertAnnotations warns on every file a rule fired for.
+func alertAnnotations(hits []alertHit) []annotation {
+	annotations := make([]annotation, 0)
+	for _, hit := range hits {
+		for _, f := range hit.Files {
+			// Anomalies are about directories, which take no annotation.
+			if _, ok := f.Metrics["score"]; ok {
+				continue
+			}
+			message := fmt.Sprintf("changes %.0f, authors %.0f, hotspot %.2f, age %.0fd",
+				f.Metrics["changes"], f.Metrics["authors"], f.Metrics["hotspot_score"], f.Metrics["age_days"])
+			annotations = append(annotations, annotation{Level: "warning", File: f.Name, Title: "Alert: " + hit.Rule, Message: message})
+		}
+	}
+	return annotations
+}
+
+func runAlert(args []string) error {
+	flags := flag.NewFlagSet("alert", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	var rules stringsFlag
+	flags.Var(&rules, "rule", "alert when a file satisfies the `expression`, e.g. 'hotspot_score > 0.8' (repeatable)")
+	anomalies := flags.Bool("anomalies", false, "also alert on the directories whose churn in the newest -window is unusual for them")
+	window := flags.String("window", "7d", "length of the windows of -anomalies, as an `age`")
+	step := flags.String("step", "", "move the -window back by `age` at a time (default the window)")
+	method := flags.String("method", anomalyZScore, "`baseline` of -anomalies: zscore, the mean of the windows before, or ewma, their moving average")
+	threshold := flags.Float64("threshold", 3, "alert on the directories at least `n` deviations above their baseline")
+	notify := addNotifyFlags(flags)
+	exitCode := flags.Bool("exit-code", false, "exit with a failure status when a rule fired")
+	output := addOutputFlags(flags)
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if len(rules) == 0 && !*anomalies {
+		return errors.New("usage: gitility alert -rule expression [-anomalies] [-notify channel] [flags]")
+	}
+	if *method != anomalyZScore && *method != anomalyEWMA {
+		return fmt.Errorf("unknown -method %q, want zscore or ewma", *method)
+	}
+	if *step == "" {
+		*step = *window
+	}
+	notifiers, err := notify.notifiers()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	custom, err := q.metrics()
+	if err != nil {
+		return err
+	}
+	compiled, compared, err := compileRules(rules, custom)
+	if err != nil {
+		return err
+	}
+
+	hits := make([]alertHit, 0)
+	if len(rules) > 0 {
+		files, err := fileMetrics(ctx, q, time.Now(), compared)
+		if err != nil {
+			return err
+		}
+		hits = evaluateRules(rules, compiled, files)
+	}
+	if *anomalies {
+		t, err := collectTrends(ctx, q, *window, *step, true)
+		if err != nil {
+			return err
+		}
+		found, err := detectAnomalies(t, *method, *threshold)
+		if err != nil {
+			return err
+		}
+		if len(found) > 0 {
+			hits = append(hits, anomalyHit(found, *method, *threshold))
+		}
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+
+	text := formatAlert(ctx, hits, 10)
+	fmt.Print(text)
+	msg := message{Subject: fmt.Sprintf("gitility: %d alert rules fired in %s", len(hits), q.topLevel), Text: text, Data: hits}
+	if err := notifyAll(ctx, notifiers, msg); err != nil {
+		return err
+	}
+	if output.annotated() {
+		if err := output.report(ctx, "Alerts", *exitCode, alertAnnotations(hits), "### Alerts\n\n```\n"+text+"```"); err != nil {
+			return err
+		}
+	}
+	if *exitCode {
+		return fmt.Errorf("%d alert rules fired", len(hits))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Churn anomalies are the directories whose changes in the newest trend
+// window stand out from their own history: their score is how many
+// deviations the newest window lies above the baseline of the windows
+// before it. Only rises count; an area cooling down needs no alert.
+
+const (
+	anomalyZScore = "zscore"
+	anomalyEWMA   = "ewma"
+)
+
+// anomalyMinWindows is the shortest baseline a series is scored against.
+const anomalyMinWindows = 4
+
+// ewmaAlpha is the weight of every new window in the moving average, the
+// rest going to the ones before.
+const ewmaAlpha = 0.3
+
+type churnAnomaly struct {
+	Name     string  `json:"name"`
+	Latest   float64 `json:"latest"`
+	Baseline float64 `json:"baseline"`
+	Score    float64 `json:"score"`
+}
+
+// baseline is the expected changes of a window after the windows of
+// history, and their deviation. zscore weighs every window the same;
+// ewma weighs recent ones more, following shifts in the baseline faster.
+func baseline(history []float64, method string) (mean, deviation float64) {
+	if method == anomalyEWMA {
+		mean = history[0]
+		variance := 0.0
+		for _, x := range history[1:] {
+			diff := x - mean
+			mean += ewmaAlpha * diff
+			variance = (1 - ewmaAlpha) * (variance + ewmaAlpha*diff*diff)
+		}
+		return mean, math.Sqrt(variance)
+	}
+	for _, x := range history {
+		mean += x
+	}
+	mean /= float64(len(history))
+	variance := 0.0
+	for _, x := range history {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(history)))
+}
+
+// detectAnomalies scores the newest window of every series against the
+// ones before it and returns the series scoring at least threshold, worst
+// first. Deviations below one change count as one, so a directory going
+// from no change a week to two is not an anomaly of infinite score.
+func detectAnomalies(t *trends, method string, threshold float64) ([]churnAnomaly, error) {
+	if method != anomalyZScore && method != anomalyEWMA {
+		return nil, fmt.Errorf("unknown anomaly method %q, want zscore or ewma", method)
+	}
+	if len(t.Windows) < anomalyMinWindows+1 {
+		return nil, fmt.Errorf("%d windows walked, anomalies need at least %d: walk more commits or shorten the -step", len(t.Windows), anomalyMinWindows+1)
+	}
+	anomalies := make([]churnAnomaly, 0)
+	for _, s := range t.Series {
+		n := len(s.Series)
+		mean, deviation := baseline(s.Series[:n-1], method)
+		latest := s.Series[n-1]
+		score := (latest - mean) / math.Max(deviation, 1)
+		if score >= threshold {
+			anomalies = append(anomalies, churnAnomaly{Name: s.Name, Latest: latest, Baseline: mean, Score: score})
+		}
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool { return anomalies[i].Score > anomalies[j].Score })
+	return anomalies, nil
+}
+
+// anomalyHit reports the anomalies the way alert reports a rule firing,
+// the directories standing for the files.
+func anomalyHit(anomalies []churnAnomaly, method string, threshold float64) alertHit {
+	hit := alertHit{Rule: fmt.Sprintf("churn anomaly, %s >= %g", method, threshold)}
+	for _, a := range anomalies {
+		hit.Files = append(hit.Files, alertedFile{Name: a.Name, Metrics: map[string]float64{
+			"latest":   a.Latest,
+			"baseline": a.Baseline,
+			"score":    a.Score,
+		}})
+	}
+	return hit
+}
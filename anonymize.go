@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Reports shared outside a team can leave out who did what: -anonymize
+// replaces every author by a pseudonym, the same for the same person,
+// identified by email like authorKey does, throughout the report. The
+// pseudonyms are keyed: with -anonymize-key, or $GITILITY_ANONYMIZE_KEY,
+// the same person gets the same pseudonym on every run, so that reports
+// can be compared; without, a random key makes them differ from run to
+// run. Filters still match the real identities. Commit subjects, trailers
+// other than Co-authored-by and signers are printed as they are.
+
+// anonymizeKeyEnv is the default of -anonymize-key.
+const anonymizeKeyEnv = "GITILITY_ANONYMIZE_KEY"
+
+// pseudonyms maps identities to pseudonyms with a key.
+type pseudonyms struct {
+	key []byte
+}
+
+type pseudonymsKey struct{}
+
+// withPseudonyms makes the commits of the query run with ctx print their
+// authors as the pseudonyms of p; nil prints them as they are.
+func withPseudonyms(ctx context.Context, p *pseudonyms) context.Context {
+	return context.WithValue(ctx, pseudonymsKey{}, p)
+}
+
+func pseudonymsOf(ctx context.Context) *pseudonyms {
+	p, _ := ctx.Value(pseudonymsKey{}).(*pseudonyms)
+	return p
+}
+
+// newPseudonyms keys the pseudonyms with key, or a random key when empty.
+func newPseudonyms(key string) (*pseudonyms, error) {
+	if key != "" {
+		return &pseudonyms{key: []byte(key)}, nil
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return &pseudonyms{key: random}, nil
+}
+
+// of is the pseudonym of identity: author- and the start of the keyed
+// hash of its authorKey.
+func (p *pseudonyms) of(identity string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(authorKey(identity)))
+	return "author-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// display is identity as the reports print it: its pseudonym, or itself
+// without pseudonyms.
+func (p *pseudonyms) display(identity string) string {
+	if p == nil {
+		return identity
+	}
+	return p.of(identity)
+}
+
+// displayAuthor is identity as the reports of the query run with ctx print
+// it: its pseudonym under -anonymize.
+func displayAuthor(ctx context.Context, identity string) string {
+	return pseudonymsOf(ctx).display(identity)
+}
+
+// displayAs is identity as commit prints its author, for the co-authors.
+func displayAs(commit Commit, identity string) string {
+	if c, ok := commit.(*commitObj); ok {
+		return c.pseudonyms.display(identity)
+	}
+	return identity
+}
+
+// commitIdentity is the real author of commit, whatever -anonymize prints,
+// for the filters and caches.
+func commitIdentity(commit Commit) string {
+	if c, ok := commit.(*commitObj); ok {
+		return c.author
+	}
+	return commit.Author()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// The server's audit log records every command it runs, one JSON object
+// per line, with the request that caused it: the git commands of the
+// analysis the request started, and its auth hook. Scheduled analyses
+// have no request.
+
+// auditEntry is a line of the audit log.
+type auditEntry struct {
+	Time time.Time `json:"time"`
+	// Repo is the repository analyzed, empty for the auth hook of the
+	// server-wide endpoints.
+	Repo string `json:"repo,omitempty"`
+	// Request is the method and path of the request, or startup or
+	// schedule for the analyses no request started.
+	Request string   `json:"request"`
+	Client  string   `json:"client,omitempty"`
+	Dir     string   `json:"dir,omitempty"`
+	Command []string `json:"command"`
+	// Refused tells why the command did not run.
+	Refused string `json:"refused,omitempty"`
+}
+
+// auditLog appends the entries to a file.
+type auditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{f: f}, nil
+}
+
+func (a *auditLog) close() error {
+	return a.f.Close()
+}
+
+// record appends the entry. An entry that cannot be written is lost, like
+// a log line; it does not fail the request.
+func (a *auditLog) record(e auditEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.f.Write(append(data, '\n'))
+}
+
+// auditScope is what the commands run with a context are audited under.
+type auditScope struct {
+	log     *auditLog
+	repo    string
+	request string
+	client  string
+}
+
+type auditKey struct{}
+
+// withAudit makes the commands run with ctx recorded in the audit log under
+// the scope.
+func withAudit(ctx context.Context, scope auditScope) context.Context {
+	if scope.log == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, auditKey{}, scope)
+}
+
+// audit records a command run with ctx, refused when err is not nil; it
+// does nothing outside of an audited context.
+func audit(ctx context.Context, dir string, command []string, err error) {
+	scope, ok := ctx.Value(auditKey{}).(auditScope)
+	if !ok {
+		return
+	}
+	e := auditEntry{
+		Time:    time.Now().UTC(),
+		Repo:    scope.repo,
+		Request: scope.request,
+		Client:  scope.client,
+		Dir:     dir,
+		Command: command,
+	}
+	if err != nil {
+		e.Refused = err.Error()
+	}
+	scope.log.record(e)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var defaultBotPatterns = []string{
+	`\[bot\]`,
+	`^dependabot`,
+	`^renovate`,
+	`^github-actions`,
+	`^gitlab-ci`,
+	`^jenkins`,
+	`noreply@ci\.`,
+}
+
+func compileAuthorPatterns(patterns []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			re = regexp.MustCompile("(?i)" + regexp.QuoteMeta(pattern))
+		}
+		res = append(res, re)
+	}
+	return res
+}
+
+func matchAuthor(res []*regexp.Regexp, author string) bool {
+	author = strings.TrimSpace(author)
+	for _, re := range res {
+		if re.MatchString(author) {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludeAuthors keeps files from commits whose "Name <email>" author
+// matches one of the patterns. Patterns are case-insensitive regexps, the
+// same way `git log --author` treats them.
+func IncludeAuthors(patterns ...string) Filters {
+	res := compileAuthorPatterns(patterns)
+	return func(file File) bool {
+		return matchAuthor(res, commitIdentity(file.GetCommit()))
+	}
+}
+
+// ExcludeAuthors drops files from commits whose author matches one of the
+// patterns.
+func ExcludeAuthors(patterns ...string) Filters {
+	res := compileAuthorPatterns(patterns)
+	return func(file File) bool {
+		return !matchAuthor(res, commitIdentity(file.GetCommit()))
+	}
+}
+
+var emailPattern = regexp.MustCompile(`<([^<>]*)>\s*$`)
+
+// authorEmail extracts the lower-cased email of a "Name <email>" identity,
+// or "" when there is none.
+func authorEmail(identity string) string {
+	m := emailPattern.FindStringSubmatch(identity)
+	if m == nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(m[1]))
+}
+
+func isNotBotCommit(file File) bool {
+	return !matchAuthor(botPatterns, commitIdentity(file.GetCommit()))
+}
+
+var botPatterns = compileAuthorPatterns(defaultBotPatterns)
+
+// authorKey identifies an author by email, or by the whole identity when
+// there is no email, so renamed authors still count once.
+func authorKey(identity string) string {
+	if key := authorEmail(identity); key != "" {
+		return key
+	}
+	return strings.ToLower(strings.TrimSpace(identity))
+}
+
+// MinAuthors keeps the files changed by at least n distinct authors over
+// the walked range.
+func MinAuthors(n int) Aggregates {
+	return func(files []File) []File {
+		authors := distinctAuthors(files)
+		return keepFiles(files, func(file File) bool { return authors[file.Name()] >= n })
+	}
+}
+
+// MaxAuthors keeps the files changed by at most n distinct authors over the
+// walked range; MaxAuthors(1) lists knowledge silos.
+func MaxAuthors(n int) Aggregates {
+	return func(files []File) []File {
+		authors := distinctAuthors(files)
+		return keepFiles(files, func(file File) bool { return authors[file.Name()] <= n })
+	}
+}
+
+func distinctAuthors(files []File) map[string]int {
+	seen := make(map[string]map[string]bool)
+	for _, file := range files {
+		if seen[file.Name()] == nil {
+			seen[file.Name()] = make(map[string]bool)
+		}
+		seen[file.Name()][authorKey(file.GetCommit().Author())] = true
+	}
+	counts := make(map[string]int, len(seen))
+	for name, authors := range seen {
+		counts[name] = len(authors)
+	}
+	return counts
+}
+
+func keepFiles(files []File, keep Filters) []File {
+	res := make([]File, 0, len(files))
+	for _, file := range files {
+		if keep(file) {
+			res = append(res, file)
+		}
+	}
+	return res
+}
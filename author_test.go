@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestAuthorsCountEveryChange walks a file two authors changed and one
+// only its author changed: the listing names each once, for its newest
+// commit, but the authors are counted over every commit.
+func TestAuthorsCountEveryChange(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	repo := filepath.Join(dir, "repo")
+	git := func(args ...string) {
+		if output, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %q: %v: %s", args, err, output)
+		}
+	}
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "--quiet")
+	for _, change := range []struct{ author, file string }{
+		{"alice", "shared.go"},
+		{"alice", "silo.go"},
+		{"bob", "shared.go"},
+	} {
+		if err := os.WriteFile(filepath.Join(repo, change.file), []byte(change.author), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", change.file)
+		git("-c", "user.name="+change.author, "-c", "user.email="+change.author+"@example.com", "commit", "--quiet", "-m", change.file)
+	}
+
+	tests := []struct {
+		flag string
+		want string
+	}{
+		{"-min-authors=2", "shared.go"},
+		{"-max-authors=1", "silo.go"},
+	}
+	for _, test := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		queryFlags := addQueryFlags(flags, 10)
+		if err := flags.Parse([]string{test.flag}); err != nil {
+			t.Fatal(err)
+		}
+		ctx, q, err := queryFlags.build(withRepoDir(context.Background(), repo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := getOrderFiles(q.backend.commits, ctx, q.listingOptions(), q.filters...)
+		q.close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, file := range q.aggregate(files) {
+			names = append(names, file.Name())
+		}
+		if len(names) != 1 || names[0] != test.want {
+			t.Errorf("%s listed %q, want [%q]", test.flag, names, test.want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// backend is where a query reads commits from: the version control system
+// of the repository and the way its history is walked.
+type backend struct {
+	// name is how -backend and the reports name it.
+	name string
+	// marker is the directory at the top of the working trees of the VCS.
+	marker   string
+	commits  GetCommits
+	topLevel func(context.Context) (string, error)
+	check    func(context.Context, Options) error
+	refState func(context.Context, Options) (string, error)
+}
+
+var gitBackend = &backend{
+	name:     "git",
+	marker:   ".git",
+	commits:  getCommits,
+	topLevel: gitTopLevel,
+	check:    checkRepository,
+	refState: cmdGetRefState,
+}
+
+func gitTopLevel(ctx context.Context) (string, error) {
+	topLevel, err := cmdGetTopLevel(ctx)
+	if err != nil {
+		return "", repositoryError(ctx, err)
+	}
+	return topLevel, nil
+}
+
+// embeddedGitBackend reads git repositories without the git binary. Builds
+// embedding a git implementation set it, and it serves the queries of the
+// systems git is not installed on, packaged binaries on minimal ones.
+var embeddedGitBackend *backend
+
+var errGitNotInstalled = errors.New("git is not installed: install it, or use a gitility build embedding a git backend")
+
+// gitInstalled tells whether the git binary is on the PATH.
+func gitInstalled() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// standaloneBackend is the backend serving a query b would serve when git
+// is not installed: the embedded one, if the build has it, for the git
+// backend picked by detection. A -backend git given explicitly keeps git.
+func standaloneBackend(b *backend, explicit bool) (*backend, error) {
+	if b != gitBackend || gitInstalled() {
+		return b, nil
+	}
+	if embeddedGitBackend == nil || explicit {
+		return nil, errGitNotInstalled
+	}
+	fmt.Fprintf(os.Stderr, "gitility: git is not installed, the %s backend reads the repository\n", embeddedGitBackend.name)
+	return embeddedGitBackend, nil
+}
+
+// backends are the ones -backend picks from. Builds with the libgit2 tag
+// add one reading git repositories in process.
+var backends = map[string]*backend{"git": gitBackend, "hg": hgBackend}
+
+func backendNames() string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// detectBackend picks the backend of the nearest repository around the
+// directory the query runs in, git when there is none so its errors
+// explain.
+func detectBackend(ctx context.Context) *backend {
+	dir := repoDir(ctx)
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	for dir != "" {
+		for _, name := range []string{"git", "hg"} {
+			if _, err := os.Stat(filepath.Join(dir, backends[name].marker)); err == nil {
+				return backends[name]
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return gitBackend
+}
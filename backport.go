@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// backport is a commit of the source branch with no patch-equivalent
+// commit on the target branch yet, and its files the filters keep.
+type backport struct {
+	Commit Commit
+	Files  []File
+}
+
+// missingBackports lists, oldest first, the commits of from that to has
+// no cherry-pick of, limited to the ones changing a file the filters and
+// the paths keep.
+func missingBackports(ctx context.Context, q *query, from string, to string, paths []string) ([]backport, error) {
+	opt := q.opt
+	opt.GetCommits.Subjects = true
+	args := []string{
+		// The paths are the names of files and directories, not patterns.
+		"--literal-pathspecs",
+		"log",
+		"--pretty=format:" + commitFormat(opt),
+		"--right-only",
+		"--cherry-pick",
+		"--no-merges",
+		"--reverse",
+	}
+	if opt.GetCommits.Limit > 0 {
+		args = append(args, fmt.Sprintf("-%d", opt.GetCommits.Limit))
+	}
+	args = append(args, to+"..."+from, "--")
+	output, err := runGit(ctx, append(args, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]backport, 0)
+	for _, line := range strings.Split(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+		commit := parseCommitFields(ctx, strings.Split(line, "\x00"), opt)
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		b := backport{Commit: commit}
+		for _, file := range files {
+			if satisfyFilters(file, q.filters) && matchesPaths(file.Name(), paths) {
+				b.Files = append(b.Files, file)
+			}
+		}
+		if len(b.Files) > 0 {
+			res = append(res, b)
+		}
+	}
+	return res, nil
+}
+
+// matchesPaths tells whether name is one of the paths or under one of
+// them; no paths match everything.
+func matchesPaths(name string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, path := range paths {
+		path = strings.TrimSuffix(path, "/")
+		if name == path || strings.HasPrefix(name, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func runBackports(args []string) error {
+	flags := flag.NewFlagSet("backports", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	from := flags.String("from", "main", "`branch` the fixes land on first")
+	to := flags.String("to", "", "release `branch` to backport to")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if *to == "" {
+		return errors.New("usage: gitility backports [flags] -to branch [-from branch] [path...]")
+	}
+	for _, branch := range []string{*from, *to} {
+		if err := checkRevision(branch); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	backports, err := missingBackports(ctx, q, *from, *to, flags.Args())
+	if err != nil {
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+	for _, b := range backports {
+		fmt.Printf("%s %-30s %s\n", b.Commit.CommitHash(), b.Commit.Author(), b.Commit.Subject())
+		for _, file := range b.Files {
+			fmt.Println("  " + displayName(ctx, file.Name()))
+		}
+	}
+	fmt.Printf("\n%d commits of %s are not on %s\n", len(backports), *from, *to)
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const defaultFixPattern = `(?i)\b(fix(e[sd])?|bug|hot-?fix|revert)\b`
+
+// filePrior is what the history before a bisect range tells about a file:
+// how often it changed and how many of those changes were fixes.
+type filePrior struct {
+	Changes int
+	Fixes   int
+}
+
+// filePriors walks the history the options select and counts, per file
+// the filters keep, the changes and the fixes, commits whose subject
+// matches fix.
+func filePriors(ctx context.Context, q *query, opt Options, fix *regexp.Regexp) (map[string]*filePrior, error) {
+	opt.GetCommits.Subjects = true
+	commits, err := getCommits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	priors := make(map[string]*filePrior)
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !satisfyFilters(file, q.filters) {
+				continue
+			}
+			p, ok := priors[file.Name()]
+			if !ok {
+				p = &filePrior{}
+				priors[file.Name()] = p
+			}
+			p.Changes++
+			if fix.MatchString(commit.Subject()) {
+				p.Fixes++
+			}
+		}
+	}
+	return priors, nil
+}
+
+// bisectHint is a commit of the range and how suspicious its files are.
+// Riskiest is the file contributing the most to Score.
+type bisectHint struct {
+	Commit   Commit
+	Score    float64
+	Riskiest string
+}
+
+// bisectHints ranks the commits of good..bad by the risk of the files they
+// touched, according to the history up to good: a file scores its churn
+// relative to the most changed file plus its fix density.
+func bisectHints(ctx context.Context, q *query, good string, bad string, fix *regexp.Regexp) ([]bisectHint, error) {
+	opt := q.opt
+	opt.GetCommits.Ref = good
+	priors, err := filePriors(ctx, q, opt, fix)
+	if err != nil {
+		return nil, err
+	}
+	maxChanges := 1
+	for _, p := range priors {
+		if p.Changes > maxChanges {
+			maxChanges = p.Changes
+		}
+	}
+
+	opt = q.opt
+	opt.GetCommits.Ref = good + ".." + bad
+	opt.GetCommits.Limit = math.MaxInt32
+	opt.GetCommits.Subjects = true
+	commits, err := getCommits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	hints := make([]bisectHint, 0, len(commits))
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		hint := bisectHint{Commit: commit}
+		riskiest := 0.0
+		for _, file := range files {
+			p, ok := priors[file.Name()]
+			if !ok || !satisfyFilters(file, q.filters) {
+				continue
+			}
+			risk := float64(p.Changes)/float64(maxChanges) + float64(p.Fixes)/float64(p.Changes)
+			hint.Score += risk
+			if risk > riskiest {
+				riskiest = risk
+				hint.Riskiest = file.Name()
+			}
+		}
+		hints = append(hints, hint)
+	}
+	sort.SliceStable(hints, func(i, j int) bool { return hints[i].Score > hints[j].Score })
+	return hints, nil
+}
+
+func runBisectHints(args []string) error {
+	flags := flag.NewFlagSet("bisect-hints", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	fixPattern := flags.String("fix", defaultFixPattern, "regular `expression` matching the subjects of fix commits")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return errors.New("usage: gitility bisect-hints [flags] <good> <bad>")
+	}
+	good, bad := flags.Arg(0), flags.Arg(1)
+
+	fix, err := regexp.Compile(*fixPattern)
+	if err != nil {
+		return fmt.Errorf("-fix: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	hints, err := bisectHints(ctx, q, good, bad, fix)
+	if err != nil {
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+	for i, hint := range hints {
+		fmt.Printf("%3d. %s %5.2f %-40s %s\n", i+1, hint.Commit.CommitHash(), hint.Score, displayName(ctx, hint.Riskiest), hint.Commit.Subject())
+	}
+	fmt.Printf("\n%d commits; to bisect them: git bisect start %s %s\n", len(hints), bad, good)
+	return nil
+}
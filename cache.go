@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Query results are memoized in a Cache, keyed by the repository, the
+// commits its walked refs point at and the query fingerprint. Moving a ref
+// changes the key, so stale entries are never served; they are simply not
+// read again and age out of the backends that support expiry.
+
+type cachedFile struct {
+	Name        string          `json:"name"`
+	Kind        FileKind        `json:"kind,omitempty"`
+	Commit      string          `json:"commit"`
+	Author      string          `json:"author"`
+	Time        time.Time       `json:"time"`
+	Signature   SignatureStatus `json:"signature"`
+	Trailers    Trailers        `json:"trailers,omitempty"`
+	Subject     string          `json:"subject,omitempty"`
+	PullRequest int             `json:"pull_request,omitempty"`
+	SVNRevision int             `json:"svn_revision,omitempty"`
+	ChangeID    string          `json:"change_id,omitempty"`
+}
+
+// resultCacheKey returns false when the query cannot be cached, like reflog
+// walks whose result changes without any ref moving, or filter plugins
+// whose answers may change at any time.
+func resultCacheKey(ctx context.Context, q *query) (string, bool, error) {
+	if q.opt.GetCommits.Reflog || len(q.plugins) > 0 {
+		return "", false, nil
+	}
+	state, err := q.backend.refState(ctx, q.opt)
+	if err != nil {
+		return "", false, err
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		q.topLevel,
+		state,
+		q.fingerprint,
+		fmt.Sprintf("%+v", q.listingOptions()),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:]), true, nil
+}
+
+const resultCacheTTL = 7 * 24 * time.Hour
+
+// resultFlights makes concurrent identical queries share one walk.
+var resultFlights flightGroup
+
+func getOrderFilesCached(fn GetCommits, ctx context.Context, cache Cache, q *query) ([]File, error) {
+	key, ok, err := resultCacheKey(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return getOrderFiles(fn, ctx, q.listingOptions(), q.filters...)
+	}
+	key = scopedKey(q.topLevel, "results:"+key)
+
+	files, err, _ := resultFlights.Do(key, func() (interface{}, error) {
+		return lookupOrderFiles(fn, ctx, cache, key, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files.([]File), nil
+}
+
+func lookupOrderFiles(fn GetCommits, ctx context.Context, cache Cache, key string, q *query) ([]File, error) {
+	data, ok, err := cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		cached := make([]cachedFile, 0)
+		if err := json.Unmarshal(data, &cached); err == nil {
+			return filesFromCache(ctx, cached), nil
+		}
+	}
+
+	files, err := getOrderFiles(fn, ctx, q.listingOptions(), q.filters...)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := filesToCache(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(cached); err != nil {
+		return nil, err
+	}
+	return files, cache.Set(ctx, key, data, q.retainedTTL(resultCacheTTL))
+}
+
+func filesToCache(ctx context.Context, files []File) ([]cachedFile, error) {
+	cached := make([]cachedFile, 0, len(files))
+	for _, file := range files {
+		commit := file.GetCommit()
+		commitTime, err := commit.CommitTime(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cached = append(cached, cachedFile{
+			Name:        file.Name(),
+			Kind:        file.Kind(),
+			Commit:      commit.CommitHash(),
+			Author:      commitIdentity(commit),
+			Time:        commitTime,
+			Signature:   commit.SignatureStatus(),
+			Trailers:    commit.Trailers(),
+			Subject:     commit.Subject(),
+			PullRequest: commit.PullRequest(),
+			SVNRevision: commit.SVN().Revision,
+			ChangeID:    commit.ChangeID(),
+		})
+	}
+	return cached, nil
+}
+
+func filesFromCache(ctx context.Context, cached []cachedFile) []File {
+	commits := make(map[string]Commit)
+	files := make([]File, 0, len(cached))
+	for _, c := range cached {
+		commit, ok := commits[c.Commit]
+		if !ok {
+			commit = c.commit(ctx)
+			commits[c.Commit] = commit
+		}
+		files = append(files, NewFileOfKind(commit, c.Name, c.Kind))
+	}
+	return files
+}
+
+func (c cachedFile) commit(ctx context.Context) *commitObj {
+	return &commitObj{
+		pseudonyms:  pseudonymsOf(ctx),
+		commitHash:  c.Commit,
+		author:      c.Author,
+		signature:   c.Signature,
+		trailers:    c.Trailers,
+		commitTime:  c.Time,
+		subject:     c.Subject,
+		pullRequest: c.PullRequest,
+		changeID:    c.ChangeID,
+	}
+}
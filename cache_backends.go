@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cacheEnv = "GITILITY_CACHE"
+
+// Cache stores opaque values under string keys. A ttl of zero keeps the
+// value until the backend evicts it.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// newCache picks a backend from its spec: "disk" (the default) keeps one
+// file per entry under the user cache directory, "memory" lives as long as
+// the process, and a redis:// URL shares the cache between server replicas.
+func newCache(spec string) (Cache, error) {
+	switch {
+	case spec == "" || spec == "disk":
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		return newDiskCache(filepath.Join(dir, "gitility", "cache")), nil
+	case spec == "memory":
+		return newMemoryCache(), nil
+	case strings.HasPrefix(spec, "redis://"):
+		return newRedisCache(spec)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", spec)
+	}
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]memoryEntry)}
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+	return nil
+}
+
+// diskCache writes every entry to its own file, named after the hash of the
+// key; the modification time tells its age.
+type diskCache struct {
+	dir string
+}
+
+func newDiskCache(dir string) *diskCache {
+	return &diskCache{dir: dir}
+}
+
+// repoScope names the repository at topLevel, a directory or a remote URL,
+// in the cache directory.
+func repoScope(topLevel string) string {
+	sum := sha1.Sum([]byte(topLevel))
+	return hex.EncodeToString(sum[:])
+}
+
+// scopedKey is key in the scope of the repository at topLevel. The disk
+// cache keeps the entries of a scope in a directory of their own, which
+// the retention of the repository purges alone.
+func scopedKey(topLevel, key string) string {
+	return repoScope(topLevel) + "/" + key
+}
+
+func (c *diskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	if scope, _, ok := strings.Cut(key, "/"); ok && len(scope) == 2*sha1.Size && strings.Trim(scope, "0123456789abcdef") == "" {
+		return filepath.Join(c.dir, scope, name)
+	}
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+func (c *diskCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	path := c.path(key)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	expires, value, ok := strings.Cut(string(data), "\n")
+	if !ok {
+		return nil, false, nil
+	}
+	if deadline, err := strconv.ParseInt(expires, 10, 64); err != nil || (deadline > 0 && time.Now().Unix() > deadline) {
+		os.Remove(path)
+		return nil, false, nil
+	}
+	return []byte(value), true, nil
+}
+
+func (c *diskCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	deadline := int64(0)
+	if ttl > 0 {
+		deadline = time.Now().Add(ttl).Unix()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := fmt.Fprintf(tmp, "%d\n%s", deadline, value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// redisCache speaks just enough RESP for GET and SET over one connection,
+// redialed after any error.
+type redisCache struct {
+	addr     string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func newRedisCache(spec string) (*redisCache, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisCache{addr: u.Host}
+	if !strings.Contains(c.addr, ":") {
+		c.addr += ":6379"
+	}
+	if password, ok := u.User.Password(); ok {
+		c.password = password
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis cache: bad database %q", db)
+		}
+	}
+	return c, nil
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", "gitility:"+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	return reply, true, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", "gitility:" + key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.do(ctx, args...)
+	return err
+}
+
+func (c *redisCache) do(ctx context.Context, args ...string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(ctx, args...)
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+func (c *redisCache) dial(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("redis cache: %w", err)
+	}
+	c.conn, c.rd = conn, bufio.NewReader(conn)
+
+	if c.password != "" {
+		if _, err := c.roundTrip(ctx, "AUTH", c.password); err != nil {
+			conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTrip(ctx, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *redisCache) roundTrip(ctx context.Context, args ...string) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	} else {
+		c.conn.SetDeadline(time.Time{})
+	}
+
+	var req strings.Builder
+	fmt.Fprintf(&req, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&req, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, req.String()); err != nil {
+		return nil, err
+	}
+
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis cache: empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, fmt.Errorf("redis cache: %s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.rd, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	default:
+		return nil, fmt.Errorf("redis cache: unexpected reply %q", line)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The cadence report shows when commits are authored: by hour of the day
+// and day of the week, in the time zone of every author unless -zone says
+// otherwise. When people work is sensitive, so the report only runs when
+// the repository opts in with privacy.cadence in .gitility.yaml, sums up
+// the whole repository by default, and privacy.aggregate_only takes away
+// the breakdown per author for good.
+
+// privacyConfig are the privacy settings of .gitility.yaml.
+type privacyConfig struct {
+	// Cadence opts the repository in to the cadence report.
+	Cadence bool `json:"cadence"`
+	// AggregateOnly refuses the cadence per author, cadence -authors. The
+	// other reports naming authors do not read it.
+	AggregateOnly bool `json:"aggregate_only"`
+	// Retention bounds how long what is cached about the repository is
+	// kept, as an age.
+	Retention string `json:"retention"`
+}
+
+// cadence counts the commits of a group by hour and weekday, Sunday first
+// like time.Weekday.
+type cadence struct {
+	// Group is the author, empty for the repository.
+	Group    string  `json:"group,omitempty"`
+	Commits  int     `json:"commits"`
+	Hours    [24]int `json:"hours"`
+	Weekdays [7]int  `json:"weekdays"`
+	// OffHours counts the commits outside the working hours on working
+	// days, Weekend those on Saturdays and Sundays.
+	OffHours int `json:"off_hours"`
+	Weekend  int `json:"weekend"`
+}
+
+// workingHours is the span of the working day, from the start hour to
+// before the end hour.
+type workingHours struct {
+	start, end int
+}
+
+func parseWorkingHours(spec string) (workingHours, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	start, err1 := strconv.Atoi(from)
+	end, err2 := strconv.Atoi(to)
+	if !ok || err1 != nil || err2 != nil || start < 0 || end > 24 || start >= end {
+		return workingHours{}, fmt.Errorf("working hours %q: want start-end hours, e.g. 9-18", spec)
+	}
+	return workingHours{start, end}, nil
+}
+
+func (c *cadence) add(t time.Time, hours workingHours) {
+	c.Commits++
+	c.Hours[t.Hour()]++
+	c.Weekdays[t.Weekday()]++
+	switch {
+	case t.Weekday() == time.Saturday || t.Weekday() == time.Sunday:
+		c.Weekend++
+	case t.Hour() < hours.start || t.Hour() >= hours.end:
+		c.OffHours++
+	}
+}
+
+// authorTimes reads when the commits were authored, in the time zone of
+// their author, with one git log per batch of commits. Other backends only
+// know the commit time.
+func authorTimes(ctx context.Context, q *query, commits []Commit) (map[string]time.Time, error) {
+	times := make(map[string]time.Time, len(commits))
+	if q.backend.marker != gitBackend.marker {
+		if err := Preload(ctx, commits, CommitFieldTime); err != nil {
+			return nil, err
+		}
+		for _, commit := range commits {
+			t, err := commit.CommitTime(ctx)
+			if err != nil {
+				return nil, err
+			}
+			times[commit.CommitHash()] = t
+		}
+		return times, nil
+	}
+	for len(commits) > 0 {
+		n := len(commits)
+		if n > preloadBatch {
+			n = preloadBatch
+		}
+		args := []string{"log", "--no-walk=unsorted", "--format=%h%x00%aD"}
+		for _, commit := range commits[:n] {
+			args = append(args, commit.CommitHash())
+		}
+		output, err := runGit(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(output), "\n") {
+			hash, date, ok := strings.Cut(line, "\x00")
+			if !ok {
+				continue
+			}
+			t, err := parseCommitTime(date)
+			if err != nil {
+				return nil, err
+			}
+			times[hash] = t
+		}
+		commits = commits[n:]
+	}
+	return times, nil
+}
+
+// collectCadence counts the walked commits changing a file the query
+// keeps, for the repository and, with byAuthor, every author. A nil zone
+// keeps the zone of every author.
+func collectCadence(ctx context.Context, q *query, zone *time.Location, hours workingHours, byAuthor bool) (*cadence, []*cadence, error) {
+	commits, err := q.backend.commits(ctx, q.listingOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := Preload(ctx, commits, CommitFieldFiles); err != nil {
+		return nil, nil, err
+	}
+	kept := make([]Commit, 0, len(commits))
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, file := range files {
+			if satisfyFilters(file, q.filters) {
+				kept = append(kept, commit)
+				break
+			}
+		}
+	}
+	times, err := authorTimes(ctx, q, kept)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all := &cadence{}
+	authors := make(map[string]*cadence)
+	for _, commit := range kept {
+		t, ok := times[commit.CommitHash()]
+		if !ok {
+			continue
+		}
+		if zone != nil {
+			t = t.In(zone)
+		}
+		all.add(t, hours)
+		if !byAuthor {
+			continue
+		}
+		key := authorKey(commit.Author())
+		c, ok := authors[key]
+		if !ok {
+			c = &cadence{Group: commit.Author()}
+			authors[key] = c
+		}
+		c.add(t, hours)
+	}
+	res := make([]*cadence, 0, len(authors))
+	for _, c := range authors {
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Commits != res[j].Commits {
+			return res[i].Commits > res[j].Commits
+		}
+		return res[i].Group < res[j].Group
+	})
+	return all, res, q.err()
+}
+
+// histogramWidth is the width of the longest bar of a histogram.
+const histogramWidth = 40
+
+func printHistogram(labels []string, counts []int) {
+	max := 1
+	for _, n := range counts {
+		if n > max {
+			max = n
+		}
+	}
+	for i, n := range counts {
+		fmt.Printf("%-4s %6d %s\n", labels[i], n, strings.Repeat("#", (n*histogramWidth+max-1)/max))
+	}
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+func runCadence(args []string) error {
+	flags := flag.NewFlagSet("cadence", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	zoneName := flags.String("zone", "", "count the hours in the time `zone`, e.g. UTC or Europe/Berlin (default the zone of every author)")
+	hoursSpec := flags.String("working-hours", "9-18", "working `hours` of working days, start-end")
+	byAuthor := flags.Bool("authors", false, "also break the counts down per author, unless privacy.aggregate_only forbids it")
+	asJSON := flags.Bool("json", false, "print the counts as a JSON object")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	hours, err := parseWorkingHours(*hoursSpec)
+	if err != nil {
+		return fmt.Errorf("-working-hours: %w", err)
+	}
+	var zone *time.Location
+	if *zoneName != "" {
+		if zone, err = time.LoadLocation(*zoneName); err != nil {
+			return fmt.Errorf("-zone: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	if !q.config.Privacy.Cadence {
+		return fmt.Errorf("the cadence report shows when people commit: the repository opts in with privacy.cadence: true in %s", configFileName)
+	}
+	if *byAuthor && q.config.Privacy.AggregateOnly {
+		return fmt.Errorf("-authors: privacy.aggregate_only in %s allows the repository totals alone", configFileName)
+	}
+
+	all, authors, err := collectCadence(ctx, q, zone, hours, *byAuthor)
+	if err != nil {
+		return err
+	}
+	if all.Commits == 0 {
+		return errors.New("no commit changed a file in the walked range")
+	}
+	if *asJSON {
+		res := struct {
+			*cadence
+			Authors []*cadence `json:"authors,omitempty"`
+		}{all, authors}
+		return printJSON(res)
+	}
+
+	hourLabels := make([]string, 24)
+	for h := range hourLabels {
+		hourLabels[h] = fmt.Sprintf("%02d", h)
+	}
+	fmt.Printf("%d commits by hour of the day\n", all.Commits)
+	printHistogram(hourLabels, all.Hours[:])
+	fmt.Println("\nby day of the week")
+	// Monday first.
+	days, counts := make([]string, 0, 7), make([]int, 0, 7)
+	for i := 1; i <= 7; i++ {
+		day := time.Weekday(i % 7)
+		days = append(days, day.String()[:3])
+		counts = append(counts, all.Weekdays[day])
+	}
+	printHistogram(days, counts)
+	fmt.Printf("\noutside %02d-%02d on working days: %.1f%%, on weekends: %.1f%%\n", hours.start, hours.end, percent(all.OffHours, all.Commits), percent(all.Weekend, all.Commits))
+
+	if len(authors) > 0 {
+		fmt.Printf("\n%-36s %7s %9s %8s\n", "author", "commits", "off-hours", "weekend")
+		for _, c := range authors {
+			fmt.Printf("%-36s %7d %8.1f%% %7.1f%%\n", c.Group, c.Commits, percent(c.OffHours, c.Commits), percent(c.Weekend, c.Commits))
+		}
+	}
+	return nil
+}
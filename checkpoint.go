@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Identities of the commits a checkpoint refers to: identitySHA only
+// resumes from a tip that is still an ancestor of HEAD, identityPatchID
+// also resumes after a rebase rewrote it, recognizing the commits by the
+// patch-id of their diff.
+const (
+	identitySHA     = "sha"
+	identityPatchID = "patch-id"
+)
+
+// checkpoint is what --since-last-run remembers per repository: the tip it
+// analyzed last and the files it reported, so the next run only has to walk
+// the commits added since.
+type checkpoint struct {
+	Tip         string           `json:"tip"`
+	Fingerprint string           `json:"fingerprint"`
+	Files       []checkpointFile `json:"files"`
+}
+
+type checkpointFile struct {
+	Name   string   `json:"name"`
+	Kind   FileKind `json:"kind,omitempty"`
+	Commit string   `json:"commit"`
+	Author string   `json:"author"`
+}
+
+func checkpointPath(topLevel string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gitility", "checkpoints", repoScope(topLevel)+".json"), nil
+}
+
+func loadCheckpoint(topLevel string) (*checkpoint, error) {
+	path, err := checkpointPath(topLevel)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func saveCheckpoint(topLevel string, cp *checkpoint) error {
+	path, err := checkpointPath(topLevel)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// getOrderFilesSinceLastRun behaves like getOrderFiles but resumes from the
+// checkpoint stored for the repository. The checkpoint is only reused when
+// it was written with the same fingerprint (options and filters) and its tip
+// is still an ancestor of the tip of the walked ref, HEAD by default, or, by
+// identityPatchID, was rebased onto it; otherwise the full query runs again.
+func getOrderFilesSinceLastRun(fn GetCommits, ctx context.Context, opt Options, topLevel string, fingerprint string, identity string, filters ...Filters) ([]File, error) {
+	rev := opt.GetCommits.Ref
+	if rev == "" {
+		rev = "HEAD"
+	}
+	tip, err := cmdGetTip(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := loadCheckpoint(topLevel)
+	if err != nil {
+		return nil, err
+	}
+	if cp != nil && cp.Fingerprint == fingerprint && cp.Tip != "" {
+		ok, err := cmdIsAncestor(ctx, cp.Tip, tip)
+		if err != nil {
+			return nil, err
+		}
+		if !ok && identity == identityPatchID {
+			if cp, err = rebaseCheckpoint(ctx, cp, tip); err != nil {
+				return nil, err
+			}
+		} else if !ok {
+			cp = nil
+		}
+	} else {
+		cp = nil
+	}
+
+	var files []File
+	if cp == nil {
+		files, err = getOrderFiles(fn, ctx, opt, filters...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		count, err := cmdCountCommits(ctx, cp.Tip+".."+tip)
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			opt.GetCommits.Ref = cp.Tip + ".." + tip
+			opt.GetCommits.Limit = count
+			files, err = getOrderFiles(fn, ctx, opt, filters...)
+			if err != nil {
+				return nil, err
+			}
+		}
+		files = mergeCheckpointFiles(ctx, files, cp.Files)
+		if err := sortFiles(ctx, files); err != nil {
+			return nil, err
+		}
+	}
+
+	cp = &checkpoint{Tip: tip, Fingerprint: fingerprint, Files: make([]checkpointFile, 0, len(files))}
+	for _, file := range files {
+		cp.Files = append(cp.Files, checkpointFile{
+			Name:   file.Name(),
+			Kind:   file.Kind(),
+			Commit: file.GetCommit().CommitHash(),
+			Author: commitIdentity(file.GetCommit()),
+		})
+	}
+	if err := saveCheckpoint(topLevel, cp); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func mergeCheckpointFiles(ctx context.Context, files []File, stored []checkpointFile) []File {
+	mapExistedFiles := make(map[string]bool, len(files))
+	for _, file := range files {
+		mapExistedFiles[file.Name()] = true
+	}
+
+	commits := make(map[string]Commit)
+	for _, storedFile := range stored {
+		if mapExistedFiles[storedFile.Name] {
+			continue
+		}
+		commit, ok := commits[storedFile.Commit]
+		if !ok {
+			// The checkpoint stores the real identity, as the cache does.
+			commit = &commitObj{
+				pseudonyms: pseudonymsOf(ctx),
+				commitHash: storedFile.Commit,
+				author:     storedFile.Author,
+				mergeDiff:  MergeDiffAuto,
+			}
+			commits[storedFile.Commit] = commit
+		}
+		mapExistedFiles[storedFile.Name] = true
+		files = append(files, NewFileOfKind(commit, storedFile.Name, storedFile.Kind))
+	}
+	return files
+}
+
+// rebaseCheckpoint resumes a checkpoint whose tip was rewritten away from
+// the merge base of the old and new tips. The stored files stay valid when
+// every commit of the rewritten range they come from has a copy with the
+// same patch-id in the new one, which the next walk lists again; it returns
+// nil, and says why, when they do not.
+func rebaseCheckpoint(ctx context.Context, cp *checkpoint, tip string) (*checkpoint, error) {
+	reason, err := checkRebasedCheckpoint(ctx, cp, tip)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		log.Printf("-since-last-run: %s, analyzing the full range again", reason)
+		return nil, nil
+	}
+	return cp, nil
+}
+
+func checkRebasedCheckpoint(ctx context.Context, cp *checkpoint, tip string) (string, error) {
+	output, err := runGit(ctx, "merge-base", cp.Tip, tip)
+	var gitErr *gitError
+	if errors.As(err, &gitErr) {
+		// Garbage collected, or of unrelated histories.
+		return fmt.Sprintf("the stored tip %.12s has no common history with HEAD", cp.Tip), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	base := strings.TrimSpace(string(output))
+
+	output, err = runGit(ctx, "rev-list", base+".."+cp.Tip)
+	if err != nil {
+		return "", err
+	}
+	rewritten := strings.Fields(string(output))
+	before, err := cmdPatchIDs(ctx, []string{base + ".." + cp.Tip}, false)
+	if err != nil {
+		return "", err
+	}
+	after, err := cmdPatchIDs(ctx, []string{base + ".." + tip}, false)
+	if err != nil {
+		return "", err
+	}
+	kept := make(map[string]bool, len(after))
+	for _, id := range after {
+		kept[id] = true
+	}
+
+	for _, file := range cp.Files {
+		for _, full := range rewritten {
+			if !strings.HasPrefix(full, file.Commit) {
+				continue
+			}
+			if id, ok := before[full]; !ok || !kept[id] {
+				return fmt.Sprintf("commit %s of %s was dropped or changed by the rewrite", file.Commit, file.Name), nil
+			}
+			break
+		}
+	}
+	cp.Tip = base
+	return "", nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	appIDEnv           = "GITILITY_APP_ID"
+	appKeyEnv          = "GITILITY_APP_KEY"
+	appInstallationEnv = "GITILITY_APP_INSTALLATION"
+)
+
+// The check runs API takes at most 50 annotations per request and a
+// summary of 65535 characters.
+const (
+	checkAnnotationsPerRequest = 50
+	checkSummaryLimit          = 65535
+)
+
+type checkOutput struct {
+	Title       string            `json:"title"`
+	Summary     string            `json:"summary"`
+	Annotations []checkAnnotation `json:"annotations,omitempty"`
+}
+
+type checkAnnotation struct {
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Level     string `json:"annotation_level"`
+	Title     string `json:"title,omitempty"`
+	Message   string `json:"message"`
+}
+
+// checkAnnotations converts the annotations on files; the others only show
+// in the summary. Findings are about whole files, so they sit on line 1.
+func checkAnnotations(annotations []annotation) []checkAnnotation {
+	res := make([]checkAnnotation, 0, len(annotations))
+	for _, a := range annotations {
+		if a.File == "" {
+			continue
+		}
+		level := a.Level
+		if level == "error" {
+			level = "failure"
+		}
+		res = append(res, checkAnnotation{Path: a.File, StartLine: 1, EndLine: 1, Level: level, Title: a.Title, Message: a.Message})
+	}
+	return res
+}
+
+func (o *outputFlags) postCheckRun(ctx context.Context, title string, failed bool, annotations []annotation, summary string) error {
+	slug := os.Getenv("GITHUB_REPOSITORY")
+	if slug == "" {
+		var err error
+		if slug, err = repoSlug(ctx, ""); err != nil {
+			return err
+		}
+	}
+	sha, err := o.headSHA(ctx)
+	if err != nil {
+		return err
+	}
+	client, err := checkClient(ctx, *o.api, slug)
+	if err != nil {
+		return err
+	}
+
+	conclusion := "success"
+	if failed {
+		conclusion = "failure"
+	} else if len(annotations) > 0 {
+		conclusion = "neutral"
+	}
+	if len(summary) > checkSummaryLimit {
+		summary = summary[:checkSummaryLimit-len("\n…")] + "\n…"
+	}
+	pending := checkAnnotations(annotations)
+	batch := func() []checkAnnotation {
+		n := len(pending)
+		if n > checkAnnotationsPerRequest {
+			n = checkAnnotationsPerRequest
+		}
+		b := pending[:n]
+		pending = pending[n:]
+		return b
+	}
+
+	var run struct {
+		ID int64 `json:"id"`
+	}
+	err = client.send(ctx, http.MethodPost, "/repos/"+slug+"/check-runs", map[string]interface{}{
+		"name":         *o.checkName,
+		"head_sha":     sha,
+		"status":       "completed",
+		"conclusion":   conclusion,
+		"completed_at": time.Now().UTC().Format(time.RFC3339),
+		"output":       checkOutput{Title: title, Summary: summary, Annotations: batch()},
+	}, &run)
+	if err != nil {
+		return fmt.Errorf("check run: %w", err)
+	}
+	for len(pending) > 0 {
+		output := checkOutput{Title: title, Summary: summary, Annotations: batch()}
+		path := fmt.Sprintf("/repos/%s/check-runs/%d", slug, run.ID)
+		if err := client.send(ctx, http.MethodPatch, path, map[string]interface{}{"output": output}, nil); err != nil {
+			return fmt.Errorf("check run: %w", err)
+		}
+	}
+	return nil
+}
+
+// headSHA is the commit the check run reports on: -check-sha, else the head
+// of the pull request a workflow runs for, as GITHUB_SHA is the merge
+// GitHub made for it there, else HEAD.
+func (o *outputFlags) headSHA(ctx context.Context) (string, error) {
+	if *o.checkSHA != "" {
+		return *o.checkSHA, nil
+	}
+	if path := os.Getenv("GITHUB_EVENT_PATH"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		var event struct {
+			PullRequest struct {
+				Head struct {
+					SHA string `json:"sha"`
+				} `json:"head"`
+			} `json:"pull_request"`
+		}
+		if err := json.Unmarshal(data, &event); err == nil && event.PullRequest.Head.SHA != "" {
+			return event.PullRequest.Head.SHA, nil
+		}
+	}
+	output, err := runGit(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// checkClient authenticates as the GitHub App of $GITILITY_APP_ID when it
+// is set, else with $GITHUB_TOKEN, which is an App token inside workflows.
+// Check runs can only be created by Apps.
+func checkClient(ctx context.Context, api string, slug string) (*forgeClient, error) {
+	appID := os.Getenv(appIDEnv)
+	if appID == "" {
+		token := os.Getenv("GITHUB_TOKEN")
+		if token == "" {
+			return nil, fmt.Errorf("-output github-check needs $GITHUB_TOKEN, or $%s and $%s for a GitHub App", appIDEnv, appKeyEnv)
+		}
+		return newForgeClient(api, token), nil
+	}
+
+	jwt, err := appJWT(appID, os.Getenv(appKeyEnv), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	app := newForgeClient(api, jwt)
+	installation := os.Getenv(appInstallationEnv)
+	if installation == "" {
+		var found struct {
+			ID int64 `json:"id"`
+		}
+		if err := app.getOne(ctx, "/repos/"+slug+"/installation", &found); err != nil {
+			return nil, fmt.Errorf("GitHub App installation on %s: %w", slug, err)
+		}
+		installation = strconv.FormatInt(found.ID, 10)
+	}
+	var access struct {
+		Token string `json:"token"`
+	}
+	if err := app.send(ctx, http.MethodPost, "/app/installations/"+installation+"/access_tokens", struct{}{}, &access); err != nil {
+		return nil, fmt.Errorf("GitHub App token: %w", err)
+	}
+	return newForgeClient(api, access.Token), nil
+}
+
+// appJWT signs the short-lived token a GitHub App authenticates as itself
+// with, from the PEM private key at keyPath.
+func appJWT(appID string, keyPath string, now time.Time) (string, error) {
+	if keyPath == "" {
+		return "", fmt.Errorf("$%s is set, so $%s must name the App's private key", appIDEnv, appKeyEnv)
+	}
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("%s: no PEM private key", keyPath)
+	}
+	// GitHub hands out PKCS #1 keys; converted ones are often PKCS #8.
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, _ := x509.ParsePKCS8PrivateKey(block.Bytes)
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return "", fmt.Errorf("%s: not an RSA private key", keyPath)
+		}
+	}
+
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	// Backdated a minute for clock drift; GitHub caps the life at 10 minutes.
+	claims := map[string]interface{}{"iat": now.Add(-time.Minute).Unix(), "exp": now.Add(9 * time.Minute).Unix(), "iss": appID}
+	unsigned := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encode(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// getOne decodes a single, unpaginated resource.
+func (c *forgeClient) getOne(ctx context.Context, path string, out interface{}) error {
+	return c.get(ctx, path, func(body json.RawMessage) error {
+		if err := json.Unmarshal(body, out); err != nil {
+			return err
+		}
+		return errLastPage
+	})
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// commitPatchIDs maps the abbreviated hashes of the commits to the stable
+// patch id of their diff. Merges and empty commits have none.
+func commitPatchIDs(ctx context.Context, args []string, commits []Commit) (map[string]string, error) {
+	ids, err := cmdPatchIDs(ctx, args, false)
+	if err != nil {
+		return nil, err
+	}
+	lengths := make(map[int]bool)
+	for _, commit := range commits {
+		lengths[len(commit.CommitHash())] = true
+	}
+	res := make(map[string]string, len(ids))
+	for full, id := range ids {
+		for n := range lengths {
+			if n <= len(full) {
+				res[full[:n]] = id
+			}
+		}
+	}
+	return res, nil
+}
+
+// skipCherryPicks keeps the oldest of the walked commits sharing a patch,
+// so a fix picked onto several branches counts once.
+func skipCherryPicks(ctx context.Context, opt Options, commits []Commit) ([]Commit, error) {
+	args, err := commitWalkArgs(opt)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := commitPatchIDs(ctx, args, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walks list the newest commits first.
+	seen := make(map[string]bool, len(ids))
+	keep := make([]bool, len(commits))
+	for i := len(commits) - 1; i >= 0; i-- {
+		id, ok := ids[commits[i].CommitHash()]
+		keep[i] = !ok || !seen[id]
+		if ok {
+			seen[id] = true
+		}
+	}
+	res := make([]Commit, 0, len(commits))
+	for i, commit := range commits {
+		if keep[i] {
+			res = append(res, commit)
+		}
+	}
+	return res, nil
+}
+
+// cherryPick is a patch found as several commits, oldest first, with the
+// ref each of them was reached from.
+type cherryPick struct {
+	Subject string
+	Commits []string
+	Refs    []string
+}
+
+func findCherryPicks(ctx context.Context, opt Options) ([]cherryPick, error) {
+	args, err := commitWalkArgs(opt)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runGit(ctx, append([]string{"log", "--source", "--format=%h%x00%S%x00%s"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make([]Commit, 0)
+	refs := make(map[string]string)
+	subjects := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.SplitN(line, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		commits = append(commits, NewCommit(fields[0], "", MergeDiffAuto))
+		refs[fields[0]] = fields[1]
+		subjects[fields[0]] = fields[2]
+	}
+	ids, err := commitPatchIDs(ctx, args, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*cherryPick)
+	order := make([]string, 0)
+	for i := len(commits) - 1; i >= 0; i-- {
+		hash := commits[i].CommitHash()
+		id, ok := ids[hash]
+		if !ok {
+			continue
+		}
+		g, ok := groups[id]
+		if !ok {
+			g = &cherryPick{Subject: subjects[hash]}
+			groups[id] = g
+			order = append(order, id)
+		}
+		g.Commits = append(g.Commits, hash)
+		g.Refs = append(g.Refs, refs[hash])
+	}
+
+	res := make([]cherryPick, 0)
+	for _, id := range order {
+		if g := groups[id]; len(g.Commits) > 1 {
+			res = append(res, *g)
+		}
+	}
+	return res, nil
+}
+
+func runCherryPicks(args []string) error {
+	flags := flag.NewFlagSet("cherry-picks", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if len(queryFlags.branches) == 0 {
+		*queryFlags.allBranches = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	picks, err := findCherryPicks(ctx, q.opt)
+	if err != nil {
+		return err
+	}
+	for _, p := range picks {
+		fmt.Println(p.Subject)
+		for i, commit := range p.Commits {
+			fmt.Printf("  %s %s\n", commit, p.Refs[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Files fall in one of four classes, told apart by their path: infra for
+// what builds and deploys the code, Dockerfiles, Kubernetes manifests,
+// Terraform and Helm charts; test, docs, and app for everything else.
+
+const (
+	classInfra = "infra"
+	classApp   = "app"
+	classDocs  = "docs"
+	classTest  = "test"
+)
+
+var fileClasses = []string{classInfra, classApp, classDocs, classTest}
+
+// The kinds of infra files.
+const (
+	kindDocker     = "docker"
+	kindKubernetes = "kubernetes"
+	kindTerraform  = "terraform"
+	kindHelm       = "helm"
+)
+
+// classifyFile returns the class of the file at name and, for infra files,
+// their kind.
+func classifyFile(name string) (class string, kind string) {
+	if kind := infraKind(name); kind != "" {
+		return classInfra, kind
+	}
+	if isTestPath(name) {
+		return classTest, ""
+	}
+	if isDocsPath(name) {
+		return classDocs, ""
+	}
+	return classApp, ""
+}
+
+func fileClass(name string) string {
+	class, _ := classifyFile(name)
+	return class
+}
+
+func infraKind(name string) string {
+	base := path.Base(name)
+	lower := strings.ToLower(base)
+	ext := path.Ext(lower)
+	dirs := strings.Split(path.Dir(name), "/")
+	yaml := ext == ".yaml" || ext == ".yml"
+	switch {
+	case base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(lower, ".dockerfile"),
+		base == "Containerfile", base == ".dockerignore",
+		yaml && (strings.HasPrefix(lower, "docker-compose") || strings.HasPrefix(lower, "compose.")):
+		return kindDocker
+	case ext == ".tf", ext == ".tfvars", strings.HasSuffix(lower, ".tf.json"), ext == ".hcl":
+		return kindTerraform
+	case base == "Chart.yaml", base == "Chart.lock", base == ".helmignore",
+		yaml && strings.HasPrefix(lower, "values") && hasDir(dirs, "charts", "chart", "helm"),
+		(yaml || ext == ".tpl") && hasDir(dirs, "templates") && hasDir(dirs, "charts", "chart", "helm"):
+		return kindHelm
+	case lower == "kustomization.yaml" || lower == "kustomization.yml",
+		yaml && hasDir(dirs, "k8s", "kube", "kubernetes", "manifests", "deploy", "deployments"):
+		return kindKubernetes
+	}
+	return ""
+}
+
+func hasDir(dirs []string, names ...string) bool {
+	for _, dir := range dirs {
+		for _, name := range names {
+			if strings.EqualFold(dir, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isTestPath(name string) bool {
+	base := path.Base(name)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	switch {
+	case strings.HasSuffix(stem, "_test"), strings.HasSuffix(stem, "_spec"),
+		strings.HasPrefix(stem, "test_"),
+		strings.Contains(base, ".test."), strings.Contains(base, ".spec."),
+		strings.HasSuffix(stem, "Test") || strings.HasSuffix(stem, "Tests"):
+		return true
+	}
+	return hasDir(strings.Split(path.Dir(name), "/"), "test", "tests", "testdata", "__tests__", "spec")
+}
+
+func isDocsPath(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".mdx", ".markdown", ".rst", ".adoc", ".txt":
+		return true
+	}
+	upper := strings.ToUpper(path.Base(name))
+	for _, prefix := range []string{"README", "LICENSE", "CHANGELOG", "CONTRIBUTING", "NOTICE", "AUTHORS"} {
+		if strings.HasPrefix(upper, prefix) {
+			return true
+		}
+	}
+	return hasDir(strings.Split(path.Dir(name), "/"), "doc", "docs")
+}
+
+// IsClass filters the files of the classes.
+func IsClass(classes ...string) Filters {
+	return func(file File) bool {
+		class := fileClass(file.Name())
+		for _, c := range classes {
+			if c == class {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// parseClasses reads the -class values, each one a class or a comma
+// separated list of them.
+func parseClasses(values []string) ([]string, error) {
+	classes := make([]string, 0)
+	for _, value := range values {
+		for _, class := range strings.Split(value, ",") {
+			class = strings.TrimSpace(class)
+			known := false
+			for _, c := range fileClasses {
+				known = known || c == class
+			}
+			if !known {
+				return nil, fmt.Errorf("unknown -class %q, want %s", class, strings.Join(fileClasses, ", "))
+			}
+			classes = append(classes, class)
+		}
+	}
+	return classes, nil
+}
+
+// classStats is the activity of a class, or of a kind of infra file, over
+// a walk.
+type classStats struct {
+	Class   string  `json:"class"`
+	Kind    string  `json:"kind,omitempty"`
+	Commits int     `json:"commits"`
+	Files   int     `json:"files"`
+	Changes int     `json:"changes"`
+	Share   float64 `json:"share"`
+}
+
+func collectClassStats(ctx context.Context, q *query) ([]*classStats, error) {
+	commits, err := q.backend.commits(ctx, q.opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := Preload(ctx, commits, CommitFieldFiles); err != nil {
+		return nil, err
+	}
+
+	filters := q.anyFileFilters()
+	stats := make(map[string]*classStats)
+	files := make(map[string]bool)
+	total := 0
+	for _, commit := range commits {
+		changed, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		touched := make(map[string]bool)
+		for _, file := range changed {
+			if !satisfyFilters(file, filters) {
+				continue
+			}
+			total++
+			class, kind := classifyFile(file.Name())
+			keys := []string{class}
+			if kind != "" {
+				keys = append(keys, class+"/"+kind)
+			}
+			for _, key := range keys {
+				s, ok := stats[key]
+				if !ok {
+					s = &classStats{Class: class}
+					if key != class {
+						s.Kind = kind
+					}
+					stats[key] = s
+				}
+				s.Changes++
+				if !touched[key] {
+					touched[key] = true
+					s.Commits++
+				}
+				if !files[key+"\x00"+file.Name()] {
+					files[key+"\x00"+file.Name()] = true
+					s.Files++
+				}
+			}
+		}
+	}
+
+	res := make([]*classStats, 0, len(stats))
+	for _, s := range stats {
+		s.Share = float64(s.Changes) / float64(total)
+		res = append(res, s)
+	}
+	// Classes by changes, each followed by its kinds.
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Class != b.Class {
+			ca, cb := stats[a.Class], stats[b.Class]
+			if ca.Changes != cb.Changes {
+				return ca.Changes > cb.Changes
+			}
+			return a.Class < b.Class
+		}
+		if (a.Kind == "") != (b.Kind == "") {
+			return a.Kind == ""
+		}
+		if a.Changes != b.Changes {
+			return a.Changes > b.Changes
+		}
+		return a.Kind < b.Kind
+	})
+	return res, q.err()
+}
+
+func runClasses(args []string) error {
+	flags := flag.NewFlagSet("classes", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 100)
+	asJSON := flags.Bool("json", false, "print a JSON array")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	stats, err := collectClassStats(ctx, q)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(stats)
+	}
+	if len(stats) == 0 {
+		return errors.New("no file changed in the walked commits")
+	}
+	for _, s := range stats {
+		label := s.Class
+		if s.Kind != "" {
+			label = "  " + s.Kind
+		}
+		fmt.Printf("%-12s %5.1f%% %5d changes %5d files %5d commits\n", label, 100*s.Share, s.Changes, s.Files, s.Commits)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// git reads its commit-graph file, when there is one, instead of parsing
+// commit objects during history walks, and answers path-limited walks
+// from the changed-path Bloom filters stored with it. Every walk gitility
+// makes benefits as is; the last-touch index, the stale report and file
+// histories the most, as they walk all of history.
+
+// commitGraphPaths are where git keeps a single commit-graph and a split
+// one, relative to the object directory.
+var commitGraphPaths = []string{"info/commit-graph", "info/commit-graphs/commit-graph-chain"}
+
+func hasCommitGraph(ctx context.Context) (bool, error) {
+	output, err := runGit(ctx, "rev-parse", "--path-format=absolute", "--git-path", "objects")
+	if err != nil {
+		return false, err
+	}
+	objects := strings.TrimSpace(string(output))
+	for _, path := range commitGraphPaths {
+		if _, err := os.Stat(filepath.Join(objects, path)); err == nil {
+			return true, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// writeCommitGraph writes the commit-graph of everything reachable from the
+// refs, with changed-path Bloom filters. The split format only adds a layer
+// for the commits new since the last write.
+func writeCommitGraph(ctx context.Context) error {
+	// -commit-graph asks for it to be written.
+	_, err := runGit(allowGitWrites(ctx), "commit-graph", "write", "--reachable", "--changed-paths", "--split")
+	return err
+}
+
+// ensureCommitGraph writes the commit-graph when the repository has none and
+// write is set, or says it is missing under GITILITY_DEBUG. Shallow
+// repositories are left alone, git does not read the commit-graph in them.
+func ensureCommitGraph(ctx context.Context, write bool) error {
+	if !write && os.Getenv(debugEnv) == "" {
+		return nil
+	}
+	ok, err := hasCommitGraph(ctx)
+	if err != nil || ok {
+		return err
+	}
+	output, err := runGit(ctx, "rev-parse", "--is-shallow-repository")
+	if err != nil || strings.TrimSpace(string(output)) == "true" {
+		return err
+	}
+	if !write {
+		log.Printf("no commit-graph, history walks parse every commit; -commit-graph writes one")
+		return nil
+	}
+	return writeCommitGraph(ctx)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// readCommitList reads the commits of -stdin, one per line, as git rev-list
+// or git log --format='%H %s' print them: the first field of every line is
+// a commit hash, and blank lines are skipped. Anything else is refused, so
+// no line can pass git an option.
+func readCommitList(r io.Reader) ([]string, error) {
+	commits := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if !isCommitHash(fields[0]) {
+			return nil, fmt.Errorf("stdin:%d: %q is not a commit hash", n, fields[0])
+		}
+		commits = append(commits, fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no commit on stdin")
+	}
+	return commits, nil
+}
+
+// isCommitHash tells abbreviated and full SHA-1 and SHA-256 hashes.
+func isCommitHash(s string) bool {
+	if len(s) < 4 || len(s) > 64 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
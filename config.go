@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const configFileName = ".gitility.yaml"
+
+// config is the repository configuration read from .gitility.yaml.
+type config struct {
+	// Filters are expressions every listed file must satisfy.
+	Filters []string       `json:"filters"`
+	Plugins []pluginConfig `json:"plugins"`
+	// Teams are the gitignore-style path patterns of every team, for -team;
+	// CODEOWNERS stands in when there are none.
+	Teams map[string][]string `json:"teams"`
+	// Scoring are the scoring profiles, by name.
+	Scoring map[string]scoringProfile `json:"scoring"`
+	Privacy privacyConfig             `json:"privacy"`
+}
+
+func loadConfig(dir string) (config, error) {
+	data, err := os.ReadFile(filepath.Join(dir, configFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return config{}, nil
+	}
+	if err != nil {
+		return config{}, err
+	}
+	return parseConfig(data)
+}
+
+func parseConfig(data []byte) (config, error) {
+	cfg := config{}
+	if err := decodeYAML(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", configFileName, err)
+	}
+	return cfg, nil
+}
+
+// decodeYAML parses the subset of YAML a configuration file needs (block
+// mappings and sequences, flow sequences, quoted and plain scalars,
+// comments) and decodes it into v the way encoding/json would.
+func decodeYAML(data []byte, v interface{}) error {
+	p := &yamlParser{}
+	for n, text := range strings.Split(string(data), "\n") {
+		text = stripYAMLComment(strings.TrimRight(text, " \t\r"))
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return fmt.Errorf("line %d: tabs are not allowed for indentation", n+1)
+		}
+		p.lines = append(p.lines, yamlLine{n: n + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(p.lines) == 0 {
+		return nil
+	}
+
+	root, err := p.parseNode(0)
+	if err != nil {
+		return err
+	}
+	if p.i < len(p.lines) {
+		return fmt.Errorf("line %d: unexpected indentation", p.lines[p.i].n)
+	}
+	encoded, err := json.Marshal(root)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+type yamlLine struct {
+	n      int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func isYAMLListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	line := p.lines[p.i]
+	if line.indent < indent {
+		return nil, nil
+	}
+	if isYAMLListItem(line.text) {
+		return p.parseList(line.indent)
+	}
+	return p.parseMap(line.indent)
+}
+
+func (p *yamlParser) parseList(indent int) (interface{}, error) {
+	list := make([]interface{}, 0)
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && isYAMLListItem(p.lines[p.i].text) {
+		line := p.lines[p.i]
+		item := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		switch {
+		case item == "":
+			p.i++
+			var value interface{}
+			if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				var err error
+				if value, err = p.parseNode(indent + 1); err != nil {
+					return nil, err
+				}
+			}
+			list = append(list, value)
+		case yamlKeyEnd(item) >= 0:
+			// "- key: value" opens a mapping whose other keys line up
+			// with the first one.
+			p.lines[p.i] = yamlLine{n: line.n, indent: indent + len(line.text) - len(item), text: item}
+			value, err := p.parseMap(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		default:
+			p.i++
+			value, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.n, err)
+			}
+			list = append(list, value)
+		}
+	}
+	return list, nil
+}
+
+func (p *yamlParser) parseMap(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && !isYAMLListItem(p.lines[p.i].text) {
+		line := p.lines[p.i]
+		end := yamlKeyEnd(line.text)
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.n)
+		}
+		key, err := parseYAMLScalar(line.text[:end])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.n, err)
+		}
+		rest := strings.TrimSpace(line.text[end+1:])
+		p.i++
+
+		var value interface{}
+		if rest != "" {
+			if value, err = parseYAMLScalar(rest); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.n, err)
+			}
+		} else if p.i < len(p.lines) {
+			next := p.lines[p.i]
+			if next.indent > indent || (next.indent == indent && isYAMLListItem(next.text)) {
+				if value, err = p.parseNode(next.indent); err != nil {
+					return nil, err
+				}
+			}
+		}
+		m[fmt.Sprint(key)] = value
+	}
+	if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.i].n)
+	}
+	return m, nil
+}
+
+// yamlKeyEnd returns the index of the colon ending the key of text, or -1.
+func yamlKeyEnd(text string) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 {
+				quote = c
+			}
+		case c == '[' || c == '{':
+			if i == 0 {
+				return -1
+			}
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+// splitYAMLFlow splits the items of a flow sequence on the commas outside
+// quotes.
+func splitYAMLFlow(text string) []string {
+	items := make([]string, 0)
+	var quote byte
+	start := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, text[start:])
+}
+
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimRight(text[:i], " \t")
+		}
+	}
+	return text
+}
+
+func parseYAMLScalar(text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(text, `"`):
+		return strconv.Unquote(text)
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated list %s", text)
+		}
+		list := make([]interface{}, 0)
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return list, nil
+		}
+		for _, item := range splitYAMLFlow(inner) {
+			value, err := parseYAMLScalar(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case text == "{}":
+		return map[string]interface{}{}, nil
+	case text == "~" || text == "null":
+		return nil, nil
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseFloat(text, 64); err == nil {
+		return n, nil
+	}
+	return text, nil
+}
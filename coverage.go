@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// fileCoverage is the statements of a file in a Go cover profile and how
+// many of them the tests ran.
+type fileCoverage struct {
+	Statements int
+	Covered    int
+}
+
+func (c fileCoverage) uncovered() float64 {
+	if c.Statements == 0 {
+		return 0
+	}
+	return 1 - float64(c.Covered)/float64(c.Statements)
+}
+
+// coverageProfile is a Go cover profile, as go test -coverprofile writes
+// it, indexed by every path suffix of its files: the profile names files
+// by import path, and the repository by path from its root.
+type coverageProfile struct {
+	files map[string]*fileCoverage
+	// ambiguous suffixes are shared by several files of the profile.
+	ambiguous map[string]bool
+}
+
+func loadCoverage(path string) (*coverageProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	byName := make(map[string]*fileCoverage)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if n == 1 && strings.HasPrefix(line, "mode:") || line == "" {
+			continue
+		}
+		// name.go:line.column,line.column statements count
+		name, block, ok := strings.Cut(line, ":")
+		fields := strings.Fields(block)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: not a cover profile line", path, n)
+		}
+		statements, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("%s:%d: not a cover profile line", path, n)
+		}
+		c, ok := byName[name]
+		if !ok {
+			c = &fileCoverage{}
+			byName[name] = c
+		}
+		c.Statements += statements
+		if count > 0 {
+			c.Covered += statements
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	p := &coverageProfile{files: make(map[string]*fileCoverage), ambiguous: make(map[string]bool)}
+	for name, c := range byName {
+		for suffix := name; ; {
+			if other, ok := p.files[suffix]; ok && other != c {
+				p.ambiguous[suffix] = true
+			}
+			p.files[suffix] = c
+			i := strings.Index(suffix, "/")
+			if i < 0 {
+				break
+			}
+			suffix = suffix[i+1:]
+		}
+	}
+	return p, nil
+}
+
+// lookup finds the coverage of a file of the repository.
+func (p *coverageProfile) lookup(name string) (fileCoverage, bool) {
+	c, ok := p.files[name]
+	if !ok || p.ambiguous[name] {
+		return fileCoverage{}, false
+	}
+	return *c, true
+}
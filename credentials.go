@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const tokenEnv = "GITILITY_TOKEN"
+
+// remoteEnv is the environment of git commands that talk to remotes. Prompts
+// are disabled and ssh runs in batch mode, so a missing credential fails
+// instead of hanging a headless run. Configured credential helpers and the
+// SSH agent keep working as usual; a token replaces the helpers for HTTPS
+// remotes. The token travels in the environment, never on the command line.
+func remoteEnv(token string) []string {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	if os.Getenv("GIT_SSH_COMMAND") == "" && os.Getenv("GIT_SSH") == "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	if token != "" {
+		env = append(env,
+			tokenEnv+"="+token,
+			"GIT_CONFIG_COUNT=2",
+			"GIT_CONFIG_KEY_0=credential.helper",
+			"GIT_CONFIG_VALUE_0=",
+			"GIT_CONFIG_KEY_1=credential.helper",
+			`GIT_CONFIG_VALUE_1=!f() { test "$1" = get && echo username=x-access-token && echo "password=$`+tokenEnv+`"; }; f`,
+		)
+	}
+	return env
+}
+
+// credentialHints are the git messages that mean a remote needed
+// credentials it could not get without a terminal.
+var credentialHints = []string{
+	"could not read Username",
+	"could not read Password",
+	"terminal prompts disabled",
+	"Authentication failed",
+	"Permission denied (publickey",
+	"Host key verification failed",
+	"HTTP Basic: Access denied",
+}
+
+func credentialError(what string, stderr string) error {
+	for _, hint := range credentialHints {
+		if !strings.Contains(stderr, hint) {
+			continue
+		}
+		switch {
+		case strings.Contains(stderr, "publickey") && os.Getenv("SSH_AUTH_SOCK") == "":
+			return fmt.Errorf("%s needs an SSH key: no SSH agent is running (SSH_AUTH_SOCK is unset) (%s)", what, stderr)
+		case strings.Contains(stderr, "publickey") || strings.Contains(stderr, "Host key"):
+			return fmt.Errorf("%s was refused by the SSH server: check the keys loaded in the SSH agent and known_hosts (%s)", what, stderr)
+		default:
+			return fmt.Errorf("%s needs credentials: pass -token or set %s, or configure a credential helper (%s)", what, tokenEnv, stderr)
+		}
+	}
+	return nil
+}
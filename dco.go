@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type dcoViolation struct {
+	commitHash string
+	author     string
+	reason     string
+}
+
+func runCheckDCO(args []string) error {
+	flags := flag.NewFlagSet("check-dco", flag.ExitOnError)
+	limit := flags.Int("limit", 10, "number of commits to check")
+	ref := flags.String("ref", "", "revision or range to check, e.g. origin/main..HEAD")
+	includeMerges := flags.Bool("include-merges", false, "also require a sign-off on merge commits")
+	output := addOutputFlags(flags)
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	opt := Options{}
+	opt.GetCommits.Limit = *limit
+	opt.GetCommits.Ref = *ref
+	if strings.Contains(*ref, "..") {
+		// Every commit of the range is checked: -limit only caps the walk
+		// when given.
+		limitSet := false
+		flags.Visit(func(f *flag.Flag) { limitSet = limitSet || f.Name == "limit" })
+		if !limitSet {
+			opt.GetCommits.Limit = math.MaxInt32
+		}
+	}
+	if !*includeMerges {
+		opt.GetCommits.Merges = MergesExclude
+	}
+
+	opt.GetCommits.Trailers = true
+
+	commits, err := getCommits(ctx, opt)
+	if err != nil {
+		return err
+	}
+
+	violations := make([]dcoViolation, 0)
+	for _, commit := range commits {
+		signOffs := commit.Trailers().Values("Signed-off-by")
+		if reason := checkSignOff(commitIdentity(commit), signOffs); reason != "" {
+			violations = append(violations, dcoViolation{commitHash: commit.CommitHash(), author: commit.Author(), reason: reason})
+		}
+	}
+
+	for _, v := range violations {
+		fmt.Printf("%s %s: %s\n", v.commitHash, v.author, v.reason)
+	}
+	summary := fmt.Sprintf("%d commits checked, %d without a matching Signed-off-by", len(commits), len(violations))
+	fmt.Println(summary)
+	if output.annotated() {
+		annotations := make([]annotation, 0, len(violations))
+		rows := make([][]string, 0, len(violations))
+		for _, v := range violations {
+			annotations = append(annotations, annotation{Level: "error", Title: "DCO", Message: fmt.Sprintf("%s %s: %s", v.commitHash, v.author, v.reason)})
+			rows = append(rows, []string{v.commitHash, v.author, v.reason})
+		}
+		markdown := "### DCO check\n\n" + summary + "\n"
+		if len(rows) > 0 {
+			markdown += "\n" + markdownTable([]string{"Commit", "Author", "Problem"}, rows)
+		}
+		if err := output.report(ctx, "DCO check", len(violations) > 0, annotations, markdown); err != nil {
+			return err
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("DCO check failed")
+	}
+	return nil
+}
+
+func checkSignOff(author string, signOffs []string) string {
+	if len(signOffs) == 0 {
+		return "missing Signed-off-by"
+	}
+	email := authorEmail(author)
+	for _, signOff := range signOffs {
+		if email != "" && authorEmail(signOff) == email {
+			return ""
+		}
+	}
+	return fmt.Sprintf("Signed-off-by %q does not match the author", strings.Join(signOffs, ", "))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// DedupScope picks how often the listing names the same file. By default
+// every file is listed once, for its newest commit; reports over the raw
+// stream of changes, like files per commit, need more of them.
+type DedupScope string
+
+const (
+	// DedupFile lists every file once, for its newest commit.
+	DedupFile DedupScope = "file"
+	// DedupDirectory lists every directory once, with its newest changed
+	// file.
+	DedupDirectory DedupScope = "directory"
+	// DedupCommit lists every file once per commit changing it.
+	DedupCommit DedupScope = "commit"
+	// DedupNone lists every file every time a commit reports it, twice
+	// for a merge diffed against both parents.
+	DedupNone DedupScope = "none"
+)
+
+// DedupFold makes names that differ only in ways file systems ignore the
+// same name when files are listed once: in repositories edited on both
+// macOS and Linux, the same file can be committed under names differing
+// in case, or in Unicode normalization, macOS decomposing accented letters
+// that Linux keeps composed. The newest of the names is listed.
+type DedupFold struct {
+	// Case compares the names ignoring case.
+	Case bool
+	// NFC compares the names in Unicode normalization form C, composed.
+	NFC bool
+}
+
+// dedupFiles lists the files of a listing of every change once per scope,
+// the first of them, which comes from the newest commit.
+func dedupFiles(files []File, scope DedupScope, fold DedupFold) []File {
+	seen := make(map[string]bool)
+	unique := make([]File, 0, len(files))
+	for _, file := range files {
+		key, dedup := dedupKey(scope, fold, file)
+		if dedup && seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, file)
+	}
+	return unique
+}
+
+// dedupKey is what the files listed once in scope share, or false when
+// every file is listed.
+func dedupKey(scope DedupScope, fold DedupFold, file File) (string, bool) {
+	name := file.Name()
+	if fold.NFC {
+		name = normalizeNFC(name)
+	}
+	if fold.Case {
+		name = strings.ToLower(name)
+	}
+	switch scope {
+	case DedupDirectory:
+		return path.Dir(name), true
+	case DedupCommit:
+		return file.GetCommit().CommitHash() + "\x00" + name, true
+	case DedupNone:
+		return "", false
+	}
+	return name, true
+}
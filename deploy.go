@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deploy is a release of the repository: when it happened and, when known,
+// the commit that went out. Deploys without a commit are matched to the
+// last first-parent commit before them.
+type deploy struct {
+	Name string
+	Time time.Time
+	Rev  string
+}
+
+// loadDeploysFile reads one deploy per line: a time (RFC 3339, a date or
+// Unix seconds), then optionally the deployed revision and a name. Blank
+// lines and lines starting with # are skipped.
+func loadDeploysFile(path string) ([]deploy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	deploys := make([]deploy, 0)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		t, err := parseDeployTime(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		d := deploy{Name: fields[0], Time: t}
+		if len(fields) > 1 {
+			if err := checkRevision(fields[1]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+			d.Rev = fields[1]
+			d.Name = fields[1]
+		}
+		if len(fields) > 2 {
+			d.Name = strings.Join(fields[2:], " ")
+		}
+		deploys = append(deploys, d)
+	}
+	return deploys, scanner.Err()
+}
+
+func parseDeployTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("bad deploy time %q", s)
+}
+
+// tagDeploys treats every tag matching the glob as a deploy, at the time
+// the tag (or its commit, for lightweight tags) was created.
+func tagDeploys(ctx context.Context, glob string) ([]deploy, error) {
+	output, err := runGit(ctx,
+		"for-each-ref",
+		"--format=%(refname:short)%00%(creatordate:unix)%00%(*objectname)%00%(objectname)",
+		"refs/tags/"+glob,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	deploys := make([]deploy, 0)
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: bad date %q", fields[0], fields[1])
+		}
+		rev := fields[2]
+		if rev == "" {
+			rev = fields[3]
+		}
+		deploys = append(deploys, deploy{Name: fields[0], Time: time.Unix(seconds, 0), Rev: rev})
+	}
+	return deploys, nil
+}
+
+// deployments lists the GitHub deployments of the repository, to one
+// environment when env is set.
+func (c *forgeClient) deployments(ctx context.Context, slug string, env string) ([]deploy, error) {
+	path := "/repos/" + slug + "/deployments?per_page=100"
+	if env != "" {
+		path += "&environment=" + url.QueryEscape(env)
+	}
+	deploys := make([]deploy, 0)
+	err := c.get(ctx, path, func(body json.RawMessage) error {
+		page := make([]struct {
+			SHA         string    `json:"sha"`
+			Ref         string    `json:"ref"`
+			Environment string    `json:"environment"`
+			CreatedAt   time.Time `json:"created_at"`
+		}, 0)
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		for _, d := range page {
+			deploys = append(deploys, deploy{Name: d.Environment + " " + d.Ref, Time: d.CreatedAt, Rev: d.SHA})
+		}
+		return nil
+	})
+	return deploys, err
+}
+
+func cmdRevBefore(ctx context.Context, rev string, t time.Time) (string, error) {
+	output, err := runGit(ctx, "rev-list", "-1", "--first-parent", "--before="+strconv.FormatInt(t.Unix(), 10), rev)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// deployChanges is what a deploy shipped since the previous one.
+type deployChanges struct {
+	deploy
+	Commits []Commit
+	Files   []File
+	Lead    time.Duration
+	// Failed tells a deploy shipped a commit that was later reverted, a
+	// proxy for a failed change.
+	Failed bool
+}
+
+// correlateDeploys splits the history at the deploys, oldest first, and
+// tells what each one shipped. The first deploy only serves as the
+// baseline of the second.
+func correlateDeploys(ctx context.Context, q *query, deploys []deploy) ([]deployChanges, error) {
+	sort.SliceStable(deploys, func(i, j int) bool { return deploys[i].Time.Before(deploys[j].Time) })
+	for i := range deploys {
+		if deploys[i].Rev != "" {
+			continue
+		}
+		rev, err := cmdRevBefore(ctx, q.rev(), deploys[i].Time)
+		if err != nil {
+			return nil, err
+		}
+		deploys[i].Rev = rev
+	}
+
+	// Only what the deploys shipped counts, reverted by then or since: the
+	// walk goes from the oldest deploy to the tip, whatever -limit.
+	var reverts []revert
+	for _, d := range deploys {
+		if d.Rev == "" {
+			continue
+		}
+		opt := q.opt
+		opt.GetCommits.Ref = d.Rev + ".." + q.rev()
+		opt.GetCommits.Limit = math.MaxInt32
+		var err error
+		if reverts, err = detectReverts(ctx, opt, true); err != nil {
+			return nil, err
+		}
+		break
+	}
+	reverted := make(map[string]bool, len(reverts))
+	for _, r := range reverts {
+		reverted[r.Original] = true
+	}
+
+	res := make([]deployChanges, 0, len(deploys))
+	for i := 1; i < len(deploys); i++ {
+		d := deployChanges{deploy: deploys[i]}
+		if deploys[i-1].Rev == "" || d.Rev == "" {
+			res = append(res, d)
+			continue
+		}
+
+		opt := q.opt
+		opt.GetCommits.Ref = deploys[i-1].Rev + ".." + d.Rev
+		opt.GetCommits.Limit = math.MaxInt32
+		commits, err := getCommits(ctx, opt)
+		if err != nil {
+			return nil, fmt.Errorf("deploy %s: %w", d.Name, err)
+		}
+
+		leads := make([]time.Duration, 0, len(commits))
+		seen := make(map[string]bool)
+		for _, commit := range commits {
+			commitTime, err := commit.CommitTime(ctx)
+			if err != nil {
+				return nil, err
+			}
+			leads = append(leads, d.Time.Sub(commitTime))
+			d.Failed = d.Failed || reverted[commit.CommitHash()]
+			files, err := commit.GetFiles(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				if !seen[file.Name()] && satisfyFilters(file, q.filters) {
+					seen[file.Name()] = true
+					d.Files = append(d.Files, file)
+				}
+			}
+		}
+		d.Commits = commits
+		d.Lead = median(leads)
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+func runDeploys(args []string) error {
+	flags := flag.NewFlagSet("deploys", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	from := flags.String("from", "", "read the deploys from `file`: one \"time [revision [name]]\" per line")
+	tags := flags.String("tags", "", "treat the tags matching `glob` as deploys, e.g. 'v*'")
+	environment := flags.String("github-environment", "", "read the deploys to the GitHub deployment `environment`")
+	api := flags.String("api", defaultForgeAPI, "forge API `url`, for GitHub Enterprise")
+	showFiles := flags.Bool("files", false, "list the files each deploy shipped")
+	timeout := flags.Duration("timeout", 10*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if *queryFlags.token == "" {
+		*queryFlags.token = orEnv(os.Getenv(tokenEnv), "GITHUB_TOKEN")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	var deploys []deploy
+	switch {
+	case *from != "":
+		deploys, err = loadDeploysFile(*from)
+	case *tags != "":
+		deploys, err = tagDeploys(ctx, *tags)
+	case *environment != "":
+		var slug string
+		if slug, err = repoSlug(ctx, *queryFlags.remote); err == nil {
+			deploys, err = newForgeClient(*api, *queryFlags.token).deployments(ctx, slug, *environment)
+		}
+	default:
+		return errors.New("usage: gitility deploys [flags] -from file | -tags glob | -github-environment env")
+	}
+	if err != nil {
+		return err
+	}
+	if len(deploys) < 2 {
+		return errors.New("need at least two deploys to compare")
+	}
+
+	changes, err := correlateDeploys(ctx, q, deploys)
+	if err != nil {
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	leads := make([]time.Duration, 0, len(changes))
+	failed := 0
+	for _, d := range changes {
+		status := ""
+		if d.Failed {
+			status = "  reverted"
+			failed++
+		}
+		fmt.Printf("%s %-24s %4d commits %4d files  lead %8s%s\n", d.Time.Format(time.RFC3339), d.Name, len(d.Commits), len(d.Files), formatHours(d.Lead), status)
+		if len(d.Commits) > 0 {
+			leads = append(leads, d.Lead)
+		}
+		if *showFiles {
+			if err := printFiles(ctx, d.Files, "  "); err != nil {
+				return err
+			}
+		}
+	}
+
+	span := changes[len(changes)-1].Time.Sub(deploys[0].Time)
+	fmt.Printf("\n%d deploys, one every %s, median lead time %s, change failure rate %.0f%%\n",
+		len(changes), formatHours(span/time.Duration(len(changes))), formatHours(median(leads)), float64(failed)/float64(len(changes))*100)
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// reportEntry is one file of an exported report. Reports with change
+// counts, like hotspots, rank by them; the others keep their order.
+type reportEntry struct {
+	Name    string   `json:"name"`
+	Changes *float64 `json:"changes"`
+}
+
+// loadReport reads the JSON array a -json run printed and returns its
+// files best first, each once.
+func loadReport(path string) ([]reportEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]reportEntry, 0)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Changes == nil || entries[j].Changes == nil {
+			return false
+		}
+		return *entries[i].Changes > *entries[j].Changes
+	})
+	res := make([]reportEntry, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry.Name != "" && !seen[entry.Name] {
+			seen[entry.Name] = true
+			res = append(res, entry)
+		}
+	}
+	return res, nil
+}
+
+// rankChange is a file whose place in the top changed between two
+// reports. Ranks count from 1; 0 means outside the top.
+type rankChange struct {
+	Name    string
+	OldRank int
+	NewRank int
+}
+
+// counted tells whether every file of a report has a change count.
+func counted(entries []reportEntry) bool {
+	for _, entry := range entries {
+		if entry.Changes == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// diffReports compares the top files of two reports, as the ranking flags
+// cut them: the ones that entered, left, and moved within it.
+func diffReports(before []reportEntry, after []reportEntry, rank *rankFlags) (entered, left, moved []rankChange) {
+	ranks := func(entries []reportEntry) map[string]int {
+		entries = entries[:rank.keep(len(entries), func(i int) float64 {
+			if entries[i].Changes == nil {
+				return 0
+			}
+			return *entries[i].Changes
+		})]
+		r := make(map[string]int, len(entries))
+		for i, entry := range entries {
+			r[entry.Name] = i + 1
+		}
+		return r
+	}
+	oldRanks, newRanks := ranks(before), ranks(after)
+
+	for _, entry := range after {
+		newRank, ok := newRanks[entry.Name]
+		if !ok {
+			continue
+		}
+		switch oldRank := oldRanks[entry.Name]; {
+		case oldRank == 0:
+			entered = append(entered, rankChange{Name: entry.Name, NewRank: newRank})
+		case oldRank != newRank:
+			moved = append(moved, rankChange{Name: entry.Name, OldRank: oldRank, NewRank: newRank})
+		}
+	}
+	for _, entry := range before {
+		if oldRank, ok := oldRanks[entry.Name]; ok && newRanks[entry.Name] == 0 {
+			left = append(left, rankChange{Name: entry.Name, OldRank: oldRank})
+		}
+	}
+	return entered, left, moved
+}
+
+func runDiffReport(args []string) error {
+	flags := flag.NewFlagSet("diff-report", flag.ExitOnError)
+	rank := addRankFlags(flags, 20)
+	exitCode := flags.Bool("exit-code", false, "exit with a failure status when files entered or left the top")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return errors.New("usage: gitility diff-report [flags] old.json new.json")
+	}
+	if err := rank.validate(); err != nil {
+		return err
+	}
+
+	before, err := loadReport(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := loadReport(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if (*rank.minCount > 0 || *rank.percentile > 0 || *rank.withTies) && (!counted(before) || !counted(after)) {
+		return errors.New("-min-count, -percentile and -with-ties need reports with change counts, like hotspots -json")
+	}
+
+	// There are no query flags: unsafe names are quoted C-style.
+	ctx := context.Background()
+	entered, left, moved := diffReports(before, after, rank)
+	label := fmt.Sprintf("the top %d", *rank.top)
+	if *rank.top <= 0 {
+		label = "the report"
+	}
+	if len(entered) > 0 {
+		fmt.Printf("entered %s:\n", label)
+		for _, c := range entered {
+			fmt.Printf("  %3d. %s\n", c.NewRank, displayName(ctx, c.Name))
+		}
+	}
+	if len(left) > 0 {
+		fmt.Printf("left %s:\n", label)
+		for _, c := range left {
+			fmt.Printf("  %3d. %s\n", c.OldRank, displayName(ctx, c.Name))
+		}
+	}
+	if len(moved) > 0 {
+		fmt.Println("moved:")
+		for _, c := range moved {
+			fmt.Printf("  %3d. %s (was %d)\n", c.NewRank, displayName(ctx, c.Name), c.OldRank)
+		}
+	}
+	if len(entered)+len(left)+len(moved) == 0 {
+		fmt.Printf("%s did not change\n", label)
+	}
+	if *exitCode && len(entered)+len(left) > 0 {
+		return fmt.Errorf("%d files entered and %d left %s", len(entered), len(left), label)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// digest is the summary of a period of activity in a repository.
+type digest struct {
+	Since        time.Time     `json:"since"`
+	Commits      int           `json:"commits"`
+	Authors      int           `json:"authors"`
+	HotFiles     []fileChanges `json:"hot_files"`
+	PullRequests []digestPull  `json:"pull_requests"`
+	Newcomers    []string      `json:"new_contributors"`
+	StaleAreas   []staleArea   `json:"stale_areas"`
+}
+
+type digestPull struct {
+	Number  int    `json:"number"`
+	Subject string `json:"subject"`
+	Files   int    `json:"files"`
+}
+
+// staleArea is a directory with many files nobody changed for a long time.
+type staleArea struct {
+	Dir   string `json:"dir"`
+	Files int    `json:"files"`
+}
+
+func buildDigest(ctx context.Context, cache Cache, q *query, since time.Time, staleCutoff time.Time, rank *rankFlags) (*digest, error) {
+	opt := q.opt
+	opt.GetCommits.Since = since
+	if opt.GetCommits.Limit == 0 {
+		opt.GetCommits.Limit = math.MaxInt32
+	}
+	opt.GetCommits.Subjects = true
+	if opt.GetCommits.MergeDiff == MergeDiffAuto {
+		// Merges stand for their pull request, so they list what it
+		// brought in; the branch commits are still walked for the authors.
+		opt.GetCommits.MergeDiff = MergeDiffFirstParent
+	}
+	commits, err := getCommits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := Preload(ctx, commits, CommitFieldFiles); err != nil {
+		return nil, err
+	}
+
+	d := &digest{Since: since, Commits: len(commits)}
+	changes := make(map[string]float64)
+	order := make([]string, 0)
+	authors := make(map[string]string)
+	pulls := make(map[int]*digestPull)
+	for _, commit := range commits {
+		if _, ok := authors[authorKey(commit.Author())]; !ok {
+			authors[authorKey(commit.Author())] = commit.Author()
+		}
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		kept := 0
+		for _, file := range files {
+			if !satisfyFilters(file, q.filters) {
+				continue
+			}
+			kept++
+			if _, ok := changes[file.Name()]; !ok {
+				order = append(order, file.Name())
+			}
+			changes[file.Name()]++
+		}
+		if n := commit.PullRequest(); n > 0 {
+			if p, ok := pulls[n]; !ok || kept > p.Files {
+				pulls[n] = &digestPull{Number: n, Subject: commit.Subject(), Files: kept}
+			}
+		}
+	}
+	d.Authors = len(authors)
+
+	for _, name := range order {
+		d.HotFiles = append(d.HotFiles, fileChanges{Name: name, Changes: changes[name]})
+	}
+	sort.Slice(d.HotFiles, func(i, j int) bool {
+		if d.HotFiles[i].Changes != d.HotFiles[j].Changes {
+			return d.HotFiles[i].Changes > d.HotFiles[j].Changes
+		}
+		return d.HotFiles[i].Name < d.HotFiles[j].Name
+	})
+	d.HotFiles = d.HotFiles[:rank.keep(len(d.HotFiles), func(i int) float64 { return d.HotFiles[i].Changes })]
+
+	for _, p := range pulls {
+		d.PullRequests = append(d.PullRequests, *p)
+	}
+	sort.Slice(d.PullRequests, func(i, j int) bool {
+		if d.PullRequests[i].Files != d.PullRequests[j].Files {
+			return d.PullRequests[i].Files > d.PullRequests[j].Files
+		}
+		return d.PullRequests[i].Number < d.PullRequests[j].Number
+	})
+	d.PullRequests = d.PullRequests[:rank.keep(len(d.PullRequests), func(i int) float64 { return float64(d.PullRequests[i].Files) })]
+
+	before := q.opt
+	before.GetCommits.Until = since
+	before.GetCommits.Limit = math.MaxInt32
+	previous, err := knownAuthors(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	for key, author := range authors {
+		if !previous[key] {
+			d.Newcomers = append(d.Newcomers, author)
+		}
+	}
+	sort.Strings(d.Newcomers)
+
+	stale, err := staleFiles(ctx, cache, q, q.rev(), staleCutoff)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, file := range stale {
+		counts[path.Dir(file.Name())]++
+	}
+	for dir, n := range counts {
+		d.StaleAreas = append(d.StaleAreas, staleArea{Dir: dir, Files: n})
+	}
+	sort.Slice(d.StaleAreas, func(i, j int) bool {
+		if d.StaleAreas[i].Files != d.StaleAreas[j].Files {
+			return d.StaleAreas[i].Files > d.StaleAreas[j].Files
+		}
+		return d.StaleAreas[i].Dir < d.StaleAreas[j].Dir
+	})
+	d.StaleAreas = d.StaleAreas[:rank.keep(len(d.StaleAreas), func(i int) float64 { return float64(d.StaleAreas[i].Files) })]
+	return d, q.err()
+}
+
+// knownAuthors lists the authors of the commits the options walk, by
+// authorKey.
+func knownAuthors(ctx context.Context, opt Options) (map[string]bool, error) {
+	args, err := commitWalkArgs(opt)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runGit(ctx, append([]string{"log", "--format=%an <%ae>"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, author := range strings.Split(string(output), "\n") {
+		if author != "" {
+			known[authorKey(author)] = true
+		}
+	}
+	return known, nil
+}
+
+func (d *digest) text(period string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d commits by %d authors in the last %s.\n", d.Commits, d.Authors, period)
+	if len(d.HotFiles) > 0 {
+		b.WriteString("\nMost changed files:\n")
+		for _, f := range d.HotFiles {
+			fmt.Fprintf(&b, "  %3.0f  %s\n", f.Changes, f.Name)
+		}
+	}
+	if len(d.PullRequests) > 0 {
+		b.WriteString("\nBiggest pull requests:\n")
+		for _, p := range d.PullRequests {
+			fmt.Fprintf(&b, "  #%d %s (%d files)\n", p.Number, p.Subject, p.Files)
+		}
+	}
+	if len(d.Newcomers) > 0 {
+		b.WriteString("\nNew contributors:\n")
+		for _, author := range d.Newcomers {
+			fmt.Fprintf(&b, "  %s\n", author)
+		}
+	}
+	if len(d.StaleAreas) > 0 {
+		b.WriteString("\nStale areas:\n")
+		for _, area := range d.StaleAreas {
+			fmt.Fprintf(&b, "  %3d files  %s/\n", area.Files, area.Dir)
+		}
+	}
+	return b.String()
+}
+
+func runDigest(args []string) error {
+	flags := flag.NewFlagSet("digest", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	period := flags.String("since", "7d", "summarize the commits of the last `age`, e.g. 7d or 2w")
+	staleAge := flags.String("stale", "12m", "a directory's files are stale when unchanged for `age`")
+	rank := addRankFlags(flags, 5)
+	notify := addNotifyFlags(flags)
+	cacheSpec := flags.String("cache", "", "cache `backend` of the last-touch index: disk, memory or redis://host:port (default $"+cacheEnv+" or disk)")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if err := rank.validate(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	since, err := ageCutoff(now, *period)
+	if err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	staleCutoff, err := ageCutoff(now, *staleAge)
+	if err != nil {
+		return fmt.Errorf("-stale: %w", err)
+	}
+	notifiers, err := notify.notifiers()
+	if err != nil {
+		return err
+	}
+	cache, err := newCache(orEnv(*cacheSpec, cacheEnv))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	d, err := buildDigest(ctx, cache, q, since, staleCutoff, rank)
+	if err != nil {
+		return err
+	}
+	text := d.text(*period)
+	fmt.Print(text)
+	msg := message{Subject: fmt.Sprintf("gitility digest of %s, last %s", path.Base(q.topLevel), *period), Text: text, Data: d}
+	return notifyAll(ctx, notifiers, msg)
+}
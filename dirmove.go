@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A directory move is a commit renaming many files from one directory to
+// another, keeping their paths below it: a reorganization. Under
+// FollowMoves, the files of a move and of the commits older than it carry
+// the names it gave them, so a file's history reads as one through any number of
+// moves.
+
+// dirMoveMinFiles is how many files a commit must move from a directory to
+// another for it to be a directory move rather than a few renames.
+const dirMoveMinFiles = 3
+
+type dirMove struct {
+	Commit string `json:"commit"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Files  int    `json:"files"`
+	// index is the position of the commit in the walk, newest first.
+	index int
+}
+
+// apply renames a path under the moved directory.
+func (m dirMove) apply(name string) (string, bool) {
+	if strings.HasPrefix(name, m.From) {
+		return m.To + strings.TrimPrefix(name, m.From), true
+	}
+	return name, false
+}
+
+// renamePrefixes splits a rename into the directories it changes, with a
+// trailing slash or empty for the root, keeping the path components the
+// two names share at their end.
+func renamePrefixes(from, to string) (string, string, bool) {
+	a, b := strings.Split(from, "/"), strings.Split(to, "/")
+	i, j := len(a), len(b)
+	for i > 0 && j > 0 && a[i-1] == b[j-1] {
+		i--
+		j--
+	}
+	if i == len(a) {
+		// The base names differ: a file rename.
+		return "", "", false
+	}
+	if i == 0 {
+		// A directory moved into another one: new/ to lib/new/, not the
+		// root to lib/, which the files of other directories stay in.
+		if i+1 == len(a) {
+			return "", "", false
+		}
+		i++
+		j++
+	}
+	join := func(parts []string) string {
+		if len(parts) == 0 {
+			return ""
+		}
+		return strings.Join(parts, "/") + "/"
+	}
+	return join(a[:i]), join(b[:j]), true
+}
+
+// detectDirMoves finds the directory moves among the walked commits,
+// asking git for their renames preloadBatch commits at a time.
+func detectDirMoves(ctx context.Context, commits []Commit) ([]dirMove, error) {
+	index := make(map[string]int, len(commits))
+	hashes := make([]string, 0, len(commits))
+	for i, commit := range commits {
+		index[commit.CommitHash()] = i
+		hashes = append(hashes, commit.CommitHash())
+	}
+
+	moves := make([]dirMove, 0)
+	for len(hashes) > 0 {
+		n := len(hashes)
+		if n > preloadBatch {
+			n = preloadBatch
+		}
+		args := []string{"-c", "core.quotePath=off", "log", "--no-walk=unsorted", "--format=%x1e%h", "-M", "--diff-filter=R", "--name-status"}
+		output, err := runGit(ctx, append(args, hashes[:n]...)...)
+		if err != nil {
+			return nil, err
+		}
+		hashes = hashes[n:]
+
+		for _, record := range strings.Split(string(output), "\x1e") {
+			lines := strings.Split(record, "\n")
+			if lines[0] == "" {
+				continue
+			}
+			counts := make(map[[2]string]int)
+			for _, line := range lines[1:] {
+				fields := strings.Split(line, "\t")
+				if len(fields) != 3 || !strings.HasPrefix(fields[0], "R") {
+					continue
+				}
+				if from, to, ok := renamePrefixes(fields[1], fields[2]); ok {
+					counts[[2]string{from, to}]++
+				}
+			}
+			for dirs, files := range counts {
+				if files >= dirMoveMinFiles {
+					moves = append(moves, dirMove{Commit: lines[0], From: dirs[0], To: dirs[1], Files: files, index: index[lines[0]]})
+				}
+			}
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		if moves[i].index != moves[j].index {
+			return moves[i].index < moves[j].index
+		}
+		// The deeper directory of a commit first, it is the more precise.
+		return len(moves[i].From) > len(moves[j].From)
+	})
+	return moves, nil
+}
+
+// followMoves renames the files of each directory move and of the commits
+// older than it the way it did, oldest move first, so chained moves
+// compose.
+func followMoves(ctx context.Context, commits []Commit) error {
+	moves, err := detectDirMoves(ctx, commits)
+	if err != nil || len(moves) == 0 {
+		return err
+	}
+	// The moves by commit, oldest first.
+	groups := make([][]dirMove, 0)
+	for i := len(moves) - 1; i >= 0; i-- {
+		if n := len(groups); n > 0 && groups[n-1][0].index == moves[i].index {
+			groups[n-1] = append([]dirMove{moves[i]}, groups[n-1]...)
+		} else {
+			groups = append(groups, []dirMove{moves[i]})
+		}
+	}
+
+	for i, commit := range commits {
+		c, ok := commit.(*commitObj)
+		if !ok {
+			continue
+		}
+		newer := make([][]dirMove, 0)
+		for _, group := range groups {
+			// The commit of a move lists the old names it deleted too.
+			if group[0].index <= i {
+				newer = append(newer, group)
+			}
+		}
+		if len(newer) == 0 {
+			continue
+		}
+		c.setRename(func(name string) string {
+			for _, group := range newer {
+				for _, m := range group {
+					if renamed, ok := m.apply(name); ok {
+						name = renamed
+						break
+					}
+				}
+			}
+			return name
+		})
+	}
+	return nil
+}
+
+func runMoves(args []string) error {
+	flags := flag.NewFlagSet("moves", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	asJSON := flags.Bool("json", false, "print a JSON array")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	if q.backend.marker != gitBackend.marker {
+		return errors.New("moves needs a git repository")
+	}
+
+	walk := q.opt
+	walk.GetCommits.FollowMoves = false
+	commits, err := q.backend.commits(ctx, walk)
+	if err != nil {
+		return err
+	}
+	moves, err := detectDirMoves(ctx, commits)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(moves)
+	}
+	if len(moves) == 0 {
+		return errors.New("no directory move in the walked commits")
+	}
+	for _, m := range moves {
+		to := m.To
+		if to == "" {
+			to = "./"
+		}
+		fmt.Printf("%s %5d files  %s -> %s\n", m.Commit, m.Files, displayName(ctx, m.From), displayName(ctx, to))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// -explain prints the plan of a listing instead of running it: the git
+// commands it would run, in order, and how many commits they would walk.
+// Counting the commits runs git rev-list, which only reads the commit
+// graph; nothing else runs.
+
+// planStep is one command of a plan, run runs times. Commit lists too long
+// for one command line are split into batches.
+type planStep struct {
+	what string
+	cmd  string
+	runs int
+}
+
+// queryPlan is what a listing would do: the commits it would walk and the
+// steps walking them.
+type queryPlan struct {
+	backend string
+	commits int
+	// sampled is about how many of the commits are analyzed.
+	sampled int
+	steps   []planStep
+	filters int
+	// aggregates run once the walk is over, on all the files.
+	aggregates int
+}
+
+// shellQuote quotes an argument for a POSIX shell when it needs it.
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,@^+%", r))
+	}) < 0 {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func gitCommandLine(args ...string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, "git")
+	for _, arg := range args {
+		// Placeholders, like <commits>, stand for what the walk finds.
+		if strings.HasPrefix(arg, "<") && strings.HasSuffix(arg, ">") {
+			quoted = append(quoted, arg)
+			continue
+		}
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func batches(commits int) int {
+	return (commits + preloadBatch - 1) / preloadBatch
+}
+
+// planQuery plans the listing of q, following getCommits and getOrderFiles.
+func planQuery(ctx context.Context, q *query) (*queryPlan, error) {
+	if q.backend.marker != gitBackend.marker {
+		return nil, errors.New("-explain needs a git repository")
+	}
+	opt := q.listingOptions()
+	if opt.GetCommits.Limit == 0 {
+		opt.GetCommits.Limit = 1
+	}
+	walk, err := commitWalkArgs(opt)
+	if err != nil {
+		return nil, err
+	}
+	count := append([]string{"rev-list", "--count"}, walk...)
+	// Unlike log, rev-list walks nothing by default.
+	if o := opt.GetCommits; o.Ref == "" && !o.AllRefs && len(o.Branches) == 0 && len(o.Commits) == 0 {
+		count = append(count, "HEAD")
+	}
+	output, err := runGit(ctx, count...)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return nil, err
+	}
+
+	o := opt.GetCommits
+	plan := &queryPlan{backend: q.backend.name, commits: commits, filters: len(q.filters), aggregates: len(q.aggregates)}
+	// Sampling thins out the walked commits before their files are listed.
+	if o.Sample.Every > 1 {
+		commits = (commits + o.Sample.Every - 1) / o.Sample.Every
+	}
+	if o.Sample.Percent > 0 && o.Sample.Percent < 100 {
+		commits = int(float64(commits) * o.Sample.Percent / 100)
+	}
+	plan.sampled = commits
+	add := func(what string, runs int, args ...string) {
+		plan.steps = append(plan.steps, planStep{what: what, cmd: gitCommandLine(args...), runs: runs})
+	}
+	add("walk the commits", 1, append([]string{"log", "--pretty=format:" + commitFormat(opt)}, walk...)...)
+	if o.SkipCherryPicks {
+		add("find cherry-picked copies", 1, append([]string{"log", "-p", "--format=commit %H", "--no-prefix"}, walk...)...)
+		plan.steps[len(plan.steps)-1].cmd += " | git patch-id --stable"
+	}
+
+	files := []string{"-c", "log.showRoot=true", "-c", "core.quotePath=off", "log", "--no-walk=unsorted", "--format=%x1e%h", "--no-renames", "--raw"}
+	if o.IgnoreFormatting {
+		files = append(files, whitespaceArgs...)
+	}
+	if o.MergeDiff != MergeDiffAuto {
+		files = append(files, "--diff-merges="+string(o.MergeDiff))
+	}
+	files = append(files, "<commits>")
+	if len(o.Paths) > 0 {
+		files = append(append(files, "--"), o.Paths...)
+	}
+	add("list the files of the commits", batches(commits), files...)
+	if o.IgnoreFormatting {
+		add("read the Go files changed, to compare them gofmt-formatted", 1, "cat-file", "--batch")
+	}
+	if o.ExcludeMassChanges.Percent > 0 {
+		add("count the files of the tree, for -mass-change-percent", 1, "ls-tree", "-r", "-z", "--name-only", treeRev(o.Ref), "--")
+	}
+	if o.FollowMoves {
+		add("find directory moves", batches(commits), "-c", "core.quotePath=off", "log", "--no-walk=unsorted", "--format=%x1e%h", "-M", "--diff-filter=R", "--name-status", "<commits>")
+	}
+	if o.ChangeIDs {
+		plan.steps = append(plan.steps, planStep{what: "load the change IDs", cmd: "jj log --no-graph -r <commits> -T <template>", runs: batches(commits)})
+	}
+	add("load the commit times, to order the commits", batches(commits), "log", "--no-walk=unsorted", "--format=%h%x00%cD", "<commits>")
+	return plan, nil
+}
+
+func (p *queryPlan) print(w io.Writer) {
+	fmt.Fprintf(w, "walks %d commits with the %s backend", p.commits, p.backend)
+	if p.sampled != p.commits {
+		fmt.Fprintf(w, ", analyzes about %d of them", p.sampled)
+	}
+	fmt.Fprint(w, "\n\n")
+	for i, step := range p.steps {
+		runs := ""
+		if step.runs != 1 {
+			runs = fmt.Sprintf(", %d times", step.runs)
+		}
+		fmt.Fprintf(w, "%d. %s%s\n   %s\n", i+1, step.what, runs, step.cmd)
+	}
+	fmt.Fprintf(w, "\nthen %d filters on every changed file and %d aggregates on the listed files, in gitility\n", p.filters, p.aggregates)
+}
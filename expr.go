@@ -0,0 +1,568 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter expressions are a small, side-effect free language over the fields
+// of a file and its commit:
+//
+//	file.ext == ".go" && !file.path.contains("mock/")
+//	commit.email.endsWith("@example.com") || commit.hasTrailer("Reviewed-by")
+//	commit.author == "alice" && file.dir startsWith "pkg/"
+//
+// Expressions are type checked when compiled, so evaluating one never
+// fails; a filter expression must be boolean.
+
+type exprType int
+
+const (
+	exprString exprType = iota
+	exprNumber
+	exprBool
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprString:
+		return "string"
+	case exprNumber:
+		return "number"
+	default:
+		return "bool"
+	}
+}
+
+type exprNode struct {
+	typ      exprType
+	eval     func(File) interface{}
+	constant bool
+}
+
+type exprVar struct {
+	typ exprType
+	get func(File) interface{}
+}
+
+var exprVars = map[string]exprVar{
+	"file.path": {exprString, func(f File) interface{} { return f.Name() }},
+	"file.name": {exprString, func(f File) interface{} { return path.Base(f.Name()) }},
+	"file.ext":  {exprString, func(f File) interface{} { return path.Ext(f.Name()) }},
+	"file.dir": {exprString, func(f File) interface{} {
+		if dir := path.Dir(f.Name()); dir != "." {
+			return dir + "/"
+		}
+		return ""
+	}},
+	"file.class": {exprString, func(f File) interface{} { return fileClass(f.Name()) }},
+	"file.kind": {exprString, func(f File) interface{} {
+		_, kind := classifyFile(f.Name())
+		return kind
+	}},
+	"file.entry":  {exprString, func(f File) interface{} { return string(f.Kind()) }},
+	"file.depth":  {exprNumber, func(f File) interface{} { return float64(strings.Count(f.Name(), "/")) }},
+	"commit.hash": {exprString, func(f File) interface{} { return f.GetCommit().CommitHash() }},
+	"commit.author": {exprString, func(f File) interface{} {
+		author := commitIdentity(f.GetCommit())
+		if i := strings.LastIndex(author, " <"); i >= 0 {
+			return author[:i]
+		}
+		return author
+	}},
+	"commit.email":    {exprString, func(f File) interface{} { return authorEmail(commitIdentity(f.GetCommit())) }},
+	"commit.identity": {exprString, func(f File) interface{} { return commitIdentity(f.GetCommit()) }},
+	"commit.signed":   {exprBool, func(f File) interface{} { return f.GetCommit().SignatureStatus().Valid() }},
+	"commit.svn":      {exprNumber, func(f File) interface{} { return float64(f.GetCommit().SVN().Revision) }},
+}
+
+// exprFuncs take string arguments: commit.trailer("Key") is the first value
+// of a trailer, or "".
+var exprFuncs = map[string]struct {
+	typ   exprType
+	nargs int
+	call  func(File, []string) interface{}
+}{
+	"commit.trailer": {exprString, 1, func(f File, args []string) interface{} {
+		return f.GetCommit().Trailers().Get(args[0])
+	}},
+	"commit.hasTrailer": {exprBool, 1, func(f File, args []string) interface{} {
+		return len(f.GetCommit().Trailers().Values(args[0])) > 0
+	}},
+}
+
+// Where compiles a filter expression into Filters.
+func Where(expression string) (Filters, error) {
+	return whereVars(expression, nil)
+}
+
+// whereVars is Where with more variables than the file and commit fields,
+// like the metrics alert rules compare.
+func whereVars(expression string, vars map[string]exprVar) (Filters, error) {
+	node, err := compileExpr(expression, vars)
+	if err != nil {
+		return nil, err
+	}
+	if node.typ != exprBool {
+		return nil, fmt.Errorf("expression is a %s, not a bool", node.typ)
+	}
+	return func(file File) bool {
+		return node.eval(file).(bool)
+	}, nil
+}
+
+// whereNeedsTrailers tells whether the expression reads commit trailers,
+// which a walk only loads on demand.
+func whereNeedsTrailers(expression string) bool {
+	return strings.Contains(expression, "commit.trailer") || strings.Contains(expression, "commit.hasTrailer") ||
+		strings.Contains(expression, "commit.svn")
+}
+
+// whereNeedsSignatures tells whether the expression reads signatures.
+func whereNeedsSignatures(expression string) bool {
+	return strings.Contains(expression, "commit.signed")
+}
+
+func compileExpr(expression string, vars map[string]exprVar) (exprNode, error) {
+	tokens, err := tokenizeExpr(expression)
+	if err != nil {
+		return exprNode{}, err
+	}
+	p := &exprParser{tokens: tokens, vars: vars}
+	node, err := p.parseOr()
+	if err != nil {
+		return exprNode{}, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return exprNode{}, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return node, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenizeExpr(s string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0)
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(s) && s[end] != s[i] {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			text := s[i : end+1]
+			if s[i] == '\'' {
+				text = `"` + strings.ReplaceAll(strings.ReplaceAll(text[1:len(text)-1], `\'`, `'`), `"`, `\"`) + `"`
+			}
+			value, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("bad string at %d: %w", i, err)
+			}
+			tokens = append(tokens, exprToken{tokString, value, i})
+			i = end + 1
+		case unicode.IsDigit(c):
+			end := i
+			for end < len(s) && (unicode.IsDigit(rune(s[end])) || s[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, exprToken{tokNumber, s[i:end], i})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(s) && (unicode.IsLetter(rune(s[end])) || unicode.IsDigit(rune(s[end])) || s[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, exprToken{tokIdent, s[i:end], i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "!", "<", ">", "(", ")", ",", "."} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, exprToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, pos: len(s)}), nil
+}
+
+// infixMethods can also be written as operators between two strings.
+var infixMethods = map[string]bool{
+	"contains":   true,
+	"startsWith": true,
+	"endsWith":   true,
+	"matches":    true,
+}
+
+type exprParser struct {
+	tokens []exprToken
+	i      int
+	vars   map[string]exprVar
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *exprParser) isOp(text string) bool {
+	tok := p.peek()
+	return tok.kind == tokOp && tok.text == text
+}
+
+func (p *exprParser) expectOp(text string) error {
+	if tok := p.next(); tok.kind != tokOp || tok.text != text {
+		return p.errorf(tok, "expected %q", text)
+	}
+	return nil
+}
+
+func (p *exprParser) errorf(tok exprToken, format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+	for p.isOp("||") {
+		tok := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return left, p.errorf(tok, "|| needs bool operands")
+		}
+		l, r := left.eval, right.eval
+		left = exprNode{typ: exprBool, eval: func(f File) interface{} { return l(f).(bool) || r(f).(bool) }}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return left, err
+	}
+	for p.isOp("&&") {
+		tok := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return left, p.errorf(tok, "&& needs bool operands")
+		}
+		l, r := left.eval, right.eval
+		left = exprNode{typ: exprBool, eval: func(f File) interface{} { return l(f).(bool) && r(f).(bool) }}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("!") {
+		tok := p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return operand, err
+		}
+		if operand.typ != exprBool {
+			return operand, p.errorf(tok, "! needs a bool operand")
+		}
+		eval := operand.eval
+		return exprNode{typ: exprBool, eval: func(f File) interface{} { return !eval(f).(bool) }}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return left, err
+	}
+	tok := p.peek()
+	if tok.kind == tokIdent && infixMethods[tok.text] {
+		// `file.dir startsWith "pkg/"` reads as file.dir.startsWith("pkg/").
+		p.next()
+		arg, err := p.parsePostfix()
+		if err != nil {
+			return arg, err
+		}
+		if left.typ != exprString {
+			return left, p.errorf(tok, "%s needs a string on its left", tok.text)
+		}
+		return p.applyStringMethod(left, tok, []exprNode{arg})
+	}
+	if tok.kind != tokOp {
+		return left, nil
+	}
+	switch tok.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePostfix()
+	if err != nil {
+		return right, err
+	}
+	if left.typ != right.typ {
+		return left, p.errorf(tok, "cannot compare %s with %s", left.typ, right.typ)
+	}
+	if left.typ == exprBool && tok.text != "==" && tok.text != "!=" {
+		return left, p.errorf(tok, "%s needs string or number operands", tok.text)
+	}
+
+	l, r, op := left.eval, right.eval, tok.text
+	return exprNode{typ: exprBool, eval: func(f File) interface{} {
+		a, b := l(f), r(f)
+		switch op {
+		case "==":
+			return a == b
+		case "!=":
+			return a != b
+		}
+		cmp := 0
+		if x, ok := a.(float64); ok {
+			y := b.(float64)
+			if x < y {
+				cmp = -1
+			} else if x > y {
+				cmp = 1
+			}
+		} else {
+			cmp = strings.Compare(a.(string), b.(string))
+		}
+		switch op {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		default:
+			return cmp >= 0
+		}
+	}}, nil
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return node, err
+	}
+	for p.isOp(".") {
+		p.next()
+		tok := p.next()
+		if tok.kind != tokIdent {
+			return node, p.errorf(tok, "expected a method name")
+		}
+		if node, err = p.parseMethod(node, tok); err != nil {
+			return node, err
+		}
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseArgs() ([]exprNode, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	args := make([]exprNode, 0)
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err := p.expectOp(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	return args, nil
+}
+
+// stringMethod builds a boolean method over two strings.
+func stringMethod(recv, arg exprNode, fn func(s, arg string) bool) exprNode {
+	r, a := recv.eval, arg.eval
+	return exprNode{typ: exprBool, eval: func(f File) interface{} { return fn(r(f).(string), a(f).(string)) }}
+}
+
+func (p *exprParser) parseMethod(recv exprNode, name exprToken) (exprNode, error) {
+	args, err := p.parseArgs()
+	if err != nil {
+		return recv, err
+	}
+	if recv.typ != exprString {
+		return recv, p.errorf(name, "%s has no method %s", recv.typ, name.text)
+	}
+	return p.applyStringMethod(recv, name, args)
+}
+
+func (p *exprParser) applyStringMethod(recv exprNode, name exprToken, args []exprNode) (exprNode, error) {
+	switch name.text {
+	case "lower", "upper":
+		if len(args) != 0 {
+			return recv, p.errorf(name, "%s takes no argument", name.text)
+		}
+		fn := strings.ToLower
+		if name.text == "upper" {
+			fn = strings.ToUpper
+		}
+		r := recv.eval
+		return exprNode{typ: exprString, eval: func(f File) interface{} { return fn(r(f).(string)) }}, nil
+	case "contains", "startsWith", "endsWith", "matches":
+	default:
+		return recv, p.errorf(name, "unknown method %s", name.text)
+	}
+
+	if len(args) != 1 || args[0].typ != exprString {
+		return recv, p.errorf(name, "%s takes one string argument", name.text)
+	}
+	switch name.text {
+	case "contains":
+		return stringMethod(recv, args[0], strings.Contains), nil
+	case "startsWith":
+		return stringMethod(recv, args[0], strings.HasPrefix), nil
+	case "endsWith":
+		return stringMethod(recv, args[0], strings.HasSuffix), nil
+	}
+
+	// Patterns are compiled once; one that is not a literal is compiled on
+	// every evaluation and never matches when invalid.
+	if pattern, ok := args[0].literal(); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return recv, p.errorf(name, "bad pattern: %v", err)
+		}
+		r := recv.eval
+		return exprNode{typ: exprBool, eval: func(f File) interface{} { return re.MatchString(r(f).(string)) }}, nil
+	}
+	return stringMethod(recv, args[0], func(s, pattern string) bool {
+		re, err := regexp.Compile(pattern)
+		return err == nil && re.MatchString(s)
+	}), nil
+}
+
+// literal returns the value of a constant string node.
+func (n exprNode) literal() (string, bool) {
+	if !n.constant || n.typ != exprString {
+		return "", false
+	}
+	value, ok := n.eval(nil).(string)
+	return value, ok
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		value := tok.text
+		return exprNode{typ: exprString, eval: func(File) interface{} { return value }, constant: true}, nil
+	case tokNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return exprNode{}, p.errorf(tok, "bad number %s", tok.text)
+		}
+		return exprNode{typ: exprNumber, eval: func(File) interface{} { return value }}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			value := tok.text == "true"
+			return exprNode{typ: exprBool, eval: func(File) interface{} { return value }}, nil
+		}
+		return p.parseName(tok)
+	case tokOp:
+		if tok.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return node, err
+			}
+			return node, p.expectOp(")")
+		}
+	}
+	return exprNode{}, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+// parseName resolves a dotted field or function name such as file.path or
+// commit.trailer, leaving any method calls that follow to parsePostfix.
+func (p *exprParser) parseName(first exprToken) (exprNode, error) {
+	name := first.text
+	for {
+		if v, ok := p.vars[name]; ok {
+			return exprNode{typ: v.typ, eval: v.get}, nil
+		}
+		if v, ok := exprVars[name]; ok {
+			return exprNode{typ: v.typ, eval: v.get}, nil
+		}
+		if fn, ok := exprFuncs[name]; ok {
+			args, err := p.parseArgs()
+			if err != nil {
+				return exprNode{}, err
+			}
+			if len(args) != fn.nargs {
+				return exprNode{}, p.errorf(first, "%s takes %d argument(s)", name, fn.nargs)
+			}
+			values := make([]string, 0, len(args))
+			for _, arg := range args {
+				value, ok := arg.literal()
+				if !ok {
+					return exprNode{}, p.errorf(first, "%s takes string literals", name)
+				}
+				values = append(values, value)
+			}
+			call := fn.call
+			return exprNode{typ: fn.typ, eval: func(f File) interface{} { return call(f, values) }}, nil
+		}
+		if !p.isOp(".") || p.tokens[p.i+1].kind != tokIdent {
+			return exprNode{}, p.errorf(first, "unknown name %s", name)
+		}
+		p.next()
+		name += "." + p.next().text
+	}
+}
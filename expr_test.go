@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWhere(t *testing.T) {
+	file := NewFile(&commitObj{
+		commitHash: "abc1234",
+		author:     "Alice <alice@example.com>",
+		trailers:   parseTrailers("Reviewed-by: bob"),
+	}, "pkg/api/server.go")
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{`file.ext == ".go"`, true},
+		{`file.ext != ".go"`, false},
+		{`file.name == "server.go" && file.dir == "pkg/api/"`, true},
+		{`file.path.contains("api/")`, true},
+		{`file.path contains "api/"`, true},
+		{`file.dir startsWith "pkg/"`, true},
+		{`file.path endsWith "_test.go"`, false},
+		{`file.path matches "^pkg/[a-z]+/"`, true},
+		{`file.path.matches(file.name)`, true},
+		{`file.path.upper().startsWith("PKG/")`, true},
+		{`file.depth == 2 && file.depth < 3 && file.depth >= 2`, true},
+		{`file.name > "a" && file.name <= "server.go"`, true},
+		{`commit.author == "Alice"`, true},
+		{`commit.email.endsWith("@example.com")`, true},
+		{`commit.identity == "Alice <alice@example.com>"`, true},
+		{`commit.hasTrailer("Reviewed-by") && commit.trailer("Reviewed-by") == 'bob'`, true},
+		{`commit.hasTrailer("Signed-off-by")`, false},
+		{`!(file.ext == ".go") || commit.hash == "abc1234"`, true},
+		{`!!true && (false || file.ext == ".go")`, true},
+		{`file.ext == ".md" || file.ext == ".txt"`, false},
+		{`"it's" == 'it\'s'`, true},
+	}
+	for _, test := range tests {
+		filter, err := Where(test.expression)
+		if err != nil {
+			t.Errorf("Where(%s): %v", test.expression, err)
+			continue
+		}
+		if got := filter(file); got != test.want {
+			t.Errorf("Where(%s) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestWhereErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{`file.path`, "expression is a string, not a bool"},
+		{`file.depth`, "expression is a number, not a bool"},
+		{`file.ext == 1`, "cannot compare string with number"},
+		{`true < false`, "< needs string or number operands"},
+		{`file.ext && true`, "&& needs bool operands"},
+		{`true || file.depth`, "|| needs bool operands"},
+		{`!file.ext`, "! needs a bool operand"},
+		{`file.depth contains "1"`, "contains needs a string on its left"},
+		{`file.depth.lower() == "1"`, "number has no method lower"},
+		{`file.path.contains(1)`, "contains takes one string argument"},
+		{`file.path.lower("x") == "x"`, "lower takes no argument"},
+		{`file.path.size() == 1`, "unknown method size"},
+		{`file.path matches "("`, "bad pattern"},
+		{`commit.trailer(file.name) == ""`, "commit.trailer takes string literals"},
+		{`commit.hasTrailer()`, "commit.hasTrailer takes 1 argument(s)"},
+		{`file.size == 1`, "unknown name file.size"},
+		{`file.ext == ".go" )`, `unexpected ")"`},
+		{`(file.ext == ".go"`, `expected ")"`},
+		{`file.ext == ".go`, "unterminated string"},
+		{`file.ext = ".go"`, `unexpected '='`},
+	}
+	for _, test := range tests {
+		_, err := Where(test.expression)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Where(%s) = %v, want an error with %q", test.expression, err, test.err)
+		}
+	}
+}
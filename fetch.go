@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// fetchRemotes brings the remote-tracking refs up to date before an
+// analysis.
+func fetchRemotes(ctx context.Context, remotes []string, token string) error {
+	args := []string{"fetch", "--quiet", "--prune"}
+	if len(remotes) == 0 {
+		args = append(args, "--all")
+	} else {
+		args = append(args, "--multiple", "--")
+		args = append(args, remotes...)
+	}
+
+	// -fetch asks for the remote-tracking refs to be written.
+	_, err := runGitWithEnv(allowGitWrites(ctx), remoteEnv(token), args...)
+	return remoteError("git fetch "+remoteNames(remotes), err)
+}
+
+func remoteNames(remotes []string) string {
+	if len(remotes) == 0 {
+		return "all remotes"
+	}
+	return strings.Join(remotes, ", ")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FileKind is the kind of tree entry a listed file is: a regular file, a
+// symbolic link, or a submodule, which git records as a gitlink pointing at
+// a commit of another repository. git lists the latter two like files.
+type FileKind string
+
+const (
+	FileKindRegular   FileKind = "file"
+	FileKindSymlink   FileKind = "symlink"
+	FileKindSubmodule FileKind = "submodule"
+)
+
+// fileKinds are the kinds -exclude-kind takes.
+var fileKinds = []FileKind{FileKindRegular, FileKindSymlink, FileKindSubmodule}
+
+// kindOfMode is the kind of an entry of the git mode.
+func kindOfMode(mode string) FileKind {
+	switch mode {
+	case "120000":
+		return FileKindSymlink
+	case "160000":
+		return FileKindSubmodule
+	}
+	return FileKindRegular
+}
+
+// parseRawLine reads a --raw line, ":old new oldhash newhash status\tname",
+// or with one mode and hash per parent and the result's after them for
+// combined merge diffs, "::p1 p2 new ...". Deleted entries keep the kind
+// they had.
+func parseRawLine(line string) (name string, kind FileKind, ok bool) {
+	meta, name, ok := strings.Cut(line, "\t")
+	if !ok || !strings.HasPrefix(meta, ":") {
+		return "", "", false
+	}
+	parents := len(meta) - len(strings.TrimLeft(meta, ":"))
+	modes := strings.Fields(meta[parents:])
+	if len(modes) <= parents {
+		return "", "", false
+	}
+	mode := modes[parents]
+	if mode == "000000" {
+		mode = modes[0]
+	}
+	return unquoteGitName(name), kindOfMode(mode), true
+}
+
+// parseFileKinds reads a comma-separated list of kinds.
+func parseFileKinds(spec string) ([]FileKind, error) {
+	kinds := make([]FileKind, 0)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, kind := range fileKinds {
+			known = known || FileKind(name) == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown file kind %q, want file, symlink or submodule", name)
+		}
+		kinds = append(kinds, FileKind(name))
+	}
+	return kinds, nil
+}
+
+// ExcludeKinds drops the files of the kinds, like symbolic links to shared
+// configuration or submodule pointer bumps.
+func ExcludeKinds(kinds ...FileKind) Filters {
+	return func(file File) bool {
+		for _, kind := range kinds {
+			if file.Kind() == kind {
+				return false
+			}
+		}
+		return true
+	}
+}
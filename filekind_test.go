@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestParseRawLine(t *testing.T) {
+	tests := []struct {
+		line string
+		name string
+		kind FileKind
+		ok   bool
+	}{
+		{":100644 100644 1111111 2222222 M\tpkg/a.go", "pkg/a.go", FileKindRegular, true},
+		{":000000 120000 0000000 2222222 A\tlink", "link", FileKindSymlink, true},
+		{":160000 000000 1111111 0000000 D\tvendor/lib", "vendor/lib", FileKindSubmodule, true},
+		{"::100644 100644 100644 1111111 2222222 3333333 MM\tmerged.go", "merged.go", FileKindRegular, true},
+		{":100644 100644 1111111 2222222 M\t\"caf\\303\\251.go\"", "café.go", FileKindRegular, true},
+		{":100644\tshort.go", "", "", false},
+		{"100644 100644 1111111 2222222 M\tno-colon.go", "", "", false},
+		{":100644 100644 1111111 2222222 M", "", "", false},
+	}
+	for _, test := range tests {
+		name, kind, ok := parseRawLine(test.line)
+		if name != test.name || kind != test.kind || ok != test.ok {
+			t.Errorf("parseRawLine(%q) = %q, %q, %v, want %q, %q, %v", test.line, name, kind, ok, test.name, test.kind, test.ok)
+		}
+	}
+}
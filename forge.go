@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const defaultForgeAPI = "https://api.github.com"
+
+type forgeRepo struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+	Archived bool   `json:"archived"`
+	Fork     bool   `json:"fork"`
+}
+
+// forgeClient talks to the GitHub REST API, or a GitHub Enterprise server
+// when api points at one.
+type forgeClient struct {
+	api   string
+	token string
+	http  *http.Client
+}
+
+func newForgeClient(api string, token string) *forgeClient {
+	if api == "" {
+		api = defaultForgeAPI
+	}
+	return &forgeClient{api: strings.TrimRight(api, "/"), token: token, http: http.DefaultClient}
+}
+
+// errLastPage stops get from fetching further pages.
+var errLastPage = errors.New("last page")
+
+var nextLinkPattern = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// get decodes every page of a paginated endpoint into pages, following the
+// Link headers, until page returns errLastPage.
+func (c *forgeClient) get(ctx context.Context, path string, page func(json.RawMessage) error) error {
+	url := c.api + path
+	for url != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+
+		var body json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		if err != nil {
+			return err
+		}
+		if err := page(body); errors.Is(err, errLastPage) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		url = ""
+		if m := nextLinkPattern.FindStringSubmatch(resp.Header.Get("Link")); m != nil {
+			url = m[1]
+		}
+	}
+	return nil
+}
+
+// send makes a write request with in as the JSON body, and decodes the
+// response into out unless it is nil.
+func (c *forgeClient) send(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.api+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, c.api+path, resp.Status, bytes.TrimSpace(detail))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *forgeClient) orgRepos(ctx context.Context, org string) ([]forgeRepo, error) {
+	repos := make([]forgeRepo, 0)
+	err := c.get(ctx, "/orgs/"+org+"/repos?per_page=100&type=all", func(body json.RawMessage) error {
+		page := make([]forgeRepo, 0)
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		repos = append(repos, page...)
+		return nil
+	})
+	return repos, err
+}
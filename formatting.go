@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// A commit that only reformats a file, changing its whitespace or, for Go,
+// nothing gofmt would not undo, leaves the file out of its changes under
+// IgnoreFormatting: a repository-wide gofmt run then makes no hotspot.
+
+// filesMode is how the files of a commit are listed.
+type filesMode struct {
+	mergeDiff        MergeDiff
+	ignoreFormatting bool
+	paths            string
+}
+
+// pathsKey joins pathspecs into a comparable filesMode.paths.
+func pathsKey(paths []string) string {
+	return strings.Join(paths, "\x00")
+}
+
+// pathspecArgs end the arguments of a command listing files with the
+// pathspecs of the mode.
+func (m filesMode) pathspecArgs() []string {
+	if m.paths == "" {
+		return nil
+	}
+	return append([]string{"--"}, strings.Split(m.paths, "\x00")...)
+}
+
+// whitespaceArgs join --raw in the git commands listing the files of
+// commits ignoring formatting: --numstat with -w leaves out the files whose
+// changes are all whitespace, the --raw lines only give the kinds.
+var whitespaceArgs = []string{"-w", "--numstat"}
+
+// numstatName reads the file name of a --numstat line.
+func numstatName(line string) string {
+	fields := strings.SplitN(line, "\t", 3)
+	if len(fields) != 3 {
+		return ""
+	}
+	return unquoteGitName(fields[2])
+}
+
+// dropGofmtChanges removes from the files of the commits, by commit hash,
+// the Go files whose old and new contents gofmt formats the same, reading
+// both with one git cat-file for all the commits.
+func dropGofmtChanges(ctx context.Context, names map[string][]string) error {
+	objects := make([]string, 0)
+	for hash, files := range names {
+		for _, name := range files {
+			if path.Ext(name) == ".go" {
+				objects = append(objects, hash+"^:"+name, hash+":"+name)
+			}
+		}
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	blobs, err := catFileBatch(ctx, objects)
+	if err != nil {
+		return err
+	}
+
+	for hash, files := range names {
+		kept := files[:0]
+		for _, name := range files {
+			if path.Ext(name) != ".go" || !sameGofmt(blobs[hash+"^:"+name], blobs[hash+":"+name]) {
+				kept = append(kept, name)
+			}
+		}
+		names[hash] = kept
+	}
+	return nil
+}
+
+// sameGofmt tells whether the two versions of a Go file, both present and
+// valid Go, format the same.
+func sameGofmt(old, new []byte) bool {
+	if old == nil || new == nil {
+		return false
+	}
+	a, err := format.Source(old)
+	if err != nil {
+		return false
+	}
+	b, err := format.Source(new)
+	return err == nil && bytes.Equal(a, b)
+}
+
+// catFileBatch reads the blobs named rev:path; missing ones are left out.
+func catFileBatch(ctx context.Context, objects []string) (map[string][]byte, error) {
+	ctx, span := startSpan(ctx, "git cat-file")
+	defer span.End()
+	span.SetAttr("gitility.objects", len(objects))
+
+	cmd, cancel, err := gitCommand(ctx, nil, "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	cmd.Stdin = strings.NewReader(strings.Join(objects, "\n") + "\n")
+	output, err := cmd.Output()
+	if err != nil {
+		span.SetError(err)
+		return nil, fmt.Errorf("git cat-file: %w", err)
+	}
+
+	blobs := make(map[string][]byte, len(objects))
+	r := bufio.NewReader(bytes.NewReader(output))
+	for _, object := range objects {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: short output for %s", object)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			// <object> missing, or ambiguous.
+			continue
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: bad header %q", header)
+		}
+		data := make([]byte, size+1)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("git cat-file: short output for %s", object)
+		}
+		if fields[1] == "blob" {
+			blobs[object] = data[:size]
+		}
+	}
+	return blobs, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Changes land either in the code people write or in code they do not:
+// generated code, which a tool writes from another source, and vendored
+// code, copied in from elsewhere.
+
+const (
+	originHandwritten = "handwritten"
+	originGenerated   = "generated"
+	originVendored    = "vendored"
+)
+
+// pathOrigin tells generated and vendored files from their path alone.
+func pathOrigin(name string) string {
+	dirs := strings.Split(path.Dir(name), "/")
+	if hasDir(dirs, "vendor", "third_party", "node_modules", "bower_components") {
+		return originVendored
+	}
+	base := path.Base(name)
+	switch {
+	case strings.Contains(base, ".pb."), strings.HasSuffix(base, "_pb2.py"),
+		strings.HasSuffix(base, "_gen.go"), strings.HasSuffix(base, ".gen.go"), strings.HasPrefix(base, "zz_generated"),
+		strings.HasPrefix(base, "mock_") || strings.HasSuffix(base, "_mock.go"),
+		strings.HasSuffix(base, ".min.js"), strings.HasSuffix(base, ".min.css"), strings.HasSuffix(base, ".map"),
+		base == "go.sum", base == "package-lock.json", base == "yarn.lock", base == "pnpm-lock.yaml",
+		base == "Cargo.lock", base == "poetry.lock", base == "Gemfile.lock", base == "composer.lock":
+		return originGenerated
+	}
+	if hasDir(dirs, "generated", "mocks", "dist") {
+		return originGenerated
+	}
+	return originHandwritten
+}
+
+// gitattrOrigins reads the linguist-generated and linguist-vendored
+// attributes of the files from .gitattributes, which win over their path.
+func gitattrOrigins(ctx context.Context, names []string) (map[string]string, error) {
+	origins := make(map[string]string)
+	if len(names) == 0 {
+		return origins, nil
+	}
+	ctx, span := startSpan(ctx, "git check-attr")
+	defer span.End()
+
+	cmd, cancel, err := gitCommand(ctx, nil, "check-attr", "--stdin", "-z", "linguist-generated", "linguist-vendored")
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	cmd.Stdin = strings.NewReader(strings.Join(names, "\x00") + "\x00")
+	output, err := cmd.Output()
+	if err != nil {
+		span.SetError(err)
+		return nil, fmt.Errorf("git check-attr: %w", err)
+	}
+	fields := bytes.Split(output, []byte{0})
+	for i := 0; i+2 < len(fields); i += 3 {
+		name, attr, value := string(fields[i]), string(fields[i+1]), string(fields[i+2])
+		switch {
+		case value == "set" || value == "true":
+			if attr == "linguist-vendored" {
+				origins[name] = originVendored
+			} else if origins[name] == "" {
+				origins[name] = originGenerated
+			}
+		case value == "unset" || value == "false":
+			if origins[name] == "" {
+				origins[name] = originHandwritten
+			}
+		}
+	}
+	return origins, nil
+}
+
+// originPeriod is the churn of a period split by origin.
+type originPeriod struct {
+	Start       time.Time `json:"start"`
+	Handwritten int       `json:"handwritten"`
+	Generated   int       `json:"generated"`
+	Vendored    int       `json:"vendored"`
+}
+
+// Share is the part of the changes that landed in generated or vendored
+// code.
+func (p *originPeriod) Share() float64 {
+	total := p.Handwritten + p.Generated + p.Vendored
+	if total == 0 {
+		return 0
+	}
+	return float64(p.Generated+p.Vendored) / float64(total)
+}
+
+// periodStart is the start of the week, a Monday, or month of t, in UTC.
+func periodStart(t time.Time, period string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if period == "week" {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day.AddDate(0, 0, 1-day.Day())
+}
+
+func collectOriginChurn(ctx context.Context, q *query, period string) ([]*originPeriod, error) {
+	commits, err := q.backend.commits(ctx, q.opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := Preload(ctx, commits, CommitFieldFiles, CommitFieldTime); err != nil {
+		return nil, err
+	}
+
+	filters := q.anyFileFilters()
+	changes := make([]File, 0)
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !satisfyFilters(file, filters) {
+				continue
+			}
+			changes = append(changes, file)
+			if !seen[file.Name()] {
+				seen[file.Name()] = true
+				names = append(names, file.Name())
+			}
+		}
+	}
+	attrs := make(map[string]string)
+	if q.backend.marker == gitBackend.marker {
+		if attrs, err = gitattrOrigins(ctx, names); err != nil {
+			return nil, err
+		}
+	}
+
+	periods := make(map[time.Time]*originPeriod)
+	for _, file := range changes {
+		commitTime, err := file.GetCommit().CommitTime(ctx)
+		if err != nil {
+			return nil, err
+		}
+		start := periodStart(commitTime, period)
+		p, ok := periods[start]
+		if !ok {
+			p = &originPeriod{Start: start}
+			periods[start] = p
+		}
+		origin := attrs[file.Name()]
+		if origin == "" {
+			origin = pathOrigin(file.Name())
+		}
+		switch origin {
+		case originGenerated:
+			p.Generated++
+		case originVendored:
+			p.Vendored++
+		default:
+			p.Handwritten++
+		}
+	}
+
+	res := make([]*originPeriod, 0, len(periods))
+	for _, p := range periods {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Start.Before(res[j].Start) })
+	return res, q.err()
+}
+
+func runGenerated(args []string) error {
+	flags := flag.NewFlagSet("generated", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	period := flags.String("period", "month", "split the churn by `period`: week or month")
+	asJSON := flags.Bool("json", false, "print a JSON array of periods")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if *period != "week" && *period != "month" {
+		return fmt.Errorf("unknown -period %q, want week or month", *period)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	periods, err := collectOriginChurn(ctx, q, *period)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		type periodJSON struct {
+			*originPeriod
+			Share float64 `json:"share"`
+		}
+		out := make([]periodJSON, 0, len(periods))
+		for _, p := range periods {
+			out = append(out, periodJSON{p, p.Share()})
+		}
+		return printJSON(out)
+	}
+	if len(periods) == 0 {
+		return errors.New("no file changed in the walked commits")
+	}
+	total := &originPeriod{}
+	fmt.Printf("%-10s %11s %9s %8s %7s\n", "period", "handwritten", "generated", "vendored", "share")
+	for _, p := range periods {
+		fmt.Printf("%-10s %11d %9d %8d %6.1f%%\n", p.Start.Format("2006-01-02"), p.Handwritten, p.Generated, p.Vendored, 100*p.Share())
+		total.Handwritten += p.Handwritten
+		total.Generated += p.Generated
+		total.Vendored += p.Vendored
+	}
+	fmt.Printf("%-10s %11d %9d %8d %6.1f%%\n", "total", total.Handwritten, total.Generated, total.Vendored, 100*total.Share())
+	return nil
+}
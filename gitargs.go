@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Revisions, remote names and URLs come from flags, arguments, files and
+// API requests, and end up as git arguments. git reads any argument
+// starting with a dash as an option wherever it is: -ref=--output=x would
+// have git log write a file. Paths go after a "--", which ends the options,
+// but revisions come before it, so they are checked instead.
+
+// checkRevision rejects a revision, or a side of a range, git would read
+// as an option, and the line breaks that would split the output read
+// back.
+func checkRevision(rev string) error {
+	for _, r := range rev {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("revision %q: control characters are not allowed", rev)
+		}
+	}
+	for _, part := range strings.Split(strings.ReplaceAll(rev, "...", ".."), "..") {
+		if strings.HasPrefix(part, "-") {
+			return fmt.Errorf("revision %q: must not start with a dash", rev)
+		}
+	}
+	return nil
+}
+
+// checkRemote rejects a remote name git would read as an option.
+func checkRemote(name string) error {
+	if strings.HasPrefix(name, "-") || name == "" {
+		return fmt.Errorf("remote %q: must be a name, not start with a dash", name)
+	}
+	return nil
+}
+
+// unsafeTransports run commands or use file descriptors instead of
+// fetching: git-remote-ext runs the command in the URL.
+var unsafeTransports = []string{"ext::", "fd::"}
+
+// checkRemoteURL rejects a URL git would read as an option or that names
+// an unsafe transport.
+func checkRemoteURL(url string) error {
+	if strings.HasPrefix(url, "-") {
+		return fmt.Errorf("remote %q: must not start with a dash", url)
+	}
+	for _, transport := range unsafeTransports {
+		if strings.HasPrefix(strings.ToLower(url), transport) {
+			return fmt.Errorf("remote %q: the %s transport is not allowed", url, strings.TrimSuffix(transport, "::"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRevision(t *testing.T) {
+	tests := []struct {
+		rev string
+		ok  bool
+	}{
+		{"", true},
+		{"HEAD", true},
+		{"main~3", true},
+		{"v1.0..HEAD", true},
+		{"main...feature", true},
+		{"refs/heads/x-y", true},
+		{"-n", false},
+		{"--output=/tmp/x", false},
+		{"a..-b", false},
+		{"a...--all", false},
+		{"-a..b", false},
+		{"main\nHEAD", false},
+		{"main\x00", false},
+		{"main\x1b[31m", false},
+	}
+	for _, test := range tests {
+		err := checkRevision(test.rev)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("checkRevision(%q) = %v, want ok %v", test.rev, err, test.ok)
+		}
+	}
+}
+
+func TestCheckRemote(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"origin", true},
+		{"up-stream", true},
+		{"", false},
+		{"-v", false},
+		{"--upload-pack=touch x", false},
+	}
+	for _, test := range tests {
+		err := checkRemote(test.name)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("checkRemote(%q) = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestCheckRemoteURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://github.com/example/api", true},
+		{"git@github.com:example/api.git", true},
+		{"/srv/git/api", true},
+		{"-u", false},
+		{"--upload-pack=touch x", false},
+		{"ext::sh -c touch% x", false},
+		{"EXT::sh -c touch% x", false},
+		{"fd::3", false},
+	}
+	for _, test := range tests {
+		err := checkRemoteURL(test.url)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("checkRemoteURL(%q) = %v, want ok %v", test.url, err, test.ok)
+		}
+	}
+}
+
+// TestCloneRemoteEndsOptions clones a repository whose path starts with a
+// dash: git only reads it as the repository after the "--".
+func TestCloneRemoteEndsOptions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	source := filepath.Join(dir, "-repo")
+	for _, args := range [][]string{
+		{"init", "--quiet", source},
+		{"-C", source, "-c", "user.name=a", "-c", "user.email=a@example.com", "commit", "--quiet", "--allow-empty", "-m", "first"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %q: %v: %s", args, err, output)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	clone, cleanup, err := cloneRemote(context.Background(), "-repo", cloneOptions{})
+	if err != nil {
+		t.Fatalf("cloneRemote: %v", err)
+	}
+	defer cleanup()
+	if _, err := os.Stat(filepath.Join(clone, "HEAD")); err != nil {
+		t.Errorf("the clone has no HEAD: %v", err)
+	}
+}
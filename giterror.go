@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// debugEnv turns on logging every failed git command with its arguments
+// and the whole of its standard error.
+const debugEnv = "GITILITY_DEBUG"
+
+// gitError is the failure of a git command, with what git said about it
+// on standard error. It unwraps to the *exec.ExitError.
+type gitError struct {
+	args   []string
+	stderr string
+	err    error
+}
+
+func newGitError(args []string, stderr []byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &gitError{args: args, stderr: strings.TrimSpace(string(stderr)), err: err}
+	if os.Getenv(debugEnv) != "" {
+		log.Printf("git %s: %v\n%s", strings.Join(args, " "), err, e.stderr)
+	}
+	return e
+}
+
+func (e *gitError) Error() string {
+	msg := e.summary()
+	if msg == "" {
+		msg = e.err.Error()
+	}
+	return "git " + gitSubcommand(e.args) + ": " + msg
+}
+
+// gitSubcommand is the command of git arguments, past the global options
+// like -c key=value.
+func gitSubcommand(args []string) string {
+	if i := gitSubcommandIndex(args); i >= 0 {
+		return args[i]
+	}
+	return strings.Join(args, " ")
+}
+
+// gitSubcommandIndex is the index of the command in git arguments, -1 when
+// there are only global options.
+func gitSubcommandIndex(args []string) int {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-c" || args[i] == "-C":
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *gitError) Unwrap() error {
+	return e.err
+}
+
+// summary is the last fatal or error line of stderr, which names the
+// cause, without its prefix; hints and warnings before it are left out.
+func (e *gitError) summary() string {
+	lines := strings.Split(e.stderr, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		for _, prefix := range []string{"fatal: ", "error: "} {
+			if strings.HasPrefix(line, prefix) {
+				return strings.TrimPrefix(line, prefix)
+			}
+		}
+	}
+	if len(lines) > 0 {
+		return strings.TrimSpace(lines[len(lines)-1])
+	}
+	return ""
+}
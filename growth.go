@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The growth report tells which parts of the codebase grow fastest: it
+// counts the tracked files and their lines per directory, the top-level
+// ones by default, at points sampled every -step back from the tip, and
+// ranks the directories by the lines they gained from the oldest point to
+// the newest. Every blob is read once, however many points share it.
+
+// growthPoint is a sampled commit: the last first-parent commit at a time.
+type growthPoint struct {
+	Commit string    `json:"commit"`
+	Time   time.Time `json:"time"`
+}
+
+type dirGrowth struct {
+	Dir string `json:"dir"`
+	// Files and Lines are counted at every point, oldest first.
+	Files []int `json:"files"`
+	Lines []int `json:"lines"`
+	// FileGrowth and LineGrowth are the differences between the newest
+	// point and the oldest, Percent the line growth relative to the oldest,
+	// 0 for a directory New since, and PerMonth the line growth per month.
+	FileGrowth int     `json:"file_growth"`
+	LineGrowth int     `json:"line_growth"`
+	Percent    float64 `json:"percent"`
+	New        bool    `json:"new,omitempty"`
+	PerMonth   float64 `json:"per_month"`
+}
+
+type growthReport struct {
+	Points []growthPoint `json:"points"`
+	Total  *dirGrowth    `json:"total"`
+	Dirs   []*dirGrowth  `json:"dirs"`
+}
+
+// growthDir is the directory name counts under: its first depth
+// components, "." for the files at the root.
+func growthDir(name string, depth int) string {
+	parts := strings.Split(name, "/")
+	if len(parts) == 1 {
+		return "."
+	}
+	if len(parts)-1 > depth {
+		parts = parts[:depth+1]
+	}
+	return strings.Join(parts[:len(parts)-1], "/")
+}
+
+// blobLines counts the lines of a blob, none for a binary one.
+func blobLines(data []byte) int {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return 0
+	}
+	n := bytes.Count(data, []byte{'\n'})
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// samplePoints samples the first-parent history of rev every step back
+// from its tip, at most n points, oldest first. The points before the
+// first commit are left out, and a commit sampled twice counts once.
+func samplePoints(ctx context.Context, rev string, n int, step string) ([]growthPoint, error) {
+	output, err := runGit(ctx, "log", "-1", "--format=%ct", rev)
+	if err != nil {
+		return nil, err
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad commit time %q", strings.TrimSpace(string(output)))
+	}
+	points := make([]growthPoint, 0, n)
+	seen := make(map[string]bool)
+	for t := time.Unix(seconds, 0); len(points) < n; {
+		commit, err := cmdRevBefore(ctx, rev, t)
+		if err != nil {
+			return nil, err
+		}
+		if commit == "" {
+			break
+		}
+		if !seen[commit] {
+			seen[commit] = true
+			points = append(points, growthPoint{Commit: commit, Time: t})
+		}
+		next, err := ageCutoff(t, step)
+		if err != nil {
+			return nil, fmt.Errorf("-step: %w", err)
+		}
+		if !next.Before(t) {
+			return nil, fmt.Errorf("-step %s: must be positive", step)
+		}
+		t = next
+	}
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	return points, nil
+}
+
+// collectGrowth counts the files the query keeps and their lines per
+// directory at every point.
+func collectGrowth(ctx context.Context, q *query, points []growthPoint, depth int) (*growthReport, error) {
+	filters := q.anyFileFilters()
+	res := &growthReport{Points: points, Total: &dirGrowth{Dir: "total", Files: make([]int, len(points)), Lines: make([]int, len(points))}}
+	dirs := make(map[string]*dirGrowth)
+	// lines counts the lines of every blob read so far.
+	lines := make(map[string]int)
+	for i, point := range points {
+		output, err := runGit(ctx, "-c", "core.quotePath=off", "ls-tree", "-r", "-z", "--full-tree", point.Commit)
+		if err != nil {
+			return nil, err
+		}
+		commit := &commitObj{commitHash: point.Commit, commitTime: point.Time}
+		blobs := make(map[string]string)
+		for _, entry := range strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+			// <mode> SP <type> SP <object> TAB <file>
+			meta, name, ok := strings.Cut(entry, "\t")
+			fields := strings.Fields(meta)
+			if !ok || len(fields) != 3 || fields[1] != "blob" {
+				continue
+			}
+			if satisfyFilters(NewFile(commit, name), filters) {
+				blobs[name] = fields[2]
+			}
+		}
+
+		missing := make([]string, 0)
+		for _, object := range blobs {
+			if _, ok := lines[object]; !ok {
+				lines[object] = 0
+				missing = append(missing, object)
+			}
+		}
+		for len(missing) > 0 {
+			n := len(missing)
+			if n > preloadBatch {
+				n = preloadBatch
+			}
+			contents, err := catFileBatch(ctx, missing[:n])
+			if err != nil {
+				return nil, err
+			}
+			for object, data := range contents {
+				lines[object] = blobLines(data)
+			}
+			missing = missing[n:]
+		}
+
+		for name, object := range blobs {
+			dir := growthDir(name, depth)
+			g, ok := dirs[dir]
+			if !ok {
+				g = &dirGrowth{Dir: dir, Files: make([]int, len(points)), Lines: make([]int, len(points))}
+				dirs[dir] = g
+				res.Dirs = append(res.Dirs, g)
+			}
+			g.Files[i]++
+			g.Lines[i] += lines[object]
+			res.Total.Files[i]++
+			res.Total.Lines[i] += lines[object]
+		}
+	}
+
+	months := points[len(points)-1].Time.Sub(points[0].Time).Hours() / 24 / 30.44
+	for _, g := range append(res.Dirs, res.Total) {
+		first, last := 0, len(points)-1
+		g.FileGrowth = g.Files[last] - g.Files[first]
+		g.LineGrowth = g.Lines[last] - g.Lines[first]
+		if g.Files[first] == 0 {
+			g.New = true
+		} else {
+			g.Percent = percent(g.LineGrowth, g.Lines[first])
+		}
+		if months > 0 {
+			g.PerMonth = float64(g.LineGrowth) / months
+		}
+	}
+	sort.Slice(res.Dirs, func(i, j int) bool {
+		if res.Dirs[i].LineGrowth != res.Dirs[j].LineGrowth {
+			return res.Dirs[i].LineGrowth > res.Dirs[j].LineGrowth
+		}
+		return res.Dirs[i].Dir < res.Dirs[j].Dir
+	})
+	return res, q.err()
+}
+
+func runGrowth(args []string) error {
+	flags := flag.NewFlagSet("growth", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	points := flags.Int("points", 8, "number of points to sample, the tip among them")
+	step := flags.String("step", "3m", "sample a point every `age` back from the tip: 30d, 6w, 3m, 1y")
+	depth := flags.Int("depth", 1, "count the directories `n` levels deep")
+	rank := addRankFlags(flags, 20)
+	asJSON := flags.Bool("json", false, "print the points and the counts as a JSON object")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	switch {
+	case *points < 2:
+		return fmt.Errorf("-points %d: must be at least 2", *points)
+	case *depth < 1:
+		return fmt.Errorf("-depth %d: must be at least 1", *depth)
+	}
+	if err := rank.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	switch {
+	case q.backend.marker != gitBackend.marker:
+		return errors.New("growth needs a git repository")
+	case len(queryFlags.where) > 0:
+		// The expressions judge the commits that changed a file, and growth
+		// reads trees.
+		return errors.New("growth counts the files of sampled trees, -where cannot narrow them")
+	case len(q.config.Filters) > 0 || len(q.plugins) > 0:
+		return fmt.Errorf("growth counts the files of sampled trees, the filters of %s cannot narrow them", configFileName)
+	case len(q.commitFilters) > 0:
+		return errors.New("growth counts the files of sampled trees, -author, -exclude-author, -no-bots, -signed-only and -trailer cannot narrow them")
+	}
+
+	sampled, err := samplePoints(ctx, q.rev(), *points, *step)
+	if err != nil {
+		return err
+	}
+	if len(sampled) < 2 {
+		return fmt.Errorf("the history is shorter than -step %s: nothing to compare the tip with", *step)
+	}
+	res, err := collectGrowth(ctx, q, sampled, *depth)
+	if err != nil {
+		return err
+	}
+	res.Dirs = res.Dirs[:rank.keep(len(res.Dirs), func(i int) float64 { return float64(res.Dirs[i].LineGrowth) })]
+	if *asJSON {
+		return printJSON(res)
+	}
+
+	first, last := sampled[0], sampled[len(sampled)-1]
+	fmt.Printf("%d points every %s from %s (%.7s) to %s (%.7s)\n\n", len(sampled), *step, first.Time.Format("2006-01-02"), first.Commit, last.Time.Format("2006-01-02"), last.Commit)
+	fmt.Printf("%-30s %7s %7s %9s %9s %8s %9s\n", "directory", "files", "+files", "lines", "+lines", "growth", "per month")
+	for _, g := range append(res.Dirs, res.Total) {
+		growth := "new"
+		if !g.New {
+			growth = fmt.Sprintf("%+.0f%%", g.Percent)
+		}
+		if g == res.Total {
+			fmt.Println()
+		}
+		fmt.Printf("%-30s %7d %+7d %9d %+9d %8s %+9.0f\n", displayName(ctx, g.Dir), g.Files[len(sampled)-1], g.FileGrowth, g.Lines[len(sampled)-1], g.LineGrowth, growth, g.PerMonth)
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+//go:build grpc
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Building with -tags grpc serves the service of proto/gitility.proto next
+// to the JSON endpoints, with serve -grpc-addr. The messages are encoded
+// by hand with protowire against the field numbers of the .proto file,
+// which keeps protoc and generated code out of the build; clients generate
+// their stubs from the file as usual.
+
+func init() {
+	serveGRPC = func(ctx context.Context, lis net.Listener, srv *server) error {
+		s := grpc.NewServer(grpc.ForceServerCodec(grpcCodec{}))
+		s.RegisterService(&gitilityServiceDesc, grpcService{srv})
+		go func() {
+			<-ctx.Done()
+			s.GracefulStop()
+		}()
+		return s.Serve(lis)
+	}
+}
+
+// pbMessage is an encoded message.
+type pbMessage []byte
+
+func (m *pbMessage) unmarshal(b []byte) error {
+	*m = append((*m)[:0], b...)
+	return nil
+}
+
+// grpcCodec passes the encoded messages through, and decodes the requests
+// with their unmarshal method.
+type grpcCodec struct{}
+
+func (grpcCodec) Name() string { return "proto" }
+
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(pbMessage)
+	if !ok {
+		return nil, fmt.Errorf("grpc: cannot encode %T", v)
+	}
+	return m, nil
+}
+
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(interface{ unmarshal([]byte) error })
+	if !ok {
+		return fmt.Errorf("grpc: cannot decode %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+// decodeFields calls field with every field of the message b, its varint
+// or its bytes, and skips the other wire types.
+func decodeFields(b []byte, field func(num protowire.Number, v uint64, s []byte)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			field(num, v, nil)
+			b = b[n:]
+		case protowire.BytesType:
+			s, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			field(num, 0, s)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+type repoRequest struct {
+	name string
+}
+
+func (m *repoRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v uint64, s []byte) {
+		if num == 1 {
+			m.name = string(s)
+		}
+	})
+}
+
+type listFilesRequest struct {
+	name      string
+	pageSize  uint32
+	pageToken string
+}
+
+func (m *listFilesRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v uint64, s []byte) {
+		switch num {
+		case 1:
+			m.name = string(s)
+		case 2:
+			m.pageSize = uint32(v)
+		case 3:
+			m.pageToken = string(s)
+		}
+	})
+}
+
+type hotspotsRequest struct {
+	name string
+	top  uint32
+}
+
+func (m *hotspotsRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(num protowire.Number, v uint64, s []byte) {
+		switch num {
+		case 1:
+			m.name = string(s)
+		case 2:
+			m.top = uint32(v)
+		}
+	})
+}
+
+type statsRequest struct{}
+
+func (m *statsRequest) unmarshal(b []byte) error {
+	return decodeFields(b, func(protowire.Number, uint64, []byte) {})
+}
+
+// The append functions leave out the zero values, as proto3 does.
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendDouble(b []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// appendTimestamp appends a google.protobuf.Timestamp, none for the zero
+// time.
+func appendTimestamp(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	ts := appendInt(nil, 1, t.Unix())
+	ts = appendInt(ts, 2, int64(t.Nanosecond()))
+	return appendMessage(b, num, ts)
+}
+
+func encodeFile(f FileResult) []byte {
+	b := appendString(nil, 1, f.Name)
+	b = appendString(b, 2, f.Hash)
+	b = appendString(b, 3, f.Author)
+	b = appendTimestamp(b, 4, f.Time)
+	if s := f.Signature; s != nil {
+		sig := appendString(nil, 1, s.Code)
+		sig = appendString(sig, 2, s.Signer)
+		sig = appendString(sig, 3, s.Key)
+		b = appendMessage(b, 5, sig)
+	}
+	keys := make([]string, 0, len(f.Trailers))
+	for key := range f.Trailers {
+		keys = append(keys, key)
+	}
+	// In a stable order, for identical answers to encode the same.
+	sort.Strings(keys)
+	for _, key := range keys {
+		var list []byte
+		for _, value := range f.Trailers[key] {
+			list = protowire.AppendTag(list, 1, protowire.BytesType)
+			list = protowire.AppendString(list, value)
+		}
+		entry := protowire.AppendTag(nil, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = appendMessage(entry, 2, list)
+		b = appendMessage(b, 6, entry)
+	}
+	b = appendString(b, 7, f.Subject)
+	b = appendInt(b, 8, int64(f.PullRequest))
+	b = appendInt(b, 9, int64(f.SVNRevision))
+	return appendString(b, 10, f.ChangeID)
+}
+
+func encodeHotspot(h HotspotResult) pbMessage {
+	b := appendString(nil, 1, h.Name)
+	return appendDouble(b, 2, h.Changes)
+}
+
+func encodeRepoStats(s repoStatus) pbMessage {
+	b := appendString(nil, 1, s.Name)
+	b = appendTimestamp(b, 2, s.Updated)
+	return appendString(b, 3, s.Error)
+}
+
+// grpcService answers the calls from the snapshots of the server, as its
+// GET endpoints do, after the same checks of the tokens and the auth
+// command.
+type grpcService struct {
+	srv *server
+}
+
+// authorize checks the call to method about the repository name, the
+// empty string for Stats, with its authorization metadata standing for
+// the Authorization header.
+func (g grpcService) authorize(ctx context.Context, method, name string) (context.Context, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, method, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			r.Header.Set("Authorization", values[0])
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	ctx = withAudit(ctx, g.srv.requestScope(r, name))
+	code, err := g.srv.authorize(r.WithContext(ctx), name, roleRead)
+	switch {
+	case err == nil:
+		return ctx, nil
+	case code == http.StatusForbidden:
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil, status.Error(codes.Unauthenticated, err.Error())
+}
+
+// snapshot is the latest analysis of the repository name.
+func (g grpcService) snapshot(ctx context.Context, method, name string) (*repoSnapshot, error) {
+	ctx, err := g.authorize(ctx, method, name)
+	if err != nil {
+		return nil, err
+	}
+	repo, ok := g.srv.repo(name)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no repository %q", name)
+	}
+	snapshot, err := repo.latest(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return snapshot, nil
+}
+
+func (g grpcService) listFiles(ctx context.Context, req *listFilesRequest) (pbMessage, error) {
+	snapshot, err := g.snapshot(ctx, "/gitility.v1.Gitility/ListFiles", req.name)
+	if err != nil {
+		return nil, err
+	}
+	files := snapshot.Files
+	start, end, next, err := pageBounds(req.pageToken, int(req.pageSize), len(files), func(i int) pagePosition {
+		return pagePosition{Commit: files[i].Hash, Name: files[i].Name}
+	})
+	switch {
+	case errors.Is(err, ErrStaleCursor):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var b []byte
+	for _, file := range files[start:end] {
+		b = appendMessage(b, 1, encodeFile(file))
+	}
+	return appendString(b, 2, next), nil
+}
+
+func (g grpcService) hotspots(req *hotspotsRequest, stream grpc.ServerStream) error {
+	snapshot, err := g.snapshot(stream.Context(), "/gitility.v1.Gitility/Hotspots", req.name)
+	if err != nil {
+		return err
+	}
+	hotspots := snapshot.Hotspots
+	if req.top > 0 && len(hotspots) > int(req.top) {
+		hotspots = hotspots[:req.top]
+	}
+	for _, hotspot := range hotspots {
+		if err := stream.SendMsg(encodeHotspot(hotspot)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g grpcService) owners(ctx context.Context, req *repoRequest) (pbMessage, error) {
+	snapshot, err := g.snapshot(ctx, "/gitility.v1.Gitility/Owners", req.name)
+	if err != nil {
+		return nil, err
+	}
+	b := appendInt(nil, 1, int64(snapshot.BusFactor))
+	for _, owner := range snapshot.Owners {
+		share := appendString(nil, 1, owner.Author)
+		share = appendDouble(share, 2, owner.Weight)
+		b = appendMessage(b, 2, share)
+	}
+	return b, nil
+}
+
+func (g grpcService) stats(_ *statsRequest, stream grpc.ServerStream) error {
+	if _, err := g.authorize(stream.Context(), "/gitility.v1.Gitility/Stats", ""); err != nil {
+		return err
+	}
+	for _, s := range g.srv.statuses() {
+		if err := stream.SendMsg(encodeRepoStats(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitilityServiceDesc is the service gitility.v1.Gitility. The server sets
+// no interceptors, so the handlers call the methods directly.
+var gitilityServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gitility.v1.Gitility",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListFiles",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &listFilesRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(grpcService).listFiles(ctx, req)
+			},
+		},
+		{
+			MethodName: "Owners",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &repoRequest{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return srv.(grpcService).owners(ctx, req)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Hotspots",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := &hotspotsRequest{}
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(grpcService).hotspots(req, stream)
+			},
+		},
+		{
+			StreamName:    "Stats",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := &statsRequest{}
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(grpcService).stats(req, stream)
+			},
+		},
+	},
+	Metadata: "proto/gitility.proto",
+}
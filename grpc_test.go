@@ -0,0 +1,113 @@
+//go:build grpc
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// TestGRPCService calls the service over a connection, encoding the
+// requests and decoding the answers with the field numbers of
+// proto/gitility.proto.
+func TestGRPCService(t *testing.T) {
+	ready := make(chan struct{})
+	close(ready)
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	srv := &server{repos: map[string]*servedRepo{
+		"api": {ready: ready, snapshot: &repoSnapshot{
+			Updated: when,
+			Files: []FileResult{
+				{Name: "b.go", CommitResult: CommitResult{Hash: "2222222", Author: "bob", Time: when}},
+				{Name: "a.go", CommitResult: CommitResult{Hash: "1111111", Author: "alice", Time: when, Trailers: Trailers{"Reviewed-by": {"carol"}}}},
+			},
+			Hotspots:  []HotspotResult{{Name: "a.go", Changes: 2.5}, {Name: "b.go", Changes: 1}},
+			Owners:    []authorShare{{Author: "alice", Weight: 2}},
+			BusFactor: 1,
+		}},
+	}}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go serveGRPC(ctx, lis, srv)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithDefaultCallOptions(grpc.ForceCodec(grpcCodec{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The first page of one file, then the page its token points to.
+	var names []string
+	token := ""
+	for page := 0; page < 2; page++ {
+		req := appendString(nil, 1, "api")
+		req = appendInt(req, 2, 1)
+		req = appendString(req, 3, token)
+		resp := pbMessage{}
+		if err := conn.Invoke(ctx, "/gitility.v1.Gitility/ListFiles", pbMessage(req), &resp); err != nil {
+			t.Fatalf("ListFiles: %v", err)
+		}
+		token = ""
+		err := decodeFields(resp, func(num protowire.Number, v uint64, s []byte) {
+			switch num {
+			case 1:
+				decodeFields(s, func(num protowire.Number, v uint64, s []byte) {
+					if num == 1 {
+						names = append(names, string(s))
+					}
+				})
+			case 2:
+				token = string(s)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(names) != 2 || names[0] != "b.go" || names[1] != "a.go" || token != "" {
+		t.Errorf("ListFiles listed %q, next page %q, want [b.go a.go] and no next page", names, token)
+	}
+
+	stream, err := conn.NewStream(ctx, &gitilityServiceDesc.Streams[0], "/gitility.v1.Gitility/Hotspots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := appendString(nil, 1, "api")
+	if err := stream.SendMsg(pbMessage(appendInt(req, 2, 1))); err != nil {
+		t.Fatal(err)
+	}
+	stream.CloseSend()
+	var hotspots []string
+	for {
+		resp := pbMessage{}
+		if err := stream.RecvMsg(&resp); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Hotspots: %v", err)
+		}
+		decodeFields(resp, func(num protowire.Number, v uint64, s []byte) {
+			if num == 1 {
+				hotspots = append(hotspots, string(s))
+			}
+		})
+	}
+	if len(hotspots) != 1 || hotspots[0] != "a.go" {
+		t.Errorf("Hotspots streamed %q, want [a.go]", hotspots)
+	}
+
+	resp := pbMessage{}
+	if err := conn.Invoke(ctx, "/gitility.v1.Gitility/Owners", pbMessage(appendString(nil, 1, "nope")), &resp); err == nil {
+		t.Error("Owners of an unknown repository succeeded")
+	}
+}
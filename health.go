@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The health score grades a repository for periodic engineering reviews
+// from signals other reports compute, each scored from 0 to 100:
+//   - stale, the share of tracked files unchanged for -stale-after;
+//   - bus-factor, the authors making half the changes, full at four;
+//   - generated, the share of changes landing in generated or vendored
+//     code;
+//   - pr-size, the mean lines a merged pull request changed, full up to
+//     prSizeBudget;
+//   - fix-density, the share of commits whose subject names a fix, none at
+//     half of them.
+//
+// The score is their mean weighted by the weights, over the signals the
+// repository has: stale needs the git backend, pr-size merged pull
+// requests.
+var healthSignals = []string{"stale", "bus-factor", "generated", "pr-size", "fix-density"}
+
+const (
+	// fullBusFactor is the bus factor scoring 100.
+	fullBusFactor = 4
+	// prSizeBudget is the mean changed lines of a pull request above which
+	// pr-size scores less than 100, in proportion.
+	prSizeBudget = 400
+	// healthPulls is how many of the newest pull requests pr-size
+	// measures, one diff each.
+	healthPulls = 50
+)
+
+// healthGrades are the lowest scores of the letter grades.
+var healthGrades = []struct {
+	min   float64
+	grade string
+}{{90, "A"}, {75, "B"}, {60, "C"}, {40, "D"}, {0, "F"}}
+
+func healthGrade(score float64) string {
+	for _, g := range healthGrades {
+		if score >= g.min {
+			return g.grade
+		}
+	}
+	return "F"
+}
+
+type healthSignal struct {
+	Name string `json:"name"`
+	// Value is what the signal measures, Detail the same in words.
+	Value  float64 `json:"value"`
+	Detail string  `json:"detail"`
+	Score  float64 `json:"score"`
+	Weight float64 `json:"weight"`
+	// Missing tells why the repository does not have the signal; it then
+	// does not count.
+	Missing string `json:"missing,omitempty"`
+}
+
+type healthReport struct {
+	Score   float64        `json:"score"`
+	Grade   string         `json:"grade"`
+	Signals []healthSignal `json:"signals"`
+}
+
+// parseHealthWeights reads name=weight pairs, separated by commas, over the
+// weights of the scoring profile; the signals left out of both weigh 1.
+func parseHealthWeights(spec string, profile map[string]float64) (map[string]float64, error) {
+	weights := make(map[string]float64, len(healthSignals))
+	for _, s := range healthSignals {
+		weights[s] = 1
+	}
+	return parseWeights(spec, profile, weights, "health signal", strings.Join(healthSignals, ", "))
+}
+
+// staleSignal measures the share of the tracked files of rev the query
+// keeps whose last change is older than cutoff.
+func staleSignal(ctx context.Context, cache Cache, q *query, cutoff time.Time) (healthSignal, error) {
+	s := healthSignal{Name: "stale"}
+	if q.backend.marker != gitBackend.marker {
+		s.Missing = "needs the git backend"
+		return s, nil
+	}
+	names, err := cmdListTree(ctx, q.rev())
+	if err != nil {
+		return s, err
+	}
+	touched, err := loadLastTouch(ctx, cache, q, q.rev())
+	if err != nil {
+		return s, err
+	}
+	tracked, stale := 0, 0
+	for _, name := range names {
+		commit, ok := touched[name]
+		if !ok || !satisfyFilters(NewFile(commit, name), q.filters) {
+			continue
+		}
+		tracked++
+		if commit.commitTime.Before(cutoff) {
+			stale++
+		}
+	}
+	if tracked == 0 {
+		s.Missing = "no tracked file"
+		return s, nil
+	}
+	s.Value = float64(stale) / float64(tracked)
+	s.Detail = fmt.Sprintf("%d of %d files", stale, tracked)
+	s.Score = 100 * (1 - s.Value)
+	return s, nil
+}
+
+func busFactorSignal(ctx context.Context, q *query) (healthSignal, error) {
+	s := healthSignal{Name: "bus-factor"}
+	o, err := collectOwnership(ctx, q, false)
+	if err != nil {
+		return s, err
+	}
+	factor, _ := o.busFactor()
+	if factor == 0 {
+		s.Missing = "no change"
+		return s, nil
+	}
+	s.Value = float64(factor)
+	s.Detail = fmt.Sprintf("%d of %d authors", factor, len(o.totals))
+	s.Score = 100 * math.Min(1, s.Value/fullBusFactor)
+	return s, nil
+}
+
+func generatedSignal(ctx context.Context, q *query) (healthSignal, error) {
+	s := healthSignal{Name: "generated"}
+	periods, err := collectOriginChurn(ctx, q, "month")
+	if err != nil {
+		return s, err
+	}
+	total := &originPeriod{}
+	for _, p := range periods {
+		total.Handwritten += p.Handwritten
+		total.Generated += p.Generated
+		total.Vendored += p.Vendored
+	}
+	changes := total.Handwritten + total.Generated + total.Vendored
+	if changes == 0 {
+		s.Missing = "no change"
+		return s, nil
+	}
+	s.Value = total.Share()
+	s.Detail = fmt.Sprintf("%d of %d changes", total.Generated+total.Vendored, changes)
+	s.Score = 100 * (1 - s.Value)
+	return s, nil
+}
+
+// commitSignals measures the pull request size and fix density of the
+// walked commits, newest first.
+func commitSignals(ctx context.Context, q *query, fix *regexp.Regexp) (healthSignal, healthSignal, error) {
+	pr, fixes := healthSignal{Name: "pr-size"}, healthSignal{Name: "fix-density"}
+	opt := q.listingOptions()
+	opt.GetCommits.Subjects = true
+	commits, err := q.backend.commits(ctx, opt)
+	if err != nil {
+		return pr, fixes, err
+	}
+
+	fixCount := 0
+	pulls := make(map[int]bool)
+	lines := 0
+	for _, commit := range commits {
+		if fix.MatchString(commit.Subject()) {
+			fixCount++
+		}
+		n := commit.PullRequest()
+		if n == 0 || pulls[n] || len(pulls) == healthPulls || q.backend.marker != gitBackend.marker {
+			continue
+		}
+		size, ok, err := cmdGetPullSize(ctx, q, commit.CommitHash())
+		if err != nil {
+			return pr, fixes, err
+		}
+		if ok {
+			pulls[n] = true
+			lines += size.Added + size.Deleted
+		}
+	}
+
+	if len(commits) == 0 {
+		fixes.Missing = "no commit"
+	} else {
+		fixes.Value = float64(fixCount) / float64(len(commits))
+		fixes.Detail = fmt.Sprintf("%d of %d commits", fixCount, len(commits))
+		fixes.Score = 100 * math.Max(0, 1-2*fixes.Value)
+	}
+	switch {
+	case q.backend.marker != gitBackend.marker:
+		pr.Missing = "needs the git backend"
+	case len(pulls) == 0:
+		pr.Missing = "no merged pull request"
+	default:
+		pr.Value = float64(lines) / float64(len(pulls))
+		pr.Detail = fmt.Sprintf("%.0f lines over %d pull requests", pr.Value, len(pulls))
+		pr.Score = 100 * math.Min(1, prSizeBudget/math.Max(pr.Value, 1))
+	}
+	return pr, fixes, q.err()
+}
+
+func healthScore(ctx context.Context, cache Cache, q *query, cutoff time.Time, fix *regexp.Regexp, weights map[string]float64) (*healthReport, error) {
+	stale, err := staleSignal(ctx, cache, q, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	bus, err := busFactorSignal(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	generated, err := generatedSignal(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	pr, fixes, err := commitSignals(ctx, q, fix)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &healthReport{Signals: []healthSignal{stale, bus, generated, pr, fixes}}
+	total := 0.0
+	for i := range r.Signals {
+		s := &r.Signals[i]
+		if s.Missing != "" {
+			continue
+		}
+		s.Weight = weights[s.Name]
+		total += s.Weight
+		r.Score += s.Weight * s.Score
+	}
+	if total == 0 {
+		return nil, errors.New("no weighted signal to score the repository by")
+	}
+	r.Score /= total
+	r.Grade = healthGrade(r.Score)
+	return r, nil
+}
+
+func runHealth(args []string) error {
+	flags := flag.NewFlagSet("health", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	staleAfter := flags.String("stale-after", "12m", "count files last changed longer than `age` ago as stale: 30d, 6w, 12m, 2y or a Go duration")
+	fixPattern := flags.String("fix", defaultFixPattern, "regular `expression` matching the subjects of fix commits")
+	weightSpec := flags.String("weights", "", "`weights` of the signals of the score as name=weight pairs, e.g. stale=2,pr-size=0.5 (default 1 each)")
+	profile := flags.String("profile", "", "start from the health weights of the scoring profile `name` of "+configFileName+" (default the default profile)")
+	cacheSpec := flags.String("cache", "", "cache `backend` of the last-touch index: disk, memory or redis://host:port (default $"+cacheEnv+" or disk)")
+	asJSON := flags.Bool("json", false, "print the score and its signals as a JSON object")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	fix, err := regexp.Compile(*fixPattern)
+	if err != nil {
+		return fmt.Errorf("-fix: %w", err)
+	}
+	cutoff, err := ageCutoff(time.Now(), *staleAfter)
+	if err != nil {
+		return fmt.Errorf("-stale-after: %w", err)
+	}
+	cache, err := newCache(orEnv(*cacheSpec, cacheEnv))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	scoring, err := q.config.scoringProfile(*profile)
+	if err != nil {
+		return err
+	}
+	weights, err := parseHealthWeights(*weightSpec, scoring.Health)
+	if err != nil {
+		return fmt.Errorf("-weights: %w", err)
+	}
+
+	r, err := healthScore(ctx, cache, q, cutoff, fix, weights)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(r)
+	}
+	fmt.Printf("health %.0f/100, grade %s\n\n", r.Score, r.Grade)
+	fmt.Printf("%-12s %5s %6s  %s\n", "signal", "score", "weight", "measure")
+	for _, s := range r.Signals {
+		if s.Missing != "" {
+			fmt.Printf("%-12s %5s %6s  %s\n", s.Name, "-", "-", s.Missing)
+			continue
+		}
+		fmt.Printf("%-12s %5.0f %6.2g  %s\n", s.Name, s.Score, s.Weight, s.Detail)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The hg backend reads Mercurial repositories with hg log templates. It
+// supports the listing, hotspots, owners and alert; the other reports read
+// git objects directly.
+
+var hgBackend = &backend{
+	name:     "hg",
+	marker:   ".hg",
+	commits:  getCommitsHg,
+	topLevel: hgRoot,
+	check:    hgCheckRepository,
+	refState: hgRefState,
+}
+
+var errNotHgRepository = errors.New("not a Mercurial repository")
+
+// hgTemplate writes a record per changeset, the fields NUL separated and
+// the description last, as it may hold anything else.
+const hgTemplate = `\x1e{node|short}\x00{author|person} <{author|email}>\x00{date|hgdate}\x00{p2rev}\x00{join(files, "\x01")}\x00{desc}`
+
+func runHg(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, span := startSpan(ctx, "hg "+args[0])
+	defer span.End()
+	span.SetAttr("hg.args", strings.Join(args, " "))
+
+	cmd := exec.CommandContext(ctx, "hg", args...)
+	cmd.Dir = repoDir(ctx)
+	// Plain mode keeps aliases, colors, pagers and localized messages of
+	// the user's configuration out of the output.
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndex(msg, "\n"); i >= 0 {
+			msg = msg[i+1:]
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		err = fmt.Errorf("hg %s: %s", args[0], strings.TrimPrefix(msg, "abort: "))
+	}
+	span.SetError(err)
+	return output, err
+}
+
+func hgRoot(ctx context.Context) (string, error) {
+	output, err := runHg(ctx, "root")
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", err
+		}
+		dir := repoDir(ctx)
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		return "", fmt.Errorf("%s: %w", dir, errNotHgRepository)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// hgCheckRepository is checkRepository for Mercurial: the working directory
+// parent, like HEAD, must have a changeset unless other heads are walked.
+func hgCheckRepository(ctx context.Context, opt Options) error {
+	if _, err := hgRoot(ctx); err != nil {
+		return err
+	}
+	if opt.GetCommits.Ref != "" || opt.GetCommits.AllRefs {
+		return nil
+	}
+	output, err := runHg(ctx, "log", "-r", ".", "--template", "{rev}")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(output)) == "-1" {
+		return errNoCommits
+	}
+	return nil
+}
+
+func hgRefState(ctx context.Context, opt Options) (string, error) {
+	output, err := runHg(ctx, "log", "-r", ". + heads(all())", "--template", `{node}\n`)
+	if err != nil {
+		return "", err
+	}
+	return opt.GetCommits.Ref + "\n" + string(output), nil
+}
+
+// hgRevset translates the walk of the options to a revset, newest first.
+// Ranges are written as in git, a..b for the changesets of b not in a.
+func hgRevset(opt Options) (string, error) {
+	o := opt.GetCommits
+	ancestors := func(rev string) string {
+		if o.FirstParent {
+			return "_firstancestors(" + rev + ")"
+		}
+		return "::" + rev
+	}
+	var set string
+	switch {
+	case o.AllRefs:
+		set = "all()"
+	case strings.Contains(o.Ref, "..."):
+		return "", fmt.Errorf("hg backend: symmetric range %q is not supported", o.Ref)
+	case strings.Contains(o.Ref, ".."):
+		from, to, _ := strings.Cut(o.Ref, "..")
+		if to == "" {
+			to = "."
+		}
+		set = ancestors(hgSymbol(to))
+		if from != "" {
+			set = "(" + set + ") - ::" + hgSymbol(from)
+		}
+	case o.Ref != "":
+		set = ancestors(hgSymbol(o.Ref))
+	default:
+		set = ancestors(".")
+	}
+	switch o.Merges {
+	case MergesExclude:
+		set = "(" + set + ") and not merge()"
+	case MergesOnly:
+		set = "(" + set + ") and merge()"
+	}
+	if !o.Since.IsZero() {
+		set = fmt.Sprintf("(%s) and date('>%d 0')", set, o.Since.Unix())
+	}
+	if !o.Until.IsZero() {
+		set = fmt.Sprintf("(%s) and date('<%d 0')", set, o.Until.Unix())
+	}
+	return "sort(" + set + ", -date)", nil
+}
+
+// hgSymbol quotes a revision name, so names with dashes or that look like
+// revset functions are looked up as they are. HEAD stands for the working
+// directory parent.
+func hgSymbol(rev string) string {
+	if rev == "HEAD" {
+		return "."
+	}
+	return strconv.Quote(rev)
+}
+
+func getCommitsHg(ctx context.Context, opt Options) ([]Commit, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	o := opt.GetCommits
+	switch {
+	case o.Reflog:
+		return nil, errors.New("hg backend: Mercurial has no reflog")
+	case o.Signatures:
+		return nil, errors.New("hg backend: signature checks need a git repository")
+	case len(o.Branches) > 0:
+		return nil, errors.New("hg backend: -branches needs a git repository, use -all-branches")
+	case o.MergeDiff == MergeDiffSeparate || o.MergeDiff == MergeDiffCombined || o.MergeDiff == MergeDiffDenseCombined:
+		return nil, fmt.Errorf("hg backend: merge diff %s needs a git repository", o.MergeDiff)
+	case o.IgnoreFormatting:
+		return nil, errors.New("hg backend: -ignore-formatting needs a git repository")
+	case o.FollowMoves:
+		return nil, errors.New("hg backend: -follow-moves needs a git repository")
+	}
+	if o.Limit == 0 {
+		o.Limit = 1
+	}
+	mergeDiff := o.MergeDiff
+	if mergeDiff == MergeDiffAuto && (o.FirstParent || o.Merges == MergesOnly) {
+		mergeDiff = MergeDiffFirstParent
+	}
+
+	revset, err := hgRevset(opt)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runHg(ctx, "log", "-r", revset, "-l", strconv.Itoa(o.Limit), "--template", hgTemplate)
+	if err != nil {
+		if stateErr := hgCheckRepository(ctx, opt); stateErr != nil {
+			return nil, stateErr
+		}
+		return nil, err
+	}
+
+	commits := make([]Commit, 0)
+	for _, record := range strings.Split(string(output), "\x1e") {
+		if record == "" {
+			continue
+		}
+		commit, err := parseHgRecord(record, opt, mergeDiff)
+		if err != nil {
+			return nil, err
+		}
+		commit.pseudonyms = pseudonymsOf(ctx)
+		commits = append(commits, commit)
+	}
+	// Grafts between the walked heads are counted on each of them:
+	// skipping cherry-picks compares git patch ids.
+	commits = o.Sample.filter(commits)
+	if o.ExcludeMassChanges.Percent > 0 {
+		return nil, errors.New("hg backend: -mass-change-percent needs a git repository")
+	}
+	if o.ExcludeMassChanges.enabled() {
+		return excludeMassChanges(ctx, opt, commits)
+	}
+	return commits, nil
+}
+
+func parseHgRecord(record string, opt Options, mergeDiff MergeDiff) (*commitObj, error) {
+	fields := strings.SplitN(record, "\x00", 6)
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("hg log: bad record %q", record)
+	}
+	commitTime, err := parseHgDate(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	commit := &commitObj{commitHash: fields[0], author: fields[1], mergeDiff: mergeDiff, commitTime: commitTime}
+	desc := fields[5]
+	if opt.GetCommits.Trailers {
+		commit.trailers = messageTrailers(desc)
+	}
+	if opt.GetCommits.Subjects {
+		commit.subject, _, _ = strings.Cut(desc, "\n")
+		commit.pullRequest = parsePullRequest(commit.subject)
+	}
+
+	// The files of a merge changeset are the ones it changed against its
+	// first parent.
+	var names []string
+	merge := fields[3] != "-1"
+	if !merge || mergeDiff == MergeDiffFirstParent {
+		names = strings.Split(fields[4], "\x01")
+	}
+	commit.mu.Lock()
+	commit.setFiles(names, nil)
+	commit.mu.Unlock()
+	return commit, nil
+}
+
+// parseHgDate reads an hgdate, seconds since the epoch and the offset of
+// the time zone in seconds west of UTC.
+func parseHgDate(s string) (time.Time, error) {
+	var seconds, offset int64
+	if _, err := fmt.Sscanf(s, "%d %d", &seconds, &offset); err != nil {
+		return time.Time{}, fmt.Errorf("bad hg date %q", s)
+	}
+	return time.Unix(seconds, 0).In(time.FixedZone("", int(-offset))), nil
+}
+
+var trailerLinePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*:\s`)
+
+// messageTrailers reads the trailers of a commit message, the last
+// paragraph when all its lines are key: value pairs, for VCSs that do not
+// parse them themselves.
+func messageTrailers(message string) Trailers {
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	if len(paragraphs) < 2 {
+		return make(Trailers)
+	}
+	lines := strings.Split(paragraphs[len(paragraphs)-1], "\n")
+	for _, line := range lines {
+		if !trailerLinePattern.MatchString(line) {
+			return make(Trailers)
+		}
+	}
+	return parseTrailers(strings.Join(lines, "\x01"))
+}
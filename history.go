@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileChange is one commit of a file history with its line counts; binary
+// changes count no lines.
+type fileChange struct {
+	File
+	Added   int
+	Deleted int
+}
+
+// fileHistory lists the commits changing path over the range, newest
+// first, following it across renames. Names are the file's name in each
+// commit.
+func fileHistory(ctx context.Context, q *query, path string) ([]fileChange, error) {
+	args := []string{
+		// path names a file, even one with a glob character or a colon.
+		"--literal-pathspecs",
+		"-c", "core.quotePath=off",
+		"log",
+		"--follow",
+		"-z",
+		"--numstat",
+		"--pretty=format:%x1e%ct%x00" + commitFormat(q.opt),
+	}
+	if q.opt.GetCommits.Limit > 0 {
+		args = append(args, fmt.Sprintf("-%d", q.opt.GetCommits.Limit))
+	}
+	if q.opt.GetCommits.Merges == MergesExclude {
+		args = append(args, "--no-merges")
+	}
+	if q.opt.GetCommits.Ref != "" {
+		args = append(args, q.opt.GetCommits.Ref)
+	}
+	output, err := runGit(ctx, append(args, "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]fileChange, 0)
+	for _, record := range strings.Split(string(output), "\x1e") {
+		header, stats, _ := strings.Cut(record, "\n")
+		fields := strings.Split(header, "\x00")
+		if len(fields) < 2 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad commit time %q", fields[0])
+		}
+		commit := parseCommitFields(ctx, fields[1:], q.opt)
+		commit.commitTime = time.Unix(seconds, 0)
+
+		change := fileChange{File: NewFile(commit, path)}
+		// -z ends every stat with a NUL and leaves the path of a rename
+		// empty, its source and destination following as two more fields.
+		entries := strings.Split(stats, "\x00")
+		for i := 0; i < len(entries); i++ {
+			stat := strings.SplitN(entries[i], "\t", 3)
+			if len(stat) != 3 {
+				continue
+			}
+			name := stat[2]
+			if name == "" && i+2 < len(entries) {
+				name = entries[i+2]
+				i += 2
+			}
+			added, deleted, err := q.lineStats.numstat(ctx, stat[0], stat[1], name, commit.commitHash+"^", commit.commitHash)
+			if err != nil {
+				return nil, err
+			}
+			change.Added, change.Deleted = added, deleted
+			change.File = NewFile(commit, name)
+		}
+		if satisfyFilters(change.File, q.commitFilters) {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func runHistory(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: gitility history [flags] <path>")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	changes, err := fileHistory(ctx, q, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+
+	added, deleted := 0, 0
+	commits := make(map[string]int)
+	names := make(map[string]string)
+	for _, change := range changes {
+		commit := change.GetCommit()
+		commitTime, err := commit.CommitTime(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s %-30s %+6d %6s %s\n", commitTime.String(), commit.CommitHash(), commit.Author(), change.Added, fmt.Sprintf("-%d", change.Deleted), displayName(ctx, change.Name()))
+		added += change.Added
+		deleted += change.Deleted
+		key := authorKey(commit.Author())
+		commits[key]++
+		if _, ok := names[key]; !ok {
+			names[key] = commit.Author()
+		}
+	}
+
+	authors := make([]string, 0, len(commits))
+	for key := range commits {
+		authors = append(authors, key)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if commits[authors[i]] != commits[authors[j]] {
+			return commits[authors[i]] > commits[authors[j]]
+		}
+		return authors[i] < authors[j]
+	})
+
+	fmt.Printf("\n%d commits, +%d -%d lines, %d authors\n", len(changes), added, deleted, len(authors))
+	for _, key := range authors {
+		fmt.Printf("  %-40s %d\n", displayName(ctx, names[key]), commits[key])
+	}
+	return nil
+}
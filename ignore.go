@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const ignoreFileName = ".gitilityignore"
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+func (r ignoreRule) match(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return r.re.MatchString(name)
+}
+
+func newIgnoreRule(pattern string) (ignoreRule, bool) {
+	rule := ignoreRule{}
+
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return rule, false
+	}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return rule, false
+	}
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return rule, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// Exclude drops files matching any of the gitignore-style patterns. As in
+// gitignore, later patterns win and a leading "!" re-includes a file.
+func Exclude(patterns ...string) Filters {
+	rules := make([]ignoreRule, 0, len(patterns))
+	for _, pattern := range patterns {
+		if rule, ok := newIgnoreRule(pattern); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	return func(file File) bool {
+		excluded := false
+		for _, rule := range rules {
+			if rule.negate != excluded {
+				continue
+			}
+			if matchIgnoreRule(rule, file.Name()) {
+				excluded = !rule.negate
+			}
+		}
+		return !excluded
+	}
+}
+
+func matchIgnoreRule(rule ignoreRule, name string) bool {
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		if rule.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return rule.match(name, false)
+}
+
+func loadIgnoreFile(dir string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readIgnorePatterns(f)
+}
+
+func readIgnorePatterns(r io.Reader) ([]string, error) {
+	patterns := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	return patterns, scanner.Err()
+}
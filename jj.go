@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A colocated Jujutsu repository keeps its commits in the git repository
+// next to it, so the git backend reads them as they are. jj leaves HEAD on
+// the parent of the working-copy commit, which is what a walk of HEAD
+// should see, and keeps every commit it ever made, abandoned ones
+// included, reachable from refs/jj/keep/*: walks of every ref skip those.
+
+// jjColocated tells whether the working tree at topLevel is also a jj
+// workspace.
+func jjColocated(topLevel string) bool {
+	_, err := os.Stat(filepath.Join(topLevel, ".jj", "repo"))
+	return err == nil
+}
+
+func runJJ(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, span := startSpan(ctx, "jj "+args[0])
+	defer span.End()
+	span.SetAttr("jj.args", strings.Join(args, " "))
+
+	// Reading never needs a snapshot of the working copy, which would
+	// record a new commit.
+	args = append(args, "--ignore-working-copy", "--no-pager", "--color=never")
+	cmd := exec.CommandContext(ctx, "jj", args...)
+	cmd.Dir = repoDir(ctx)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.Index(msg, "\n"); i >= 0 {
+			msg = msg[:i]
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		err = fmt.Errorf("jj %s: %s", args[0], strings.TrimPrefix(msg, "Error: "))
+	}
+	span.SetError(err)
+	return output, err
+}
+
+// resolveJJRefs replaces the jj change IDs and revsets of a revision or
+// range that git does not know with the commits they name.
+func resolveJJRefs(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		return ref, nil
+	}
+	sep := ".."
+	if strings.Contains(ref, "...") {
+		sep = "..."
+	}
+	parts := strings.Split(ref, sep)
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		if _, err := runGit(ctx, "rev-parse", "--verify", "-q", part+"^{commit}"); err == nil {
+			continue
+		}
+		output, err := runJJ(ctx, "log", "--no-graph", "--limit", "1", "-r", part, "-T", `commit_id ++ "\n"`)
+		if err != nil {
+			return "", err
+		}
+		if parts[i] = strings.TrimSpace(string(output)); parts[i] == "" {
+			return "", fmt.Errorf("jj revision %s names no commit", part)
+		}
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// loadChangeIDs sets the jj change IDs of the commits, asking jj about
+// preloadBatch commits at a time. Commits jj does not know keep none.
+func loadChangeIDs(ctx context.Context, commits []Commit) error {
+	pending := make([]*commitObj, 0, len(commits))
+	for _, commit := range commits {
+		if c, ok := commit.(*commitObj); ok {
+			pending = append(pending, c)
+		}
+	}
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > preloadBatch {
+			n = preloadBatch
+		}
+		batch := pending[:n]
+		pending = pending[n:]
+
+		revs := make([]string, 0, len(batch))
+		lengths := make(map[int]bool)
+		for _, c := range batch {
+			revs = append(revs, "present("+c.commitHash+")")
+			lengths[len(c.commitHash)] = true
+		}
+		output, err := runJJ(ctx, "log", "--no-graph", "-r", strings.Join(revs, " | "),
+			"-T", `commit_id ++ " " ++ change_id.short() ++ "\n"`)
+		if err != nil {
+			return err
+		}
+		ids := make(map[string]string)
+		for _, line := range strings.Split(string(output), "\n") {
+			full, changeID, ok := strings.Cut(line, " ")
+			if !ok {
+				continue
+			}
+			for n := range lengths {
+				if n <= len(full) {
+					ids[full[:n]] = changeID
+				}
+			}
+		}
+		for _, c := range batch {
+			c.changeID = ids[c.commitHash]
+		}
+	}
+	return nil
+}
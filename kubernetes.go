@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// gitility deploy -kubernetes prints the manifests running gitility in a
+// cluster, from the image the Dockerfile builds: a CronJob running a
+// report on a schedule, or a Deployment and its Service running the
+// server. The configuration file is mounted from a ConfigMap.
+
+// configMountPath is where the configuration file is mounted.
+const configMountPath = "/etc/gitility"
+
+// kubernetesDeploy is what the manifests deploy.
+type kubernetesDeploy struct {
+	name      string
+	namespace string
+	image     string
+	// schedule is the cron schedule of a report; empty, the server runs.
+	schedule string
+	// args follow the gitility of the container: the report and its
+	// flags, or the flags of serve.
+	args []string
+	// configName and config are the name and contents of the mounted
+	// configuration file, if any.
+	configName string
+	config     string
+	// tokenSecret is the Secret whose token key becomes $GITILITY_TOKEN.
+	tokenSecret string
+	port        int
+}
+
+// yamlQuote writes s as a double-quoted YAML scalar, whose escapes are
+// Go's.
+func yamlQuote(s string) string {
+	return strconv.Quote(s)
+}
+
+// yamlBlock writes the lines of s as a literal block scalar indented by
+// indent, or s quoted when a block cannot hold it as it is.
+func yamlBlock(s, indent string) string {
+	plain := s != "" && !strings.HasPrefix(s, " ") && !strings.HasPrefix(s, "\n") && !strings.ContainsRune(s, '\r')
+	for _, r := range s {
+		plain = plain && (r == '\n' || !unicode.IsControl(r)) && r != unicode.ReplacementChar
+	}
+	if !plain {
+		return yamlQuote(s)
+	}
+	header := "|"
+	if !strings.HasSuffix(s, "\n") {
+		header = "|-"
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return header + "\n" + strings.Join(lines, "\n")
+}
+
+// metadata writes the metadata of an object, or only the labels of the
+// pods of a template.
+func (d kubernetesDeploy) metadata(w io.Writer, indent string, template bool) {
+	fmt.Fprintf(w, "%smetadata:\n", indent)
+	if !template {
+		fmt.Fprintf(w, "%s  name: %s\n", indent, yamlQuote(d.name))
+		if d.namespace != "" {
+			fmt.Fprintf(w, "%s  namespace: %s\n", indent, yamlQuote(d.namespace))
+		}
+	}
+	fmt.Fprintf(w, "%s  labels:\n%s    app.kubernetes.io/name: gitility\n%s    app.kubernetes.io/instance: %s\n", indent, indent, indent, yamlQuote(d.name))
+}
+
+// pod writes the pod spec at indent: the gitility container, running as
+// a user, with its configuration mounted and a scratch cache for clones.
+func (d kubernetesDeploy) pod(w io.Writer, indent, restartPolicy string) {
+	p := func(format string, a ...interface{}) {
+		fmt.Fprintf(w, indent+format+"\n", a...)
+	}
+	p("restartPolicy: %s", restartPolicy)
+	p("securityContext:")
+	p("  runAsNonRoot: true")
+	p("  runAsUser: 65532")
+	p("containers:")
+	p("  - name: gitility")
+	p("    image: %s", yamlQuote(d.image))
+	p("    args:")
+	for _, arg := range d.args {
+		p("      - %s", yamlQuote(arg))
+	}
+	if d.tokenSecret != "" {
+		p("    env:")
+		p("      - name: %s", tokenEnv)
+		p("        valueFrom:")
+		p("          secretKeyRef:")
+		p("            name: %s", yamlQuote(d.tokenSecret))
+		p("            key: token")
+	}
+	if d.port > 0 {
+		p("    ports:")
+		p("      - name: http")
+		p("        containerPort: %d", d.port)
+		p("    readinessProbe:")
+		p("      tcpSocket:")
+		p("        port: http")
+	}
+	p("    securityContext:")
+	p("      allowPrivilegeEscalation: false")
+	p("      readOnlyRootFilesystem: true")
+	p("    volumeMounts:")
+	if d.config != "" {
+		p("      - name: config")
+		p("        mountPath: %s", configMountPath)
+		p("        readOnly: true")
+	}
+	p("      - name: cache")
+	p("        mountPath: /home/gitility/.cache")
+	p("      - name: tmp")
+	p("        mountPath: /tmp")
+	p("volumes:")
+	if d.config != "" {
+		p("  - name: config")
+		p("    configMap:")
+		p("      name: %s", yamlQuote(d.name))
+	}
+	p("  - name: cache")
+	p("    emptyDir: {}")
+	p("  - name: tmp")
+	p("    emptyDir: {}")
+}
+
+// write writes the manifests, separated by ---.
+func (d kubernetesDeploy) write(w io.Writer) {
+	if d.config != "" {
+		fmt.Fprintln(w, "apiVersion: v1")
+		fmt.Fprintln(w, "kind: ConfigMap")
+		d.metadata(w, "", false)
+		fmt.Fprintln(w, "data:")
+		fmt.Fprintf(w, "  %s: %s\n", yamlQuote(d.configName), yamlBlock(d.config, "    "))
+		fmt.Fprintln(w, "---")
+	}
+	if d.schedule != "" {
+		fmt.Fprintln(w, "apiVersion: batch/v1")
+		fmt.Fprintln(w, "kind: CronJob")
+		d.metadata(w, "", false)
+		fmt.Fprintln(w, "spec:")
+		fmt.Fprintf(w, "  schedule: %s\n", yamlQuote(d.schedule))
+		// A report still running when the next one is due is not doubled.
+		fmt.Fprintln(w, "  concurrencyPolicy: Forbid")
+		fmt.Fprintln(w, "  jobTemplate:")
+		fmt.Fprintln(w, "    spec:")
+		fmt.Fprintln(w, "      backoffLimit: 1")
+		fmt.Fprintln(w, "      template:")
+		fmt.Fprintln(w, "        spec:")
+		d.pod(w, "          ", "Never")
+		return
+	}
+	fmt.Fprintln(w, "apiVersion: apps/v1")
+	fmt.Fprintln(w, "kind: Deployment")
+	d.metadata(w, "", false)
+	fmt.Fprintln(w, "spec:")
+	// The server keeps its analyses in memory: one replica answers them.
+	fmt.Fprintln(w, "  replicas: 1")
+	fmt.Fprintln(w, "  selector:")
+	fmt.Fprintln(w, "    matchLabels:")
+	fmt.Fprintf(w, "      app.kubernetes.io/instance: %s\n", yamlQuote(d.name))
+	fmt.Fprintln(w, "  template:")
+	d.metadata(w, "    ", true)
+	fmt.Fprintln(w, "    spec:")
+	d.pod(w, "      ", "Always")
+	fmt.Fprintln(w, "---")
+	fmt.Fprintln(w, "apiVersion: v1")
+	fmt.Fprintln(w, "kind: Service")
+	d.metadata(w, "", false)
+	fmt.Fprintln(w, "spec:")
+	fmt.Fprintln(w, "  selector:")
+	fmt.Fprintf(w, "    app.kubernetes.io/instance: %s\n", yamlQuote(d.name))
+	fmt.Fprintln(w, "  ports:")
+	fmt.Fprintln(w, "    - name: http")
+	fmt.Fprintf(w, "      port: %d\n", d.port)
+	fmt.Fprintln(w, "      targetPort: http")
+}
+
+func runDeploy(args []string) error {
+	flags := flag.NewFlagSet("deploy", flag.ExitOnError)
+	kubernetes := flags.Bool("kubernetes", false, "print Kubernetes manifests")
+	name := flags.String("name", "gitility", "`name` of the Kubernetes objects")
+	namespace := flags.String("namespace", "", "`namespace` of the Kubernetes objects (default the one kubectl applies to)")
+	image := flags.String("image", "gitility:latest", "container `image`, built from the Dockerfile")
+	schedule := flags.String("schedule", "", "run the report given after the flags on the cron `schedule`, e.g. '0 6 * * 1', instead of the server")
+	configPath := flags.String("config", "", "mount `file` in "+configMountPath+" for the server to read as its -config")
+	tokenSecret := flags.String("token-secret", "", "set $"+tokenEnv+" from the token key of the Secret `name`")
+	port := flags.Int("port", 8080, "`port` the server listens on")
+	flags.Parse(args)
+	if !*kubernetes {
+		return errors.New("usage: gitility deploy -kubernetes [-schedule cron report [flags]] [-config file] [flags]")
+	}
+
+	d := kubernetesDeploy{name: *name, namespace: *namespace, image: *image, schedule: *schedule, tokenSecret: *tokenSecret}
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return err
+		}
+		d.configName, d.config = filepath.Base(*configPath), string(data)
+	}
+	if d.schedule != "" {
+		if flags.NArg() == 0 {
+			return errors.New("-schedule runs a report: give it after the flags, e.g. -schedule '0 6 * * 1' hotspots -remote url")
+		}
+		if flags.Arg(0) == "serve" || flags.Arg(0) == "deploy" {
+			return fmt.Errorf("-schedule runs a report, not %s", flags.Arg(0))
+		}
+		if d.config != "" {
+			// Reports read the .gitility.yaml of their repository, and
+			// nothing would read the mounted file.
+			return fmt.Errorf("-config is the configuration of the server, the reports of -schedule read the %s of their repository", configFileName)
+		}
+		d.args = flags.Args()
+	} else {
+		if *port <= 0 || *port > 65535 {
+			return fmt.Errorf("-port %d: want a port number", *port)
+		}
+		d.port = *port
+		d.args = []string{"serve", "-addr", fmt.Sprintf(":%d", d.port)}
+		if d.config != "" {
+			d.args = append(d.args, "-config", configMountPath+"/"+d.configName)
+		}
+		d.args = append(d.args, flags.Args()...)
+	}
+	d.write(os.Stdout)
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The last-touch index maps every file ever changed to the newest commit
+// changing it, like the commit column of a forge file listing. It is built
+// in one streamed git log pass, stored in the Cache with the tip it covers,
+// and brought up to date by walking only the commits added since.
+
+type lastTouchIndex struct {
+	Tip   string                `json:"tip"`
+	Files map[string]cachedFile `json:"files"`
+}
+
+const lastTouchTTL = 30 * 24 * time.Hour
+
+func lastTouchKey(q *query) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		q.topLevel,
+		string(q.opt.GetCommits.Merges),
+		strconv.FormatBool(q.opt.GetCommits.FirstParent),
+		strconv.FormatBool(q.opt.GetCommits.Signatures),
+		strconv.FormatBool(q.opt.GetCommits.Trailers),
+	}, "\x00")))
+	return scopedKey(q.topLevel, "lasttouch:"+hex.EncodeToString(sum[:]))
+}
+
+// loadLastTouch returns the last commit touching every file in the history
+// of rev.
+func loadLastTouch(ctx context.Context, cache Cache, q *query, rev string) (map[string]*commitObj, error) {
+	output, err := runGit(ctx, "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	tip := strings.TrimSpace(string(output))
+
+	key := lastTouchKey(q)
+	idx := lastTouchIndex{}
+	data, ok, err := cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if err := json.Unmarshal(data, &idx); err != nil {
+			idx = lastTouchIndex{}
+		}
+	}
+
+	if idx.Tip != tip {
+		walk := tip
+		if idx.Tip != "" {
+			// A stored tip that was rewritten away cannot be extended.
+			if ok, err := cmdIsAncestor(ctx, idx.Tip, tip); err == nil && ok {
+				walk = idx.Tip + ".." + tip
+			} else {
+				idx.Files = nil
+			}
+		}
+		if idx.Files == nil {
+			idx.Files = make(map[string]cachedFile)
+		}
+
+		newer := make(map[string]cachedFile)
+		if err := streamLastTouch(ctx, q.opt, walk, newer); err != nil {
+			return nil, err
+		}
+		for name, file := range newer {
+			idx.Files[name] = file
+		}
+		idx.Tip = tip
+
+		if data, err = json.Marshal(idx); err != nil {
+			return nil, err
+		}
+		if err := cache.Set(ctx, key, data, q.retainedTTL(lastTouchTTL)); err != nil {
+			return nil, err
+		}
+	}
+
+	touched := make(map[string]*commitObj, len(idx.Files))
+	commits := make(map[string]*commitObj)
+	for name, file := range idx.Files {
+		commit, ok := commits[file.Commit]
+		if !ok {
+			commit = file.commit(ctx)
+			commits[file.Commit] = commit
+		}
+		touched[name] = commit
+	}
+	return touched, nil
+}
+
+// streamLastTouch records in touched the newest commit of revs changing
+// each file.
+func streamLastTouch(ctx context.Context, opt Options, revs string, touched map[string]cachedFile) error {
+	args := []string{
+		"-c", "core.quotePath=off",
+		"log",
+		"--pretty=format:%x1e%ct%x00" + commitFormat(opt),
+		"--name-only",
+	}
+	if opt.GetCommits.Merges == MergesExclude {
+		args = append(args, "--no-merges")
+	}
+	if opt.GetCommits.FirstParent {
+		args = append(args, "--first-parent")
+	}
+	args = append(args, revs, "--")
+
+	return streamGit(ctx, func(r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 64<<20)
+		scanner.Split(splitRecords)
+		for scanner.Scan() {
+			lines := strings.Split(scanner.Text(), "\n")
+			fields := strings.Split(lines[0], "\x00")
+			if len(fields) < 2 {
+				continue
+			}
+			seconds, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("bad commit time %q", fields[0])
+			}
+			commit := parseCommitFields(ctx, fields[1:], opt)
+			file := cachedFile{
+				Commit:      commit.commitHash,
+				Author:      commit.author,
+				Time:        time.Unix(seconds, 0),
+				Signature:   commit.signature,
+				Trailers:    commit.trailers,
+				Subject:     commit.subject,
+				PullRequest: commit.pullRequest,
+			}
+			for _, name := range lines[1:] {
+				if name == "" {
+					continue
+				}
+				if _, ok := touched[name]; !ok {
+					file.Name = name
+					touched[name] = file
+				}
+			}
+		}
+		return scanner.Err()
+	}, args...)
+}
+
+// splitRecords splits git log output on the record separators in its
+// format.
+func splitRecords(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	if len(data) > 0 && data[0] == '\x1e' {
+		start = 1
+	}
+	if i := bytes.IndexByte(data[start:], '\x1e'); i >= 0 {
+		return start + i, data[start : start+i], nil
+	}
+	if atEOF && len(data) > start {
+		return len(data), data[start:], nil
+	}
+	return 0, nil, nil
+}
+
+func cmdShowPrefix(ctx context.Context) (string, error) {
+	output, err := runGit(ctx, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// lastTouchOf finds the last change of name, a file or a directory whose
+// files are all considered.
+func lastTouchOf(touched map[string]*commitObj, name string) (*commitObj, bool) {
+	if commit, ok := touched[name]; ok {
+		return commit, true
+	}
+	var newest *commitObj
+	dir := strings.TrimSuffix(name, "/") + "/"
+	for file, commit := range touched {
+		if (dir == "/" || strings.HasPrefix(file, dir)) && (newest == nil || commit.commitTime.After(newest.commitTime)) {
+			newest = commit
+		}
+	}
+	return newest, newest != nil
+}
+
+func runLast(args []string) error {
+	flags := flag.NewFlagSet("last", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	cacheSpec := flags.String("cache", "", "cache `backend` of the last-touch index: disk, memory or redis://host:port (default $"+cacheEnv+" or disk)")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: gitility last [flags] <path>...")
+	}
+
+	cache, err := newCache(orEnv(*cacheSpec, cacheEnv))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	touched, err := loadLastTouch(ctx, cache, q, q.rev())
+	if err != nil {
+		return err
+	}
+	prefix := ""
+	if *queryFlags.remote == "" {
+		if prefix, err = cmdShowPrefix(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, arg := range flags.Args() {
+		name := strings.TrimPrefix(path.Clean(prefix+arg), "./")
+		if name == "." {
+			name = ""
+		}
+		commit, ok := lastTouchOf(touched, name)
+		if !ok {
+			return fmt.Errorf("%s: never changed in %s", arg, q.rev())
+		}
+		fmt.Println(commit.commitTime.String(), commit.commitHash, commit.Author(), displayName(ctx, arg))
+	}
+	return nil
+}
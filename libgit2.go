@@ -0,0 +1,266 @@
+//go:build libgit2
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// Building with -tags libgit2 needs libgit2 1.5 and its headers.
+
+func init() {
+	b := *gitBackend
+	b.name = "libgit2"
+	b.commits = getCommitsLibgit2
+	backends["libgit2"] = &b
+}
+
+// getCommitsLibgit2 walks the history in process through libgit2 and loads
+// the time and files of every commit during the walk, instead of running
+// git for them. Reflog walks, combined merge diffs and signatures are left
+// to the git backend.
+func getCommitsLibgit2(ctx context.Context, opt Options) ([]Commit, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	o := opt.GetCommits
+	switch {
+	case o.Reflog:
+		return nil, errors.New("libgit2 backend: reflog walks need -backend git")
+	case o.Signatures:
+		return nil, errors.New("libgit2 backend: signature checks need -backend git")
+	case o.MergeDiff == MergeDiffCombined || o.MergeDiff == MergeDiffDenseCombined:
+		return nil, errors.New("libgit2 backend: combined merge diffs need -backend git")
+	case o.IgnoreFormatting:
+		return nil, errors.New("libgit2 backend: -ignore-formatting needs -backend git")
+	}
+	if o.Limit == 0 {
+		o.Limit = 1
+	}
+	mergeDiff := o.MergeDiff
+	if mergeDiff == MergeDiffAuto && (o.FirstParent || o.Merges == MergesOnly) {
+		mergeDiff = MergeDiffFirstParent
+	}
+
+	output, err := runGit(ctx, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return nil, repositoryError(ctx, err)
+	}
+	repo, err := git.OpenRepository(strings.TrimSpace(string(output)))
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Free()
+	walk, err := libgit2Walk(repo, opt)
+	if err != nil {
+		if stateErr := checkRepository(ctx, opt); stateErr != nil {
+			return nil, stateErr
+		}
+		return nil, err
+	}
+	defer walk.Free()
+
+	commits := make([]Commit, 0)
+	var walkErr error
+	err = walk.Iterate(func(c *git.Commit) bool {
+		if walkErr = ctx.Err(); walkErr != nil {
+			return false
+		}
+		when := c.Committer().When
+		if !o.Since.IsZero() && when.Before(o.Since) {
+			// The walk is sorted by time, everything after is older.
+			return false
+		}
+		if !o.Until.IsZero() && when.After(o.Until) {
+			return true
+		}
+		merge := c.ParentCount() > 1
+		if (o.Merges == MergesExclude && merge) || (o.Merges == MergesOnly && !merge) {
+			return true
+		}
+
+		var commit *commitObj
+		if commit, walkErr = libgit2Commit(repo, c, opt, mergeDiff); walkErr != nil {
+			return false
+		}
+		commit.pseudonyms = pseudonymsOf(ctx)
+		commits = append(commits, commit)
+		return len(commits) < o.Limit
+	})
+	if err == nil {
+		err = walkErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if o.SkipCherryPicks {
+		if commits, err = skipCherryPicks(ctx, opt, commits); err != nil {
+			return nil, err
+		}
+	}
+	commits = o.Sample.filter(commits)
+	if o.ExcludeMassChanges.enabled() {
+		if commits, err = excludeMassChanges(ctx, opt, commits); err != nil {
+			return nil, err
+		}
+	}
+	if o.FollowMoves {
+		if err := followMoves(ctx, commits); err != nil {
+			return nil, err
+		}
+	}
+	return commits, nil
+}
+
+// libgit2Walk starts the walk where git log would: at the ref or range, the
+// refs asked for, or HEAD.
+func libgit2Walk(repo *git.Repository, opt Options) (*git.RevWalk, error) {
+	o := opt.GetCommits
+	walk, err := repo.Walk()
+	if err != nil {
+		return nil, err
+	}
+	walk.Sorting(git.SortTime)
+	if o.FirstParent {
+		walk.SimplifyFirstParent()
+	}
+
+	push := func() error {
+		if o.AllRefs {
+			if err := walk.PushGlob("*"); err != nil {
+				return err
+			}
+			if err := walk.PushHead(); err != nil {
+				return err
+			}
+		}
+		for _, glob := range o.Branches {
+			if err := walk.PushGlob("heads/" + glob); err != nil {
+				return err
+			}
+		}
+		switch {
+		case strings.Contains(o.Ref, ".."):
+			return walk.PushRange(o.Ref)
+		case o.Ref != "":
+			obj, err := repo.RevparseSingle(o.Ref)
+			if err != nil {
+				return err
+			}
+			defer obj.Free()
+			peeled, err := obj.Peel(git.ObjectCommit)
+			if err != nil {
+				return err
+			}
+			defer peeled.Free()
+			return walk.Push(peeled.Id())
+		case !o.AllRefs && len(o.Branches) == 0:
+			return walk.PushHead()
+		}
+		return nil
+	}
+	if err := push(); err != nil {
+		walk.Free()
+		return nil, fmt.Errorf("libgit2 backend: %w", err)
+	}
+	return walk, nil
+}
+
+func libgit2Commit(repo *git.Repository, c *git.Commit, opt Options, mergeDiff MergeDiff) (*commitObj, error) {
+	hash, err := c.ShortId()
+	if err != nil {
+		return nil, err
+	}
+	author := c.Author()
+	commit := &commitObj{
+		commitHash: hash,
+		author:     author.Name + " <" + author.Email + ">",
+		mergeDiff:  mergeDiff,
+		commitTime: c.Committer().When,
+	}
+	if opt.GetCommits.Trailers {
+		trailers, err := git.MessageTrailers(c.Message())
+		if err != nil {
+			return nil, err
+		}
+		raw := make([]string, 0, len(trailers))
+		for _, trailer := range trailers {
+			raw = append(raw, trailer.Key+": "+trailer.Value)
+		}
+		commit.trailers = parseTrailers(strings.Join(raw, "\x01"))
+	}
+	if opt.GetCommits.Subjects {
+		commit.subject = c.Summary()
+		commit.pullRequest = parsePullRequest(commit.subject)
+	}
+
+	names, err := libgit2Files(repo, c, mergeDiff)
+	if err != nil {
+		return nil, err
+	}
+	commit.mu.Lock()
+	commit.setFiles(names, nil)
+	commit.mu.Unlock()
+	return commit, nil
+}
+
+// libgit2Files lists the files of a commit like cmdGetFiles: against the
+// empty tree for root commits, and for merges only with a merge diff.
+func libgit2Files(repo *git.Repository, c *git.Commit, mergeDiff MergeDiff) ([]string, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+
+	parents := []uint{}
+	switch n := c.ParentCount(); {
+	case n <= 1 || mergeDiff == MergeDiffFirstParent:
+		parents = append(parents, 0)
+	case mergeDiff == MergeDiffSeparate:
+		for i := uint(0); i < n; i++ {
+			parents = append(parents, i)
+		}
+	}
+
+	names := make([]string, 0)
+	for _, i := range parents {
+		var parentTree *git.Tree
+		if c.ParentCount() > 0 {
+			// A missing parent, at the edge of a shallow clone, reads like a
+			// root commit, as it does to git.
+			if parent := c.Parent(i); parent != nil {
+				parentTree, err = parent.Tree()
+				parent.Free()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		diff, err := repo.DiffTreeToTree(parentTree, tree, nil)
+		if parentTree != nil {
+			parentTree.Free()
+		}
+		if err != nil {
+			return nil, err
+		}
+		deltas, err := diff.NumDeltas()
+		for d := 0; err == nil && d < deltas; d++ {
+			var delta git.DiffDelta
+			if delta, err = diff.Delta(d); err == nil {
+				names = append(names, delta.NewFile.Path)
+			}
+		}
+		diff.Free()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
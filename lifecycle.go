@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The lifecycle of files is when they were created, renamed and deleted:
+// during a large refactor, where everything under a directory came from
+// and went. The files are selected by a path or a gitignore-style pattern,
+// a directory selecting the files below it, and a rename counts when
+// either of its names matches, so files moving in or out show too.
+
+const (
+	lifecycleCreated = "created"
+	lifecycleRenamed = "renamed"
+	lifecycleDeleted = "deleted"
+)
+
+type lifecycleEvent struct {
+	Time   time.Time `json:"time"`
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	Event  string    `json:"event"`
+	Name   string    `json:"name"`
+	// From is the old name of a renamed file, Similarity the percentage of
+	// its content the rename kept.
+	From       string `json:"from,omitempty"`
+	Similarity int    `json:"similarity,omitempty"`
+	Subject    string `json:"subject"`
+}
+
+// lifecycleSummary counts the events, and Alive the files they created or
+// renamed that the last walked commit still has.
+type lifecycleSummary struct {
+	Created int `json:"created"`
+	Renamed int `json:"renamed"`
+	Deleted int `json:"deleted"`
+	Alive   int `json:"alive"`
+}
+
+// fileLifecycle lists the creations, renames and deletions of the files
+// matching pattern over the range, oldest first, with one git log.
+func fileLifecycle(ctx context.Context, q *query, pattern string) ([]lifecycleEvent, lifecycleSummary, error) {
+	summary := lifecycleSummary{}
+	rule, ok := newIgnoreRule(pattern)
+	if !ok || rule.negate {
+		return nil, summary, fmt.Errorf("bad path or pattern %q", pattern)
+	}
+	opt := q.opt
+	opt.GetCommits.Subjects = true
+	args := []string{
+		"-c", "core.quotePath=off",
+		"log",
+		"--reverse",
+		"-M",
+		"--diff-filter=ADR",
+		"--name-status",
+		"--pretty=format:%x1e%ct%x00" + commitFormat(opt),
+	}
+	if opt.GetCommits.Limit > 0 {
+		args = append(args, fmt.Sprintf("-%d", opt.GetCommits.Limit))
+	}
+	if opt.GetCommits.Merges == MergesExclude {
+		args = append(args, "--no-merges")
+	}
+	if opt.GetCommits.FirstParent {
+		// What the merges brought in, as the branch saw it.
+		args = append(args, "--first-parent", "--diff-merges=first-parent")
+	}
+	if opt.GetCommits.Ref != "" {
+		args = append(args, opt.GetCommits.Ref)
+	}
+	// Not narrowed by a pathspec: git would no longer pair the names of the
+	// files renamed in or out.
+	output, err := runGit(ctx, append(args, "--")...)
+	if err != nil {
+		return nil, summary, err
+	}
+
+	events := make([]lifecycleEvent, 0)
+	alive := make(map[string]bool)
+	for _, record := range strings.Split(string(output), "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		fields := strings.Split(lines[0], "\x00")
+		if len(fields) < 2 {
+			continue
+		}
+		seconds, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, summary, fmt.Errorf("bad commit time %q", fields[0])
+		}
+		commit := parseCommitFields(ctx, fields[1:], opt)
+		commit.commitTime = time.Unix(seconds, 0)
+
+		for _, line := range lines[1:] {
+			status := strings.Split(line, "\t")
+			if len(status) < 2 || status[0] == "" {
+				continue
+			}
+			e := lifecycleEvent{
+				Time:    commit.commitTime,
+				Commit:  commit.commitHash,
+				Author:  commit.Author(),
+				Name:    status[len(status)-1],
+				Subject: commit.subject,
+			}
+			switch status[0][0] {
+			case 'A':
+				e.Event = lifecycleCreated
+			case 'D':
+				e.Event = lifecycleDeleted
+			case 'R':
+				if len(status) != 3 {
+					continue
+				}
+				e.Event = lifecycleRenamed
+				e.From = status[1]
+				e.Similarity, _ = strconv.Atoi(status[0][1:])
+			default:
+				continue
+			}
+			matched := matchIgnoreRule(rule, e.Name) || e.From != "" && matchIgnoreRule(rule, e.From)
+			if !matched || !satisfyFilters(NewFile(commit, e.Name), q.commitFilters) {
+				continue
+			}
+			events = append(events, e)
+			switch e.Event {
+			case lifecycleCreated:
+				summary.Created++
+				alive[e.Name] = true
+			case lifecycleDeleted:
+				summary.Deleted++
+				delete(alive, e.Name)
+			case lifecycleRenamed:
+				summary.Renamed++
+				delete(alive, e.From)
+				if matchIgnoreRule(rule, e.Name) {
+					alive[e.Name] = true
+				}
+			}
+		}
+	}
+	summary.Alive = len(alive)
+	return events, summary, nil
+}
+
+func runLifecycle(args []string) error {
+	flags := flag.NewFlagSet("lifecycle", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	asJSON := flags.Bool("json", false, "print the events and their counts as a JSON object")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: gitility lifecycle [flags] <path-or-pattern>")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	if q.backend.marker != gitBackend.marker {
+		return errors.New("lifecycle needs a git repository")
+	}
+
+	events, summary, err := fileLifecycle(ctx, q, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+	if *asJSON {
+		res := struct {
+			Events []lifecycleEvent `json:"events"`
+			lifecycleSummary
+		}{events, summary}
+		return printJSON(res)
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("no file matching %q was created, renamed or deleted in the walked range", flags.Arg(0))
+	}
+
+	month := ""
+	for _, e := range events {
+		// The timeline is split by month.
+		if m := e.Time.Format("2006-01"); m != month {
+			if month != "" {
+				fmt.Println()
+			}
+			fmt.Println(m)
+			month = m
+		}
+		name := displayName(ctx, e.Name)
+		if e.Event == lifecycleRenamed {
+			name = fmt.Sprintf("%s -> %s (%d%%)", displayName(ctx, e.From), name, e.Similarity)
+		}
+		fmt.Printf("  %s %s %-7s %-50s %-24s %s\n", e.Time.Format("2006-01-02"), e.Commit, e.Event, name, e.Author, e.Subject)
+	}
+	fmt.Printf("\n%d created, %d renamed, %d deleted; %d still exist\n", summary.Created, summary.Renamed, summary.Deleted, summary.Alive)
+	return nil
+}
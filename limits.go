@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// flightGroup collapses concurrent calls with the same key into one: the
+// first caller runs fn, the others wait for its result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func (g *flightGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.value, call.err, true
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	call.value, call.err = fn()
+	close(call.done)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return call.value, call.err, false
+}
+
+const gitProcsEnv = "GITILITY_MAX_GIT_PROCS"
+
+// repoLimiter bounds the number of git processes running at once against
+// the same repository.
+type repoLimiter struct {
+	limit int
+	mu    sync.Mutex
+	sems  map[string]chan struct{}
+}
+
+var gitLimiter = newRepoLimiterFromEnv()
+
+func newRepoLimiterFromEnv() *repoLimiter {
+	limit := runtime.NumCPU()
+	if n, err := strconv.Atoi(os.Getenv(gitProcsEnv)); err == nil && n > 0 {
+		limit = n
+	}
+	return &repoLimiter{limit: limit, sems: make(map[string]chan struct{})}
+}
+
+// acquire waits for a slot on dir and returns the function releasing it.
+func (l *repoLimiter) acquire(ctx context.Context, dir string) (func(), error) {
+	l.mu.Lock()
+	sem, ok := l.sems[dir]
+	if !ok {
+		sem = make(chan struct{}, l.limit)
+		l.sems[dir] = sem
+	}
+	l.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Lines are code, comment or blank, as a lightweight lexer of the file's
+// language tells them apart: it knows comments and strings, so a comment
+// marker in a string is code, but nothing of the grammar. Line stats can
+// count the lines of one kind only, to focus on functional changes.
+
+type lineKind int
+
+const (
+	lineCode lineKind = iota
+	lineComment
+	lineBlank
+)
+
+// The -lines modes.
+const (
+	linesAll     = "all"
+	linesCode    = "code"
+	linesComment = "comment"
+	linesBlank   = "blank"
+)
+
+var lineModes = map[string]lineKind{linesCode: lineCode, linesComment: lineComment, linesBlank: lineBlank}
+
+// lexer describes the comments and strings of a language.
+type lexer struct {
+	line    []string
+	blocks  [][2]string
+	quotes  string
+	escapes bool
+}
+
+var (
+	cLexer     = &lexer{line: []string{"//"}, blocks: [][2]string{{"/*", "*/"}}, quotes: "\"'`", escapes: true}
+	hashLexer  = &lexer{line: []string{"#"}, quotes: "\"'", escapes: true}
+	dashLexer  = &lexer{line: []string{"--"}, quotes: "\"'"}
+	htmlLexer  = &lexer{blocks: [][2]string{{"<!--", "-->"}}}
+	cssLexer   = &lexer{blocks: [][2]string{{"/*", "*/"}}, quotes: "\"'", escapes: true}
+	hclLexer   = &lexer{line: []string{"#", "//"}, blocks: [][2]string{{"/*", "*/"}}, quotes: "\"", escapes: true}
+	lispLexer  = &lexer{line: []string{";"}, quotes: "\"", escapes: true}
+	latexLexer = &lexer{line: []string{"%"}}
+)
+
+var lexers = map[string]*lexer{
+	".go": cLexer, ".c": cLexer, ".h": cLexer, ".cc": cLexer, ".cpp": cLexer, ".hpp": cLexer,
+	".java": cLexer, ".kt": cLexer, ".scala": cLexer, ".cs": cLexer, ".swift": cLexer, ".rs": cLexer,
+	".js": cLexer, ".jsx": cLexer, ".ts": cLexer, ".tsx": cLexer, ".mjs": cLexer, ".php": cLexer,
+	".dart": cLexer, ".proto": cLexer, ".m": cLexer,
+	".py": hashLexer, ".rb": hashLexer, ".sh": hashLexer, ".bash": hashLexer, ".zsh": hashLexer,
+	".pl": hashLexer, ".r": hashLexer, ".yaml": hashLexer, ".yml": hashLexer, ".toml": hashLexer,
+	".sql": dashLexer, ".lua": dashLexer, ".hs": dashLexer,
+	".html": htmlLexer, ".xml": htmlLexer, ".vue": htmlLexer,
+	".css": cssLexer, ".scss": cssLexer, ".less": cssLexer,
+	".tf": hclLexer, ".hcl": hclLexer,
+	".clj": lispLexer, ".el": lispLexer, ".lisp": lispLexer,
+	".tex": latexLexer,
+}
+
+func lexerFor(name string) *lexer {
+	if base := path.Base(name); base == "Dockerfile" || base == "Makefile" {
+		return hashLexer
+	}
+	return lexers[strings.ToLower(path.Ext(name))]
+}
+
+// classify tells the kind of each line of src.
+func (l *lexer) classify(src string) []lineKind {
+	lines := strings.Split(src, "\n")
+	kinds := make([]lineKind, len(lines))
+	block := -1
+	var quote byte
+	for i, line := range lines {
+		code, comment := false, block >= 0
+	scan:
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+			switch {
+			case block >= 0:
+				if end := l.blocks[block][1]; strings.HasPrefix(line[j:], end) {
+					block = -1
+					j += len(end) - 1
+				}
+			case quote != 0:
+				code = true
+				if l.escapes && c == '\\' {
+					j++
+				} else if c == quote {
+					quote = 0
+				}
+			case c == ' ' || c == '\t' || c == '\r':
+			default:
+				for _, prefix := range l.line {
+					if strings.HasPrefix(line[j:], prefix) {
+						comment = true
+						break scan
+					}
+				}
+				for n, b := range l.blocks {
+					if strings.HasPrefix(line[j:], b[0]) {
+						block, comment = n, true
+						j += len(b[0]) - 1
+						continue scan
+					}
+				}
+				code = true
+				if strings.IndexByte(l.quotes, c) >= 0 {
+					quote = c
+				}
+			}
+		}
+		// Strings other than backquoted ones end with their line.
+		if quote != '`' {
+			quote = 0
+		}
+		switch {
+		case code:
+			kinds[i] = lineCode
+		case comment:
+			kinds[i] = lineComment
+		default:
+			kinds[i] = lineBlank
+		}
+	}
+	return kinds
+}
+
+// kindLines counts the lines of kind a change of path from the revision
+// from to the revision to added and deleted.
+func kindLines(ctx context.Context, path, from, to string, kind lineKind) (int, int, error) {
+	l := lexerFor(path)
+	from, err := parentOrEmptyTree(ctx, from)
+	if err != nil {
+		return 0, 0, err
+	}
+	output, err := runGit(ctx, "-c", "core.quotePath=off", "diff", "--no-ext-diff", "--no-color", "--no-renames", "-U0", from, to, "--", path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var oldKinds, newKinds []lineKind
+	if l != nil {
+		for _, side := range []struct {
+			rev   string
+			kinds *[]lineKind
+		}{{from, &oldKinds}, {to, &newKinds}} {
+			data, err := runGit(ctx, "cat-file", "blob", side.rev+":"+path)
+			if err != nil && ctx.Err() != nil {
+				return 0, 0, ctx.Err()
+			}
+			*side.kinds = l.classify(string(data))
+		}
+	}
+	// Without a lexer, lines are blank or code.
+	kindOf := func(kinds []lineKind, n int, text string) lineKind {
+		if strings.TrimSpace(text) == "" {
+			return lineBlank
+		}
+		if n-1 < len(kinds) {
+			return kinds[n-1]
+		}
+		return lineCode
+	}
+
+	added, deleted := 0, 0
+	oldLine, newLine := 0, 0
+	inHunk := false
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			var err error
+			if oldLine, newLine, err = parseHunkHeader(line); err != nil {
+				return 0, 0, err
+			}
+			inHunk = true
+		case strings.HasPrefix(line, "diff "):
+			inHunk = false
+		case inHunk && strings.HasPrefix(line, "+"):
+			if kindOf(newKinds, newLine, line[1:]) == kind {
+				added++
+			}
+			newLine++
+		case inHunk && strings.HasPrefix(line, "-"):
+			if kindOf(oldKinds, oldLine, line[1:]) == kind {
+				deleted++
+			}
+			oldLine++
+		}
+	}
+	return added, deleted, nil
+}
+
+// parseHunkHeader reads the first old and new line numbers of a hunk,
+// @@ -old[,count] +new[,count] @@.
+func parseHunkHeader(header string) (int, int, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 {
+		return 0, 0, fmt.Errorf("bad hunk header %q", header)
+	}
+	start := func(field string) (int, error) {
+		n, _, _ := strings.Cut(field[1:], ",")
+		return strconv.Atoi(n)
+	}
+	oldLine, err := start(fields[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad hunk header %q", header)
+	}
+	newLine, err := start(fields[2])
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad hunk header %q", header)
+	}
+	return oldLine, newLine, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// emptyTree is the hash of the tree with no entries, what a root commit
+// is diffed against.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// lineStats reads the line counts of git --numstat, correcting two cases
+// where they mislead. git counts no lines for binary files, even when a
+// diff driver with a textconv command, set with diff=<driver> in
+// .gitattributes and diff.<driver>.textconv in the git config, turns them
+// into text that git diff shows line by line: those are counted through the
+// driver. And Jupyter notebooks, JSON that stores the outputs and execution
+// counts of their cells along with the code, churn by hundreds of lines
+// each time they are re-run: unless raw, only their cell sources count.
+// Text files can also count the lines of one kind alone, see lineKind.
+type lineStats struct {
+	rawNotebooks bool
+	// kinds is whether only the lines of kind count.
+	kinds bool
+	kind  lineKind
+
+	mu      sync.Mutex
+	paths   map[string]bool
+	drivers map[string]bool
+}
+
+func newLineStats(rawNotebooks bool, lines string) *lineStats {
+	t := &lineStats{rawNotebooks: rawNotebooks, paths: make(map[string]bool), drivers: make(map[string]bool)}
+	t.kind, t.kinds = lineModes[lines]
+	return t
+}
+
+// textconv tells whether the diff driver of path converts it to text.
+func (t *lineStats) textconv(ctx context.Context, path string) (bool, error) {
+	if sandboxOf(ctx) != nil {
+		// The drivers are commands of the repository's configuration.
+		return false, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ok, seen := t.paths[path]; seen {
+		return ok, nil
+	}
+	output, err := runGit(ctx, "check-attr", "-z", "diff", "--", path)
+	if err != nil {
+		return false, err
+	}
+	fields := bytes.Split(output, []byte{0})
+	driver := ""
+	if len(fields) >= 3 {
+		driver = string(fields[2])
+	}
+	switch driver {
+	case "", "unspecified", "set", "unset":
+		t.paths[path] = false
+		return false, nil
+	}
+	ok, seen := t.drivers[driver]
+	if !seen {
+		// git config exits 1 when the key is not set.
+		output, _ := runGit(ctx, "config", "--get", "diff."+driver+".textconv")
+		ok = strings.TrimSpace(string(output)) != ""
+		t.drivers[driver] = ok
+	}
+	t.paths[path] = ok
+	return ok, nil
+}
+
+// numstat reads the --numstat line counts of path between the revisions
+// from and to; from may name the missing parent of a root commit. Renames,
+// whose path is written old => new, keep git's counts.
+func (t *lineStats) numstat(ctx context.Context, added, deleted, path, from, to string) (int, int, error) {
+	if strings.Contains(path, " => ") {
+		a, _ := strconv.Atoi(added)
+		d, _ := strconv.Atoi(deleted)
+		return a, d, nil
+	}
+	if !t.rawNotebooks && strings.EqualFold(filepath.Ext(path), ".ipynb") {
+		a, d, ok, err := t.notebookLines(ctx, path, from, to)
+		if err != nil || ok {
+			return a, d, err
+		}
+	}
+	if added != "-" || deleted != "-" {
+		if t.kinds {
+			return kindLines(ctx, path, from, to, t.kind)
+		}
+		a, _ := strconv.Atoi(added)
+		d, _ := strconv.Atoi(deleted)
+		return a, d, nil
+	}
+	ok, err := t.textconv(ctx, path)
+	if err != nil || !ok {
+		return 0, 0, err
+	}
+	from, err = parentOrEmptyTree(ctx, from)
+	if err != nil {
+		return 0, 0, err
+	}
+	output, err := runGit(ctx, "-c", "core.quotePath=off", "diff", "--textconv", "--no-ext-diff", "--no-color", "-U0", from, to, "--", path)
+	if err != nil {
+		return 0, 0, err
+	}
+	a, d := countDiffLines(output)
+	return a, d, nil
+}
+
+// notebookLines counts the lines the cell sources of the notebook at path
+// gained and lost, diffing them with git. Notebooks that do not parse
+// report !ok.
+func (t *lineStats) notebookLines(ctx context.Context, path, from, to string) (int, int, bool, error) {
+	dir, err := os.MkdirTemp("", "gitility-notebook-")
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer os.RemoveAll(dir)
+
+	files := make([]string, 0, 2)
+	for i, rev := range []string{from, to} {
+		data, err := runGit(ctx, "cat-file", "blob", rev+":"+path)
+		if err != nil {
+			// Added and deleted notebooks have no blob at one end.
+			if ctx.Err() != nil {
+				return 0, 0, false, ctx.Err()
+			}
+			data = []byte(`{"cells": []}`)
+		}
+		source, ok := notebookSource(data)
+		if !ok {
+			return 0, 0, false, nil
+		}
+		file := filepath.Join(dir, strconv.Itoa(i))
+		if err := os.WriteFile(file, source, 0o600); err != nil {
+			return 0, 0, false, err
+		}
+		files = append(files, file)
+	}
+	// git diff --no-index exits 1 when the files differ.
+	output, err := runGit(ctx, "diff", "--no-index", "--no-ext-diff", "--no-color", "-U0", files[0], files[1])
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return 0, 0, false, err
+	}
+	a, d := countDiffLines(output)
+	return a, d, true, nil
+}
+
+// countDiffLines counts the lines a patch adds and deletes.
+func countDiffLines(patch []byte) (added int, deleted int) {
+	inHunk := false
+	for _, line := range strings.Split(string(patch), "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case strings.HasPrefix(line, "diff "):
+			inHunk = false
+		case inHunk && strings.HasPrefix(line, "+"):
+			added++
+		case inHunk && strings.HasPrefix(line, "-"):
+			deleted++
+		}
+	}
+	return added, deleted
+}
+
+func parentOrEmptyTree(ctx context.Context, rev string) (string, error) {
+	if _, err := runGit(ctx, "rev-parse", "--verify", "-q", rev+"^{commit}"); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return emptyTree, nil
+	}
+	return rev, nil
+}
@@ -1,12 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -36,92 +46,591 @@ func isNotGoTestFile(file File) bool {
 	return true
 }
 
+var subcommands = map[string]func(args []string) error{
+	"recent":            runRecent,
+	"audit-signatures":  runAuditSignatures,
+	"check-dco":         runCheckDCO,
+	"owners":            runOwners,
+	"org":               runOrg,
+	"stale":             runStale,
+	"last":              runLast,
+	"history":           runHistory,
+	"review-stats":      runReviewStats,
+	"deploy":            runDeploy,
+	"deploys":           runDeploys,
+	"reverts":           runReverts,
+	"risky":             runRisky,
+	"risk":              runRisk,
+	"health":            runHealth,
+	"onboard":           runOnboard,
+	"suggest-reviewers": runSuggestReviewers,
+	"sizes":             runSizes,
+	"cadence":           runCadence,
+	"purge":             runPurge,
+	"lifecycle":         runLifecycle,
+	"growth":            runGrowth,
+	"metrics":           runMetrics,
+	"cherry-picks":      runCherryPicks,
+	"backports":         runBackports,
+	"bisect-hints":      runBisectHints,
+	"hotspots":          runHotspots,
+	"diff-report":       runDiffReport,
+	"alert":             runAlert,
+	"digest":            runDigest,
+	"projects":          runProjects,
+	"affected":          runAffected,
+	"classes":           runClasses,
+	"generated":         runGenerated,
+	"mass-changes":      runMassChanges,
+	"moves":             runMoves,
+	"serve":             runServe,
+	"token":             runToken,
+	"mcp":               runMCP,
+}
+
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	name, args := "recent", os.Args[1:]
+	if len(args) > 0 {
+		if _, ok := subcommands[args[0]]; ok {
+			name, args = args[0], args[1:]
+		}
+	}
+
+	err := subcommands[name](args)
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	if err := defaultTracer.flush(flushCtx); err != nil {
+		log.Print(err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runRecent lists the files changed by the recent commits, newest first.
+// It is what gitility runs without a subcommand.
+func runRecent(args []string) error {
+	flags := flag.NewFlagSet("recent", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 10)
+	groupByTrailerKey := flags.String("group-by-trailer", "", "group the files by the values of the trailer `key`")
+	groupByPR := flags.Bool("group-by-pr", false, "group the files by the pull request their commit came from")
+	changeIDs := flags.Bool("change-ids", false, "print the jj change ID next to the commit hash, in colocated jj repositories")
+	groupBySVN := flags.Bool("group-by-svn", false, "group the files by the Subversion revision of their git-svn commit")
+	groupBy := flags.String("group-by", "", "group the files by `what`: project, the Bazel package or Go module they belong to, or team, per "+configFileName+" or CODEOWNERS")
+	projects := flags.String("projects", projectsAuto, "project `layout` for -group-by project: auto, bazel, go or node")
+	confirmPRs := flags.Bool("confirm-prs", false, "ask the GitHub API for the pull request of commits whose message names none")
+	api := flags.String("api", defaultForgeAPI, "forge API `url` for -confirm-prs, for GitHub Enterprise")
+	report := flags.String("report", "", "hand the files to the report plugin `name` declared in "+configFileName)
+	asJSON := flags.Bool("json", false, "print the files as a JSON array, the input of report plugins and diff-report")
+	var outputFlags stringsFlag
+	flags.Var(&outputFlags, "output", "write the files as `format[=file]`: table, json or markdown, to stdout without a file (repeatable)")
+	pageSize := flags.Int("page-size", 0, "print `N` files at most, and the -cursor of the next page on stderr")
+	cursor := flags.String("cursor", "", "print the page of files after `cursor`, printed by the previous page")
+	explain := flags.Bool("explain", false, "print the git commands the listing would run and the number of commits they walk, instead of running them")
+	timeout := flags.Duration("timeout", 5*time.Second, "give up after `duration`")
+	noCache := flags.Bool("no-cache", false, "do not reuse nor store the results of identical queries")
+	cacheSpec := flags.String("cache", "", "cache `backend`: disk, memory or redis://[:password@]host:port[/db] (default $"+cacheEnv+" or disk)")
+	sinceLastRun := flags.Bool("since-last-run", false, "only analyze commits added since the previous run and merge them with its results")
+	identity := flags.String("identity", identitySHA, "how -since-last-run recognizes the commits of the previous run: sha, or patch-id to resume after rebases")
+	cpuProfile := flags.String("cpuprofile", "", "write a CPU profile to `file`")
+	memProfile := flags.String("memprofile", "", "write a heap profile to `file` when the run ends")
+	tracePath := flags.String("trace", "", "write an execution trace to `file`")
+	flags.Parse(args)
+	outputs, err := parseOutputs(outputFlags)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *asJSON && len(outputs) > 0:
+		return errors.New("-json is -output json, pass one or the other")
+	case *asJSON:
+		outputs = []outputSpec{{format: outputJSON}}
+	case len(outputs) == 0:
+		outputs = []outputSpec{{format: outputTable}}
+	}
+	if *report != "" && len(outputFlags) > 0 {
+		return errors.New("-report hands the files to a plugin, it cannot be combined with -output")
+	}
+
+	prof, err := startProfiles(*cpuProfile, *memProfile, *tracePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := prof.stop(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	ctx, span := startSpan(ctx, "gitility")
+	defer span.End()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	var layout *projectMap
+	var teams map[string][]string
+	switch *groupBy {
+	case "":
+	case "project":
+		if layout, err = loadProjectMap(ctx, treeRev(q.rev()), *projects); err != nil {
+			return err
+		}
+	case "team":
+		if teams, err = loadTeams(ctx, q.config, q.topLevel, ""); err != nil {
+			return err
+		}
+		if len(teams) == 0 {
+			return fmt.Errorf("-group-by team: no teams in %s nor CODEOWNERS", configFileName)
+		}
+	default:
+		return fmt.Errorf("unknown -group-by %q, want project or team", *groupBy)
+	}
+	if *changeIDs {
+		if !jjColocated(q.topLevel) {
+			return errors.New("-change-ids needs a colocated jj repository")
+		}
+		q.opt.GetCommits.ChangeIDs = true
+	}
+	if *groupByTrailerKey != "" || *groupBySVN {
+		q.opt.GetCommits.Trailers = true
+	}
+	if *groupByPR || *confirmPRs {
+		q.opt.GetCommits.Subjects = true
+	}
+
+	if *explain {
+		plan, err := planQuery(ctx, q)
+		if err != nil {
+			return err
+		}
+		plan.print(os.Stdout)
+		return nil
+	}
 
-	filters := []Filters{
-		isGoFile,
-		isNotGoProtoFile,
-		isNotGoMockFile,
-		isNotGoTestFile,
+	if *identity != identitySHA && *identity != identityPatchID {
+		return fmt.Errorf("unknown -identity %q, want sha or patch-id", *identity)
+	}
+	if *identity != identitySHA && !*sinceLastRun {
+		return errors.New("-identity only applies to -since-last-run")
 	}
 
-	opt := Options{}
-	opt.GetCommits.Limit = 10
+	paged := *pageSize != 0 || *cursor != ""
+	if *sinceLastRun && paged {
+		return errors.New("-since-last-run cannot be combined with -page-size or -cursor")
+	}
 
-	files, err := getOrderFiles(getCommits, ctx, opt, filters...)
+	var files []File
+	var next string
+	if *sinceLastRun {
+		if q.opt.GetCommits.Reflog {
+			return errors.New("-since-last-run cannot be combined with -reflog")
+		}
+		if len(q.opt.GetCommits.Commits) > 0 {
+			return errors.New("-since-last-run cannot be combined with -stdin")
+		}
+		if q.opt.GetCommits.AllRefs || len(q.opt.GetCommits.Branches) > 0 {
+			return errors.New("-since-last-run resumes from the tip of one ref, it cannot be combined with -all-branches or -branches")
+		}
+		if strings.Contains(q.opt.GetCommits.Ref, "..") {
+			return fmt.Errorf("-since-last-run walks from the last run to the tip of -ref, it cannot be combined with the range %q", q.opt.GetCommits.Ref)
+		}
+		if len(q.aggregates) > 0 {
+			return errors.New("-since-last-run keeps one commit per file, it cannot count the authors of -min-authors or -max-authors")
+		}
+		if q.opt.Dedup != DedupFile {
+			return errors.New("-since-last-run only lists every file once, it cannot be combined with -dedup")
+		}
+		if q.opt.DedupFold != (DedupFold{}) {
+			return errors.New("-since-last-run tells files apart by their exact names, it cannot be combined with -dedup-ignore-case or -dedup-nfc")
+		}
+		if q.backend.marker != gitBackend.marker {
+			return errors.New("-since-last-run needs a git repository")
+		}
+		files, err = getOrderFilesSinceLastRun(q.backend.commits, ctx, q.listingOptions(), q.topLevel, q.fingerprint, *identity, q.filters...)
+	} else if paged && len(q.aggregates) == 0 {
+		// The commits past the page are never listed.
+		files, next, err = getOrderFilesPage(q.backend.commits, ctx, q.listingOptions(), *cursor, *pageSize, q.filters...)
+	} else if *noCache {
+		files, err = getOrderFiles(q.backend.commits, ctx, q.listingOptions(), q.filters...)
+	} else {
+		var cache Cache
+		if cache, err = newCache(orEnv(*cacheSpec, cacheEnv)); err != nil {
+			return err
+		}
+		files, err = getOrderFilesCached(q.backend.commits, ctx, cache, q)
+	}
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
 	}
+	files = q.aggregate(files)
+	if paged && len(q.aggregates) > 0 {
+		// -min-authors and -max-authors judge the whole listing, which the
+		// page is cut out of.
+		if files, next, err = pageFiles(files, *cursor, *pageSize); err != nil {
+			return err
+		}
+	}
+	if next != "" {
+		fmt.Fprintf(os.Stderr, "next page: -cursor %s\n", next)
+	}
+	if *confirmPRs {
+		if err := confirmPullRequests(ctx, newForgeClient(*api, *queryFlags.token), *queryFlags.remote, files); err != nil {
+			return err
+		}
+	}
+
+	if *report != "" {
+		plugin, ok := q.config.plugin(pluginReport, *report)
+		if !ok && q.untrustedPlugins {
+			return fmt.Errorf("-report %s: the plugins of %s only run with -trust-plugins", *report, configFileName)
+		}
+		if !ok {
+			return fmt.Errorf("no report plugin %q in %s", *report, configFileName)
+		}
+		return runReportPlugin(ctx, q.topLevel, plugin, files)
+	}
+	var groups []fileGroup
+	if *groupByTrailerKey != "" {
+		keys, byKey := groupByTrailer(files, *groupByTrailerKey)
+		for _, key := range keys {
+			label := key
+			if label == "" {
+				label = "(no " + *groupByTrailerKey + ")"
+			}
+			groups = append(groups, fileGroup{label, byKey[key]})
+		}
+	} else if layout != nil {
+		names, byName := groupByProject(files, layout)
+		for _, name := range names {
+			label := name
+			if label == "" {
+				label = "(no project)"
+			}
+			groups = append(groups, fileGroup{label, byName[name]})
+		}
+	} else if teams != nil {
+		names, byName := groupByTeam(files, teams)
+		for _, name := range names {
+			label := name
+			if label == "" {
+				label = "(no team)"
+			}
+			groups = append(groups, fileGroup{label, byName[name]})
+		}
+	} else if *groupBySVN {
+		revisions, byRevision := groupBySVNRevision(files)
+		for _, revision := range revisions {
+			label := fmt.Sprintf("r%d", revision)
+			if revision == 0 {
+				label = "(not from svn)"
+			}
+			groups = append(groups, fileGroup{label, byRevision[revision]})
+		}
+	} else if *groupByPR {
+		numbers, byNumber := groupByPullRequest(files)
+		for _, number := range numbers {
+			label := fmt.Sprintf("#%d", number)
+			if number == 0 {
+				label = "(no pull request)"
+			}
+			groups = append(groups, fileGroup{label, byNumber[number]})
+		}
+	}
+	return writeOutputs(outputs, func(format string, w io.Writer) error {
+		return renderListing(ctx, w, format, files, groups)
+	})
+}
+
+// orEnv is value, or the environment variable env when value is empty.
+// The flags that default to a secret in the environment read it once
+// parsed, so that the usage does not print it.
+func orEnv(value, env string) string {
+	if value == "" {
+		return os.Getenv(env)
+	}
+	return value
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func printFiles(ctx context.Context, files []File, indent string) error {
+	return writeFiles(ctx, os.Stdout, files, indent)
+}
+
+func writeFiles(ctx context.Context, w io.Writer, files []File, indent string) error {
+	rows, err := fileRows(ctx, files)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		fmt.Fprintln(w, indent+row[0], row[1], row[2])
+	}
+	return nil
+}
+
+// fileRows are the commit time, the commit hash, with its change ID when it
+// has one, and the name of every file.
+func fileRows(ctx context.Context, files []File) ([][]string, error) {
+	commits := make([]Commit, 0, len(files))
+	for _, file := range files {
+		commits = append(commits, file.GetCommit())
+	}
+	if err := Preload(ctx, commits, CommitFieldTime); err != nil {
+		return nil, err
+	}
+	rows := make([][]string, 0, len(files))
 	for _, file := range files {
 		commitTime, err := file.GetCommit().CommitTime(ctx)
 		if err != nil {
-			log.Panic(err)
+			return nil, err
 		}
-		fmt.Println(commitTime, file.GetCommit().CommitHash(), file.Name())
+		hash := file.GetCommit().CommitHash()
+		if changeID := file.GetCommit().ChangeID(); changeID != "" {
+			hash += " " + changeID
+		}
+		rows = append(rows, []string{commitTime.String(), hash, displayName(ctx, file.Name())})
 	}
+	return rows, nil
 }
 
 type Filters func(File) bool
 
+// Aggregates filter the files once the walk is over, when a decision needs
+// the whole range rather than one file at a time.
+type Aggregates func([]File) []File
+
 type GetCommits func(ctx context.Context, opt Options) ([]Commit, error)
 
 type Options struct {
 	GetCommits struct {
-		Limit int
+		Limit       int
+		Ref         string
+		Merges      MergeMode
+		FirstParent bool
+		MergeDiff   MergeDiff
+		Sample      Sample
+		Signatures  bool
+		Trailers    bool
+		// Subjects loads the subjects, and the pull request numbers
+		// parsed out of them.
+		Subjects bool
+		Reflog   bool
+		AllRefs  bool
+		Branches []string
+		// Commits, when set, are the walked commits, in their order,
+		// instead of the ones Ref, AllRefs and Branches select; the other
+		// options still apply to them.
+		Commits []string
+		// Since and Until, when set, bound the commit dates of the walk.
+		Since time.Time
+		Until time.Time
+		// SkipCherryPicks drops the commits whose patch is the same as an
+		// older walked commit's, the copies cherry-picks leave on the other
+		// walked branches.
+		SkipCherryPicks bool
+		// ChangeIDs loads the change IDs of a colocated jj repository.
+		ChangeIDs bool
+		// IgnoreFormatting leaves out of the files of a commit those it
+		// only reformatted: whitespace changes, and Go code gofmt formats
+		// the same before and after.
+		IgnoreFormatting bool
+		// ExcludeMassChanges drops the commits changing too many files.
+		ExcludeMassChanges MassChanges
+		// FollowMoves names the files of the commits before a directory
+		// move the way it renamed them.
+		FollowMoves bool
+		// Paths, when set, are git pathspecs the files of the commits are
+		// listed for, leaving the others out. The walked commits stay the
+		// same.
+		Paths []string
 	}
+	// Dedup is how often the listing names the same file, every file once
+	// by default.
+	Dedup DedupScope
+	// DedupFold is which differences between names Dedup ignores.
+	DedupFold DedupFold
 }
 
+// Sample thins out the walked commits so statistics over huge histories
+// finish in bounded time. Results are approximate: files only touched by
+// skipped commits are missing. Every keeps each Nth commit, Percent keeps
+// a random share of them, reproducible for the same Seed.
+type Sample struct {
+	Every   int
+	Percent float64
+	Seed    int64
+}
+
+func (s Sample) filter(commits []Commit) []Commit {
+	if s.Every <= 1 && (s.Percent <= 0 || s.Percent >= 100) {
+		return commits
+	}
+
+	rnd := rand.New(rand.NewSource(s.Seed))
+	sampled := make([]Commit, 0, len(commits))
+	for i, commit := range commits {
+		if s.Every > 1 && i%s.Every != 0 {
+			continue
+		}
+		if s.Percent > 0 && s.Percent < 100 && rnd.Float64()*100 >= s.Percent {
+			continue
+		}
+		sampled = append(sampled, commit)
+	}
+	return sampled
+}
+
+type MergeMode string
+
+const (
+	MergesInclude MergeMode = "include"
+	MergesExclude MergeMode = "exclude"
+	MergesOnly    MergeMode = "only"
+)
+
+// MergeDiff picks which files a merge commit, including an octopus merge,
+// reports from GetFiles. The values follow git's --diff-merges.
+type MergeDiff string
+
+const (
+	MergeDiffAuto          MergeDiff = ""
+	MergeDiffNone          MergeDiff = "off"
+	MergeDiffFirstParent   MergeDiff = "first-parent"
+	MergeDiffSeparate      MergeDiff = "separate"
+	MergeDiffCombined      MergeDiff = "combined"
+	MergeDiffDenseCombined MergeDiff = "dense-combined"
+)
+
 func getOrderFiles(fn GetCommits, ctx context.Context, opt Options, filters ...Filters) ([]File, error) {
+	ctx, span := startSpan(ctx, "getOrderFiles")
+	defer span.End()
+
 	uniqueFiles := make([]File, 0)
 	mapExistedFiles := make(map[string]File)
 
-	commits, err := fn(ctx, opt)
+	commitsCtx, commitsSpan := startSpan(ctx, "getCommits")
+	commits, err := fn(commitsCtx, opt)
+	commitsSpan.SetError(err)
+	commitsSpan.End()
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttr("gitility.commits", len(commits))
+	if err := Preload(ctx, commits, CommitFieldFiles); err != nil {
+		return nil, err
+	}
+	if err := sortCommits(ctx, commits); err != nil {
+		return nil, err
+	}
 
 	for _, commit := range commits {
-		files, err := commit.GetFiles(ctx)
+		filesCtx, filesSpan := startSpan(ctx, "Commit.GetFiles")
+		filesSpan.SetAttr("git.commit", commit.CommitHash())
+		files, err := commit.GetFiles(filesCtx)
+		filesSpan.SetError(err)
+		filesSpan.End()
 		if err != nil {
 			return nil, err
 		}
+		files = append([]File(nil), files...)
+		sort.SliceStable(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
 		for _, file := range files {
-			if _, ok := mapExistedFiles[file.Name()]; !ok {
-				filterChains := true
-				for _, isSatisfyFilter := range filters {
-					if !isSatisfyFilter(file) {
-						filterChains = false
-						break
-					}
-				}
-				if filterChains {
-					mapExistedFiles[file.Name()] = file
+			key, dedup := dedupKey(opt.Dedup, opt.DedupFold, file)
+			if _, ok := mapExistedFiles[key]; !ok || !dedup {
+				if satisfyFilters(file, filters) {
+					mapExistedFiles[key] = file
 					uniqueFiles = append(uniqueFiles, file)
 				}
 			}
 		}
 	}
+	span.SetAttr("gitility.files", len(uniqueFiles))
 	return uniqueFiles, nil
 }
 
+func satisfyFilters(file File, filters []Filters) bool {
+	for _, isSatisfyFilter := range filters {
+		if !isSatisfyFilter(file) {
+			return false
+		}
+	}
+	return true
+}
+
 func getCommits(ctx context.Context, opt Options) ([]Commit, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
 	if opt.GetCommits.Limit == 0 {
 		opt.GetCommits.Limit = 1
 	}
 
-	commitHashes, err := cmdGetCommits(ctx, opt)
+	// Merge commits only contribute files when their branch commits are not
+	// walked on their own, otherwise the same change would be counted twice.
+	mergeDiff := opt.GetCommits.MergeDiff
+	if mergeDiff == MergeDiffAuto && (opt.GetCommits.FirstParent || opt.GetCommits.Merges == MergesOnly) {
+		mergeDiff = MergeDiffFirstParent
+	}
+
+	commitLines, err := cmdGetCommits(ctx, opt)
 	if err != nil {
+		if stateErr := checkRepository(ctx, opt); stateErr != nil {
+			return nil, stateErr
+		}
 		return nil, err
 	}
 
-	commits := make([]Commit, 0, len(commitHashes))
-	for _, commitHash := range commitHashes {
-		if commitHash == "" {
+	commits := make([]Commit, 0, len(commitLines))
+	seen := make(map[string]bool, len(commitLines))
+	for _, commitLine := range commitLines {
+		if commitLine == "" {
+			continue
+		}
+		fields := strings.Split(commitLine, "\x00")
+		// The reflog revisits commits on every checkout of them.
+		if seen[fields[0]] {
 			continue
 		}
-		commits = append(commits, NewCommit(commitHash))
+		seen[fields[0]] = true
+		commit := parseCommitFields(ctx, fields, opt)
+		commit.mergeDiff = mergeDiff
+		commit.ignoreFormatting = opt.GetCommits.IgnoreFormatting
+		commit.paths = pathsKey(opt.GetCommits.Paths)
+		commits = append(commits, commit)
+	}
+	if opt.GetCommits.SkipCherryPicks {
+		if commits, err = skipCherryPicks(ctx, opt, commits); err != nil {
+			return nil, err
+		}
+	}
+	commits = opt.GetCommits.Sample.filter(commits)
+	if opt.GetCommits.ExcludeMassChanges.enabled() {
+		if commits, err = excludeMassChanges(ctx, opt, commits); err != nil {
+			return nil, err
+		}
+	}
+	if opt.GetCommits.FollowMoves {
+		if err := followMoves(ctx, commits); err != nil {
+			return nil, err
+		}
+	}
+	if opt.GetCommits.ChangeIDs {
+		if err := loadChangeIDs(ctx, commits); err != nil {
+			return nil, err
+		}
 	}
 	return commits, nil
 }
@@ -129,15 +638,31 @@ func getCommits(ctx context.Context, opt Options) ([]Commit, error) {
 type File interface {
 	Name() string
 	GetCommit() Commit
+	// Kind tells symbolic links and submodules from regular files.
+	Kind() FileKind
 }
 
 type fileObj struct {
 	Commit
 	name string
+	kind FileKind
 }
 
+// NewFile is a regular file of the commit.
 func NewFile(c Commit, name string) File {
-	return &fileObj{Commit: c, name: name}
+	return &fileObj{Commit: c, name: name, kind: FileKindRegular}
+}
+
+// NewFileOfKind is a file of the commit of any kind.
+func NewFileOfKind(c Commit, name string, kind FileKind) File {
+	if kind == "" {
+		kind = FileKindRegular
+	}
+	return &fileObj{Commit: c, name: name, kind: kind}
+}
+
+func (f *fileObj) Kind() FileKind {
+	return f.kind
 }
 
 func (f *fileObj) GetCommit() Commit {
@@ -148,18 +673,90 @@ func (f *fileObj) Name() string {
 	return f.name
 }
 
+// Commit loads its time and files lazily, on the first call, and keeps
+// them; Preload fetches them for many commits at once. The commits of this
+// package are safe for concurrent use, and a failed load is tried again
+// on the next call.
 type Commit interface {
+	// GetFiles lists the files the commit changed against its parent. For
+	// merge commits the result depends on the MergeDiff the commit was
+	// loaded with: nothing by default, the diff against the first parent
+	// when the walk follows first parents or only merges, or the combined
+	// diff (files that differ from every parent) when asked for.
 	GetFiles(context.Context) ([]File, error)
 	CommitTime(context.Context) (time.Time, error)
 	CommitHash() string
+	Author() string
+	// SignatureStatus is only known when the commits were loaded with
+	// Options.GetCommits.Signatures, and is SignatureUnknown otherwise.
+	SignatureStatus() SignatureStatus
+	// Trailers are only loaded with Options.GetCommits.Trailers and are
+	// empty otherwise.
+	Trailers() Trailers
+	// PullRequest is the number of the pull request the commit came from,
+	// or 0 when unknown or not loaded with Options.GetCommits.Subjects.
+	PullRequest() int
+	// Subject is only loaded with Options.GetCommits.Subjects.
+	Subject() string
+	// SVN is the Subversion revision of a commit git-svn made, read from
+	// its trailers, and zero otherwise.
+	SVN() SVNRevision
+	// ChangeID is the jj change the commit is a version of, only loaded
+	// with Options.GetCommits.ChangeIDs.
+	ChangeID() string
 }
 
 type commitObj struct {
 	commitHash string
+	author     string
+	mergeDiff  MergeDiff
+	// ignoreFormatting is IgnoreFormatting of the walk.
+	ignoreFormatting bool
+	// paths are the Paths of the walk, see pathsKey.
+	paths string
+	// rename, when set, renames the files of the commit, see FollowMoves.
+	rename      func(string) string
+	signature   SignatureStatus
+	trailers    Trailers
+	subject     string
+	pullRequest int
+	changeID    string
+	// pseudonyms are the pseudonyms of -anonymize, see Author.
+	pseudonyms *pseudonyms
+
+	// mu guards the lazily loaded fields below.
+	mu          sync.Mutex
+	commitTime  time.Time
+	files       []File
+	filesLoaded bool
+}
+
+func NewCommit(message string, author string, mergeDiff MergeDiff) Commit {
+	return &commitObj{commitHash: message, author: author, mergeDiff: mergeDiff}
+}
+
+func (c *commitObj) Author() string {
+	return c.pseudonyms.display(c.author)
+}
+
+func (c *commitObj) SignatureStatus() SignatureStatus {
+	return c.signature
+}
+
+func (c *commitObj) Trailers() Trailers {
+	return c.trailers
+}
+
+func (c *commitObj) Subject() string {
+	return c.subject
 }
 
-func NewCommit(message string) Commit {
-	return &commitObj{commitHash: message}
+func (c *commitObj) PullRequest() int {
+	return c.pullRequest
+}
+
+func (c *commitObj) ChangeID() string {
+	return c.changeID
 }
 
 func (c *commitObj) CommitHash() string {
@@ -167,80 +764,456 @@ func (c *commitObj) CommitHash() string {
 }
 
 func (c *commitObj) CommitTime(ctx context.Context) (time.Time, error) {
-	return cmdGetCommitTime(ctx, c.CommitHash())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.commitTime.IsZero() {
+		return c.commitTime, nil
+	}
+	commitTime, err := cmdGetCommitTime(ctx, c.CommitHash())
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.commitTime = commitTime
+	return commitTime, nil
 }
 
 func (c *commitObj) GetFiles(ctx context.Context) ([]File, error) {
-	fileNames, err := cmdGetFiles(ctx, c.CommitHash())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.filesLoaded {
+		return c.files, nil
+	}
+	fileNames, kinds, err := cmdGetFiles(ctx, c.CommitHash(), filesMode{c.mergeDiff, c.ignoreFormatting, c.paths})
 	if err != nil {
 		return nil, err
 	}
+	c.setFiles(fileNames, kinds)
+	return c.files, nil
+}
 
+// setFiles memoizes the files of the commit from the names git listed and
+// the kinds of those that are not regular files; c.mu must be held.
+func (c *commitObj) setFiles(fileNames []string, kinds map[string]FileKind) {
 	files := make([]File, 0, len(fileNames))
+	seen := make(map[string]bool, len(fileNames))
 	for _, fileName := range fileNames {
-		if fileName == "" {
+		kind := kinds[fileName]
+		if fileName != "" && c.rename != nil {
+			fileName = c.rename(fileName)
+		}
+		if fileName == "" || seen[fileName] {
 			continue
 		}
-		files = append(files, NewFile(c, fileName))
+		seen[fileName] = true
+		files = append(files, NewFileOfKind(c, fileName, kind))
 	}
-	return files, nil
+	c.files = files
+	c.filesLoaded = true
 }
 
-var cmdCache = make(map[interface{}]interface{})
+// setRename renames the files of the commit, the loaded ones included.
+func (c *commitObj) setRename(rename func(string) string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rename = rename
+	if c.filesLoaded {
+		names := make([]string, 0, len(c.files))
+		kinds := make(map[string]FileKind)
+		for _, file := range c.files {
+			names = append(names, file.Name())
+			kinds[file.Name()] = file.Kind()
+		}
+		c.setFiles(names, kinds)
+	}
+}
 
-func cmdGetCommits(ctx context.Context, opt Options) ([]string, error) {
-	output, err := exec.CommandContext(ctx,
-		"git",
-		"log",
-		fmt.Sprintf("-%d", opt.GetCommits.Limit),
-		"--pretty=format:%h",
-	).Output()
+// gitCommand is the git command with args operating on the repository of
+// ctx, in its sandbox if it has one; call cancel once it is done. Commands
+// that could write to the repository are refused unless ctx allows it,
+// and all of them are audited.
+func gitCommand(ctx context.Context, env []string, args ...string) (cmd *exec.Cmd, cancel context.CancelFunc, err error) {
+	err = checkGitWrites(ctx, args)
+	audit(ctx, repoDir(ctx), append([]string{"git"}, args...), err)
+	if err != nil {
+		return nil, nil, err
+	}
+	sb := sandboxOf(ctx)
+	if sb == nil {
+		cmd = exec.CommandContext(ctx, "git", args...)
+		cancel = func() {}
+	} else {
+		ctx, cancel = context.WithTimeout(ctx, sb.timeout)
+		name, sandboxed := sb.command(args)
+		cmd = exec.CommandContext(ctx, name, sandboxed...)
+		env = append(env, sb.env()...)
+	}
+	cmd.Dir = repoDir(ctx)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd, cancel, nil
+}
+
+func runGit(ctx context.Context, args ...string) ([]byte, error) {
+	return runGitWithEnv(ctx, nil, args...)
+}
+
+func runGitWithEnv(ctx context.Context, env []string, args ...string) ([]byte, error) {
+	ctx, span := startSpan(ctx, "git "+args[0])
+	defer span.End()
+	span.SetAttr("git.args", strings.Join(args, " "))
+
+	release, err := gitLimiter.acquire(ctx, repoDir(ctx))
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
+	defer release()
 
-	return strings.Split(string(output), "\n"), nil
+	cmd, cancel, err := gitCommand(ctx, env, args...)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer cancel()
+	output, err := cmd.Output()
+	if cmd.ProcessState != nil {
+		span.SetAttr("process.exit_code", cmd.ProcessState.ExitCode())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		span.SetAttr("process.stderr", strings.TrimSpace(string(exitErr.Stderr)))
+		err = newGitError(args, exitErr.Stderr, err)
+	} else if err != nil {
+		err = newGitError(args, nil, err)
+	}
+	span.SetError(err)
+	return output, err
 }
 
-func cmdGetFiles(ctx context.Context, commitHash string) ([]string, error) {
-	output, err := exec.CommandContext(ctx,
-		"git",
-		"diff",
-		"--name-only",
-		commitHash,
-	).Output()
+// commitFormat is the git log format of the commit fields the options ask
+// for, NUL separated; parseCommitFields reads them back.
+func commitFormat(opt Options) string {
+	format := "%h%x00%an <%ae>"
+	if opt.GetCommits.Signatures {
+		format += "%x00%G?%x00%GS%x00%GK"
+	}
+	if opt.GetCommits.Trailers {
+		format += "%x00%(trailers:unfold,separator=%x01)"
+	}
+	if opt.GetCommits.Subjects {
+		format += "%x00%s"
+	}
+	return format
+}
+
+func parseCommitFields(ctx context.Context, fields []string, opt Options) *commitObj {
+	commit := &commitObj{commitHash: fields[0], pseudonyms: pseudonymsOf(ctx)}
+	fields = fields[1:]
+	if len(fields) > 0 {
+		commit.author = fields[0]
+		fields = fields[1:]
+	}
+	if opt.GetCommits.Signatures && len(fields) > 2 {
+		commit.signature = SignatureStatus{Code: fields[0], Signer: fields[1], Key: fields[2]}
+		fields = fields[3:]
+	}
+	if opt.GetCommits.Trailers && len(fields) > 0 {
+		commit.trailers = parseTrailers(fields[0])
+		fields = fields[1:]
+	}
+	if opt.GetCommits.Subjects && len(fields) > 0 {
+		commit.subject = fields[0]
+		commit.pullRequest = parsePullRequest(fields[0])
+	}
+	return commit
+}
+
+// streamGit is runGit for outputs too big to hold twice: read consumes the
+// output while git writes it.
+func streamGit(ctx context.Context, read func(io.Reader) error, args ...string) error {
+	ctx, span := startSpan(ctx, "git "+args[0])
+	defer span.End()
+	span.SetAttr("git.args", strings.Join(args, " "))
+
+	release, err := gitLimiter.acquire(ctx, repoDir(ctx))
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd, cancelCmd, err := gitCommand(ctx, nil, args...)
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	defer cancelCmd()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		span.SetError(err)
+		return err
+	}
+	if err := read(stdout); err != nil {
+		cancel()
+		cmd.Wait()
+		span.SetError(err)
+		return err
+	}
+	err = cmd.Wait()
+	span.SetAttr("process.exit_code", cmd.ProcessState.ExitCode())
+	if err != nil {
+		span.SetAttr("process.stderr", strings.TrimSpace(stderr.String()))
+		err = newGitError(args, stderr.Bytes(), err)
+	}
+	span.SetError(err)
+	return err
+}
+
+func cmdGetCommits(ctx context.Context, opt Options) ([]string, error) {
+	args, err := commitWalkArgs(opt)
+	if err != nil {
+		return nil, err
+	}
+	output, err := runGit(ctx, append([]string{"log", "--pretty=format:" + commitFormat(opt)}, args...)...)
 	if err != nil {
 		return nil, err
 	}
+
 	return strings.Split(string(output), "\n"), nil
 }
 
-func cmdGetCommitTime(ctx context.Context, commitHash string) (time.Time, error) {
-	var output []byte
+// commitWalkArgs are the git log arguments selecting the commits the
+// options walk.
+func commitWalkArgs(opt Options) ([]string, error) {
+	args := []string{fmt.Sprintf("-%d", opt.GetCommits.Limit)}
+	switch opt.GetCommits.Merges {
+	case "", MergesInclude:
+	case MergesExclude:
+		args = append(args, "--no-merges")
+	case MergesOnly:
+		args = append(args, "--merges")
+	default:
+		return nil, fmt.Errorf("unknown merges mode %q", opt.GetCommits.Merges)
+	}
+	if opt.GetCommits.FirstParent {
+		args = append(args, "--first-parent")
+	}
+	// git reads timestamps before 1970 as garbage; every commit is newer.
+	if opt.GetCommits.Since.Unix() > 0 {
+		args = append(args, fmt.Sprintf("--since=%d", opt.GetCommits.Since.Unix()))
+	}
+	if !opt.GetCommits.Until.IsZero() {
+		args = append(args, fmt.Sprintf("--until=%d", opt.GetCommits.Until.Unix()))
+	}
+	if opt.GetCommits.Reflog {
+		args = append(args, "--walk-reflogs")
+	}
+	if opt.GetCommits.AllRefs {
+		// jj keeps abandoned commits reachable from these.
+		args = append(args, "--exclude=refs/jj/*", "--all")
+	}
+	for _, glob := range opt.GetCommits.Branches {
+		args = append(args, "--branches="+glob)
+	}
+	if opt.GetCommits.Ref != "" {
+		if err := checkRevision(opt.GetCommits.Ref); err != nil {
+			return nil, err
+		}
+		args = append(args, opt.GetCommits.Ref)
+	}
+	if len(opt.GetCommits.Commits) > 0 {
+		args = append(append(args, "--no-walk=unsorted"), opt.GetCommits.Commits...)
+	}
+	return args, nil
+}
 
-	cacheKey := fmt.Sprintf("cmdGetCommitTime-%s", commitHash)
-	if result, ok := cmdCache[cacheKey]; ok {
-		output, _ = result.([]byte)
+// cmdGetRefState describes where the refs a walk starts from point to.
+func cmdGetRefState(ctx context.Context, opt Options) (string, error) {
+	if len(opt.GetCommits.Commits) > 0 {
+		// The listed commits are the state; their hashes never move.
+		return strings.Join(opt.GetCommits.Commits, "\n"), nil
+	}
+	multiRef := opt.GetCommits.AllRefs || len(opt.GetCommits.Branches) > 0
+	var state string
+	if opt.GetCommits.Ref != "" {
+		output, err := runGit(ctx, "rev-parse", opt.GetCommits.Ref)
+		if err != nil {
+			return "", err
+		}
+		state = string(output)
+	} else {
+		// Walks of other refs do not need HEAD to have a commit yet.
+		head, ok, err := cmdResolveHead(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !ok && !multiRef {
+			return "", errNoCommits
+		}
+		state = head + "\n"
 	}
 
-	if len(output) == 0 {
-		out, err := exec.CommandContext(ctx,
-			"git",
-			"show",
-			"-s",
-			"--format=%cD",
-			commitHash,
-		).Output()
+	if multiRef {
+		output, err := runGit(ctx, "for-each-ref", "--format=%(objectname) %(refname)")
 		if err != nil {
-			return time.Time{}, err
+			return "", err
 		}
-		output = out
-		cmdCache[cacheKey] = output
+		state += string(output)
 	}
+	return state, nil
+}
 
-	parsedTime, err := time.Parse(time.RFC1123Z, string(output)[:len(output)-1])
+func cmdGetTip(ctx context.Context, rev string) (string, error) {
+	output, err := runGit(ctx,
+		"rev-parse",
+		"--verify",
+		rev+"^{commit}",
+	)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func cmdIsAncestor(ctx context.Context, ancestor string, commitHash string) (bool, error) {
+	_, err := runGit(ctx,
+		"merge-base",
+		"--is-ancestor",
+		ancestor,
+		commitHash,
+	)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func cmdCountCommits(ctx context.Context, revRange string) (int, error) {
+	output, err := runGit(ctx,
+		"rev-list",
+		"--count",
+		revRange,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+func cmdGetTopLevel(ctx context.Context) (string, error) {
+	output, err := runGit(ctx,
+		"rev-parse",
+		"--show-toplevel",
+	)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func cmdReadFile(ctx context.Context, rev string, path string) ([]byte, bool, error) {
+	output, err := runGit(ctx,
+		"ls-tree",
+		"--name-only",
+		rev,
+		"--",
+		path,
+	)
+	if err != nil || len(output) == 0 {
+		return nil, false, err
+	}
+	output, err = runGit(ctx,
+		"cat-file",
+		"blob",
+		rev+":"+path,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	return output, true, nil
+}
+
+// cmdGetFiles lists the files of a commit, and the kinds of those that are
+// not regular files.
+func cmdGetFiles(ctx context.Context, commitHash string, mode filesMode) ([]string, map[string]FileKind, error) {
+	args := []string{
+		"-c", "core.quotePath=off",
+		"diff-tree",
+		"--no-commit-id",
+		"-r",
+		"--root",
+		"--raw",
+	}
+	if mode.ignoreFormatting {
+		args = append(args, whitespaceArgs...)
+	}
+	if mode.mergeDiff != MergeDiffAuto {
+		args = append(args, "--diff-merges="+string(mode.mergeDiff))
+	}
+	args = append(args, commitHash)
+	args = append(args, mode.pathspecArgs()...)
+
+	output, err := runGit(ctx, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := strings.Split(string(output), "\n")
+	names := map[string][]string{commitHash: make([]string, 0, len(lines))}
+	kinds := make(map[string]FileKind)
+	for _, line := range lines {
+		name := ""
+		if rawName, kind, ok := parseRawLine(line); ok {
+			if kind != FileKindRegular {
+				kinds[rawName] = kind
+			}
+			if mode.ignoreFormatting {
+				// The --numstat lines after say which changes count.
+				continue
+			}
+			name = rawName
+		} else if mode.ignoreFormatting {
+			name = numstatName(line)
+		}
+		if name != "" {
+			names[commitHash] = append(names[commitHash], name)
+		}
+	}
+	if !mode.ignoreFormatting {
+		return names[commitHash], kinds, nil
+	}
+	if err := dropGofmtChanges(ctx, names); err != nil {
+		return nil, nil, err
+	}
+	return names[commitHash], kinds, nil
+}
+
+func cmdGetCommitTime(ctx context.Context, commitHash string) (time.Time, error) {
+	output, err := runGit(ctx,
+		"show",
+		"-s",
+		"--format=%cD",
+		commitHash,
+	)
 	if err != nil {
 		return time.Time{}, err
 	}
-	return parsedTime, nil
+	return parseCommitTime(strings.TrimSuffix(string(output), "\n"))
+}
+
+// parseCommitTime reads a %cD date, which does not pad the day of the
+// month, unlike time.RFC1123Z.
+func parseCommitTime(s string) (time.Time, error) {
+	return time.Parse("Mon, 2 Jan 2006 15:04:05 -0700", s)
 }
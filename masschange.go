@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// MassChanges are the thresholds past which a commit is a mass change, a
+// repository-wide rename, license header update or reformatting, whose
+// files say nothing about where work happens: more than Files files
+// changed, or more than Percent percent of the files in the walked tree.
+// Zero disables a threshold.
+type MassChanges struct {
+	Files   int
+	Percent float64
+}
+
+func (m MassChanges) enabled() bool {
+	return m.Files > 0 || m.Percent > 0
+}
+
+// massChange is a commit past the thresholds.
+type massChange struct {
+	Commit  Commit
+	Files   int
+	Percent float64
+}
+
+// splitMassChanges separates the mass changes from the other commits. The
+// share of the repository a commit changed, measured for the Percent
+// threshold or when share is set, is of the files in the tree at the tip of
+// the walk.
+func splitMassChanges(ctx context.Context, opt Options, commits []Commit, share bool) ([]Commit, []massChange, error) {
+	m := opt.GetCommits.ExcludeMassChanges
+	if err := Preload(ctx, commits, CommitFieldFiles); err != nil {
+		return nil, nil, err
+	}
+	treeFiles := 0
+	if m.Percent > 0 || share {
+		names, err := cmdListTree(ctx, treeRev(opt.GetCommits.Ref))
+		if err != nil {
+			return nil, nil, err
+		}
+		treeFiles = len(names)
+	}
+
+	kept := make([]Commit, 0, len(commits))
+	excluded := make([]massChange, 0)
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		change := massChange{Commit: commit, Files: len(files)}
+		if treeFiles > 0 {
+			change.Percent = 100 * float64(len(files)) / float64(treeFiles)
+		}
+		if (m.Files > 0 && change.Files > m.Files) || (m.Percent > 0 && change.Percent > m.Percent) {
+			excluded = append(excluded, change)
+			continue
+		}
+		kept = append(kept, commit)
+	}
+	return kept, excluded, nil
+}
+
+// excludeMassChanges drops the mass changes from the commits, naming them
+// under GITILITY_DEBUG.
+func excludeMassChanges(ctx context.Context, opt Options, commits []Commit) ([]Commit, error) {
+	kept, excluded, err := splitMassChanges(ctx, opt, commits, false)
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv(debugEnv) != "" {
+		for _, change := range excluded {
+			log.Printf("excluded mass change %s: %d files", change.Commit.CommitHash(), change.Files)
+		}
+	}
+	return kept, nil
+}
+
+// runMassChanges lists the commits of the walk the mass change thresholds
+// exclude, 100 files or 10% of the repository unless given.
+func runMassChanges(args []string) error {
+	flags := flag.NewFlagSet("mass-changes", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	asJSON := flags.Bool("json", false, "print a JSON array")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	opt := q.opt
+	if !opt.GetCommits.ExcludeMassChanges.enabled() {
+		opt.GetCommits.ExcludeMassChanges = MassChanges{Files: 100}
+		if q.backend.marker == gitBackend.marker {
+			opt.GetCommits.ExcludeMassChanges.Percent = 10
+		}
+	}
+	walk := opt
+	walk.GetCommits.ExcludeMassChanges = MassChanges{}
+	walk.GetCommits.Subjects = true
+	commits, err := q.backend.commits(ctx, walk)
+	if err != nil {
+		return err
+	}
+	_, excluded, err := splitMassChanges(ctx, opt, commits, q.backend.marker == gitBackend.marker)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		type massChangeJSON struct {
+			Commit  string  `json:"commit"`
+			Subject string  `json:"subject"`
+			Files   int     `json:"files"`
+			Percent float64 `json:"percent"`
+		}
+		out := make([]massChangeJSON, 0, len(excluded))
+		for _, change := range excluded {
+			out = append(out, massChangeJSON{change.Commit.CommitHash(), change.Commit.Subject(), change.Files, change.Percent})
+		}
+		return printJSON(out)
+	}
+	if len(excluded) == 0 {
+		return errors.New("no mass change in the walked commits")
+	}
+	for _, change := range excluded {
+		fmt.Printf("%s %6d files %5.1f%%  %s\n", change.Commit.CommitHash(), change.Files, change.Percent, change.Commit.Subject())
+	}
+	return nil
+}
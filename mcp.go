@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// gitility mcp is a Model Context Protocol server over stdio: coding
+// assistants call its tools to ask a repository what changed lately and who
+// owns it. Messages are JSON-RPC 2.0, one per line.
+
+const mcpProtocolVersion = "2024-11-05"
+
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes.
+const (
+	mcpParseError     = -32700
+	mcpMethodNotFound = -32601
+	mcpInvalidParams  = -32602
+)
+
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	run         func(ctx context.Context, q *query, args mcpArgs) (interface{}, error)
+}
+
+// mcpArgs are the arguments of a tool call. Every tool walks the commits
+// like the CLI: limit, ref and flags, more query flags in their command
+// line form, pick them.
+type mcpArgs struct {
+	Limit *int     `json:"limit"`
+	Ref   string   `json:"ref"`
+	Flags []string `json:"flags"`
+	Top   int      `json:"top"`
+	Path  string   `json:"path"`
+}
+
+// mcpToolFlags are the query flags a tool call may pass: the ones that
+// filter and range the walk. The others would have the server clone,
+// fetch, write to the repository, send a token or read a file of its own
+// choosing, on the word of an assistant or of what it read.
+var mcpToolFlags = map[string]bool{
+	"limit":               true,
+	"ref":                 true,
+	"author":              true,
+	"exclude-author":      true,
+	"no-bots":             true,
+	"signed-only":         true,
+	"where":               true,
+	"team":                true,
+	"exclude-kind":        true,
+	"class":               true,
+	"min-authors":         true,
+	"max-authors":         true,
+	"trailer":             true,
+	"merges":              true,
+	"no-merges":           true,
+	"first-parent":        true,
+	"merge-diff":          true,
+	"sample-every":        true,
+	"sample-percent":      true,
+	"sample-seed":         true,
+	"all-branches":        true,
+	"branches":            true,
+	"keep-cherry-picks":   true,
+	"reflog":              true,
+	"notebooks":           true,
+	"lines":               true,
+	"ignore-formatting":   true,
+	"mass-change-files":   true,
+	"mass-change-percent": true,
+	"dedup":               true,
+	"dedup-ignore-case":   true,
+	"dedup-nfc":           true,
+	"follow-moves":        true,
+	"anonymize":           true,
+	"quote-names":         true,
+}
+
+func mcpSchema(required []string, extra map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{
+		"limit": map[string]interface{}{"type": "integer", "description": "number of commits to walk"},
+		"ref":   map[string]interface{}{"type": "string", "description": "revision or range to walk, e.g. origin/main..HEAD"},
+		"flags": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "more gitility query flags filtering and ranging the walk, e.g. [\"-no-bots\", \"-class\", \"app\"]",
+		},
+	}
+	for name, property := range extra {
+		properties[name] = property
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var topProperty = map[string]interface{}{
+	"top": map[string]interface{}{"type": "integer", "description": "number of entries to return, 0 for all"},
+}
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "recent_files",
+		Description: "List the files changed by the recent commits, newest first, each with the last commit changing it.",
+		InputSchema: mcpSchema(nil, nil),
+		run: func(ctx context.Context, q *query, args mcpArgs) (interface{}, error) {
+			files, err := getOrderFiles(q.backend.commits, ctx, q.listingOptions(), q.filters...)
+			if err != nil {
+				return nil, err
+			}
+			if err := q.err(); err != nil {
+				return nil, err
+			}
+			return fileResults(ctx, q.aggregate(files))
+		},
+	},
+	{
+		Name:        "hotspots",
+		Description: "Rank the files by how many of the walked commits changed them.",
+		InputSchema: mcpSchema(nil, topProperty),
+		run: func(ctx context.Context, q *query, args mcpArgs) (interface{}, error) {
+			o, err := collectOwnership(ctx, q, false)
+			if err != nil {
+				return nil, err
+			}
+			hotspots := o.hotspots()
+			if args.Top > 0 && len(hotspots) > args.Top {
+				hotspots = hotspots[:args.Top]
+			}
+			return hotspotResults(hotspots), nil
+		},
+	},
+	{
+		Name:        "ownership",
+		Description: "Tell who owns the code: the main author of every file and their share of its changes, the authors ranked by changes, and the bus factor.",
+		InputSchema: mcpSchema(nil, topProperty),
+		run: func(ctx context.Context, q *query, args mcpArgs) (interface{}, error) {
+			o, err := collectOwnership(ctx, q, false)
+			if err != nil {
+				return nil, err
+			}
+			type fileOwner struct {
+				Name    string  `json:"name"`
+				Owner   string  `json:"owner"`
+				Share   float64 `json:"share"`
+				Authors int     `json:"authors"`
+			}
+			files := make([]fileOwner, 0, len(o.order))
+			for _, name := range o.order {
+				shares := o.sorted(o.files[name])
+				total := 0.0
+				for _, share := range shares {
+					total += share.Weight
+				}
+				files = append(files, fileOwner{Name: name, Owner: shares[0].Author, Share: shares[0].Weight / total, Authors: len(shares)})
+			}
+			owners := o.sorted(o.totals)
+			if args.Top > 0 && len(owners) > args.Top {
+				owners = owners[:args.Top]
+			}
+			busFactor, _ := o.busFactor()
+			return struct {
+				BusFactor int           `json:"bus_factor"`
+				Owners    []authorShare `json:"owners"`
+				Files     []fileOwner   `json:"files"`
+			}{busFactor, owners, files}, nil
+		},
+	},
+	{
+		Name:        "file_history",
+		Description: "List the commits changing a file, newest first, following renames, with their author and line counts.",
+		InputSchema: mcpSchema([]string{"path"}, map[string]interface{}{
+			"path": map[string]interface{}{"type": "string", "description": "path of the file, from the repository root"},
+		}),
+		run: func(ctx context.Context, q *query, args mcpArgs) (interface{}, error) {
+			if args.Path == "" {
+				return nil, errors.New("file_history needs a path")
+			}
+			changes, err := fileHistory(ctx, q, args.Path)
+			if err != nil {
+				return nil, err
+			}
+			if err := q.err(); err != nil {
+				return nil, err
+			}
+			type historyEntry struct {
+				Commit  string    `json:"commit"`
+				Author  string    `json:"author"`
+				Time    time.Time `json:"time"`
+				Name    string    `json:"name"`
+				Added   int       `json:"added"`
+				Deleted int       `json:"deleted"`
+			}
+			entries := make([]historyEntry, 0, len(changes))
+			for _, change := range changes {
+				commit := change.GetCommit()
+				commitTime, err := commit.CommitTime(ctx)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, historyEntry{commit.CommitHash(), commit.Author(), commitTime, change.Name(), change.Added, change.Deleted})
+			}
+			return entries, nil
+		},
+	},
+}
+
+type mcpServer struct {
+	dir          string
+	timeout      time.Duration
+	trustPlugins bool
+}
+
+func (s *mcpServer) handle(ctx context.Context, req mcpRequest) (interface{}, *mcpError) {
+	switch req.Method {
+	case "initialize":
+		params := struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}{}
+		json.Unmarshal(req.Params, &params)
+		version := params.ProtocolVersion
+		if version == "" {
+			version = mcpProtocolVersion
+		}
+		return map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "gitility", "version": "0"},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": mcpTools}, nil
+	case "tools/call":
+		params := struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}{}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &mcpError{Code: mcpInvalidParams, Message: err.Error()}
+		}
+		for _, tool := range mcpTools {
+			if tool.Name == params.Name {
+				return s.call(ctx, tool, params.Arguments), nil
+			}
+		}
+		return nil, &mcpError{Code: mcpInvalidParams, Message: fmt.Sprintf("no tool %q", params.Name)}
+	}
+	return nil, &mcpError{Code: mcpMethodNotFound, Message: fmt.Sprintf("no method %q", req.Method)}
+}
+
+// call runs a tool. Its failures are results the assistant reads, not
+// protocol errors.
+func (s *mcpServer) call(ctx context.Context, tool mcpTool, raw json.RawMessage) interface{} {
+	result, err := s.run(ctx, tool, raw)
+	var text []byte
+	if err == nil {
+		text, err = json.MarshalIndent(result, "", "  ")
+	}
+	if err != nil {
+		return map[string]interface{}{
+			"content": []interface{}{map[string]interface{}{"type": "text", "text": err.Error()}},
+			"isError": true,
+		}
+	}
+	return map[string]interface{}{
+		"content": []interface{}{map[string]interface{}{"type": "text", "text": string(text)}},
+	}
+}
+
+func (s *mcpServer) run(ctx context.Context, tool mcpTool, raw json.RawMessage) (interface{}, error) {
+	args := mcpArgs{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return nil, err
+		}
+	}
+	flags := flag.NewFlagSet(tool.Name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	queryFlags := addQueryFlags(flags, 100)
+	cmdline := append([]string{}, args.Flags...)
+	if args.Limit != nil {
+		cmdline = append(cmdline, "-limit", strconv.Itoa(*args.Limit))
+	}
+	if args.Ref != "" {
+		cmdline = append(cmdline, "-ref", args.Ref)
+	}
+	if err := flags.Parse(cmdline); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q in flags", flags.Arg(0))
+	}
+	var refused string
+	flags.Visit(func(f *flag.Flag) {
+		if !mcpToolFlags[f.Name] && refused == "" {
+			refused = f.Name
+		}
+	})
+	if refused != "" {
+		return nil, fmt.Errorf("-%s is not for tools: they only pass the flags that filter and range the walk", refused)
+	}
+	*queryFlags.trustPlugins = s.trustPlugins
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if s.dir != "" {
+		ctx = withRepoDir(ctx, s.dir)
+	}
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer q.close()
+	return tool.run(ctx, q, args)
+}
+
+// serve answers the requests of r on w until r ends. Requests are answered
+// one at a time, in order.
+func (s *mcpServer) serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	encoder := json.NewEncoder(w)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		req := mcpRequest{}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			if err := encoder.Encode(mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{Code: mcpParseError, Message: err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		result, rpcErr := s.handle(ctx, req)
+		// Notifications get no answer.
+		if len(req.ID) == 0 {
+			continue
+		}
+		if err := encoder.Encode(mcpResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func runMCP(args []string) error {
+	flags := flag.NewFlagSet("mcp", flag.ExitOnError)
+	dir := flags.String("C", "", "answer about the repository in `dir` instead of the working directory")
+	timeout := flags.Duration("timeout", time.Minute, "give up on a tool call after `duration`")
+	trustPlugins := flags.Bool("trust-plugins", false, "run the plugins the repository declares in "+configFileName)
+	flags.Parse(args)
+
+	s := &mcpServer{dir: *dir, timeout: *timeout, trustPlugins: *trustPlugins}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go defaultTracer.flushLoop(ctx)
+	done := make(chan error, 1)
+	go func() { done <- s.serve(ctx, os.Stdin, os.Stdout) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		// Stopped: return, for the spans to be flushed on the way out.
+		return nil
+	}
+}
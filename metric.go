@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metric is a figure measured on the files of a walk, next to the built-in
+// alert metrics: it can be printed by gitility metrics, compared by alert
+// rules and weighed into the risk score. Go programs register theirs with
+// RegisterMetric; others declare a metric plugin in .gitility.yaml.
+type Metric interface {
+	// Name is how rules, weights and -metric name the metric; it must be
+	// an identifier.
+	Name() string
+	// Collect measures the files of a walk: commits are the walked
+	// commits, newest first, and files every file they changed the query
+	// keeps, once, for its newest change.
+	Collect(ctx context.Context, commits []Commit, files []File) error
+	// Value is the measure of a file, or of a directory, after Collect;
+	// false when the metric has none for it.
+	Value(name string) (float64, bool)
+}
+
+var metricRegistry struct {
+	mu      sync.Mutex
+	metrics []Metric
+}
+
+// RegisterMetric makes a metric available to every query of the program.
+func RegisterMetric(m Metric) error {
+	name := m.Name()
+	if !isIdentifier(name) {
+		return fmt.Errorf("metric name %q: want an identifier", name)
+	}
+	for _, builtin := range append(append([]string{}, alertMetrics...), riskComponents...) {
+		if name == builtin {
+			return fmt.Errorf("metric %s: the name is taken by a built-in one", name)
+		}
+	}
+	metricRegistry.mu.Lock()
+	defer metricRegistry.mu.Unlock()
+	for _, other := range metricRegistry.metrics {
+		if other.Name() == name {
+			return fmt.Errorf("metric %s registered twice", name)
+		}
+	}
+	metricRegistry.metrics = append(metricRegistry.metrics, m)
+	return nil
+}
+
+func isIdentifier(name string) bool {
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+const pluginMetric = "metric"
+
+// metricPlugin is a metric plugin: it receives the JSON array of the files,
+// like a report plugin, and answers with a JSON object of their values by
+// name.
+type metricPlugin struct {
+	cfg    pluginConfig
+	dir    string
+	values map[string]float64
+}
+
+func (p *metricPlugin) Name() string { return p.cfg.Name }
+
+func (p *metricPlugin) Collect(ctx context.Context, commits []Commit, files []File) error {
+	results, err := fileResults(ctx, files)
+	if err != nil {
+		return err
+	}
+	input, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, p.cfg.Command, p.cfg.Args...)
+	cmd.Dir = p.dir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.cfg.Name, err)
+	}
+	p.values = make(map[string]float64)
+	if err := json.Unmarshal(output, &p.values); err != nil {
+		return fmt.Errorf("plugin %s: %w", p.cfg.Name, err)
+	}
+	return nil
+}
+
+func (p *metricPlugin) Value(name string) (float64, bool) {
+	v, ok := p.values[name]
+	return v, ok
+}
+
+// metrics are the custom metrics of the query: the registered ones, then
+// the metric plugins of its configuration.
+func (q *query) metrics() ([]Metric, error) {
+	metricRegistry.mu.Lock()
+	metrics := append([]Metric(nil), metricRegistry.metrics...)
+	metricRegistry.mu.Unlock()
+	for _, cfg := range q.config.Plugins {
+		if cfg.Kind != pluginMetric {
+			continue
+		}
+		m := &metricPlugin{cfg: cfg, dir: q.topLevel}
+		for _, other := range metrics {
+			if other.Name() == m.Name() {
+				return nil, fmt.Errorf("%s: metric %s declared twice", configFileName, m.Name())
+			}
+		}
+		if !isIdentifier(m.Name()) {
+			return nil, fmt.Errorf("%s: metric name %q: want an identifier", configFileName, m.Name())
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// pickMetrics are the metrics of names, in order.
+func pickMetrics(metrics []Metric, names []string) ([]Metric, error) {
+	picked := make([]Metric, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, m := range metrics {
+			if m.Name() == name {
+				picked = append(picked, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no metric %q", name)
+		}
+	}
+	return picked, nil
+}
+
+func runMetrics(args []string) error {
+	flags := flag.NewFlagSet("metrics", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	rank := addRankFlags(flags, 20)
+	var names stringsFlag
+	flags.Var(&names, "metric", "also measure the custom metric `name` (repeatable, default all of them)")
+	sortBy := flags.String("sort", "changes", "rank the files by the metric `name`")
+	asJSON := flags.Bool("json", false, "print the files and their metrics as a JSON array")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if err := rank.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	custom, err := q.metrics()
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		if custom, err = pickMetrics(custom, names); err != nil {
+			return err
+		}
+	}
+	columns := append([]string{}, alertMetrics...)
+	for _, m := range custom {
+		columns = append(columns, m.Name())
+	}
+	known := false
+	for _, column := range columns {
+		known = known || column == *sortBy
+	}
+	if !known {
+		return fmt.Errorf("-sort: no metric %q", *sortBy)
+	}
+
+	files, err := fileMetrics(ctx, q, time.Now(), custom)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		vi, vj := files[i].metrics[*sortBy], files[j].metrics[*sortBy]
+		if vi != vj {
+			return vi > vj
+		}
+		return files[i].Name() < files[j].Name()
+	})
+	files = files[:rank.keep(len(files), func(i int) float64 { return files[i].metrics[*sortBy] })]
+	if len(files) == 0 {
+		return errors.New("no file changed in the walked commits")
+	}
+	if *asJSON {
+		out := make([]alertedFile, 0, len(files))
+		for _, mf := range files {
+			out = append(out, alertedFile{Name: mf.Name(), Metrics: mf.metrics})
+		}
+		return printJSON(out)
+	}
+	for _, column := range columns {
+		fmt.Printf("%13s ", column)
+	}
+	fmt.Println("file")
+	for _, mf := range files {
+		for _, column := range columns {
+			if v, ok := mf.metrics[column]; ok {
+				fmt.Printf("%13.4g ", v)
+			} else {
+				fmt.Printf("%13s ", "-")
+			}
+		}
+		fmt.Println(displayName(ctx, mf.Name()))
+	}
+	return nil
+}
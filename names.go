@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A file name can hold any byte but NUL and the slash: newlines that fake
+// report lines, terminal escape sequences, or bidirectional overrides that
+// show a name other than the one stored. git quotes those names C-style
+// even with core.quotePath off; unquoteGitName reads them back, and
+// displayName quotes them again in the text reports.
+
+// unquoteGitName reads a name git may have quoted, "a\tb" for a name with
+// a tab.
+func unquoteGitName(name string) string {
+	if len(name) < 2 || name[0] != '"' || name[len(name)-1] != '"' {
+		return name
+	}
+	// git's escapes, octal bytes included, are Go's.
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		return unquoted
+	}
+	return name
+}
+
+// The -quote-names modes.
+const (
+	quoteNamesC    = "c"
+	quoteNamesJSON = "json"
+	quoteNamesNone = "none"
+)
+
+type nameQuotingKey struct{}
+
+// withNameQuoting makes the text reports of the query run with ctx print
+// unsafe names the way of the -quote-names mode.
+func withNameQuoting(ctx context.Context, mode string) context.Context {
+	return context.WithValue(ctx, nameQuotingKey{}, mode)
+}
+
+// nameQuoting is the -quote-names mode of ctx, c by default.
+func nameQuoting(ctx context.Context) string {
+	if mode, ok := ctx.Value(nameQuotingKey{}).(string); ok {
+		return mode
+	}
+	return quoteNamesC
+}
+
+// unsafeName tells the names a terminal would not print as they are
+// stored: with control or format characters, the bidirectional ones among
+// them, or bytes that are not UTF-8. Names starting with a double quote
+// would pass for quoted ones.
+func unsafeName(name string) bool {
+	if strings.HasPrefix(name, `"`) {
+		return true
+	}
+	for _, r := range name {
+		if r == utf8.RuneError || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return true
+		}
+	}
+	return !utf8.ValidString(name)
+}
+
+// displayName is the name as the text reports print it: unsafe names come
+// quoted, C-style, or as a JSON string, unless -quote-names none.
+func displayName(ctx context.Context, name string) string {
+	mode := nameQuoting(ctx)
+	if mode == quoteNamesNone || !unsafeName(name) {
+		return name
+	}
+	if mode == quoteNamesJSON {
+		// Unlike encoding/json, escape the format characters too; bytes
+		// that are not UTF-8 have no JSON escape and become U+FFFD.
+		var b strings.Builder
+		b.WriteByte('"')
+		for _, r := range strings.ToValidUTF8(name, "�") {
+			switch {
+			case r == '"' || r == '\\':
+				b.WriteString(`\` + string(r))
+			case r > 0xffff && unicode.Is(unicode.Cf, r):
+				r1, r2 := utf16.EncodeRune(r)
+				fmt.Fprintf(&b, `\u%04x\u%04x`, r1, r2)
+			case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+				fmt.Fprintf(&b, `\u%04x`, r)
+			default:
+				b.WriteRune(r)
+			}
+		}
+		b.WriteByte('"')
+		return b.String()
+	}
+	return strconv.Quote(name)
+}
+
+// parseQuoteNames checks a -quote-names mode.
+func parseQuoteNames(mode string) error {
+	switch mode {
+	case quoteNamesC, quoteNamesJSON, quoteNamesNone:
+		return nil
+	}
+	return fmt.Errorf("unknown -quote-names %q, want c, json or none", mode)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// File names reach git as the bytes the file system handed over, and macOS
+// hands over decomposed Unicode: é as e and a combining acute accent, where
+// Linux keeps the composed é the name was typed with. The same file then
+// shows up under two names. normalizeNFC composes them back for the
+// letters names are written with: Latin, Greek and Cyrillic, from the
+// canonical compositions of Unicode, and Hangul syllables, which compose by
+// arithmetic. Like Unicode, it decomposes the name and orders the marks of
+// each letter first, so the marks below and above a letter compose in
+// whatever order they were typed.
+
+// nfcCompositions are the canonical compositions by combining mark: pairs
+// of the base letter and the letter it composes to with the mark.
+var nfcCompositions = map[rune]string{
+	0x0300: "AÀEÈIÌNǸOÒUÙWẀYỲaàeèiìnǹoòuùwẁyỳ¨῭" +
+		"ÂẦÊỀÔỒÜǛâầêềôồüǜĂẰăằĒḔēḕ" +
+		"ŌṐōṑƠỜơờƯỪưừΑᾺΕῈΗῊΙῚΟῸΥῪ" +
+		"ΩῺαὰεὲηὴιὶοὸυὺωὼϊῒϋῢЕЀИЍ" +
+		"еѐиѝἀἂἁἃἈἊἉἋἐἒἑἓἘἚἙἛ" +
+		"ἠἢἡἣἨἪἩἫἰἲἱἳἸἺἹἻὀὂὁὃ" +
+		"ὈὊὉὋὐὒὑὓὙὛὠὢὡὣὨὪὩὫ᾿῍" +
+		"῾῝",
+	0x0301: "AÁCĆEÉGǴIÍKḰLĹMḾNŃOÓPṔRŔSŚUÚWẂYÝZŹaá" +
+		"cćeégǵiíkḱlĺmḿnńoópṕrŕsśuúwẃyýzź¨΅" +
+		"ÂẤÅǺÆǼÇḈÊẾÏḮÔỐÕṌØǾÜǗâấåǻæǽ" +
+		"çḉêếïḯôốõṍøǿüǘĂẮăắĒḖēḗŌṒ" +
+		"ōṓŨṸũṹƠỚơớƯỨưứΑΆΕΈΗΉΙΊΟΌΥΎ" +
+		"ΩΏαάεέηήιίοόυύωώϊΐϋΰϒϓГЃКЌгѓкќ" +
+		"ἀἄἁἅἈἌἉἍἐἔἑἕἘἜἙἝἠἤἡἥ" +
+		"ἨἬἩἭἰἴἱἵἸἼἹἽὀὄὁὅὈὌὉὍ" +
+		"ὐὔὑὕὙὝὠὤὡὥὨὬὩὭ᾿῎῾῞",
+	0x0302: "AÂCĈEÊGĜHĤIÎJĴOÔSŜUÛWŴYŶZẐaâcĉeêgĝhĥiî" +
+		"jĵoôsŝuûwŵyŷzẑẠẬạậẸỆẹệỌỘọộ",
+	0x0303: "AÃEẼIĨNÑOÕUŨVṼYỸaãeẽiĩnñoõuũvṽyỹÂẪ" +
+		"ÊỄÔỖâẫêễôỗĂẴăẵƠỠơỡƯỮưữ",
+	0x0304: "AĀEĒGḠIĪOŌUŪYȲaāeēgḡiīoōuūyȳÄǞÆǢÕȬÖȪ" +
+		"ÜǕäǟæǣõȭöȫüǖǪǬǫǭȦǠȧǡȮȰȯȱΑᾹΙῙ" +
+		"ΥῩαᾱιῑυῡИӢУӮиӣуӯḶḸḷḹṚṜṛṝ",
+	0x0306: "AĂEĔGĞIĬOŎUŬaăeĕgğiĭoŏuŭȨḜȩḝΑᾸΙῘ" +
+		"ΥῨαᾰιῐυῠАӐЕӖЖӁИЙУЎаӑеӗжӂийуў" +
+		"ẠẶạặ",
+	0x0307: "AȦBḂCĊDḊEĖFḞGĠHḢIİMṀNṄOȮPṖRṘSṠTṪ" +
+		"WẆXẊYẎZŻaȧbḃcċdḋeėfḟgġhḣmṁnṅoȯpṗ" +
+		"rṙsṡtṫwẇxẋyẏzżŚṤśṥŠṦšṧſẛṢṨ" +
+		"ṣṩ",
+	0x0308: "AÄEËHḦIÏOÖUÜWẄXẌYŸaäeëhḧiïoötẗuüwẅ" +
+		"xẍyÿÕṎõṏŪṺūṻΙΪΥΫιϊυϋϒϔІЇАӒЕЁ" +
+		"ЖӜЗӞИӤОӦУӰЧӴЫӸЭӬаӓеёжӝзӟиӥоӧуӱ" +
+		"чӵыӹэӭіїӘӚәӛӨӪөӫ",
+	0x0309: "AẢEẺIỈOỎUỦYỶaảeẻiỉoỏuủyỷÂẨÊỂ" +
+		"ÔỔâẩêểôổĂẲăẳƠỞơởƯỬưử",
+	0x030A: "AÅUŮaåuůwẘyẙ",
+	0x030B: "OŐUŰoőuűУӲуӳ",
+	0x030C: "AǍCČDĎEĚGǦHȞIǏKǨLĽNŇOǑRŘSŠTŤUǓZŽaǎcčdďeě" +
+		"gǧhȟiǐjǰkǩlľnňoǒrřsštťuǔzžÜǙüǚƷǮʒǯ",
+	0x030F: "AȀEȄIȈOȌRȐUȔaȁeȅiȉoȍrȑuȕѴѶѵѷ",
+	0x0311: "AȂEȆIȊOȎRȒUȖaȃeȇiȋoȏrȓuȗ",
+	0x0313: "ΑἈΕἘΗἨΙἸΟὈΩὨαἀεἐηἠιἰοὀρῤ" +
+		"υὐωὠ",
+	0x0314: "ΑἉΕἙΗἩΙἹΟὉΡῬΥὙΩὩαἁεἑηἡιἱ" +
+		"οὁρῥυὑωὡ",
+	0x031B: "OƠUƯoơuư",
+	0x0323: "AẠBḄDḌEẸHḤIỊKḲLḶMṂNṆOỌRṚSṢTṬUỤ" +
+		"VṾWẈYỴZẒaạbḅdḍeẹhḥiịkḳlḷmṃnṇoọ" +
+		"rṛsṣtṭuụvṿwẉyỵzẓƠỢơợƯỰưự",
+	0x0324: "UṲuṳ",
+	0x0325: "AḀaḁ",
+	0x0326: "SȘTȚsștț",
+	0x0327: "CÇDḐEȨGĢHḨKĶLĻNŅRŖSŞTŢcçdḑeȩgģhḩkķlļ" +
+		"nņrŗsştţ",
+	0x0328: "AĄEĘIĮOǪUŲaąeęiįoǫuų",
+	0x032D: "DḒEḘLḼNṊTṰUṶdḓeḙlḽnṋtṱuṷ",
+	0x032E: "HḪhḫ",
+	0x0330: "EḚIḬUṴeḛiḭuṵ",
+	0x0331: "BḆDḎKḴLḺNṈRṞTṮZẔbḇdḏhẖkḵlḻnṉrṟ" +
+		"tṯzẕ",
+	0x0342: "¨῁αᾶηῆιῖυῦωῶϊῗϋῧἀἆἁἇἈἎ" +
+		"ἉἏἠἦἡἧἨἮἩἯἰἶἱἷἸἾἹἿὐὖ" +
+		"ὑὗὙὟὠὦὡὧὨὮὩὯ᾿῏῾῟",
+	0x0345: "ΑᾼΗῌΩῼάᾴήῄαᾳηῃωῳώῴἀᾀἁᾁ" +
+		"ἂᾂἃᾃἄᾄἅᾅἆᾆἇᾇἈᾈἉᾉἊᾊἋᾋ" +
+		"ἌᾌἍᾍἎᾎἏᾏἠᾐἡᾑἢᾒἣᾓἤᾔἥᾕ" +
+		"ἦᾖἧᾗἨᾘἩᾙἪᾚἫᾛἬᾜἭᾝἮᾞἯᾟ" +
+		"ὠᾠὡᾡὢᾢὣᾣὤᾤὥᾥὦᾦὧᾧὨᾨὩᾩ" +
+		"ὪᾪὫᾫὬᾬὭᾭὮᾮὯᾯὰᾲὴῂὼῲᾶᾷ" +
+		"ῆῇῶῷ",
+}
+
+// nfcSingletons decompose without ever composing back: the ohm sign is an
+// omega, the Kelvin sign a K and the Greek letters with an oxia the ones
+// with a tonos.
+var nfcSingletons = map[rune]string{
+	0x0340: "\u0300",
+	0x0341: "\u0301",
+	0x0343: "\u0313",
+	0x0344: "\u0308\u0301",
+	0x0374: "ʹ",
+	0x037E: ";",
+	0x0387: "·",
+	0x1F71: "ά",
+	0x1F73: "έ",
+	0x1F75: "ή",
+	0x1F77: "ί",
+	0x1F79: "ό",
+	0x1F7B: "ύ",
+	0x1F7D: "ώ",
+	0x1FBB: "Ά",
+	0x1FBE: "ι",
+	0x1FC9: "Έ",
+	0x1FCB: "Ή",
+	0x1FD3: "ΐ",
+	0x1FDB: "Ί",
+	0x1FE3: "ΰ",
+	0x1FEB: "Ύ",
+	0x1FEE: "΅",
+	0x1FEF: "`",
+	0x1FF9: "Ό",
+	0x1FFB: "Ώ",
+	0x1FFD: "´",
+	0x2000: "\u2002",
+	0x2001: "\u2003",
+	0x2126: "Ω",
+	0x212A: "K",
+	0x212B: "Å",
+	0x2329: "〈",
+	0x232A: "〉",
+}
+
+// nfcClasses are the canonical combining classes of the combining
+// diacritical marks, U+0300 to U+036F, each from the first mark of its run.
+// The marks of a letter go by class: overlays, the horn, the cedilla and
+// ogonek, the marks below, above, then the iota subscript. Any other
+// character is read as a letter of its own.
+var nfcClasses = []struct {
+	first rune
+	class int
+}{
+	{0x0300, 230}, {0x0315, 232}, {0x0316, 220}, {0x031A, 232}, {0x031B, 216},
+	{0x031C, 220}, {0x0321, 202}, {0x0323, 220}, {0x0327, 202}, {0x0329, 220},
+	{0x0334, 1}, {0x0339, 220}, {0x033D, 230}, {0x0345, 240}, {0x0346, 230},
+	{0x0347, 220}, {0x034A, 230}, {0x034D, 220}, {0x034F, 0}, {0x0350, 230},
+	{0x0353, 220}, {0x0357, 230}, {0x0358, 232}, {0x0359, 220}, {0x035B, 230},
+	{0x035C, 233}, {0x035D, 234}, {0x035F, 233}, {0x0360, 234}, {0x0362, 233},
+	{0x0363, 230},
+}
+
+func nfcClass(r rune) int {
+	class := 0
+	if r < 0x0300 || r > 0x036F {
+		return class
+	}
+	for _, c := range nfcClasses {
+		if r >= c.first {
+			class = c.class
+		}
+	}
+	return class
+}
+
+var nfcPairs struct {
+	once  sync.Once
+	table map[[2]rune]rune
+	// decompositions are the pairs composing to each letter.
+	decompositions map[rune][2]rune
+}
+
+func nfcTables() {
+	nfcPairs.once.Do(func() {
+		nfcPairs.table = make(map[[2]rune]rune)
+		nfcPairs.decompositions = make(map[rune][2]rune)
+		for mark, pairs := range nfcCompositions {
+			runes := []rune(pairs)
+			for i := 0; i+1 < len(runes); i += 2 {
+				nfcPairs.table[[2]rune{runes[i], mark}] = runes[i+1]
+				nfcPairs.decompositions[runes[i+1]] = [2]rune{runes[i], mark}
+			}
+		}
+	})
+}
+
+func nfcCompose(base, mark rune) (rune, bool) {
+	nfcTables()
+	r, ok := nfcPairs.table[[2]rune{base, mark}]
+	return r, ok
+}
+
+// nfcDecompose appends the full decomposition of r to out.
+func nfcDecompose(out []rune, r rune) []rune {
+	nfcTables()
+	if s, ok := nfcSingletons[r]; ok {
+		for _, d := range s {
+			out = nfcDecompose(out, d)
+		}
+		return out
+	}
+	if pair, ok := nfcPairs.decompositions[r]; ok {
+		return append(nfcDecompose(out, pair[0]), pair[1])
+	}
+	return append(out, r)
+}
+
+// The Hangul syllables compose from their leading consonant, vowel and
+// optional trailing consonant jamo.
+const (
+	hangulBase   = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulCount  = hangulLCount * hangulVCount * hangulTCount
+)
+
+func hangulCompose(prev, r rune) (rune, bool) {
+	if l, v := prev-hangulLBase, r-hangulVBase; l >= 0 && l < hangulLCount && v >= 0 && v < hangulVCount {
+		return hangulBase + (l*hangulVCount+v)*hangulTCount, true
+	}
+	if s, t := prev-hangulBase, r-hangulTBase; s >= 0 && s < hangulCount && s%hangulTCount == 0 && t > 0 && t < hangulTCount {
+		return prev + t, true
+	}
+	return 0, false
+}
+
+// normalizeNFC composes the decomposed letters of s. Names with nothing to
+// compose, all of the ASCII ones among them, come back as they are.
+func normalizeNFC(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		ascii = ascii && s[i] < utf8.RuneSelf
+	}
+	if ascii {
+		return s
+	}
+	runes := make([]rune, 0, len(s))
+	for _, r := range s {
+		runes = nfcDecompose(runes, r)
+	}
+	for i := 0; i < len(runes); i++ {
+		j := i
+		for j < len(runes) && nfcClass(runes[j]) != 0 {
+			j++
+		}
+		marks := runes[i:j]
+		sort.SliceStable(marks, func(a, b int) bool { return nfcClass(marks[a]) < nfcClass(marks[b]) })
+		i = j
+	}
+
+	// A mark composes with the last letter unless a mark of its class or
+	// a letter that did not compose comes between them.
+	var b strings.Builder
+	out := make([]rune, 0, len(runes))
+	letter, last := -1, 0
+	for _, r := range runes {
+		class := nfcClass(r)
+		if letter >= 0 {
+			next := len(out)-1 == letter
+			if next || class != 0 && last < class {
+				if c, ok := nfcCompose(out[letter], r); ok {
+					out[letter] = c
+					continue
+				}
+			}
+			if c, ok := hangulCompose(out[letter], r); ok && next {
+				out[letter] = c
+				continue
+			}
+		}
+		if class == 0 {
+			letter = len(out)
+		}
+		last = class
+		out = append(out, r)
+	}
+	for _, r := range out {
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestNormalizeNFC(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main.go", "main.go"},
+		{"re\u0301sume\u0301.md", "résumé.md"},
+		{"résumé.md", "résumé.md"},
+		{"И\u0306огурт", "Йогурт"},
+		{"α\u0313\u0342\u0345", "ᾆ"},
+		{"\u1100\u1161\u11A8.txt", "각.txt"},
+		// Marks below go before marks above, in whatever order typed.
+		{"a\u0302\u0323", "ậ"},
+		{"a\u0323\u0302", "ậ"},
+		{"â\u0323", "ậ"},
+		// Overlays go first and let the marks above compose.
+		{"o\u0338\u0301", "ó\u0338"},
+		// A mark above that did not compose keeps the next from it.
+		{"s\u0306\u0301", "s\u0306\u0301"},
+		{"ab\u0301", "ab\u0301"},
+		// Singletons never compose back.
+		{"\u2126", "Ω"},
+		{"\u212Bngström", "Ångström"},
+		{"\u1F71", "ά"},
+		{"ι\u0344", "ΐ"},
+	}
+	for _, test := range tests {
+		if got := normalizeNFC(test.name); got != test.want {
+			t.Errorf("normalizeNFC(%+q) = %+q, want %+q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// The -notebooks modes.
+const (
+	notebooksSource = "source"
+	notebooksRaw    = "raw"
+)
+
+// notebookSource extracts the sources of the cells of a Jupyter notebook,
+// each cell headed by a line with its type, dropping the outputs,
+// execution counts and metadata that change when it is re-run.
+func notebookSource(data []byte) ([]byte, bool) {
+	var nb struct {
+		Cells []struct {
+			CellType string          `json:"cell_type"`
+			Source   json.RawMessage `json:"source"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal(data, &nb); err != nil || nb.Cells == nil {
+		return nil, false
+	}
+	var b strings.Builder
+	for _, cell := range nb.Cells {
+		// nbformat stores a source as a string or a list of lines.
+		var source string
+		if err := json.Unmarshal(cell.Source, &source); err != nil {
+			var lines []string
+			if err := json.Unmarshal(cell.Source, &lines); err != nil {
+				return nil, false
+			}
+			source = strings.Join(lines, "")
+		}
+		b.WriteString("# %% [" + cell.CellType + "]\n")
+		b.WriteString(source)
+		if !strings.HasSuffix(source, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return []byte(b.String()), true
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+const (
+	slackWebhookEnv = "GITILITY_SLACK_WEBHOOK"
+	teamsWebhookEnv = "GITILITY_TEAMS_WEBHOOK"
+	smtpAddrEnv     = "GITILITY_SMTP_ADDR"
+	smtpFromEnv     = "GITILITY_SMTP_FROM"
+	smtpUserEnv     = "GITILITY_SMTP_USER"
+	smtpPasswordEnv = "GITILITY_SMTP_PASSWORD"
+)
+
+// message is what a notification says: a subject line, a plain text body,
+// and the data behind it for the channels speaking JSON.
+type message struct {
+	Subject string      `json:"subject"`
+	Text    string      `json:"text"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type notifier interface {
+	notify(ctx context.Context, msg message) error
+}
+
+type notifyFlags struct {
+	flags        *flag.FlagSet
+	channels     stringsFlag
+	slackWebhook *string
+	teamsWebhook *string
+	webhookURL   *string
+	emailTo      *string
+}
+
+func addNotifyFlags(flags *flag.FlagSet) *notifyFlags {
+	n := &notifyFlags{flags: flags}
+	flags.Var(&n.channels, "notify", "send the result to `channel`: slack, teams, webhook or email (repeatable)")
+	n.slackWebhook = flags.String("slack-webhook", "", "Slack incoming webhook `url`, implies -notify slack when given (default $"+slackWebhookEnv+")")
+	n.teamsWebhook = flags.String("teams-webhook", "", "Microsoft Teams incoming webhook `url`, implies -notify teams when given (default $"+teamsWebhookEnv+")")
+	n.webhookURL = flags.String("webhook-url", "", "`url` the webhook channel POSTs the JSON message to")
+	n.emailTo = flags.String("email-to", "", "comma separated `addresses` the email channel writes to, through $"+smtpAddrEnv)
+	return n
+}
+
+// notifiers sets up the channels asked for, by -notify or by giving a
+// channel's webhook on the command line; none means printing only.
+func (n *notifyFlags) notifiers() ([]notifier, error) {
+	channels := append(stringsFlag(nil), n.channels...)
+	n.flags.Visit(func(f *flag.Flag) {
+		implied := map[string]string{"slack-webhook": "slack", "teams-webhook": "teams"}[f.Name]
+		if implied == "" {
+			return
+		}
+		for _, channel := range channels {
+			if channel == implied {
+				return
+			}
+		}
+		channels = append(channels, implied)
+	})
+
+	res := make([]notifier, 0, len(channels))
+	for _, channel := range channels {
+		switch channel {
+		case "slack":
+			webhook := orEnv(*n.slackWebhook, slackWebhookEnv)
+			if webhook == "" {
+				return nil, fmt.Errorf("-notify slack needs -slack-webhook or $%s", slackWebhookEnv)
+			}
+			res = append(res, &postNotifier{url: webhook, body: slackBody})
+		case "teams":
+			webhook := orEnv(*n.teamsWebhook, teamsWebhookEnv)
+			if webhook == "" {
+				return nil, fmt.Errorf("-notify teams needs -teams-webhook or $%s", teamsWebhookEnv)
+			}
+			res = append(res, &postNotifier{url: webhook, body: teamsBody})
+		case "webhook":
+			if *n.webhookURL == "" {
+				return nil, fmt.Errorf("-notify webhook needs -webhook-url")
+			}
+			res = append(res, &postNotifier{url: *n.webhookURL, body: func(msg message) interface{} { return msg }})
+		case "email":
+			e, err := newEmailNotifier(*n.emailTo)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, e)
+		default:
+			return nil, fmt.Errorf("unknown -notify channel %q, want slack, teams, webhook or email", channel)
+		}
+	}
+	return res, nil
+}
+
+func notifyAll(ctx context.Context, notifiers []notifier, msg message) error {
+	for _, n := range notifiers {
+		if err := n.notify(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postNotifier POSTs the JSON body made from a message to a URL.
+type postNotifier struct {
+	url  string
+	body func(message) interface{}
+}
+
+func slackBody(msg message) interface{} {
+	return map[string]string{"text": "*" + msg.Subject + "*\n" + msg.Text}
+}
+
+// teamsBody is a message for Teams incoming webhooks, which render text as
+// markdown: the body keeps its line breaks and alignment in a code block.
+func teamsBody(msg message) interface{} {
+	return map[string]string{"title": msg.Subject, "text": "```\n" + msg.Text + "```"}
+}
+
+func (p *postNotifier) notify(ctx context.Context, msg message) error {
+	body, err := json.Marshal(p.body(msg))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("notify %s: %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+type emailNotifier struct {
+	addr string
+	from string
+	to   []string
+	auth smtp.Auth
+}
+
+func newEmailNotifier(to string) (*emailNotifier, error) {
+	e := &emailNotifier{addr: os.Getenv(smtpAddrEnv), from: os.Getenv(smtpFromEnv)}
+	for _, address := range strings.Split(to, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			e.to = append(e.to, address)
+		}
+	}
+	if len(e.to) == 0 || e.addr == "" || e.from == "" {
+		return nil, fmt.Errorf("-notify email needs -email-to, $%s and $%s", smtpAddrEnv, smtpFromEnv)
+	}
+	if user := os.Getenv(smtpUserEnv); user != "" {
+		host := e.addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		e.auth = smtp.PlainAuth("", user, os.Getenv(smtpPasswordEnv), host)
+	}
+	return e, nil
+}
+
+func (e *emailNotifier) notify(ctx context.Context, msg message) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n", e.from, strings.Join(e.to, ", "), msg.Subject)
+	body.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	return smtp.SendMail(e.addr, e.auth, e.from, e.to, body.Bytes())
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+)
+
+// A newcomer reads the central files first: the ones changing most, along
+// with the most other files, by the most authors. Their centrality is the
+// mean of the three relative to the file measuring the most, from 0 to 1.
+// The pairs of files changed together most often come next, and the entry
+// points, where the programs start, last, with what last changed in them.
+
+// couplingMaxFiles is the most files a commit may change for them to count
+// as coupled: a sweeping change couples everything with everything.
+const couplingMaxFiles = 30
+
+// entryPointNames are the base names of the files programs start from.
+var entryPointNames = map[string]bool{
+	"main.go":     true,
+	"main.py":     true,
+	"__main__.py": true,
+	"app.py":      true,
+	"manage.py":   true,
+	"main.rs":     true,
+	"lib.rs":      true,
+	"main.c":      true,
+	"main.cc":     true,
+	"main.cpp":    true,
+	"index.js":    true,
+	"index.ts":    true,
+	"main.js":     true,
+	"main.ts":     true,
+	"server.js":   true,
+	"Program.cs":  true,
+	"Main.java":   true,
+	"main.swift":  true,
+}
+
+func isEntryPoint(name string) bool {
+	return entryPointNames[path.Base(name)]
+}
+
+type onboardFile struct {
+	Name       string  `json:"name"`
+	Centrality float64 `json:"centrality"`
+	Changes    float64 `json:"changes"`
+	// Coupled counts the other files changed along with it.
+	Coupled int `json:"coupled"`
+	Authors int `json:"authors"`
+}
+
+// coupledPair is two files, in name order, and the walked commits changing
+// both.
+type coupledPair struct {
+	Files   [2]string `json:"files"`
+	Commits int       `json:"commits"`
+}
+
+// entryPointChange is the newest walked change of an entry point.
+type entryPointChange struct {
+	Name    string    `json:"name"`
+	Commit  string    `json:"commit"`
+	Author  string    `json:"author"`
+	Time    time.Time `json:"time"`
+	Subject string    `json:"subject"`
+}
+
+type onboarding struct {
+	ReadFirst   []onboardFile      `json:"read_first"`
+	Coupled     []coupledPair      `json:"coupled"`
+	EntryPoints []entryPointChange `json:"entry_points"`
+}
+
+func collectOnboarding(ctx context.Context, q *query) (*onboarding, error) {
+	opt := q.listingOptions()
+	opt.GetCommits.Subjects = true
+	commits, err := q.backend.commits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := Preload(ctx, commits, CommitFieldFiles, CommitFieldTime); err != nil {
+		return nil, err
+	}
+
+	o := newOwnership(false)
+	coupled := make(map[string]map[string]int)
+	seen := make(map[string]bool)
+	res := &onboarding{}
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		kept := make([]string, 0, len(files))
+		for _, file := range files {
+			if !satisfyFilters(file, q.filters) {
+				continue
+			}
+			o.add(file)
+			kept = append(kept, file.Name())
+			if !isEntryPoint(file.Name()) || seen[file.Name()] {
+				continue
+			}
+			// The commits come newest first.
+			seen[file.Name()] = true
+			commitTime, err := commit.CommitTime(ctx)
+			if err != nil {
+				return nil, err
+			}
+			res.EntryPoints = append(res.EntryPoints, entryPointChange{
+				Name:    file.Name(),
+				Commit:  commit.CommitHash(),
+				Author:  commit.Author(),
+				Time:    commitTime,
+				Subject: commit.Subject(),
+			})
+		}
+		if len(kept) > couplingMaxFiles {
+			continue
+		}
+		for _, name := range kept {
+			if coupled[name] == nil {
+				coupled[name] = make(map[string]int)
+			}
+			for _, other := range kept {
+				if other != name {
+					coupled[name][other]++
+				}
+			}
+		}
+	}
+
+	maxChanges, maxCoupled, maxAuthors := 1.0, 1, 1
+	for _, f := range o.hotspots() {
+		file := onboardFile{Name: f.Name, Changes: f.Changes, Coupled: len(coupled[f.Name]), Authors: len(o.files[f.Name])}
+		res.ReadFirst = append(res.ReadFirst, file)
+		if file.Changes > maxChanges {
+			maxChanges = file.Changes
+		}
+		if file.Coupled > maxCoupled {
+			maxCoupled = file.Coupled
+		}
+		if file.Authors > maxAuthors {
+			maxAuthors = file.Authors
+		}
+	}
+	for i := range res.ReadFirst {
+		f := &res.ReadFirst[i]
+		f.Centrality = (f.Changes/maxChanges + float64(f.Coupled)/float64(maxCoupled) + float64(f.Authors)/float64(maxAuthors)) / 3
+	}
+	sort.SliceStable(res.ReadFirst, func(i, j int) bool { return res.ReadFirst[i].Centrality > res.ReadFirst[j].Centrality })
+
+	for name, others := range coupled {
+		for other, commits := range others {
+			if name < other {
+				res.Coupled = append(res.Coupled, coupledPair{Files: [2]string{name, other}, Commits: commits})
+			}
+		}
+	}
+	sort.Slice(res.Coupled, func(i, j int) bool {
+		a, b := res.Coupled[i], res.Coupled[j]
+		if a.Commits != b.Commits {
+			return a.Commits > b.Commits
+		}
+		if a.Files[0] != b.Files[0] {
+			return a.Files[0] < b.Files[0]
+		}
+		return a.Files[1] < b.Files[1]
+	})
+	return res, q.err()
+}
+
+func runOnboard(args []string) error {
+	flags := flag.NewFlagSet("onboard", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	rank := addRankFlags(flags, 15)
+	entryPoints := flags.Int("entry-points", 10, "number of recently changed entry points to print, 0 for all")
+	asJSON := flags.Bool("json", false, "print the central files and the entry point changes as a JSON object")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if err := rank.validate(); err != nil {
+		return err
+	}
+	if *entryPoints < 0 {
+		return fmt.Errorf("-entry-points %d: must not be negative", *entryPoints)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	res, err := collectOnboarding(ctx, q)
+	if err != nil {
+		return err
+	}
+	// The centrality is no count: -min-count only cuts the pairs.
+	central := *rank
+	central.minCount = new(float64)
+	res.ReadFirst = res.ReadFirst[:central.keep(len(res.ReadFirst), func(i int) float64 { return res.ReadFirst[i].Centrality })]
+	res.Coupled = res.Coupled[:rank.keep(len(res.Coupled), func(i int) float64 { return float64(res.Coupled[i].Commits) })]
+	if *entryPoints > 0 && len(res.EntryPoints) > *entryPoints {
+		res.EntryPoints = res.EntryPoints[:*entryPoints]
+	}
+	if *asJSON {
+		return printJSON(res)
+	}
+
+	fmt.Println("Read these first:")
+	for i, f := range res.ReadFirst {
+		fmt.Printf("%3d. %-40s %4.2f  %g changes, coupled with %d files, %d authors\n", i+1, displayName(ctx, f.Name), f.Centrality, f.Changes, f.Coupled, f.Authors)
+	}
+	if len(res.Coupled) > 0 {
+		fmt.Println("\nChanged together most often:")
+		for i, pair := range res.Coupled {
+			fmt.Printf("%3d. %s and %s, %d commits\n", i+1, displayName(ctx, pair.Files[0]), displayName(ctx, pair.Files[1]), pair.Commits)
+		}
+	}
+	if len(res.EntryPoints) == 0 {
+		return nil
+	}
+	fmt.Println("\nRecently changed entry points:")
+	for _, e := range res.EntryPoints {
+		fmt.Printf("%s %-30s %s %-24s %s\n", e.Time.Format("2006-01-02"), displayName(ctx, e.Name), e.Commit, e.Author, e.Subject)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Validate rejects options that cannot be walked or contradict each other,
+// before any git command runs.
+func (opt Options) Validate() error {
+	o := opt.GetCommits
+	if o.Limit < 0 {
+		return fmt.Errorf("limit %d: must not be negative", o.Limit)
+	}
+	switch o.Merges {
+	case "", MergesInclude, MergesExclude, MergesOnly:
+	default:
+		return fmt.Errorf("unknown merges mode %q, want include, exclude or only", o.Merges)
+	}
+	switch o.MergeDiff {
+	case MergeDiffAuto, MergeDiffNone, MergeDiffFirstParent, MergeDiffSeparate, MergeDiffCombined, MergeDiffDenseCombined:
+	default:
+		return fmt.Errorf("unknown merge diff %q, want off, first-parent, separate, combined or dense-combined", o.MergeDiff)
+	}
+	if o.Merges == MergesExclude && o.MergeDiff != MergeDiffAuto {
+		return errors.New("merge diff has no effect when merges are excluded")
+	}
+	if o.Merges == MergesOnly && o.MergeDiff == MergeDiffNone {
+		return errors.New("walking only merges with merge diff off lists no files")
+	}
+	if !o.Since.IsZero() && !o.Until.IsZero() && o.Since.After(o.Until) {
+		return fmt.Errorf("since %s is after until %s, no commit can match", o.Since.Format(time.RFC3339), o.Until.Format(time.RFC3339))
+	}
+	if err := checkRevision(o.Ref); err != nil {
+		return err
+	}
+	if len(o.Commits) > 0 && (o.Ref != "" || o.AllRefs || len(o.Branches) > 0 || o.Reflog) {
+		return errors.New("a commit list replaces the ref, branches and reflog walks, it cannot be combined with them")
+	}
+	if o.Sample.Every < 0 {
+		return fmt.Errorf("sample every %d: must not be negative", o.Sample.Every)
+	}
+	if o.Sample.Percent < 0 || o.Sample.Percent > 100 {
+		return fmt.Errorf("sample percent %g: must be between 0 and 100", o.Sample.Percent)
+	}
+	switch opt.Dedup {
+	case "", DedupFile, DedupDirectory, DedupCommit, DedupNone:
+	default:
+		return fmt.Errorf("unknown dedup scope %q, want file, directory, commit or none", opt.Dedup)
+	}
+	if o.ExcludeMassChanges.Files < 0 {
+		return fmt.Errorf("mass change files %d: must not be negative", o.ExcludeMassChanges.Files)
+	}
+	if o.ExcludeMassChanges.Percent < 0 || o.ExcludeMassChanges.Percent > 100 {
+		return fmt.Errorf("mass change percent %g: must be between 0 and 100", o.ExcludeMassChanges.Percent)
+	}
+	return nil
+}
+
+// Option sets up one aspect of a listing, for ListFiles and NewOptions. They
+// serve the code of this package; being in package main, no other module
+// can import them.
+//
+//	files, err := ListFiles(ctx, WithLimit(100), WithSince(lastWeek), WithFilters(isGoFile))
+type Option func(*listing)
+
+type listing struct {
+	opt     Options
+	filters []Filters
+	backend GetCommits
+}
+
+func newListing(opts []Option) listing {
+	l := listing{backend: getCommits}
+	l.opt.GetCommits.Limit = 10
+	for _, o := range opts {
+		o(&l)
+	}
+	return l
+}
+
+// NewOptions builds the Options the options describe, starting from a walk
+// of the last 10 commits of HEAD. Filters and backends only apply to
+// ListFiles.
+func NewOptions(opts ...Option) Options {
+	return newListing(opts).opt
+}
+
+// ListFiles lists the files changed by the walked commits, each once with
+// its newest change, keeping the ones every filter accepts.
+func ListFiles(ctx context.Context, opts ...Option) ([]File, error) {
+	l := newListing(opts)
+	if err := l.opt.Validate(); err != nil {
+		return nil, err
+	}
+	return getOrderFiles(l.backend, ctx, l.opt, l.filters...)
+}
+
+// ListFilesPage lists a page of size files of the listing of ListFiles,
+// the one after cursor, or the first one for an empty cursor. It returns
+// the cursor of the next page, empty on the last page. The files of the
+// commits past the page are not listed, so the first pages of long walks
+// come quickly.
+//
+//	files, next, err := ListFilesPage(ctx, "", 100, WithLimit(5000))
+//	for err == nil && next != "" {
+//		files, next, err = ListFilesPage(ctx, next, 100, WithLimit(5000))
+//	}
+func ListFilesPage(ctx context.Context, cursor string, size int, opts ...Option) ([]File, string, error) {
+	l := newListing(opts)
+	if err := l.opt.Validate(); err != nil {
+		return nil, "", err
+	}
+	return getOrderFilesPage(l.backend, ctx, l.opt, cursor, size, l.filters...)
+}
+
+// WithOptions starts from existing Options, for callers moving over from
+// filling in the struct.
+func WithOptions(opt Options) Option {
+	return func(l *listing) { l.opt = opt }
+}
+
+func WithLimit(n int) Option {
+	return func(l *listing) { l.opt.GetCommits.Limit = n }
+}
+
+// WithRef walks a revision or a range, e.g. origin/main..HEAD, instead of
+// HEAD.
+func WithRef(ref string) Option {
+	return func(l *listing) { l.opt.GetCommits.Ref = ref }
+}
+
+func WithSince(t time.Time) Option {
+	return func(l *listing) { l.opt.GetCommits.Since = t }
+}
+
+func WithUntil(t time.Time) Option {
+	return func(l *listing) { l.opt.GetCommits.Until = t }
+}
+
+func WithMerges(mode MergeMode) Option {
+	return func(l *listing) { l.opt.GetCommits.Merges = mode }
+}
+
+func WithFirstParent() Option {
+	return func(l *listing) { l.opt.GetCommits.FirstParent = true }
+}
+
+func WithMergeDiff(diff MergeDiff) Option {
+	return func(l *listing) { l.opt.GetCommits.MergeDiff = diff }
+}
+
+func WithSample(s Sample) Option {
+	return func(l *listing) { l.opt.GetCommits.Sample = s }
+}
+
+// WithPaths only lists the files matching the git pathspecs, which saves
+// git the work of listing the others.
+func WithPaths(pathspecs ...string) Option {
+	return func(l *listing) { l.opt.GetCommits.Paths = append(l.opt.GetCommits.Paths, pathspecs...) }
+}
+
+// WithDedup lists the same file once per scope instead of once overall.
+func WithDedup(scope DedupScope) Option {
+	return func(l *listing) { l.opt.Dedup = scope }
+}
+
+// WithDedupFold ignores the differences of case or Unicode normalization
+// between names when listing every file once.
+func WithDedupFold(fold DedupFold) Option {
+	return func(l *listing) { l.opt.DedupFold = fold }
+}
+
+// WithExcludeMassChanges leaves out the commits past the thresholds.
+func WithExcludeMassChanges(m MassChanges) Option {
+	return func(l *listing) { l.opt.GetCommits.ExcludeMassChanges = m }
+}
+
+// WithSignatures and WithTrailers load what signature and trailer filters
+// look at.
+func WithSignatures() Option {
+	return func(l *listing) { l.opt.GetCommits.Signatures = true }
+}
+
+func WithTrailers() Option {
+	return func(l *listing) { l.opt.GetCommits.Trailers = true }
+}
+
+func WithSubjects() Option {
+	return func(l *listing) { l.opt.GetCommits.Subjects = true }
+}
+
+// WithCommits walks exactly the commits, in their order, instead of
+// selecting them from a ref.
+func WithCommits(hashes ...string) Option {
+	return func(l *listing) { l.opt.GetCommits.Commits = append(l.opt.GetCommits.Commits, hashes...) }
+}
+
+func WithReflog() Option {
+	return func(l *listing) { l.opt.GetCommits.Reflog = true }
+}
+
+// WithBranches walks the branches matching the globs, or every ref when
+// none are given, counting cherry-picks between them once.
+func WithBranches(globs ...string) Option {
+	return func(l *listing) {
+		if len(globs) == 0 {
+			l.opt.GetCommits.AllRefs = true
+		}
+		l.opt.GetCommits.Branches = append(l.opt.GetCommits.Branches, globs...)
+		l.opt.GetCommits.SkipCherryPicks = true
+	}
+}
+
+// WithFilters adds to the filters a listed file must satisfy.
+func WithFilters(filters ...Filters) Option {
+	return func(l *listing) { l.filters = append(l.filters, filters...) }
+}
+
+// WithBackend replaces the git log walk with another source of commits.
+func WithBackend(backend GetCommits) Option {
+	return func(l *listing) { l.backend = backend }
+}
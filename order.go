@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Listings are ordered by commit time, newest first, then in the order of
+// the walk and by file name. Commits sharing a timestamp, as rebases and
+// scripted commits often do, keep the order git walked them in, children
+// before their parents, so a file is listed for the newest of them and
+// identical runs still print identical output.
+
+func sortCommits(ctx context.Context, commits []Commit) error {
+	times, err := commitTimes(ctx, commits)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return times[commits[i].CommitHash()].After(times[commits[j].CommitHash()])
+	})
+	return nil
+}
+
+func sortFiles(ctx context.Context, files []File) error {
+	commits := make([]Commit, 0, len(files))
+	for _, file := range files {
+		commits = append(commits, file.GetCommit())
+	}
+	times, err := commitTimes(ctx, commits)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return times[files[i].GetCommit().CommitHash()].After(times[files[j].GetCommit().CommitHash()])
+	})
+	return nil
+}
+
+func commitTimes(ctx context.Context, commits []Commit) (map[string]time.Time, error) {
+	if err := Preload(ctx, commits, CommitFieldTime); err != nil {
+		return nil, err
+	}
+	times := make(map[string]time.Time, len(commits))
+	for _, commit := range commits {
+		if _, ok := times[commit.CommitHash()]; ok {
+			continue
+		}
+		commitTime, err := commit.CommitTime(ctx)
+		if err != nil {
+			return nil, err
+		}
+		times[commit.CommitHash()] = commitTime
+	}
+	return times, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestListingOrderSameSecond commits three times within the same second:
+// the listing keeps the order of the walk, newest first, and lists the
+// file every commit changed for the newest of them, whatever its hash.
+func TestListingOrderSameSecond(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("GIT_AUTHOR_DATE", "2024-01-02T03:04:05Z")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-02T03:04:05Z")
+	repo := filepath.Join(dir, "repo")
+	git := func(args ...string) string {
+		output, err := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=a", "-c", "user.email=a@example.com"}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %q: %v: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	if err := os.Mkdir(repo, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "--quiet")
+	var hashes []string
+	for _, name := range []string{"first.go", "second.go", "third.go"} {
+		for _, file := range []string{name, "shared.go"} {
+			if err := os.WriteFile(filepath.Join(repo, file), []byte(name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		git("add", name, "shared.go")
+		git("commit", "--quiet", "-m", name)
+		hashes = append(hashes, git("rev-parse", "HEAD"))
+	}
+
+	opt := Options{}
+	opt.GetCommits.Limit = 10
+	files, err := getOrderFiles(getCommits, withRepoDir(context.Background(), repo), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ name, commit string }{
+		{"shared.go", hashes[2]},
+		{"third.go", hashes[2]},
+		{"second.go", hashes[1]},
+		{"first.go", hashes[0]},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("listed %d files, want %d", len(files), len(want))
+	}
+	for i, file := range files {
+		// The listing abbreviates the hashes.
+		if file.Name() != want[i].name || !strings.HasPrefix(want[i].commit, file.GetCommit().CommitHash()) {
+			t.Errorf("file %d is %s of %.7s, want %s of %.7s", i, file.Name(), file.GetCommit().CommitHash(), want[i].name, want[i].commit)
+		}
+	}
+}
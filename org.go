@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+func runOrg(args []string) error {
+	flags := flag.NewFlagSet("org", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 100)
+	api := flags.String("api", defaultForgeAPI, "forge API `url`, for GitHub Enterprise")
+	var include, exclude stringsFlag
+	flags.Var(&include, "include", "only analyze the repositories whose name matches the `glob` (repeatable)")
+	flags.Var(&exclude, "exclude", "skip the repositories whose name matches the `glob` (repeatable)")
+	withArchived := flags.Bool("archived", false, "also analyze archived repositories")
+	withForks := flags.Bool("forks", false, "also analyze forks")
+	concurrency := flags.Int("concurrency", 4, "number of repositories analyzed at once")
+	coAuthors := flags.Bool("co-authors", false, "split the credit of a change with its Co-authored-by trailers")
+	rank := addRankFlags(flags, 20)
+	timeout := flags.Duration("timeout", 30*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: gitility org [flags] <github-org>")
+	}
+	if err := rank.validate(); err != nil {
+		return err
+	}
+	org := flags.Arg(0)
+	if *queryFlags.token == "" {
+		*queryFlags.token = orEnv(os.Getenv(tokenEnv), "GITHUB_TOKEN")
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	repos, err := newForgeClient(*api, *queryFlags.token).orgRepos(ctx, org)
+	if err != nil {
+		return err
+	}
+
+	selected := make([]forgeRepo, 0, len(repos))
+	for _, repo := range repos {
+		if (repo.Archived && !*withArchived) || (repo.Fork && !*withForks) {
+			continue
+		}
+		if len(include) > 0 && !matchAnyGlob(include, repo.Name) {
+			continue
+		}
+		if matchAnyGlob(exclude, repo.Name) {
+			continue
+		}
+		selected = append(selected, repo)
+	}
+
+	total := newOwnership(*coAuthors)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := 0
+	sem := make(chan struct{}, *concurrency)
+	for _, repo := range selected {
+		repo := repo
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			o, err := analyzeOrgRepo(ctx, queryFlags, repo, *coAuthors)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "%s: %v\n", repo.FullName, err)
+				return
+			}
+			total.merge(repo.Name+"/", o)
+		}()
+	}
+	wg.Wait()
+
+	fmt.Printf("%s: %d repositories analyzed, %d failed\n\nhotspots:\n", org, len(selected)-failed, failed)
+	hotspots := total.hotspots()
+	for _, hotspot := range hotspots[:rank.keep(len(hotspots), func(i int) float64 { return hotspots[i].Changes })] {
+		fmt.Printf("%6.0f  %s\n", hotspot.Changes, displayName(ctx, hotspot.Name))
+	}
+
+	fmt.Println("\nowners:")
+	owners := total.sorted(total.totals)
+	for _, owner := range owners[:rank.keep(len(owners), func(i int) float64 { return owners[i].Weight })] {
+		fmt.Printf("%8.1f  %s\n", owner.Weight, owner.Author)
+	}
+
+	factor, owners := total.busFactor()
+	names := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		names = append(names, owner.Author)
+	}
+	fmt.Printf("\nbus factor: %d (%s)\n", factor, strings.Join(names, ", "))
+	return nil
+}
+
+func analyzeOrgRepo(ctx context.Context, queryFlags *queryFlags, repo forgeRepo, coAuthors bool) (*ownership, error) {
+	ctx, q, err := queryFlags.buildRemote(ctx, repo.CloneURL)
+	if err != nil {
+		return nil, err
+	}
+	defer q.close()
+	if coAuthors {
+		q.opt.GetCommits.Trailers = true
+	}
+	return collectOwnership(ctx, q, coAuthors)
+}
+
+func matchAnyGlob(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
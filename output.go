@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The listing is rendered as a table, the default text output, as JSON or
+// as Markdown; -output sends it to several of them at once, so the walk
+// runs once however many reports it feeds.
+const (
+	outputTable    = "table"
+	outputJSON     = "json"
+	outputMarkdown = "markdown"
+)
+
+// outputSpec is an -output: a format and the file it goes to, stdout when
+// the path is empty.
+type outputSpec struct {
+	format string
+	path   string
+}
+
+// parseOutputs reads -output format[=file] flags. At most one output goes
+// to stdout, and every file gets one.
+func parseOutputs(specs []string) ([]outputSpec, error) {
+	outputs := make([]outputSpec, 0, len(specs))
+	paths := make(map[string]bool)
+	for _, spec := range specs {
+		format, path, _ := strings.Cut(spec, "=")
+		switch format {
+		case outputTable, outputJSON, outputMarkdown:
+		default:
+			return nil, fmt.Errorf("-output %q: unknown format %q, want table, json or markdown", spec, format)
+		}
+		if paths[path] {
+			if path == "" {
+				return nil, fmt.Errorf("-output %q: only one output can go to stdout, give the others a file", spec)
+			}
+			return nil, fmt.Errorf("-output %q: %s is written twice", spec, path)
+		}
+		paths[path] = true
+		outputs = append(outputs, outputSpec{format: format, path: path})
+	}
+	return outputs, nil
+}
+
+// writeOutputs renders the outputs one after the other; a file that fails
+// to be written does not stop the others.
+func writeOutputs(outputs []outputSpec, render func(format string, w io.Writer) error) error {
+	var firstErr error
+	for _, o := range outputs {
+		err := writeOutput(o, render)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func writeOutput(o outputSpec, render func(format string, w io.Writer) error) error {
+	if o.path == "" {
+		return render(o.format, os.Stdout)
+	}
+	f, err := os.Create(o.path)
+	if err != nil {
+		return err
+	}
+	if err := render(o.format, f); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %w", o.path, err)
+	}
+	return f.Close()
+}
+
+// fileGroup is a labeled group of the listing, for the -group-by flags.
+type fileGroup struct {
+	label string
+	files []File
+}
+
+// renderListing renders the listing in format; groups, when there are
+// some, stand in for the files in the table and Markdown outputs.
+func renderListing(ctx context.Context, w io.Writer, format string, files []File, groups []fileGroup) error {
+	switch format {
+	case outputJSON:
+		results, err := fileResults(ctx, files)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	case outputMarkdown:
+		header := []string{"Time", "Commit", "File"}
+		if groups == nil {
+			rows, err := fileRows(ctx, files)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, markdownTable(header, rows))
+			return err
+		}
+		for i, g := range groups {
+			rows, err := fileRows(ctx, g.files)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "### %s\n\n", g.label)
+			if _, err := io.WriteString(w, markdownTable(header, rows)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if groups == nil {
+		return writeFiles(ctx, w, files, "")
+	}
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s:\n", g.label)
+		if err := writeFiles(ctx, w, g.files, "  "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
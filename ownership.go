@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type authorShare struct {
+	Author string  `json:"author"`
+	Weight float64 `json:"weight"`
+}
+
+// ownership accumulates how much of each file's changes every author made.
+// A commit counts as one change per file; with co-author credit the change
+// is split evenly between the author and each Co-authored-by trailer.
+type ownership struct {
+	coAuthors bool
+	// weight, when set, weighs the changes of every commit instead of 1.
+	weight func(Commit) float64
+	names  map[string]string
+	order  []string
+	files  map[string]map[string]float64
+	totals map[string]float64
+}
+
+func newOwnership(coAuthors bool) *ownership {
+	return &ownership{
+		coAuthors: coAuthors,
+		names:     make(map[string]string),
+		files:     make(map[string]map[string]float64),
+		totals:    make(map[string]float64),
+	}
+}
+
+func (o *ownership) identity(author string) string {
+	key := authorKey(author)
+	if _, ok := o.names[key]; !ok {
+		o.names[key] = strings.TrimSpace(author)
+	}
+	return key
+}
+
+func (o *ownership) credits(commit Commit) map[string]float64 {
+	authors := []string{o.identity(commit.Author())}
+	if o.coAuthors {
+		for _, coAuthor := range commit.Trailers().Values("Co-authored-by") {
+			authors = append(authors, o.identity(displayAs(commit, coAuthor)))
+		}
+	}
+
+	credits := make(map[string]float64, len(authors))
+	for _, author := range authors {
+		credits[author] = 0
+	}
+	for author := range credits {
+		credits[author] = 1 / float64(len(credits))
+	}
+	return credits
+}
+
+func (o *ownership) add(file File) {
+	shares, ok := o.files[file.Name()]
+	if !ok {
+		shares = make(map[string]float64)
+		o.files[file.Name()] = shares
+		o.order = append(o.order, file.Name())
+	}
+	weight := 1.0
+	if o.weight != nil {
+		weight = o.weight(file.GetCommit())
+	}
+	for author, credit := range o.credits(file.GetCommit()) {
+		shares[author] += credit * weight
+		o.totals[author] += credit * weight
+	}
+}
+
+func (o *ownership) sorted(weights map[string]float64) []authorShare {
+	shares := make([]authorShare, 0, len(weights))
+	for author, weight := range weights {
+		shares = append(shares, authorShare{Author: o.names[author], Weight: weight})
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Weight != shares[j].Weight {
+			return shares[i].Weight > shares[j].Weight
+		}
+		return shares[i].Author < shares[j].Author
+	})
+	return shares
+}
+
+// busFactor is the smallest number of authors that together made more than
+// half of all changes.
+func (o *ownership) busFactor() (int, []authorShare) {
+	shares := o.sorted(o.totals)
+	total := 0.0
+	for _, share := range shares {
+		total += share.Weight
+	}
+
+	covered := 0.0
+	for i, share := range shares {
+		covered += share.Weight
+		if covered > total/2 {
+			return i + 1, shares[:i+1]
+		}
+	}
+	return len(shares), shares
+}
+
+type fileChanges struct {
+	Name    string  `json:"name"`
+	Changes float64 `json:"changes"`
+}
+
+// hotspots ranks the files by how often they changed, ties by name; every
+// change weighs one, whatever the number of co-authors sharing it.
+func (o *ownership) hotspots() []fileChanges {
+	res := make([]fileChanges, 0, len(o.order))
+	for _, name := range o.order {
+		changes := 0.0
+		for _, weight := range o.files[name] {
+			changes += weight
+		}
+		res = append(res, fileChanges{Name: name, Changes: changes})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Changes != res[j].Changes {
+			return res[i].Changes > res[j].Changes
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// merge adds the figures of other, with its file names under prefix.
+func (o *ownership) merge(prefix string, other *ownership) {
+	for key, name := range other.names {
+		if _, ok := o.names[key]; !ok {
+			o.names[key] = name
+		}
+	}
+	for _, name := range other.order {
+		merged := prefix + name
+		shares, ok := o.files[merged]
+		if !ok {
+			shares = make(map[string]float64)
+			o.files[merged] = shares
+			o.order = append(o.order, merged)
+		}
+		for author, weight := range other.files[name] {
+			shares[author] += weight
+		}
+	}
+	for author, weight := range other.totals {
+		o.totals[author] += weight
+	}
+}
+
+func collectOwnership(ctx context.Context, q *query, coAuthors bool) (*ownership, error) {
+	commits, err := q.backend.commits(ctx, q.listingOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	o := newOwnership(coAuthors)
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if satisfyFilters(file, q.filters) {
+				o.add(file)
+			}
+		}
+	}
+	return o, q.err()
+}
+
+func runOwners(args []string) error {
+	flags := flag.NewFlagSet("owners", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 100)
+	rank := addRankFlags(flags, 0)
+	coAuthors := flags.Bool("co-authors", false, "split the credit of a change with its Co-authored-by trailers")
+	flags.Parse(args)
+	if err := rank.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	if *coAuthors {
+		q.opt.GetCommits.Trailers = true
+	}
+
+	o, err := collectOwnership(ctx, q, *coAuthors)
+	if err != nil {
+		return err
+	}
+
+	files := o.hotspots()
+	for _, f := range files[:rank.keep(len(files), func(i int) float64 { return files[i].Changes })] {
+		shares := o.sorted(o.files[f.Name])
+		fmt.Printf("%-40s %-36s %5.1f%% %3d authors\n", displayName(ctx, f.Name), shares[0].Author, shares[0].Weight/f.Changes*100, len(shares))
+	}
+
+	factor, owners := o.busFactor()
+	names := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		names = append(names, owner.Author)
+	}
+	fmt.Printf("\nbus factor: %d (%s)\n", factor, strings.Join(names, ", "))
+	return nil
+}
+
+func runHotspots(args []string) error {
+	flags := flag.NewFlagSet("hotspots", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	rank := addRankFlags(flags, 20)
+	window := flags.String("window", "", "print the changes in moving windows of `age`, e.g. 30d, instead of over the whole walk")
+	step := flags.String("step", "", "move the -window back by `age` at a time, e.g. 7d (default the window)")
+	by := flags.String("by", "file", "with -window, count the changes of every `file` or directory")
+	halfLife := flags.String("half-life", "", "weigh every change by its recency, halving every `age`, e.g. 90d")
+	profile := flags.String("profile", "", "take -half-life from the scoring profile `name` of "+configFileName+" (default the default profile)")
+	asJSON := flags.Bool("json", false, "print a JSON array, for diff-report")
+	output := addOutputFlags(flags)
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if err := rank.validate(); err != nil {
+		return err
+	}
+	if *by != "file" && *by != "directory" {
+		return fmt.Errorf("unknown -by %q, want file or directory", *by)
+	}
+	if *window == "" && (*step != "" || *by != "file") {
+		return errors.New("-step and -by only apply to -window")
+	}
+	if *step == "" {
+		*step = *window
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	scoring, err := q.config.scoringProfile(*profile)
+	if err != nil {
+		return err
+	}
+	if *halfLife == "" {
+		*halfLife = scoring.HalfLife
+	}
+	if *window != "" && *halfLife != "" {
+		return errors.New("-window counts changes, it cannot be combined with -half-life")
+	}
+
+	if *window != "" {
+		t, err := collectTrends(ctx, q, *window, *step, *by == "directory")
+		if err != nil {
+			return err
+		}
+		t.Series = t.Series[:rank.keep(len(t.Series), func(i int) float64 { return t.Series[i].Changes })]
+		if *asJSON {
+			return printJSON(t)
+		}
+		t.print(ctx, os.Stdout)
+		return nil
+	}
+
+	var hotspots []fileChanges
+	if *halfLife != "" {
+		hotspots, err = recencyHotspots(ctx, q, *halfLife)
+	} else {
+		var o *ownership
+		if o, err = collectOwnership(ctx, q, false); err == nil {
+			hotspots = o.hotspots()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	hotspots = hotspots[:rank.keep(len(hotspots), func(i int) float64 { return hotspots[i].Changes })]
+	if *asJSON {
+		return printJSON(hotspotResults(hotspots))
+	}
+	for _, hotspot := range hotspots {
+		if *halfLife != "" {
+			fmt.Printf("%8.2f  %s\n", hotspot.Changes, displayName(ctx, hotspot.Name))
+		} else {
+			fmt.Printf("%6.0f  %s\n", hotspot.Changes, displayName(ctx, hotspot.Name))
+		}
+	}
+	if output.annotated() {
+		annotations := make([]annotation, 0, len(hotspots))
+		rows := make([][]string, 0, len(hotspots))
+		for _, hotspot := range hotspots {
+			message := fmt.Sprintf("changed by %.0f of the last %d commits", hotspot.Changes, q.opt.GetCommits.Limit)
+			annotations = append(annotations, annotation{Level: "warning", File: hotspot.Name, Title: "Hotspot", Message: message})
+			rows = append(rows, []string{fmt.Sprintf("%.0f", hotspot.Changes), "`" + hotspot.Name + "`"})
+		}
+		return output.report(ctx, "Hotspots", false, annotations, "### Hotspots\n\n"+markdownTable([]string{"Changes", "File"}, rows))
+	}
+	return nil
+}
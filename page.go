@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Listings are paged with cursors. A cursor names the last file of a page
+// by its name and the commit it is listed for, so the next page starts
+// right after that file wherever it moved, and callers hand it back as is
+// without reading it.
+
+// pagePosition is where a file sits in a listing.
+type pagePosition struct {
+	Commit string `json:"c"`
+	Name   string `json:"n"`
+}
+
+func filePosition(file File) pagePosition {
+	return pagePosition{Commit: file.GetCommit().CommitHash(), Name: file.Name()}
+}
+
+func (p pagePosition) cursor() string {
+	data, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func parseCursor(cursor string) (pagePosition, error) {
+	p := pagePosition{}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(data, &p)
+	}
+	if err != nil || p.Commit == "" || p.Name == "" {
+		return p, fmt.Errorf("cursor %q: not a cursor gitility returned", cursor)
+	}
+	return p, nil
+}
+
+// ErrStaleCursor is returned for a cursor whose file is not in the listing
+// anymore, because newer commits changed it since or the filters differ.
+// The listing has to start over from its first page.
+var ErrStaleCursor = errors.New("the cursor is not in the listing anymore, start over from the first page")
+
+// pageBounds finds the page of size files after cursor in a listing of n
+// files, where at gives the position of the i-th one, and the cursor of
+// the page after it, empty on the last page. A size of 0 takes every file.
+func pageBounds(cursor string, size, n int, at func(i int) pagePosition) (start, end int, next string, err error) {
+	if size < 0 {
+		return 0, 0, "", fmt.Errorf("page size %d: must not be negative", size)
+	}
+	if cursor != "" {
+		after, err := parseCursor(cursor)
+		if err != nil {
+			return 0, 0, "", err
+		}
+		start = -1
+		for i := 0; i < n; i++ {
+			if at(i) == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return 0, 0, "", ErrStaleCursor
+		}
+	}
+	end = n
+	if size > 0 && start+size < n {
+		end = start + size
+		next = at(end - 1).cursor()
+	}
+	return start, end, next, nil
+}
+
+// pageFiles cuts the page after cursor out of a listing.
+func pageFiles(files []File, cursor string, size int) ([]File, string, error) {
+	start, end, next, err := pageBounds(cursor, size, len(files), func(i int) pagePosition { return filePosition(files[i]) })
+	if err != nil {
+		return nil, "", err
+	}
+	return files[start:end], next, nil
+}
+
+// getOrderFilesPage is getOrderFiles stopping at the end of the page: the
+// files of the commits past it are never listed. The commits before the
+// cursor still are, for their files not to show up again.
+func getOrderFilesPage(fn GetCommits, ctx context.Context, opt Options, cursor string, size int, filters ...Filters) ([]File, string, error) {
+	ctx, span := startSpan(ctx, "getOrderFilesPage")
+	defer span.End()
+
+	if size < 0 {
+		return nil, "", fmt.Errorf("page size %d: must not be negative", size)
+	}
+	var after *pagePosition
+	if cursor != "" {
+		p, err := parseCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &p
+	}
+
+	commits, err := fn(ctx, opt)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := sortCommits(ctx, commits); err != nil {
+		return nil, "", err
+	}
+
+	seen := make(map[string]bool)
+	page := make([]File, 0, size)
+	for start := 0; start < len(commits); start += preloadBatch {
+		batch := commits[start:]
+		if len(batch) > preloadBatch {
+			batch = batch[:preloadBatch]
+		}
+		if err := Preload(ctx, batch, CommitFieldFiles); err != nil {
+			return nil, "", err
+		}
+		for _, commit := range batch {
+			files, err := commit.GetFiles(ctx)
+			if err != nil {
+				return nil, "", err
+			}
+			files = append([]File(nil), files...)
+			sort.SliceStable(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+			for _, file := range files {
+				key, dedup := dedupKey(opt.Dedup, opt.DedupFold, file)
+				if dedup && seen[key] || !satisfyFilters(file, filters) {
+					continue
+				}
+				seen[key] = true
+				if after != nil {
+					if filePosition(file) == *after {
+						after = nil
+					}
+					continue
+				}
+				// One more file than the page holds: there is a next page.
+				if size > 0 && len(page) == size {
+					return page, filePosition(page[size-1]).cursor(), nil
+				}
+				page = append(page, file)
+			}
+		}
+	}
+	if after != nil {
+		return nil, "", ErrStaleCursor
+	}
+	return page, "", nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPageFiles(t *testing.T) {
+	files := make([]File, 0)
+	for _, name := range []string{"a.go", "b.go", "c.go", "d.go", "e.go"} {
+		files = append(files, NewFile(NewCommit("abc1234", "alice", MergeDiffNone), name))
+	}
+
+	var names []string
+	cursor, pages := "", 0
+	for {
+		page, next, err := pageFiles(files, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range page {
+			names = append(names, file.Name())
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if pages != 3 || len(names) != len(files) || names[2] != "c.go" || names[4] != "e.go" {
+		t.Errorf("paged %q in %d pages, want the five files in 3", names, pages)
+	}
+
+	if page, next, err := pageFiles(files, "", 0); err != nil || len(page) != len(files) || next != "" {
+		t.Errorf("a page of size 0 = %d files, next %q, %v, want every file", len(page), next, err)
+	}
+	if _, _, err := pageFiles(files, "", -1); err == nil {
+		t.Error("a negative page size succeeded")
+	}
+	if _, _, err := pageFiles(files, "nope", 2); err == nil || errors.Is(err, ErrStaleCursor) {
+		t.Errorf("a cursor gitility did not return = %v, want a bad cursor", err)
+	}
+	gone := pagePosition{Commit: "abc1234", Name: "gone.go"}.cursor()
+	if _, _, err := pageFiles(files, gone, 2); !errors.Is(err, ErrStaleCursor) {
+		t.Errorf("the cursor of a file not listed = %v, want ErrStaleCursor", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readPathList reads the files of -paths-from: one path from the top of the
+// repository per line, or per NUL when the list has any, as git ls-files
+// -z prints them. "-" reads stdin.
+func readPathList(name string) (map[string]bool, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sep := []byte("\n")
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = []byte{0}
+	}
+	paths := make(map[string]bool)
+	for _, line := range bytes.Split(data, sep) {
+		path := strings.TrimRight(string(line), "\r")
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+		path = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(path)), "./")
+		if strings.HasPrefix(path, "../") || filepath.IsAbs(path) {
+			return nil, fmt.Errorf("%s: %q is not a path inside the repository", name, path)
+		}
+		paths[path] = true
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: no path", name)
+	}
+	return paths, nil
+}
+
+// inPathList keeps the files of the list.
+func inPathList(paths map[string]bool) Filters {
+	return func(file File) bool { return paths[file.Name()] }
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// Plugins are executables declared in .gitility.yaml. They speak JSON over
+// stdin and stdout, so they can be written in any language:
+//
+//   - a filter plugin runs for the whole query and receives one file per
+//     line, a FileResult; it answers each with {"keep": bool}.
+//   - a report plugin, picked with -report, receives the JSON array of the
+//     listed files on stdin and writes the report to stdout.
+//
+// Plugins run in the repository root. They are commands of whoever wrote
+// the repository, so they only run with -trust-plugins, and are never read
+// from a -remote repository nor run in the sandbox.
+
+type pluginConfig struct {
+	Name    string   `json:"name"`
+	Kind    string   `json:"kind"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+const (
+	pluginFilter = "filter"
+	pluginReport = "report"
+)
+
+func (c config) plugin(kind, name string) (pluginConfig, bool) {
+	for _, p := range c.Plugins {
+		if p.Kind == kind && p.Name == name {
+			return p, true
+		}
+	}
+	return pluginConfig{}, false
+}
+
+func (c config) filterPlugins() []pluginConfig {
+	res := make([]pluginConfig, 0)
+	for _, p := range c.Plugins {
+		if p.Kind == pluginFilter {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+type filterPlugin struct {
+	name string
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+	out  *bufio.Scanner
+
+	mu  sync.Mutex
+	err error
+}
+
+func startFilterPlugin(ctx context.Context, dir string, cfg pluginConfig) (*filterPlugin, error) {
+	cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", cfg.Name, err)
+	}
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	return &filterPlugin{name: cfg.Name, cmd: cmd, in: in, out: scanner}, nil
+}
+
+// filter asks the plugin about every file. After the first failure it
+// drops every file; Err reports why.
+func (p *filterPlugin) filter(ctx context.Context) Filters {
+	return func(file File) bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.err != nil {
+			return false
+		}
+
+		keep := false
+		results, err := fileResults(ctx, []File{file})
+		if err == nil {
+			keep, err = p.ask(results[0])
+		}
+		if err != nil {
+			p.err = fmt.Errorf("plugin %s: %w", p.name, err)
+			return false
+		}
+		return keep
+	}
+}
+
+func (p *filterPlugin) ask(file FileResult) (bool, error) {
+	line, err := json.Marshal(file)
+	if err != nil {
+		return false, err
+	}
+	if _, err := p.in.Write(append(line, '\n')); err != nil {
+		return false, err
+	}
+	if !p.out.Scan() {
+		if err := p.out.Err(); err != nil {
+			return false, err
+		}
+		return false, io.ErrUnexpectedEOF
+	}
+	reply := struct {
+		Keep bool `json:"keep"`
+	}{}
+	if err := json.Unmarshal(p.out.Bytes(), &reply); err != nil {
+		return false, err
+	}
+	return reply.Keep, nil
+}
+
+func (p *filterPlugin) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *filterPlugin) close() {
+	p.in.Close()
+	p.cmd.Wait()
+}
+
+// runReportPlugin feeds files to the report plugin, whose output goes
+// straight to stdout.
+func runReportPlugin(ctx context.Context, dir string, cfg pluginConfig, files []File) error {
+	results, err := fileResults(ctx, files)
+	if err != nil {
+		return err
+	}
+	input, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, cfg.Command, cfg.Args...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("plugin %s: %w", cfg.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+// CommitField is a lazily loaded part of a Commit.
+type CommitField int
+
+const (
+	CommitFieldTime CommitField = iota
+	CommitFieldFiles
+)
+
+// preloadBatch bounds the commits named on one git command line.
+const preloadBatch = 500
+
+// Preload loads the fields of the commits that are not loaded yet with one
+// git command per batch of commits, instead of one per commit and field.
+// Commits of other implementations are left alone.
+func Preload(ctx context.Context, commits []Commit, fields ...CommitField) error {
+	ctx, span := startSpan(ctx, "Preload")
+	defer span.End()
+	span.SetAttr("gitility.commits", len(commits))
+
+	for _, field := range fields {
+		// Files are listed per merge diff, which log applies to the whole
+		// command.
+		batches := make(map[filesMode][]*commitObj)
+		for _, commit := range commits {
+			c, ok := commit.(*commitObj)
+			if !ok {
+				continue
+			}
+			c.mu.Lock()
+			loaded := (field == CommitFieldTime && !c.commitTime.IsZero()) || (field == CommitFieldFiles && c.filesLoaded)
+			c.mu.Unlock()
+			if !loaded {
+				key := filesMode{mergeDiff: MergeDiffAuto}
+				if field == CommitFieldFiles {
+					key = filesMode{c.mergeDiff, c.ignoreFormatting, c.paths}
+				}
+				batches[key] = append(batches[key], c)
+			}
+		}
+		for mode, pending := range batches {
+			for len(pending) > 0 {
+				n := len(pending)
+				if n > preloadBatch {
+					n = preloadBatch
+				}
+				var err error
+				if field == CommitFieldTime {
+					err = preloadTimes(ctx, pending[:n])
+				} else {
+					err = preloadFiles(ctx, pending[:n], mode)
+				}
+				if err != nil {
+					span.SetError(err)
+					return err
+				}
+				pending = pending[n:]
+			}
+		}
+	}
+	return nil
+}
+
+func preloadTimes(ctx context.Context, commits []*commitObj) error {
+	args := []string{"log", "--no-walk=unsorted", "--format=%h%x00%cD"}
+	for _, c := range commits {
+		args = append(args, c.commitHash)
+	}
+	output, err := runGit(ctx, args...)
+	if err != nil {
+		return err
+	}
+
+	times := make(map[string]string, len(commits))
+	for _, line := range strings.Split(string(output), "\n") {
+		if hash, date, ok := strings.Cut(line, "\x00"); ok {
+			times[hash] = date
+		}
+	}
+	for _, c := range commits {
+		date, ok := times[c.commitHash]
+		if !ok {
+			continue
+		}
+		commitTime, err := parseCommitTime(date)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.commitTime = commitTime
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// preloadFiles lists the files of the commits the way cmdGetFiles does:
+// without rename detection, with the root commit diffed against the empty
+// tree and merges following the mode.
+func preloadFiles(ctx context.Context, commits []*commitObj, mode filesMode) error {
+	args := []string{"-c", "log.showRoot=true", "-c", "core.quotePath=off", "log", "--no-walk=unsorted", "--format=%x1e%h", "--no-renames", "--raw"}
+	if mode.ignoreFormatting {
+		args = append(args, whitespaceArgs...)
+	}
+	if mode.mergeDiff != MergeDiffAuto {
+		args = append(args, "--diff-merges="+string(mode.mergeDiff))
+	}
+	for _, c := range commits {
+		args = append(args, c.commitHash)
+	}
+	output, err := runGit(ctx, append(args, mode.pathspecArgs()...)...)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string][]string, len(commits))
+	kinds := make(map[string]map[string]FileKind)
+	for _, record := range strings.Split(string(output), "\x1e") {
+		lines := strings.Split(record, "\n")
+		// Separate merge diffs repeat the commit once per parent.
+		if lines[0] == "" {
+			continue
+		}
+		hash := lines[0]
+		for _, line := range lines[1:] {
+			name := ""
+			if rawName, kind, ok := parseRawLine(line); ok {
+				if kind != FileKindRegular {
+					if kinds[hash] == nil {
+						kinds[hash] = make(map[string]FileKind)
+					}
+					kinds[hash][rawName] = kind
+				}
+				if !mode.ignoreFormatting {
+					name = rawName
+				}
+			} else if mode.ignoreFormatting {
+				name = numstatName(line)
+			}
+			names[hash] = append(names[hash], name)
+		}
+	}
+	if mode.ignoreFormatting {
+		if err := dropGofmtChanges(ctx, names); err != nil {
+			return err
+		}
+	}
+	for _, c := range commits {
+		fileNames, ok := names[c.commitHash]
+		// log leaves out the commits changing none of the paths.
+		if !ok && mode.paths == "" {
+			continue
+		}
+		c.mu.Lock()
+		c.setFiles(fileNames, kinds[c.commitHash])
+		c.mu.Unlock()
+	}
+	return nil
+}
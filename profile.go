@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+type profiles struct {
+	cpuFile   *os.File
+	traceFile *os.File
+	memPath   string
+}
+
+func startProfiles(cpuPath string, memPath string, tracePath string) (*profiles, error) {
+	p := &profiles{memPath: memPath}
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		p.cpuFile = f
+	}
+	if tracePath != "" {
+		f, err := os.Create(tracePath)
+		if err != nil {
+			p.stop()
+			return nil, err
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			p.stop()
+			return nil, err
+		}
+		p.traceFile = f
+	}
+	return p, nil
+}
+
+func (p *profiles) stop() error {
+	if p.cpuFile != nil {
+		pprof.StopCPUProfile()
+		p.cpuFile.Close()
+	}
+	if p.traceFile != nil {
+		trace.Stop()
+		p.traceFile.Close()
+	}
+	if p.memPath != "" {
+		f, err := os.Create(p.memPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		runtime.GC()
+		return pprof.WriteHeapProfile(f)
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A monorepo is split into projects: the Bazel packages, directories with a
+// BUILD file, the Go modules of its go.work, or of its go.mod files when
+// there is no go.work, and the Node packages Nx and Turborepo build, with a
+// project.json or package.json. A file belongs to the project of the
+// nearest directory above it.
+
+const (
+	projectsAuto  = "auto"
+	projectsBazel = "bazel"
+	projectsGo    = "go"
+	projectsNode  = "node"
+)
+
+type project struct {
+	Kind string `json:"kind"`
+	// Name is the label of a Bazel package, //path/to/pkg, or the path of
+	// a Go module.
+	Name string `json:"name"`
+	Dir  string `json:"dir"`
+}
+
+type projectMap struct {
+	kind string
+	dirs map[string]project
+}
+
+// loadProjectMap maps the projects of the tree at rev. Auto picks Bazel
+// when the tree has a WORKSPACE or MODULE.bazel at its root, and both Go
+// modules and Node packages otherwise, for mixed-language trees.
+func loadProjectMap(ctx context.Context, rev string, kind string) (*projectMap, error) {
+	names, err := cmdListTree(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+	kinds := []string{kind}
+	if kind == projectsAuto {
+		kinds = []string{projectsGo, projectsNode}
+		for _, name := range names {
+			if name == "WORKSPACE" || name == "WORKSPACE.bazel" || name == "MODULE.bazel" {
+				kinds = []string{projectsBazel}
+				break
+			}
+		}
+	}
+
+	m := &projectMap{kind: strings.Join(kinds, "+"), dirs: make(map[string]project)}
+	for _, kind := range kinds {
+		if err := m.load(ctx, rev, kind, names); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.dirs) == 0 {
+		return nil, fmt.Errorf("no %s projects in %s", m.kind, rev)
+	}
+	return m, nil
+}
+
+// load adds the projects of kind, leaving the directories already mapped
+// to the kinds loaded before.
+func (m *projectMap) load(ctx context.Context, rev string, kind string, names []string) error {
+	add := func(p project) {
+		if _, ok := m.dirs[p.Dir]; !ok {
+			m.dirs[p.Dir] = p
+		}
+	}
+	switch kind {
+	case projectsBazel:
+		for _, name := range names {
+			if base := path.Base(name); base == "BUILD" || base == "BUILD.bazel" {
+				dir := projectDir(name)
+				add(project{Kind: kind, Name: "//" + dir, Dir: dir})
+			}
+		}
+	case projectsGo:
+		modDirs, err := goWorkModules(ctx, rev, names)
+		if err != nil {
+			return err
+		}
+		for _, dir := range modDirs {
+			data, ok, err := cmdReadFile(ctx, rev, path.Join(dir, "go.mod"))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if module := goModulePath(data); module != "" {
+				add(project{Kind: kind, Name: module, Dir: dir})
+			}
+		}
+	case projectsNode:
+		// Nx names a project in its project.json, which wins over the
+		// package.json next to it.
+		for _, manifest := range []string{"project.json", "package.json"} {
+			for _, name := range names {
+				if path.Base(name) != manifest || strings.Contains("/"+name, "/node_modules/") {
+					continue
+				}
+				data, ok, err := cmdReadFile(ctx, rev, name)
+				if err != nil {
+					return err
+				}
+				var pkg struct {
+					Name       string      `json:"name"`
+					Workspaces interface{} `json:"workspaces"`
+				}
+				if !ok || json.Unmarshal(data, &pkg) != nil || pkg.Name == "" {
+					continue
+				}
+				// The root of the workspaces is no project of its own.
+				if pkg.Workspaces != nil && projectDir(name) == "" {
+					continue
+				}
+				add(project{Kind: kind, Name: pkg.Name, Dir: projectDir(name)})
+			}
+		}
+	default:
+		return fmt.Errorf("unknown projects %q, want auto, bazel, go or node", kind)
+	}
+	return nil
+}
+
+// treeRev is the revision whose tree lays out the projects of a walk of
+// ref, the tip of a range.
+func treeRev(ref string) string {
+	if i := strings.LastIndex(ref, ".."); i >= 0 {
+		ref = ref[i+2:]
+	}
+	if ref == "" {
+		return "HEAD"
+	}
+	return ref
+}
+
+// projectDir is the directory of a file in the tree, "" at the root.
+func projectDir(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// goWorkModules lists the module directories the go.work at the root of the
+// tree uses, or all the directories with a go.mod without one.
+func goWorkModules(ctx context.Context, rev string, names []string) ([]string, error) {
+	data, ok, err := cmdReadFile(ctx, rev, "go.work")
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]string, 0)
+	if !ok {
+		for _, name := range names {
+			if path.Base(name) == "go.mod" {
+				dirs = append(dirs, projectDir(name))
+			}
+		}
+		return dirs, nil
+	}
+
+	inUse := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inUse && fields[0] == ")":
+			inUse = false
+		case inUse:
+			dirs = append(dirs, workDir(fields[0]))
+		case fields[0] == "use" && len(fields) > 1 && fields[1] == "(":
+			inUse = true
+		case fields[0] == "use" && len(fields) > 1:
+			dirs = append(dirs, workDir(fields[1]))
+		}
+	}
+	return dirs, scanner.Err()
+}
+
+func workDir(use string) string {
+	dir := path.Clean(strings.Trim(use, `"`+"`"))
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func goModulePath(gomod []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(gomod))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`+"`")
+		}
+	}
+	return ""
+}
+
+// of finds the project of the file name.
+func (m *projectMap) of(name string) (project, bool) {
+	dir := projectDir(name)
+	for {
+		if p, ok := m.dirs[dir]; ok {
+			return p, true
+		}
+		if dir == "" {
+			return project{}, false
+		}
+		dir = projectDir(dir)
+	}
+}
+
+// target is what CI builds or tests for a changed file: every target of its
+// Bazel package, the Go package of its directory or the Node package.
+func (m *projectMap) target(p project, name string) string {
+	switch p.Kind {
+	case projectsBazel:
+		return p.Name + ":all"
+	case projectsNode:
+		return p.Name
+	}
+	rel := strings.TrimPrefix(projectDir(name), p.Dir)
+	return strings.TrimSuffix(p.Name+"/"+strings.TrimPrefix(rel, "/"), "/")
+}
+
+func groupByProject(files []File, m *projectMap) ([]string, map[string][]File) {
+	names := make([]string, 0)
+	groups := make(map[string][]File)
+	for _, file := range files {
+		p, _ := m.of(file.Name())
+		if _, ok := groups[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+		groups[p.Name] = append(groups[p.Name], file)
+	}
+	return names, groups
+}
+
+// projectChurn is the activity of a project over a walk.
+type projectChurn struct {
+	project
+	Changes float64  `json:"changes"`
+	Files   int      `json:"files"`
+	Targets []string `json:"targets"`
+}
+
+func collectProjectChurn(ctx context.Context, q *query, m *projectMap) ([]*projectChurn, error) {
+	commits, err := q.backend.commits(ctx, q.opt)
+	if err != nil {
+		return nil, err
+	}
+	if err := Preload(ctx, commits, CommitFieldFiles); err != nil {
+		return nil, err
+	}
+
+	// Every file counts, not only Go sources: a BUILD or package.json
+	// change affects its project too.
+	filters := q.anyFileFilters()
+	churn := make(map[string]*projectChurn)
+	files := make(map[string]bool)
+	targets := make(map[string]bool)
+	for _, commit := range commits {
+		changed, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		touched := make(map[string]bool)
+		for _, file := range changed {
+			if !satisfyFilters(file, filters) {
+				continue
+			}
+			p, ok := m.of(file.Name())
+			if !ok {
+				continue
+			}
+			c, ok := churn[p.Name]
+			if !ok {
+				c = &projectChurn{project: p, Targets: make([]string, 0)}
+				churn[p.Name] = c
+			}
+			if !touched[p.Name] {
+				touched[p.Name] = true
+				c.Changes++
+			}
+			if !files[file.Name()] {
+				files[file.Name()] = true
+				c.Files++
+			}
+			if target := m.target(p, file.Name()); !targets[target] {
+				targets[target] = true
+				c.Targets = append(c.Targets, target)
+			}
+		}
+	}
+
+	res := make([]*projectChurn, 0, len(churn))
+	for _, c := range churn {
+		sort.Strings(c.Targets)
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Changes != res[j].Changes {
+			return res[i].Changes > res[j].Changes
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, q.err()
+}
+
+func runProjects(args []string) error {
+	flags := flag.NewFlagSet("projects", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 100)
+	kind := flags.String("projects", projectsAuto, "project `layout`: auto, bazel (BUILD files), go (go.work or go.mod files) or node (project.json or package.json files)")
+	asJSON := flags.Bool("json", false, "print a JSON array")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	m, err := loadProjectMap(ctx, treeRev(q.rev()), *kind)
+	if err != nil {
+		return err
+	}
+	churn, err := collectProjectChurn(ctx, q, m)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(churn)
+	}
+	if len(churn) == 0 {
+		return errors.New("no project changed in the walked commits")
+	}
+	for _, c := range churn {
+		fmt.Printf("%4.0f changes %4d files  %s\n", c.Changes, c.Files, displayName(ctx, c.Name))
+		for _, target := range c.Targets {
+			fmt.Printf("    %s\n", displayName(ctx, target))
+		}
+	}
+	return nil
+}
+
+// runAffected prints the projects changed by the walk, one per line, for
+// orchestrators like Nx, Turborepo or a CI matrix to build.
+func runAffected(args []string) error {
+	flags := flag.NewFlagSet("affected", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 100)
+	kind := flags.String("projects", projectsAuto, "project `layout`: auto, bazel, go or node")
+	dirs := flags.Bool("dirs", false, "print the directories of the projects instead of their names")
+	asJSON := flags.Bool("json", false, "print a JSON array of strings")
+	print0 := flags.Bool("print0", false, "end each project with a NUL instead of a newline, for xargs -0")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	if strings.Contains(q.opt.GetCommits.Ref, "..") {
+		// A project changed by any commit of the range is affected: -limit
+		// only caps the walk when given.
+		limitSet := false
+		flags.Visit(func(f *flag.Flag) { limitSet = limitSet || f.Name == "limit" })
+		if !limitSet {
+			q.opt.GetCommits.Limit = math.MaxInt32
+		}
+	}
+
+	m, err := loadProjectMap(ctx, treeRev(q.rev()), *kind)
+	if err != nil {
+		return err
+	}
+	churn, err := collectProjectChurn(ctx, q, m)
+	if err != nil {
+		return err
+	}
+	affected := make([]string, 0, len(churn))
+	for _, c := range churn {
+		if *dirs {
+			dir := c.Dir
+			if dir == "" {
+				dir = "."
+			}
+			affected = append(affected, dir)
+		} else {
+			affected = append(affected, c.Name)
+		}
+	}
+	sort.Strings(affected)
+
+	if *asJSON {
+		return printJSON(affected)
+	}
+	end := "\n"
+	if *print0 {
+		end = "\x00"
+	}
+	for _, name := range affected {
+		fmt.Print(name + end)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pullRequestPatterns match the subjects forges write when merging: a
+// GitHub merge commit, a GitHub or GitLab squash "Title (#123)", Bitbucket
+// "Merged in branch (pull request #123)" and Azure DevOps "Merged PR 123:".
+var pullRequestPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^Merge pull request #(\d+) `),
+	regexp.MustCompile(`\(pull request #(\d+)\)`),
+	regexp.MustCompile(`^Merged PR (\d+):`),
+	regexp.MustCompile(`\((?:#|!)(\d+)\)\s*$`),
+}
+
+func parsePullRequest(subject string) int {
+	for _, re := range pullRequestPatterns {
+		if m := re.FindStringSubmatch(subject); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// groupByPullRequest buckets files by the pull request of their commit, in
+// the order the pull requests first appear; files of commits outside any
+// pull request are grouped under 0.
+func groupByPullRequest(files []File) ([]int, map[int][]File) {
+	numbers := make([]int, 0)
+	groups := make(map[int][]File)
+	for _, file := range files {
+		number := file.GetCommit().PullRequest()
+		if _, ok := groups[number]; !ok {
+			numbers = append(numbers, number)
+		}
+		groups[number] = append(groups[number], file)
+	}
+	return numbers, groups
+}
+
+var forgeSlugPattern = regexp.MustCompile(`[:/]([^/:]+/[^/]+?)(?:\.git)?/?$`)
+
+// forgeSlug returns the owner/name of the repository at url.
+func forgeSlug(url string) (string, bool) {
+	m := forgeSlugPattern.FindStringSubmatch(url)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// repoSlug is the forge owner/name of the -remote url, or of the origin
+// remote when analyzing a local checkout.
+func repoSlug(ctx context.Context, remote string) (string, error) {
+	url := remote
+	if url == "" {
+		var err error
+		if url, err = cmdGetRemoteURL(ctx, "origin"); err != nil {
+			return "", err
+		}
+	}
+	slug, ok := forgeSlug(url)
+	if !ok {
+		return "", fmt.Errorf("cannot tell the forge repository of %s", url)
+	}
+	return slug, nil
+}
+
+func cmdGetRemoteURL(ctx context.Context, remote string) (string, error) {
+	output, err := runGit(ctx, "remote", "get-url", remote)
+	if err != nil {
+		return "", fmt.Errorf("remote %s: %w", remote, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// pullRequestOf asks the forge for the merged pull request that contains
+// commit.
+func (c *forgeClient) pullRequestOf(ctx context.Context, slug string, commit string) (int, error) {
+	number := 0
+	err := c.get(ctx, "/repos/"+slug+"/commits/"+commit+"/pulls", func(body json.RawMessage) error {
+		pulls := make([]struct {
+			Number   int     `json:"number"`
+			MergedAt *string `json:"merged_at"`
+		}, 0)
+		if err := json.Unmarshal(body, &pulls); err != nil {
+			return err
+		}
+		for _, pull := range pulls {
+			if number == 0 && pull.MergedAt != nil {
+				number = pull.Number
+			}
+		}
+		return nil
+	})
+	return number, err
+}
+
+// confirmPullRequests fills in the pull request of the commits whose
+// message does not name one, through the forge API. The repository is the
+// -remote url, or the origin remote.
+func confirmPullRequests(ctx context.Context, client *forgeClient, remote string, files []File) error {
+	slug, err := repoSlug(ctx, remote)
+	if err != nil {
+		return err
+	}
+
+	asked := make(map[string]int)
+	for _, file := range files {
+		commit, ok := file.GetCommit().(*commitObj)
+		if !ok || commit.pullRequest != 0 {
+			continue
+		}
+		number, ok := asked[commit.commitHash]
+		if !ok {
+			var err error
+			if number, err = client.pullRequestOf(ctx, slug, commit.commitHash); err != nil {
+				return err
+			}
+			asked[commit.commitHash] = number
+		}
+		commit.pullRequest = number
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+)
+
+// Filters are functions gitility runs on every file git lists. Some of them
+// also have a git pathspec saying the same, or less: handing those to the
+// git commands listing the files of the commits keeps the other files out
+// of their output, which on big repositories is most of it. The filters
+// still run on what git lists, so a pathspec only has to keep every file
+// its filter keeps.
+//
+// Only the files listed are narrowed, never the walked commits: pushing
+// -author or a pathspec into the walk would change what -limit counts.
+
+// Pathspecs are read relative to the working directory and file paths are
+// relative to the top of the repository, so every pathspec handed to git
+// carries the top magic.
+
+// goSourcePaths are the pathspecs of the default filters, Go sources that
+// are neither generated protobuf code, mocks nor tests. Pathspec wildcards
+// match across slashes.
+var goSourcePaths = []string{":(top)*.go", ":(top,exclude)*.pb.*", ":(top,exclude)*mock/*", ":(top,exclude)*_test.*"}
+
+// hasGlob tells whether s has a character git pathspecs match specially.
+func hasGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[\\")
+}
+
+// whereGitPaths are the pathspecs of the file conditions an expression
+// requires, or none when it requires none git can check: the ones of the
+// terms of a conjunction that compare file.path, file.dir or file.ext to a
+// literal.
+func whereGitPaths(expression string) []string {
+	tokens, err := tokenizeExpr(expression)
+	if err != nil {
+		return nil
+	}
+	paths := make([]string, 0)
+	depth, start := 0, 0
+	for i, tok := range tokens {
+		switch {
+		case tok.kind == tokOp && tok.text == "(":
+			depth++
+		case tok.kind == tokOp && tok.text == ")":
+			depth--
+		case tok.kind == tokOp && tok.text == "||" && depth == 0:
+			// Either side may hold, so neither is required.
+			return nil
+		case (tok.kind == tokOp && tok.text == "&&" || tok.kind == tokEOF) && depth == 0:
+			if path, ok := termGitPath(tokens[start:i]); ok {
+				paths = append(paths, path)
+			}
+			start = i + 1
+		}
+	}
+	return paths
+}
+
+// termGitPath reads the pathspec of one term of a conjunction:
+//
+//	file.ext == ".go"                    :(top)*.go
+//	file.dir startsWith "pkg/"           :(top)pkg/
+//	file.path.contains("gen/")           :(top)*gen/*
+//	!file.path endsWith "_gen.go"        :(top,exclude)*_gen.go
+func termGitPath(tokens []exprToken) (string, bool) {
+	// Negations and parentheses around a single term, without more
+	// inside.
+	exclude := false
+	for len(tokens) > 0 && tokens[0].kind == tokOp {
+		if tokens[0].text == "!" {
+			exclude = !exclude
+			tokens = tokens[1:]
+		} else if len(tokens) > 2 && tokens[0].text == "(" && tokens[len(tokens)-1].text == ")" {
+			tokens = tokens[1 : len(tokens)-1]
+		} else {
+			break
+		}
+	}
+
+	text := make([]string, 0, len(tokens))
+	for _, tok := range tokens {
+		if tok.kind == tokString {
+			text = append(text, `"`)
+		} else {
+			text = append(text, tok.text)
+		}
+	}
+	shape := strings.Join(text, " ")
+	lit := ""
+	if n := len(tokens); n > 0 && tokens[n-1].kind == tokString {
+		lit = tokens[n-1].text
+	} else if n > 1 && tokens[n-2].kind == tokString && tokens[n-1].text == ")" {
+		lit = tokens[n-2].text
+	}
+	if lit == "" || hasGlob(lit) || strings.HasPrefix(lit, ":") {
+		return "", false
+	}
+
+	var path string
+	switch shape {
+	case `file . ext == "`:
+		path = "*" + lit
+	case `file . dir startsWith "`, `file . dir . startsWith ( " )`,
+		`file . path startsWith "`, `file . path . startsWith ( " )`:
+		// Only directories: a pathspec naming a file prefix matches
+		// that one file.
+		if !strings.HasSuffix(lit, "/") {
+			return "", false
+		}
+		path = lit
+	case `file . path contains "`, `file . path . contains ( " )`:
+		path = "*" + lit + "*"
+	case `file . path endsWith "`, `file . path . endsWith ( " )`:
+		path = "*" + lit
+	default:
+		return "", false
+	}
+	if exclude {
+		return ":(top,exclude)" + path, true
+	}
+	return ":(top)" + path, true
+}
+
+// listingOptions are the options of the walks whose files the query
+// filters, with its pathspecs. Moves rename files after git lists them,
+// and mass changes count every file of a commit, so both keep git
+// listing them all. With aggregates, the walk lists every change, which
+// they count the authors of, and aggregate lists the files once after.
+func (q *query) listingOptions() Options {
+	opt := q.opt
+	if len(q.aggregates) > 0 {
+		opt.Dedup, opt.DedupFold = DedupNone, DedupFold{}
+	}
+	if opt.GetCommits.FollowMoves || opt.GetCommits.ExcludeMassChanges.enabled() {
+		return opt
+	}
+	opt.GetCommits.Paths = q.paths
+	return opt
+}
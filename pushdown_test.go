@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWhereGitPaths(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       []string
+	}{
+		{`file.ext == ".go"`, []string{":(top)*.go"}},
+		{`file.dir startsWith "pkg/"`, []string{":(top)pkg/"}},
+		{`file.dir.startsWith("pkg/")`, []string{":(top)pkg/"}},
+		{`file.path startsWith "cmd/"`, []string{":(top)cmd/"}},
+		{`file.path.contains("gen/")`, []string{":(top)*gen/*"}},
+		{`file.path contains "gen/"`, []string{":(top)*gen/*"}},
+		{`file.path.endsWith("_gen.go")`, []string{":(top)*_gen.go"}},
+		{`!file.path endsWith "_gen.go"`, []string{":(top,exclude)*_gen.go"}},
+		{`!!file.ext == ".go"`, []string{":(top)*.go"}},
+		{`(file.ext == ".go")`, []string{":(top)*.go"}},
+		{`!(file.ext == ".go")`, []string{":(top,exclude)*.go"}},
+		{`file.ext == ".go" && !file.path.contains("mock/") && commit.author == "alice"`,
+			[]string{":(top)*.go", ":(top,exclude)*mock/*"}},
+		{`commit.author == "alice" && (file.ext == ".go" && file.dir startsWith "pkg/")`, []string{}},
+
+		// A file prefix, not a directory, names a single file.
+		{`file.path startsWith "pkg"`, []string{}},
+		// Globs and magic would change what the pathspec matches.
+		{`file.ext == ".g*"`, []string{}},
+		{`file.path contains ":(icase)x"`, []string{}},
+		// Neither side of a disjunction is required.
+		{`file.ext == ".go" || file.ext == ".md"`, nil},
+		{`file.ext == ".go" && (file.dir startsWith "a/" || file.dir startsWith "b/")`, []string{":(top)*.go"}},
+		{`file.ext != ".go"`, []string{}},
+		{`file.name == "main.go"`, []string{}},
+		{`file.ext == ".go`, nil},
+	}
+	for _, test := range tests {
+		if got := whereGitPaths(test.expression); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("whereGitPaths(%s) = %q, want %q", test.expression, got, test.want)
+		}
+	}
+}
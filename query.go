@@ -0,0 +1,644 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// queryFlags are the commit selection and filtering flags shared by the
+// default listing and the subcommands that walk files.
+type queryFlags struct {
+	flags          *flag.FlagSet
+	limit          *int
+	ref            *string
+	includeAuthors stringsFlag
+	excludeAuthors stringsFlag
+	noBots         *bool
+	signedOnly     *bool
+	trailerFilters stringsFlag
+	where          stringsFlag
+	classes        stringsFlag
+	notebooks      *string
+	lines          *string
+	ignoreFormat   *bool
+	massFiles      *int
+	massPercent    *float64
+	followMoves    *bool
+	dedup          *string
+	dedupCase      *bool
+	dedupNFC       *bool
+	minAuthors     *int
+	maxAuthors     *int
+	teams          stringsFlag
+	pathsFrom      *string
+	excludeKinds   *string
+	quoteNames     *string
+	merges         *string
+	noMerges       *bool
+	firstParent    *bool
+	mergeDiff      *string
+	sampleEvery    *int
+	samplePercent  *float64
+	sampleSeed     *int64
+	reflog         *bool
+	stdin          *bool
+	commitGraph    *bool
+	backend        *string
+	allBranches    *bool
+	branches       stringsFlag
+	keepPicks      *bool
+	fetch          *bool
+	fetchRemotes   stringsFlag
+	token          *string
+	remote         *string
+	keepClone      *bool
+	shallow        *bool
+	anonymize      *bool
+	anonymizeKey   *string
+	trustPlugins   *bool
+}
+
+func addQueryFlags(flags *flag.FlagSet, defaultLimit int) *queryFlags {
+	q := &queryFlags{flags: flags}
+	q.limit = flags.Int("limit", defaultLimit, "number of commits to walk")
+	q.ref = flags.String("ref", "", "revision or range to walk, e.g. origin/main..HEAD")
+	flags.Var(&q.includeAuthors, "author", "only include commits whose author matches the `pattern` (repeatable)")
+	flags.Var(&q.excludeAuthors, "exclude-author", "exclude commits whose author matches the `pattern` (repeatable)")
+	q.noBots = flags.Bool("no-bots", false, "exclude commits authored by bots (dependabot, renovate, CI)")
+	q.signedOnly = flags.Bool("signed-only", false, "exclude commits without a valid GPG/SSH signature")
+	flags.Var(&q.where, "where", "only include files satisfying the `expression`, e.g. 'file.dir startsWith \"pkg/\"' (repeatable)")
+	flags.Var(&q.teams, "team", "only include files owned by the `team`, per "+configFileName+" or CODEOWNERS (repeatable)")
+	q.pathsFrom = flags.String("paths-from", "", "only include the files listed in `file`, one path per line, - for stdin")
+	q.excludeKinds = flags.String("exclude-kind", "", "leave out the files of the `kinds`, comma-separated: symlink, submodule or file")
+	flags.Var(&q.classes, "class", "only include files of the `class`: infra, app, docs or test, instead of Go sources (repeatable)")
+	q.minAuthors = flags.Int("min-authors", 0, "only list files changed by at least `N` distinct authors over the range")
+	q.maxAuthors = flags.Int("max-authors", 0, "only list files changed by at most `N` distinct authors over the range")
+	flags.Var(&q.trailerFilters, "trailer", "only include commits with a trailer matching `key=pattern`, e.g. Reviewed-by=alice (repeatable)")
+	q.merges = flags.String("merges", string(MergesInclude), "merge commits to walk: include, exclude or only")
+	q.noMerges = flags.Bool("no-merges", false, "shorthand for -merges=exclude")
+	q.firstParent = flags.Bool("first-parent", false, "follow only the first parent of merge commits")
+	q.mergeDiff = flags.String("merge-diff", "", "files of merge commits: off, first-parent, separate, combined or dense-combined")
+	q.sampleEvery = flags.Int("sample-every", 0, "only analyze every `N`th commit")
+	q.samplePercent = flags.Float64("sample-percent", 0, "only analyze a random `p` percent of the commits")
+	q.sampleSeed = flags.Int64("sample-seed", 0, "random seed for -sample-percent")
+	q.allBranches = flags.Bool("all-branches", false, "walk the commits reachable from any ref, not just HEAD")
+	flags.Var(&q.branches, "branches", "walk the commits of the branches matching the `glob` (repeatable)")
+	q.keepPicks = flags.Bool("keep-cherry-picks", false, "count a patch cherry-picked onto several walked branches once per commit")
+	q.fetch = flags.Bool("fetch", false, "fetch all remotes before the analysis")
+	flags.Var(&q.fetchRemotes, "fetch-remote", "fetch the remote `name` before the analysis (repeatable, implies -fetch)")
+	q.token = flags.String("token", "", "access `token` for HTTPS remotes (default $"+tokenEnv+")")
+	q.remote = flags.String("remote", "", "analyze the repository at `url` through a temporary blobless clone")
+	q.keepClone = flags.Bool("keep-clone", false, "keep the -remote clone in the cache directory and reuse it on the next run")
+	q.shallow = flags.Bool("shallow", false, "make the -remote clone only as deep as -limit, results may be approximate on merge-heavy histories")
+	q.stdin = flags.Bool("stdin", false, "walk the commits listed on stdin, one hash per line as git rev-list prints them, instead of -ref")
+	q.reflog = flags.Bool("reflog", false, "walk the HEAD reflog instead of the history, including amended and rebased-away commits")
+	q.backend = flags.String("backend", "", "`source` of the commits: "+backendNames()+" (default detected from the repository)")
+	q.notebooks = flags.String("notebooks", notebooksSource, "line counts of Jupyter notebooks: source, of the cell sources alone, or raw, of the JSON with outputs")
+	q.lines = flags.String("lines", linesAll, "lines to count in line stats: all, or only code, comment or blank ones")
+	q.ignoreFormat = flags.Bool("ignore-formatting", false, "leave out the files a commit only reformatted: whitespace-only changes, and Go code gofmt formats the same")
+	q.massFiles = flags.Int("mass-change-files", 0, "leave out the commits changing more than `N` files, like repository-wide renames")
+	q.massPercent = flags.Float64("mass-change-percent", 0, "leave out the commits changing more than `p` percent of the files in the tree")
+	q.dedup = flags.String("dedup", string(DedupFile), "how often to list the same file: once per file, directory or commit, or none to list every change")
+	q.dedupCase = flags.Bool("dedup-ignore-case", false, "list the files whose names only differ in case once, as case-insensitive file systems see them")
+	q.dedupNFC = flags.Bool("dedup-nfc", false, "list the files whose names only differ in Unicode normalization once, like macOS decomposed accents")
+	q.followMoves = flags.Bool("follow-moves", false, "name the files of the commits before a directory move the way it renamed them")
+	q.anonymize = flags.Bool("anonymize", false, "print the authors as pseudonyms, the same for the same person throughout the report")
+	q.anonymizeKey = flags.String("anonymize-key", "", "`key` of the -anonymize pseudonyms, the same for the same person across runs (default $"+anonymizeKeyEnv+", else a random key)")
+	q.quoteNames = flags.String("quote-names", quoteNamesC, "print file names with control characters `quoted`: c, json, or none to print them as they are")
+	q.trustPlugins = flags.Bool("trust-plugins", false, "run the plugins the repository declares in "+configFileName+", which are commands of its authors")
+	q.commitGraph = flags.Bool("commit-graph", false, "write git's commit-graph, which speeds up long history walks, when the repository has none")
+	return q
+}
+
+type query struct {
+	opt            Options
+	backend        *backend
+	filters        []Filters
+	commitFilters  []Filters
+	aggregates     []Aggregates
+	topLevel       string
+	ignorePatterns []string
+	classes        []string
+	// scopeFilters are the filters of -team, -paths-from and
+	// -exclude-kind, which apply to every file rather than Go sources.
+	scopeFilters []Filters
+	lineStats    *lineStats
+	// paths are pathspecs saying what the filters say, or less; see
+	// listingOptions.
+	paths       []string
+	fingerprint string
+	config      config
+	plugins     []*filterPlugin
+	// retention bounds the time to live of the cache entries of the query,
+	// zero keeps them as long as their feature wants.
+	retention time.Duration
+	// untrustedPlugins tells the configuration declared plugins that were
+	// dropped without -trust-plugins.
+	untrustedPlugins bool
+	close            func()
+}
+
+// rev is the single revision the query looks at, for the reports reading
+// a tree rather than walking a range.
+func (q *query) rev() string {
+	if q.opt.GetCommits.Ref != "" {
+		return q.opt.GetCommits.Ref
+	}
+	return "HEAD"
+}
+
+// anyFileFilters are the filters of the reports that look at every file of
+// a commit, not only Go sources: the commit filters, the ignore file,
+// -class, -team, -paths-from and -exclude-kind.
+func (q *query) anyFileFilters() []Filters {
+	filters := append([]Filters{}, q.commitFilters...)
+	if len(q.ignorePatterns) > 0 {
+		filters = append(filters, Exclude(q.ignorePatterns...))
+	}
+	if len(q.classes) > 0 {
+		filters = append(filters, IsClass(q.classes...))
+	}
+	return append(filters, q.scopeFilters...)
+}
+
+// aggregate applies the aggregates to the files of the walk, every change
+// the walk listed, then lists them once as -dedup asks.
+func (q *query) aggregate(files []File) []File {
+	if len(q.aggregates) == 0 {
+		return files
+	}
+	for _, aggregate := range q.aggregates {
+		files = aggregate(files)
+	}
+	return dedupFiles(files, q.opt.Dedup, q.opt.DedupFold)
+}
+
+// err reports the failure of a filter plugin, which drops the files it
+// could not judge instead of failing the walk.
+func (q *query) err() error {
+	for _, p := range q.plugins {
+		if err := p.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runtimeFlags change how a query runs but not what it returns.
+var runtimeFlags = map[string]bool{
+	"since-last-run": true,
+	"identity":       true,
+	"explain":        true,
+	"page-size":      true,
+	"cursor":         true,
+	"no-cache":       true,
+	"cache":          true,
+	"report":         true,
+	"output":         true,
+	"quote-names":    true,
+	"confirm-prs":    true,
+	"api":            true,
+	"cpuprofile":     true,
+	"memprofile":     true,
+	"trace":          true,
+	"timeout":        true,
+	"token":          true,
+	"keep-clone":     true,
+	"fetch":          true,
+	"fetch-remote":   true,
+	"concurrency":    true,
+}
+
+// fingerprint identifies what a query returns: the flags that were set,
+// which stand in for the filter functions that cannot be compared, and the
+// ignore patterns, configured filters and -paths-from list. It is a hash
+// so no secret ever lands in a cache file.
+func (q *queryFlags) fingerprint(ignorePatterns []string, cfg config, pathList []string) string {
+	parts := make([]string, 0)
+	q.flags.Visit(func(f *flag.Flag) {
+		if !runtimeFlags[f.Name] {
+			parts = append(parts, f.Name+"="+f.Value.String())
+		}
+	})
+	sort.Strings(parts)
+	parts = append(parts, ignorePatterns...)
+	for _, filter := range cfg.Filters {
+		parts = append(parts, "filter "+filter)
+	}
+	for _, p := range cfg.filterPlugins() {
+		parts = append(parts, fmt.Sprintf("plugin %s %q %q", p.Name, p.Command, p.Args))
+	}
+	for _, path := range pathList {
+		parts = append(parts, "path "+path)
+	}
+	if len(q.teams) > 0 {
+		// In a stable order, or the same query would miss its own entry.
+		teams := make([]string, 0, len(cfg.Teams))
+		for team := range cfg.Teams {
+			teams = append(teams, team)
+		}
+		sort.Strings(teams)
+		for _, team := range teams {
+			parts = append(parts, fmt.Sprintf("team %s %q", team, cfg.Teams[team]))
+		}
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// build turns the flags into a query. The returned context points the git
+// commands at the analyzed repository and must be used to run the query;
+// call close once done with it.
+func (q *queryFlags) build(ctx context.Context) (context.Context, *query, error) {
+	if err := q.validate(); err != nil {
+		return ctx, nil, err
+	}
+	*q.token = orEnv(*q.token, tokenEnv)
+	*q.anonymizeKey = orEnv(*q.anonymizeKey, anonymizeKeyEnv)
+	ctx = withNameQuoting(ctx, *q.quoteNames)
+	var p *pseudonyms
+	if *q.anonymize {
+		var err error
+		if p, err = newPseudonyms(*q.anonymizeKey); err != nil {
+			return ctx, nil, err
+		}
+	}
+	ctx = withPseudonyms(ctx, p)
+	if *q.remote != "" {
+		if !gitInstalled() {
+			// Cloning takes git, embedded or not.
+			return ctx, nil, errGitNotInstalled
+		}
+		return q.buildRemote(ctx, *q.remote)
+	}
+	if *q.fetch || len(q.fetchRemotes) > 0 {
+		if sandboxOf(ctx) != nil {
+			// Fetching runs the transport and the hooks of the repository
+			// configuration, which the sandbox does not trust.
+			return ctx, nil, errors.New("-fetch writes to the repository, the sandbox only reads it")
+		}
+		if err := fetchRemotes(ctx, q.fetchRemotes, *q.token); err != nil {
+			return ctx, nil, err
+		}
+	}
+	res := &query{close: func() {}}
+	if err := q.buildQuery(ctx, res, ""); err != nil {
+		res.close()
+		return ctx, nil, err
+	}
+	return ctx, res, nil
+}
+
+// validate rejects bad and contradictory flags before anything is fetched
+// or cloned.
+func (q *queryFlags) validate() error {
+	switch {
+	case *q.limit < 0:
+		return errors.New("-limit must not be negative")
+	case *q.noMerges && MergeMode(*q.merges) == MergesOnly:
+		return errors.New("-no-merges contradicts -merges=only")
+	case (*q.noMerges || MergeMode(*q.merges) == MergesExclude) && *q.mergeDiff != "":
+		return errors.New("-merge-diff has no effect when merges are excluded")
+	case *q.minAuthors < 0 || *q.maxAuthors < 0:
+		return errors.New("-min-authors and -max-authors must not be negative")
+	case *q.maxAuthors > 0 && *q.minAuthors > *q.maxAuthors:
+		return fmt.Errorf("-min-authors %d is above -max-authors %d, no file can match", *q.minAuthors, *q.maxAuthors)
+	case *q.sampleEvery < 0:
+		return errors.New("-sample-every must not be negative")
+	case *q.samplePercent < 0 || *q.samplePercent > 100:
+		return errors.New("-sample-percent must be between 0 and 100")
+	case (*q.shallow || *q.keepClone) && *q.remote == "":
+		return errors.New("-shallow and -keep-clone only apply to -remote")
+	case *q.stdin && (*q.ref != "" || *q.allBranches || len(q.branches) > 0 || *q.reflog):
+		return errors.New("-stdin walks the listed commits, it cannot be combined with -ref, -all-branches, -branches or -reflog")
+	case *q.stdin && *q.remote != "":
+		return errors.New("-stdin lists commits of the local repository, it cannot be combined with -remote")
+	case *q.stdin && *q.pathsFrom == "-":
+		return errors.New("-stdin reads the commits from stdin, -paths-from cannot read the paths from it too")
+	case *q.backend != "" && backends[*q.backend] == nil:
+		return fmt.Errorf("unknown -backend %q, want %s", *q.backend, backendNames())
+	}
+	if *q.notebooks != notebooksSource && *q.notebooks != notebooksRaw {
+		return fmt.Errorf("unknown -notebooks %q, want source or raw", *q.notebooks)
+	}
+	if _, ok := lineModes[*q.lines]; !ok && *q.lines != linesAll {
+		return fmt.Errorf("unknown -lines %q, want all, code, comment or blank", *q.lines)
+	}
+	if _, err := parseClasses(q.classes); err != nil {
+		return err
+	}
+	if err := parseQuoteNames(*q.quoteNames); err != nil {
+		return err
+	}
+	if _, err := parseFileKinds(*q.excludeKinds); err != nil {
+		return fmt.Errorf("-exclude-kind: %w", err)
+	}
+	for _, remote := range q.fetchRemotes {
+		if err := checkRemote(remote); err != nil {
+			return fmt.Errorf("-fetch-remote: %w", err)
+		}
+	}
+	if err := checkRemoteURL(*q.remote); err != nil {
+		return fmt.Errorf("-remote: %w", err)
+	}
+	for _, trailerFilter := range q.trailerFilters {
+		if key, _, _ := strings.Cut(trailerFilter, "="); key == "" {
+			return fmt.Errorf("-trailer %q: want key=pattern", trailerFilter)
+		}
+	}
+	opt := Options{}
+	opt.GetCommits.Ref = *q.ref
+	opt.GetCommits.Merges = MergeMode(*q.merges)
+	opt.GetCommits.MergeDiff = MergeDiff(*q.mergeDiff)
+	opt.GetCommits.ExcludeMassChanges = MassChanges{Files: *q.massFiles, Percent: *q.massPercent}
+	opt.Dedup = DedupScope(*q.dedup)
+	return opt.Validate()
+}
+
+// buildRemote is build for the repository at url, analyzed through a clone.
+func (q *queryFlags) buildRemote(ctx context.Context, url string) (context.Context, *query, error) {
+	opts := cloneOptions{
+		keep:        *q.keepClone,
+		token:       *q.token,
+		allBranches: *q.allBranches || len(q.branches) > 0,
+	}
+	if *q.shallow {
+		// One more commit than walked, so the oldest one still diffs
+		// against its parent instead of looking like a root commit.
+		opts.depth = *q.limit + 1
+	}
+	dir, cleanup, err := cloneRemote(ctx, url, opts)
+	if err != nil {
+		return ctx, nil, err
+	}
+	ctx = withRepoDir(ctx, dir)
+
+	res := &query{close: cleanup}
+	if err := q.buildQuery(ctx, res, url); err != nil {
+		res.close()
+		return ctx, nil, err
+	}
+	return ctx, res, nil
+}
+
+func (q *queryFlags) buildQuery(ctx context.Context, res *query, remote string) error {
+	b := gitBackend
+	if *q.backend != "" {
+		b = backends[*q.backend]
+	} else if remote == "" {
+		b = detectBackend(ctx)
+	}
+	if remote != "" && b.marker != gitBackend.marker {
+		return fmt.Errorf("-remote clones git repositories, -backend %s cannot read them", *q.backend)
+	}
+	b, err := standaloneBackend(b, *q.backend != "" || remote != "")
+	if err != nil {
+		return err
+	}
+	if sandboxOf(ctx) != nil {
+		switch {
+		case b != gitBackend:
+			return errors.New("the sandbox only runs git, the repository needs the git backend")
+		case *q.commitGraph:
+			return errors.New("-commit-graph writes to the repository, the sandbox only reads it")
+		}
+	}
+	res.backend = b
+
+	commitFilters := make([]Filters, 0)
+	if *q.noBots {
+		commitFilters = append(commitFilters, isNotBotCommit)
+	}
+	if *q.signedOnly {
+		commitFilters = append(commitFilters, isSignedCommit)
+	}
+	for _, trailerFilter := range q.trailerFilters {
+		key, pattern, _ := strings.Cut(trailerFilter, "=")
+		commitFilters = append(commitFilters, HasTrailer(key, pattern))
+	}
+	if len(q.includeAuthors) > 0 {
+		commitFilters = append(commitFilters, IncludeAuthors(q.includeAuthors...))
+	}
+	if len(q.excludeAuthors) > 0 {
+		commitFilters = append(commitFilters, ExcludeAuthors(q.excludeAuthors...))
+	}
+	filters := []Filters{
+		isGoFile,
+		isNotGoProtoFile,
+		isNotGoMockFile,
+		isNotGoTestFile,
+	}
+	classes, _ := parseClasses(q.classes)
+	if len(classes) > 0 {
+		filters = []Filters{IsClass(classes...)}
+	} else {
+		res.paths = append(res.paths, goSourcePaths...)
+	}
+	res.classes = classes
+	res.lineStats = newLineStats(*q.notebooks == notebooksRaw, *q.lines)
+	filters = append(filters, commitFilters...)
+
+	var topLevel string
+	var ignorePatterns []string
+	var cfg config
+	if remote != "" {
+		topLevel = remote
+		data, ok, err := cmdReadFile(ctx, "HEAD", ignoreFileName)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if ignorePatterns, err = readIgnorePatterns(bytes.NewReader(data)); err != nil {
+				return err
+			}
+		}
+		if data, ok, err = cmdReadFile(ctx, "HEAD", configFileName); err != nil {
+			return err
+		}
+		if ok {
+			if cfg, err = parseConfig(data); err != nil {
+				return err
+			}
+			// Never run the commands of a repository that is not checked
+			// out here.
+			cfg.Plugins = nil
+		}
+	} else {
+		var err error
+		if topLevel, err = b.topLevel(ctx); err != nil {
+			return err
+		}
+		if ignorePatterns, err = loadIgnoreFile(topLevel); err != nil {
+			return err
+		}
+		if cfg, err = loadConfig(topLevel); err != nil {
+			return err
+		}
+		if sandboxOf(ctx) != nil {
+			// Nor of one the sandbox does not trust.
+			cfg.Plugins = nil
+		}
+		if !*q.trustPlugins && len(cfg.Plugins) > 0 {
+			// Nor any unless asked to: they are commands whoever wrote
+			// the repository chose.
+			res.untrustedPlugins = true
+			cfg.Plugins = nil
+		}
+	}
+	retention, err := applyRetention(cfg.Privacy.Retention, topLevel)
+	if err != nil {
+		return fmt.Errorf("%s: privacy.retention: %w", configFileName, err)
+	}
+	res.retention = retention
+	if len(ignorePatterns) > 0 {
+		filters = append(filters, Exclude(ignorePatterns...))
+	}
+	if len(q.teams) > 0 {
+		dir := topLevel
+		if remote != "" {
+			dir = ""
+		}
+		teams, err := loadTeams(ctx, cfg, dir, "HEAD")
+		if err != nil {
+			return err
+		}
+		filter, err := teamFilter(teams, q.teams)
+		if err != nil {
+			return err
+		}
+		res.scopeFilters = append(res.scopeFilters, filter)
+		// What the teams own decides what the query returns.
+		cfg.Teams = teams
+	}
+	var pathList []string
+	if *q.pathsFrom != "" {
+		paths, err := readPathList(*q.pathsFrom)
+		if err != nil {
+			return fmt.Errorf("-paths-from: %w", err)
+		}
+		res.scopeFilters = append(res.scopeFilters, inPathList(paths))
+		listed := make([]string, 0, len(paths))
+		for path := range paths {
+			listed = append(listed, path)
+		}
+		sort.Strings(listed)
+		pathList = listed
+	}
+	if kinds, _ := parseFileKinds(*q.excludeKinds); len(kinds) > 0 {
+		res.scopeFilters = append(res.scopeFilters, ExcludeKinds(kinds...))
+	}
+	filters = append(filters, res.scopeFilters...)
+	needTrailers, needSignatures := false, false
+	for i, expression := range append(append([]string{}, cfg.Filters...), q.where...) {
+		filter, err := Where(expression)
+		if err != nil && i < len(cfg.Filters) {
+			return fmt.Errorf("%s: filter %q: %w", configFileName, expression, err)
+		}
+		if err != nil {
+			return fmt.Errorf("-where %q: %w", expression, err)
+		}
+		filters = append(filters, filter)
+		res.paths = append(res.paths, whereGitPaths(expression)...)
+		needTrailers = needTrailers || whereNeedsTrailers(expression)
+		needSignatures = needSignatures || whereNeedsSignatures(expression)
+	}
+	for _, pc := range cfg.filterPlugins() {
+		p, err := startFilterPlugin(ctx, topLevel, pc)
+		if err != nil {
+			return err
+		}
+		close := res.close
+		res.close = func() {
+			p.close()
+			close()
+		}
+		res.plugins = append(res.plugins, p)
+		filters = append(filters, p.filter(ctx))
+	}
+
+	opt := Options{}
+	opt.GetCommits.Limit = *q.limit
+	opt.GetCommits.Ref = *q.ref
+	if b.marker == gitBackend.marker {
+		ref, err := resolveSVNRefs(ctx, opt.GetCommits.Ref)
+		if err != nil {
+			return err
+		}
+		if remote == "" && jjColocated(topLevel) {
+			if ref, err = resolveJJRefs(ctx, ref); err != nil {
+				return err
+			}
+		}
+		opt.GetCommits.Ref = ref
+	}
+	opt.GetCommits.Merges = MergeMode(*q.merges)
+	if *q.noMerges {
+		opt.GetCommits.Merges = MergesExclude
+	}
+	opt.GetCommits.FirstParent = *q.firstParent
+	opt.GetCommits.MergeDiff = MergeDiff(*q.mergeDiff)
+	opt.GetCommits.Sample = Sample{Every: *q.sampleEvery, Percent: *q.samplePercent, Seed: *q.sampleSeed}
+	opt.GetCommits.Signatures = *q.signedOnly || needSignatures
+	opt.GetCommits.Trailers = len(q.trailerFilters) > 0 || len(res.plugins) > 0 || needTrailers
+	opt.GetCommits.Reflog = *q.reflog
+	opt.GetCommits.AllRefs = *q.allBranches
+	opt.GetCommits.Branches = q.branches
+	if *q.stdin {
+		if b.marker != gitBackend.marker {
+			return errors.New("-stdin needs a git repository")
+		}
+		commits, err := readCommitList(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("-stdin: %w", err)
+		}
+		opt.GetCommits.Commits = commits
+		// -limit still caps the list, but only when given.
+		limitSet := false
+		q.flags.Visit(func(f *flag.Flag) { limitSet = limitSet || f.Name == "limit" })
+		if !limitSet {
+			opt.GetCommits.Limit = len(commits)
+		}
+	}
+	opt.GetCommits.SkipCherryPicks = (*q.allBranches || len(q.branches) > 0) && !*q.keepPicks
+	opt.GetCommits.IgnoreFormatting = *q.ignoreFormat
+	opt.GetCommits.ExcludeMassChanges = MassChanges{Files: *q.massFiles, Percent: *q.massPercent}
+	opt.GetCommits.FollowMoves = *q.followMoves
+	opt.Dedup = DedupScope(*q.dedup)
+	opt.DedupFold = DedupFold{Case: *q.dedupCase, NFC: *q.dedupNFC}
+	if err := b.check(ctx, opt); err != nil {
+		return err
+	}
+	if b.marker == gitBackend.marker {
+		if err := ensureCommitGraph(ctx, *q.commitGraph); err != nil {
+			return err
+		}
+	}
+
+	aggregates := make([]Aggregates, 0)
+	if *q.minAuthors > 0 {
+		aggregates = append(aggregates, MinAuthors(*q.minAuthors))
+	}
+	if *q.maxAuthors > 0 {
+		aggregates = append(aggregates, MaxAuthors(*q.maxAuthors))
+	}
+
+	res.opt = opt
+	res.filters = filters
+	res.commitFilters = commitFilters
+	res.aggregates = aggregates
+	res.topLevel = topLevel
+	res.ignorePatterns = ignorePatterns
+	res.config = cfg
+	res.fingerprint = q.fingerprint(ignorePatterns, cfg, pathList)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+)
+
+// Ranked reports print their entries by decreasing count, ties by name so
+// that runs over the same history print the same, and cut them down to
+// stay readable on big repositories: -top keeps the first N entries,
+// -min-count the ones counted at least c times and -percentile the ones at
+// or above the p-th percentile of all the counts. -with-ties keeps every
+// entry tied with the last one -top keeps, instead of an arbitrary few.
+type rankFlags struct {
+	top        *int
+	minCount   *float64
+	percentile *float64
+	withTies   *bool
+}
+
+func addRankFlags(flags *flag.FlagSet, defaultTop int) *rankFlags {
+	return &rankFlags{
+		top:        flags.Int("top", defaultTop, "number of entries to print, 0 for all"),
+		minCount:   flags.Float64("min-count", 0, "only print the entries counted at least `c` times"),
+		percentile: flags.Float64("percentile", 0, "only print the entries at or above the `p`-th percentile of the counts, 90 for the top tenth"),
+		withTies:   flags.Bool("with-ties", false, "also print the entries tied with the last one -top keeps"),
+	}
+}
+
+func (r *rankFlags) validate() error {
+	switch {
+	case *r.top < 0:
+		return fmt.Errorf("-top %d: must not be negative", *r.top)
+	case *r.minCount < 0:
+		return fmt.Errorf("-min-count %g: must not be negative", *r.minCount)
+	case *r.percentile < 0 || *r.percentile >= 100:
+		return fmt.Errorf("-percentile %g: must be at least 0 and below 100", *r.percentile)
+	}
+	return nil
+}
+
+// keep is how many of n entries, ranked by decreasing count, to print.
+func (r *rankFlags) keep(n int, count func(i int) float64) int {
+	keep := n
+	// Counts may be negative, like the lines a directory lost: only
+	// -min-count and -percentile drop entries for their count.
+	cutoff := math.Inf(-1)
+	if *r.minCount > 0 {
+		cutoff = *r.minCount
+	}
+	if *r.percentile > 0 && n > 0 {
+		// The nearest-rank percentile: the count of the entry ranked
+		// ceil(p% of n) from the bottom.
+		rank := int(math.Ceil(*r.percentile / 100 * float64(n)))
+		if rank < 1 {
+			rank = 1
+		}
+		cutoff = math.Max(cutoff, count(n-rank))
+	}
+	for keep > 0 && count(keep-1) < cutoff {
+		keep--
+	}
+	if top := *r.top; top > 0 && keep > top {
+		last := top
+		for *r.withTies && last < keep && count(last) == count(top-1) {
+			last++
+		}
+		keep = last
+	}
+	return keep
+}
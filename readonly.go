@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// gitility only reads the repositories it analyzes. Every git command goes
+// through gitCommand, which refuses the commands off readOnlyGitCommands
+// unless the context allows writes: to the clones gitility makes of
+// -remote, and for -fetch and -commit-graph, which ask for them.
+
+// readOnlyGitCommands are the git commands that never change a
+// repository; config, symbolic-ref and remote only in the forms that read.
+var readOnlyGitCommands = map[string]bool{
+	"cat-file":     true,
+	"check-attr":   true,
+	"diff":         true,
+	"diff-tree":    true,
+	"for-each-ref": true,
+	"log":          true,
+	"ls-tree":      true,
+	"merge-base":   true,
+	"patch-id":     true,
+	"rev-list":     true,
+	"rev-parse":    true,
+	"show":         true,
+}
+
+// gitWrites tells whether the git arguments may change a repository.
+func gitWrites(args []string) bool {
+	i := gitSubcommandIndex(args)
+	if i < 0 {
+		return true
+	}
+	rest := args[i+1:]
+	operands := 0
+	for _, arg := range rest {
+		if !strings.HasPrefix(arg, "-") {
+			operands++
+		}
+	}
+	switch args[i] {
+	case "config":
+		return len(rest) == 0 || rest[0] != "--get"
+	case "symbolic-ref":
+		// A second operand is the ref to point the first at.
+		return operands > 1
+	case "remote":
+		return len(rest) == 0 || rest[0] != "get-url"
+	}
+	return !readOnlyGitCommands[args[i]]
+}
+
+type gitWritesKey struct{}
+
+// allowGitWrites lets the git commands run with ctx write.
+func allowGitWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, gitWritesKey{}, true)
+}
+
+// checkGitWrites refuses the git arguments that would change a
+// repository, unless ctx allows writes.
+func checkGitWrites(ctx context.Context, args []string) error {
+	if allowed, _ := ctx.Value(gitWritesKey{}).(bool); allowed || !gitWrites(args) {
+		return nil
+	}
+	return fmt.Errorf("git %s: gitility only reads repositories, this command could write to it", gitSubcommand(args))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type repoDirKey struct{}
+
+// withRepoDir makes the git commands run with ctx operate on the repository
+// in dir instead of the working directory.
+func withRepoDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, repoDirKey{}, dir)
+}
+
+func repoDir(ctx context.Context) string {
+	dir, _ := ctx.Value(repoDirKey{}).(string)
+	return dir
+}
+
+func clonePath(url string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(url))
+	return filepath.Join(dir, "gitility", "clones", hex.EncodeToString(sum[:])), nil
+}
+
+type cloneOptions struct {
+	keep        bool
+	token       string
+	allBranches bool
+	depth       int
+}
+
+// cloneRemote makes a bare, blobless clone of url for an analysis: history
+// and trees are all gitility needs, so no file content is downloaded up
+// front and the few blobs a feature may read are fetched lazily by git.
+// Unless allBranches is set only the default branch is fetched, without
+// tags; depth makes the clone shallow. With keep the clone stays in the
+// cache directory and is refreshed on the next run; otherwise the returned
+// cleanup removes it.
+func cloneRemote(ctx context.Context, url string, opts cloneOptions) (string, func(), error) {
+	// The clone is gitility's own, not a repository it analyzes in place.
+	ctx = allowGitWrites(ctx)
+	dir, err := clonePath(url)
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {}
+	if !opts.keep {
+		if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+			return "", nil, err
+		}
+		dir, err = os.MkdirTemp(filepath.Dir(dir), "tmp-")
+		if err != nil {
+			return "", nil, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+	}
+	repoCtx := withRepoDir(ctx, dir)
+
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err == nil {
+		if err := configureCloneFetch(repoCtx, opts); err != nil {
+			return "", nil, err
+		}
+		args := []string{"fetch", "--quiet", "--prune"}
+		if opts.depth > 0 {
+			args = append(args, fmt.Sprintf("--depth=%d", opts.depth))
+		} else if _, err := os.Stat(filepath.Join(dir, "shallow")); err == nil {
+			args = append(args, "--unshallow")
+		}
+		_, err := runGitWithEnv(repoCtx, remoteEnv(opts.token), append(args, "origin")...)
+		return dir, cleanup, remoteError("git fetch "+url, err)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		cleanup()
+		return "", nil, err
+	}
+
+	args := []string{
+		"clone",
+		"--quiet",
+		"--bare",
+		"--filter=blob:none",
+	}
+	if !opts.allBranches {
+		args = append(args, "--single-branch", "--no-tags")
+	}
+	if opts.depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", opts.depth))
+	}
+	_, err = runGitWithEnv(ctx, remoteEnv(opts.token), append(args, "--", url, dir)...)
+	if err == nil {
+		err = configureCloneFetch(repoCtx, opts)
+	}
+	if err := remoteError("git clone "+url, err); err != nil {
+		cleanup()
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// configureCloneFetch sets up what refreshing a kept clone fetches. Bare
+// clones do not fetch by themselves, so the refspec maps the remote
+// branches, or only the default one, straight onto the local ones.
+func configureCloneFetch(ctx context.Context, opts cloneOptions) error {
+	refspec := "+refs/heads/*:refs/heads/*"
+	tagOpt := "--tags"
+	if !opts.allBranches {
+		output, err := runGit(ctx, "symbolic-ref", "HEAD")
+		if err != nil {
+			return err
+		}
+		head := strings.TrimSpace(string(output))
+		refspec = "+" + head + ":" + head
+		tagOpt = "--no-tags"
+	}
+	if _, err := runGit(ctx, "config", "remote.origin.fetch", refspec); err != nil {
+		return err
+	}
+	_, err := runGit(ctx, "config", "remote.origin.tagOpt", tagOpt)
+	return err
+}
+
+func remoteError(what string, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	stderr := strings.TrimSpace(string(exitErr.Stderr))
+	if err := credentialError(what, stderr); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s: %s", what, stderr)
+}
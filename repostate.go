@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	errNotRepository = errors.New("not a git repository")
+	errNoCommits     = errors.New("the repository has no commits yet")
+)
+
+// cmdResolveHead returns the commit HEAD points at, and false on an unborn
+// branch: a new repository or an orphan branch before its first commit.
+func cmdResolveHead(ctx context.Context) (string, bool, error) {
+	output, err := runGit(ctx, "rev-parse", "--verify", "-q", "HEAD")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimSpace(string(output)), true, nil
+}
+
+// checkRepository makes sure the walk the options describe can start:
+// the directory is a repository and, unless other refs are walked, HEAD
+// has a commit. A detached HEAD is fine.
+func checkRepository(ctx context.Context, opt Options) error {
+	if opt.GetCommits.Ref != "" || opt.GetCommits.AllRefs || len(opt.GetCommits.Branches) > 0 || len(opt.GetCommits.Commits) > 0 {
+		return nil
+	}
+	_, ok, err := cmdResolveHead(ctx)
+	if err != nil {
+		return repositoryError(ctx, err)
+	}
+	if ok {
+		return nil
+	}
+	output, err := runGit(ctx, "for-each-ref", "--count=1")
+	if err != nil {
+		return err
+	}
+	if len(output) == 0 {
+		return errNoCommits
+	}
+	output, err = runGit(ctx, "symbolic-ref", "--short", "-q", "HEAD")
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("branch %s has no commits yet, use -ref or -all-branches to walk other branches", strings.TrimSpace(string(output)))
+}
+
+// repositoryError tells a failure to run git in a directory that is not a
+// repository apart from the others, which come back unchanged.
+func repositoryError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	if !gitInstalled() {
+		return errGitNotInstalled
+	}
+	if _, gitErr := runGit(ctx, "rev-parse", "--git-dir"); gitErr == nil {
+		return err
+	}
+	dir := repoDir(ctx)
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	return fmt.Errorf("%s: %w", dir, errNotRepository)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// The result types are what gitility hands to other programs: the -json
+// output of the listing and of hotspots, the input of plugins, the HTTP API
+// and the MCP tools. They are decoupled from the types of the walk, so the
+// JSON stays the same when those change.
+
+// ResultSchemaVersion is the version of the JSON results, in their
+// schema_version field. It only grows when a field changes meaning or
+// goes away; new fields leave it alone.
+const ResultSchemaVersion = 1
+
+// SignatureResult is the signature check of a commit: Code is git's %G?
+// letter, G for a good signature, N for none.
+type SignatureResult struct {
+	Code   string `json:"code"`
+	Signer string `json:"signer,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// CommitResult is a commit. The fields after Time are only set when the
+// query loaded them.
+type CommitResult struct {
+	Hash        string           `json:"commit"`
+	Author      string           `json:"author"`
+	Time        time.Time        `json:"time"`
+	Signature   *SignatureResult `json:"signature,omitempty"`
+	Trailers    Trailers         `json:"trailers,omitempty"`
+	Subject     string           `json:"subject,omitempty"`
+	PullRequest int              `json:"pull_request,omitempty"`
+	SVNRevision int              `json:"svn_revision,omitempty"`
+	ChangeID    string           `json:"change_id,omitempty"`
+}
+
+// FileResult is a listed file with the commit it is listed for, whose
+// fields it carries alongside its name.
+type FileResult struct {
+	SchemaVersion int    `json:"schema_version"`
+	Name          string `json:"name"`
+	// Kind is symlink or submodule for those, and empty for regular files.
+	Kind string `json:"kind,omitempty"`
+	CommitResult
+}
+
+// HotspotResult is a file with the number of walked commits changing it,
+// shared between co-authors.
+type HotspotResult struct {
+	SchemaVersion int     `json:"schema_version"`
+	Name          string  `json:"name"`
+	Changes       float64 `json:"changes"`
+}
+
+func newCommitResult(ctx context.Context, commit Commit) (CommitResult, error) {
+	commitTime, err := commit.CommitTime(ctx)
+	if err != nil {
+		return CommitResult{}, err
+	}
+	res := CommitResult{
+		Hash:        commit.CommitHash(),
+		Author:      commit.Author(),
+		Time:        commitTime,
+		Trailers:    commit.Trailers(),
+		Subject:     commit.Subject(),
+		PullRequest: commit.PullRequest(),
+		SVNRevision: commit.SVN().Revision,
+		ChangeID:    commit.ChangeID(),
+	}
+	if s := commit.SignatureStatus(); s.Code != SignatureUnknown {
+		res.Signature = &SignatureResult{Code: s.Code, Signer: s.Signer, Key: s.Key}
+	}
+	return res, nil
+}
+
+func fileResults(ctx context.Context, files []File) ([]FileResult, error) {
+	commits := make([]Commit, 0, len(files))
+	for _, file := range files {
+		commits = append(commits, file.GetCommit())
+	}
+	if err := Preload(ctx, commits, CommitFieldTime); err != nil {
+		return nil, err
+	}
+	res := make([]FileResult, 0, len(files))
+	for _, file := range files {
+		commit, err := newCommitResult(ctx, file.GetCommit())
+		if err != nil {
+			return nil, err
+		}
+		r := FileResult{SchemaVersion: ResultSchemaVersion, Name: file.Name(), CommitResult: commit}
+		if kind := file.Kind(); kind != FileKindRegular {
+			r.Kind = string(kind)
+		}
+		res = append(res, r)
+	}
+	return res, nil
+}
+
+func hotspotResults(hotspots []fileChanges) []HotspotResult {
+	res := make([]HotspotResult, 0, len(hotspots))
+	for _, hotspot := range hotspots {
+		res = append(res, HotspotResult{SchemaVersion: ResultSchemaVersion, Name: hotspot.Name, Changes: hotspot.Changes})
+	}
+	return res
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What gitility caches names the authors of a repository: the result cache
+// entries, the --since-last-run checkpoints and the kept -remote clones.
+// A retention, set by privacy.retention in .gitility.yaml or by serve,
+// bounds how long any of it is kept: no cache entry outlives it, and every
+// query first purges the cache entries and the checkpoint of its own
+// repository written longer ago, never what other repositories cached nor
+// the clone it reads. serve purges the whole cache directory every hour,
+// the clones fetched longer ago included, and gitility purge does on
+// demand. The redis cache cannot be listed; its entries expire on their
+// own, within the retention.
+
+// serverRetention is the retention of serve, which the repositories it
+// analyzes may shorten but not lengthen. serve sets it before it analyzes
+// any.
+var serverRetention time.Duration
+
+// parseRetention reads a retention given as an age: 30d, 6w, 3m, 1y.
+func parseRetention(spec string) (time.Duration, error) {
+	now := time.Now()
+	cutoff, err := ageCutoff(now, spec)
+	if err != nil {
+		return 0, err
+	}
+	if !cutoff.Before(now) {
+		return 0, fmt.Errorf("retention %q: must be positive", spec)
+	}
+	return now.Sub(cutoff), nil
+}
+
+// retainedTTL is ttl bounded by the retention of the query.
+func (q *query) retainedTTL(ttl time.Duration) time.Duration {
+	if q.retention > 0 && (ttl == 0 || ttl > q.retention) {
+		return q.retention
+	}
+	return ttl
+}
+
+// applyRetention returns the retention of a query of the repository at
+// topLevel from the spec of its configuration, bounded by the one of the
+// server, zero for none, and purges what the repository cached that it has
+// outlived.
+func applyRetention(spec string, topLevel string) (time.Duration, error) {
+	retention := serverRetention
+	if spec != "" {
+		configured, err := parseRetention(spec)
+		if err != nil {
+			return 0, err
+		}
+		if retention == 0 || configured < retention {
+			retention = configured
+		}
+	}
+	if retention == 0 {
+		return 0, nil
+	}
+	return retention, purgeRepo(topLevel, time.Now().Add(-retention))
+}
+
+// purgeRepo removes the cache entries of the repository at topLevel
+// written before cutoff or expired, and its checkpoint when written before
+// cutoff.
+func purgeRepo(topLevel string, cutoff time.Time) error {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return err
+	}
+	dir = filepath.Join(dir, "gitility")
+	remove := func(path string, size int64) error {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if _, err := purgeEntries(filepath.Join(dir, "cache", repoScope(topLevel)), cutoff, remove); err != nil {
+		return err
+	}
+	checkpoint, err := checkpointPath(topLevel)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(checkpoint); err == nil && info.ModTime().Before(cutoff) {
+		return remove(checkpoint, info.Size())
+	}
+	return nil
+}
+
+// purgeEntries removes the disk cache entries under root written before
+// cutoff or expired, and counts them.
+func purgeEntries(root string, cutoff time.Time, remove func(path string, size int64) error) (int, error) {
+	n := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(cutoff) && !cacheEntryExpired(path) {
+			return nil
+		}
+		n++
+		return remove(path, info.Size())
+	})
+	return n, err
+}
+
+// purged counts what a purge removed, or would remove.
+type purged struct {
+	Entries     int   `json:"entries"`
+	Checkpoints int   `json:"checkpoints"`
+	Clones      int   `json:"clones"`
+	Bytes       int64 `json:"bytes"`
+}
+
+// purgeCacheDir removes from the gitility cache directory the cache
+// entries written before cutoff or expired, the checkpoints written before
+// cutoff and the clones last fetched before it. With dryRun it only counts
+// them.
+func purgeCacheDir(cutoff time.Time, dryRun bool) (purged, error) {
+	res := purged{}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return res, err
+	}
+	dir = filepath.Join(dir, "gitility")
+	remove := func(path string, size int64) error {
+		res.Bytes += size
+		if dryRun {
+			return nil
+		}
+		// A concurrent purge may have been first.
+		if err := os.RemoveAll(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if res.Entries, err = purgeEntries(filepath.Join(dir, "cache"), cutoff, remove); err != nil {
+		return res, err
+	}
+
+	checkpoints, err := os.ReadDir(filepath.Join(dir, "checkpoints"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return res, err
+	}
+	for _, entry := range checkpoints {
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return res, err
+		}
+		if info.ModTime().Before(cutoff) {
+			res.Checkpoints++
+			if err := remove(filepath.Join(dir, "checkpoints", entry.Name()), info.Size()); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	clones, err := os.ReadDir(filepath.Join(dir, "clones"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return res, err
+	}
+	for _, entry := range clones {
+		path := filepath.Join(dir, "clones", entry.Name())
+		if !cloneFetched(path).Before(cutoff) {
+			continue
+		}
+		res.Clones++
+		if err := remove(path, dirSize(path)); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// cacheEntryExpired tells whether the deadline a disk cache entry starts
+// with has passed.
+func cacheEntryExpired(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	deadline, err := strconv.ParseInt(strings.TrimSuffix(line, "\n"), 10, 64)
+	return err == nil && deadline > 0 && time.Now().Unix() > deadline
+}
+
+// cloneFetched is when the clone at path was last cloned or fetched.
+func cloneFetched(path string) time.Time {
+	last := time.Time{}
+	for _, name := range []string{"", "HEAD", "FETCH_HEAD"} {
+		if info, err := os.Stat(filepath.Join(path, name)); err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last
+}
+
+func dirSize(path string) int64 {
+	size := int64(0)
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func runPurge(args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	olderThan := flags.String("older-than", "30d", "remove what was cached longer ago than `age`: 30d, 6w, 3m, 1y")
+	all := flags.Bool("all", false, "remove everything gitility cached, whatever its age")
+	dryRun := flags.Bool("dry-run", false, "only print what would be removed")
+	asJSON := flags.Bool("json", false, "print the counts as a JSON object")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		return errors.New("usage: gitility purge [-older-than age | -all] [-dry-run] [-json]")
+	}
+	cutoff := time.Now()
+	if !*all {
+		retention, err := parseRetention(*olderThan)
+		if err != nil {
+			return fmt.Errorf("-older-than: %w", err)
+		}
+		cutoff = cutoff.Add(-retention)
+	}
+
+	res, err := purgeCacheDir(cutoff, *dryRun)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(res)
+	}
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("%s %d cache entries, %d checkpoints and %d clones, %d bytes\n", verb, res.Entries, res.Checkpoints, res.Clones, res.Bytes)
+	return nil
+}
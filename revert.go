@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// revert pairs a revert commit with the commit it undid. How tells whether
+// the message said so or the patches cancel out.
+type revert struct {
+	Revert   string
+	Original string
+	How      string
+}
+
+var revertMessagePattern = regexp.MustCompile(`This reverts commit ([0-9a-f]{7,40})`)
+
+const defaultHotfixPattern = `(?i)\bhot-?fix`
+
+// detectReverts finds the reverts among the walked commits: the ones whose
+// message names the commit they revert, as git revert writes, and with
+// patches, the ones whose diff is exactly the reverse of an older walked
+// commit's.
+func detectReverts(ctx context.Context, opt Options, patches bool) ([]revert, error) {
+	args := revertWalkArgs(opt)
+	output, err := runGit(ctx, append([]string{"log", "--format=%x1e%H%x00%h%x00%b"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	short := make(map[string]string)
+	order := make([]string, 0)
+	bodies := make(map[string]string)
+	for _, record := range strings.Split(string(output), "\x1e") {
+		fields := strings.SplitN(record, "\x00", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		short[fields[0]] = fields[1]
+		order = append(order, fields[0])
+		bodies[fields[0]] = fields[2]
+	}
+	resolve := func(hash string) string {
+		for full, abbrev := range short {
+			if strings.HasPrefix(full, hash) {
+				return abbrev
+			}
+		}
+		if len(hash) > 7 {
+			return hash[:7]
+		}
+		return hash
+	}
+
+	reverts := make([]revert, 0)
+	named := make(map[string]bool)
+	for _, full := range order {
+		if m := revertMessagePattern.FindStringSubmatch(bodies[full]); m != nil {
+			reverts = append(reverts, revert{Revert: short[full], Original: resolve(m[1]), How: "message"})
+			named[short[full]] = true
+		}
+	}
+	if !patches {
+		return reverts, nil
+	}
+
+	forward, err := cmdPatchIDs(ctx, args, false)
+	if err != nil {
+		return nil, err
+	}
+	backward, err := cmdPatchIDs(ctx, args, true)
+	if err != nil {
+		return nil, err
+	}
+	undoes := make(map[string]string, len(backward))
+	for commit, id := range backward {
+		undoes[id] = commit
+	}
+	// order is newest first, so a revert comes before what it reverts.
+	for i, full := range order {
+		original, ok := undoes[forward[full]]
+		if !ok || named[short[full]] {
+			continue
+		}
+		for _, older := range order[i+1:] {
+			if older == original {
+				reverts = append(reverts, revert{Revert: short[full], Original: short[original], How: "patch"})
+				break
+			}
+		}
+	}
+	return reverts, nil
+}
+
+func revertWalkArgs(opt Options) []string {
+	args := []string{"--no-merges"}
+	if opt.GetCommits.Limit > 0 && opt.GetCommits.Limit < math.MaxInt32 {
+		args = append(args, fmt.Sprintf("-%d", opt.GetCommits.Limit))
+	}
+	if opt.GetCommits.FirstParent {
+		args = append(args, "--first-parent")
+	}
+	if opt.GetCommits.Ref != "" {
+		args = append(args, opt.GetCommits.Ref)
+	}
+	return args
+}
+
+// cmdPatchIDs maps the full hashes of the walked commits to the stable
+// patch id of their diff, or of the reversed diff.
+func cmdPatchIDs(ctx context.Context, args []string, reverse bool) (map[string]string, error) {
+	// Reversed diffs swap the a/ and b/ prefixes, which patch-id hashes.
+	logArgs := []string{"log", "-p", "--format=commit %H", "--no-prefix"}
+	if reverse {
+		logArgs = append(logArgs, "-R")
+	}
+
+	ids := make(map[string]string)
+	err := streamGit(ctx, func(r io.Reader) error {
+		cmd, cancel, err := gitCommand(ctx, nil, "patch-id", "--stable")
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		cmd.Stdin = r
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			if id, commit, ok := strings.Cut(scanner.Text(), " "); ok {
+				ids[commit] = id
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			cmd.Wait()
+			return err
+		}
+		return newGitError(cmd.Args[1:], stderr.Bytes(), cmd.Wait())
+	}, append(logArgs, args...)...)
+	return ids, err
+}
+
+func runReverts(args []string) error {
+	flags := flag.NewFlagSet("reverts", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	patches := flags.Bool("patches", true, "also detect reverts by patch equivalence, not only by message")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	reverts, err := detectReverts(ctx, q.opt, *patches)
+	if err != nil {
+		return err
+	}
+	for _, r := range reverts {
+		fmt.Printf("%s reverts %s (%s)\n", r.Revert, r.Original, r.How)
+	}
+	return nil
+}
+
+type riskyFile struct {
+	Name     string
+	Changes  int
+	Reverted int
+	Hotfixed int
+}
+
+func (f riskyFile) risk() float64 {
+	return float64(f.Reverted+f.Hotfixed) / float64(f.Changes)
+}
+
+// riskyFiles counts, per file, the walked changes later reverted and the
+// hotfix commits, whose subject matches hotfix.
+func riskyFiles(ctx context.Context, q *query, patches bool, hotfix *regexp.Regexp) ([]riskyFile, error) {
+	opt := q.opt
+	opt.GetCommits.Subjects = true
+	commits, err := getCommits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	reverts, err := detectReverts(ctx, opt, patches)
+	if err != nil {
+		return nil, err
+	}
+	reverted := make(map[string]bool, len(reverts))
+	for _, r := range reverts {
+		reverted[r.Original] = true
+	}
+
+	stats := make(map[string]*riskyFile)
+	order := make([]string, 0)
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !satisfyFilters(file, q.filters) {
+				continue
+			}
+			f, ok := stats[file.Name()]
+			if !ok {
+				f = &riskyFile{Name: file.Name()}
+				stats[file.Name()] = f
+				order = append(order, file.Name())
+			}
+			f.Changes++
+			if reverted[commit.CommitHash()] {
+				f.Reverted++
+			}
+			if hotfix.MatchString(commit.Subject()) {
+				f.Hotfixed++
+			}
+		}
+	}
+
+	res := make([]riskyFile, 0)
+	for _, name := range order {
+		if f := stats[name]; f.Reverted+f.Hotfixed > 0 {
+			res = append(res, *f)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Reverted+res[i].Hotfixed != res[j].Reverted+res[j].Hotfixed {
+			return res[i].Reverted+res[i].Hotfixed > res[j].Reverted+res[j].Hotfixed
+		}
+		return res[i].risk() > res[j].risk()
+	})
+	return res, nil
+}
+
+func runRisky(args []string) error {
+	flags := flag.NewFlagSet("risky", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	patches := flags.Bool("patches", true, "also detect reverts by patch equivalence, not only by message")
+	hotfixPattern := flags.String("hotfix", defaultHotfixPattern, "regular `expression` matching the subjects of hotfix commits")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+
+	hotfix, err := regexp.Compile(*hotfixPattern)
+	if err != nil {
+		return fmt.Errorf("-hotfix: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	files, err := riskyFiles(ctx, q, *patches, hotfix)
+	if err != nil {
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Printf("%-50s %4d changes %3d reverted %3d hotfixes %5.1f%%\n", displayName(ctx, f.Name), f.Changes, f.Reverted, f.Hotfixed, f.risk()*100)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type forgePull struct {
+	Number         int        `json:"number"`
+	Title          string     `json:"title"`
+	User           forgeUser  `json:"user"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	MergedAt       *time.Time `json:"merged_at"`
+	MergeCommitSHA string     `json:"merge_commit_sha"`
+}
+
+type forgeUser struct {
+	Login string `json:"login"`
+}
+
+type forgeReview struct {
+	User        forgeUser  `json:"user"`
+	SubmittedAt *time.Time `json:"submitted_at"`
+}
+
+// mergedPulls lists the pull requests merged since the cutoff, newest
+// updated first.
+func (c *forgeClient) mergedPulls(ctx context.Context, slug string, since time.Time) ([]forgePull, error) {
+	pulls := make([]forgePull, 0)
+	err := c.get(ctx, "/repos/"+slug+"/pulls?state=closed&sort=updated&direction=desc&per_page=100", func(body json.RawMessage) error {
+		page := make([]forgePull, 0)
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		for _, pull := range page {
+			// Sorted by update, nothing further down was merged later.
+			if pull.UpdatedAt.Before(since) {
+				return errLastPage
+			}
+			if pull.MergedAt != nil && !pull.MergedAt.Before(since) {
+				pulls = append(pulls, pull)
+			}
+		}
+		return nil
+	})
+	return pulls, err
+}
+
+// firstReview is when someone other than the author first reviewed the
+// pull request, or the zero time.
+func (c *forgeClient) firstReview(ctx context.Context, slug string, pull forgePull) (time.Time, error) {
+	first := time.Time{}
+	err := c.get(ctx, "/repos/"+slug+"/pulls/"+strconv.Itoa(pull.Number)+"/reviews?per_page=100", func(body json.RawMessage) error {
+		reviews := make([]forgeReview, 0)
+		if err := json.Unmarshal(body, &reviews); err != nil {
+			return err
+		}
+		for _, review := range reviews {
+			if review.SubmittedAt == nil || review.User.Login == pull.User.Login {
+				continue
+			}
+			if first.IsZero() || review.SubmittedAt.Before(first) {
+				first = *review.SubmittedAt
+			}
+		}
+		return nil
+	})
+	return first, err
+}
+
+type pullSize struct {
+	Files   int
+	Added   int
+	Deleted int
+}
+
+// cmdGetPullSize measures what a merged pull request brought in: the diff
+// of its merge or squash commit against the first parent, counting the
+// files the query keeps. The commit comes from the forge, so anything but
+// a hash is unknown.
+func cmdGetPullSize(ctx context.Context, q *query, commit string) (pullSize, bool, error) {
+	size := pullSize{}
+	if !isCommitHash(commit) {
+		return size, false, nil
+	}
+	if _, err := runGit(ctx, "cat-file", "-e", commit+"^{commit}"); err != nil {
+		return size, false, nil
+	}
+	output, err := runGit(ctx, "-c", "core.quotePath=off", "diff", "--numstat", "--no-renames", commit+"^1", commit, "--")
+	if err != nil {
+		return size, false, err
+	}
+	c := &commitObj{commitHash: commit}
+	for _, line := range strings.Split(string(output), "\n") {
+		stat := strings.SplitN(line, "\t", 3)
+		if len(stat) != 3 || !satisfyFilters(NewFile(c, stat[2]), q.filters) {
+			continue
+		}
+		added, deleted, err := q.lineStats.numstat(ctx, stat[0], stat[1], stat[2], commit+"^1", commit)
+		if err != nil {
+			return size, false, err
+		}
+		size.Files++
+		size.Added += added
+		size.Deleted += deleted
+	}
+	return size, true, nil
+}
+
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// medianInt is median for counts: the mean of the two middle values of an
+// even number of them can fall between two counts.
+func medianInt(values []int) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return float64(sorted[mid-1]+sorted[mid]) / 2
+	}
+	return float64(sorted[mid])
+}
+
+// formatHours prints a duration in hours, which reads better than Go's
+// format for review latencies.
+func formatHours(d time.Duration) string {
+	return strconv.FormatFloat(d.Hours(), 'f', 1, 64) + "h"
+}
+
+func runReviewStats(args []string) error {
+	flags := flag.NewFlagSet("review-stats", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	api := flags.String("api", defaultForgeAPI, "forge API `url`, for GitHub Enterprise")
+	since := flags.String("since", "30d", "report the pull requests merged within `age`: 30d, 6w, 3m, 1y")
+	timeout := flags.Duration("timeout", 10*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if *queryFlags.token == "" {
+		*queryFlags.token = orEnv(os.Getenv(tokenEnv), "GITHUB_TOKEN")
+	}
+
+	cutoff, err := ageCutoff(time.Now(), *since)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	slug, err := repoSlug(ctx, *queryFlags.remote)
+	if err != nil {
+		return err
+	}
+	client := newForgeClient(*api, *queryFlags.token)
+	pulls, err := client.mergedPulls(ctx, slug, cutoff)
+	if err != nil {
+		return err
+	}
+	if len(pulls) == 0 {
+		return errors.New("no pull request merged in the window")
+	}
+	sort.Slice(pulls, func(i, j int) bool { return pulls[i].MergedAt.After(*pulls[j].MergedAt) })
+
+	toReview := make([]time.Duration, 0, len(pulls))
+	toMerge := make([]time.Duration, 0, len(pulls))
+	files, lines := make([]int, 0, len(pulls)), make([]int, 0, len(pulls))
+	for _, pull := range pulls {
+		size, ok, err := cmdGetPullSize(ctx, q, pull.MergeCommitSHA)
+		if err != nil {
+			return err
+		}
+		sizeText := "      ?"
+		if ok {
+			sizeText = fmt.Sprintf("%3d files %+6d %6s", size.Files, size.Added, fmt.Sprintf("-%d", size.Deleted))
+			files = append(files, size.Files)
+			lines = append(lines, size.Added+size.Deleted)
+		}
+
+		reviewText := "    -"
+		first, err := client.firstReview(ctx, slug, pull)
+		if err != nil {
+			return err
+		}
+		if !first.IsZero() {
+			toReview = append(toReview, first.Sub(pull.CreatedAt))
+			reviewText = formatHours(first.Sub(pull.CreatedAt))
+		}
+		merge := pull.MergedAt.Sub(pull.CreatedAt)
+		toMerge = append(toMerge, merge)
+
+		fmt.Printf("#%-6d %s  review %7s  merge %7s  %s\n", pull.Number, sizeText, reviewText, formatHours(merge), pull.Title)
+	}
+
+	fmt.Printf("\n%d pull requests merged since %s\n", len(pulls), cutoff.Format("2006-01-02"))
+	if len(files) > 0 {
+		fmt.Printf("median size: %s files, %s lines\n", strconv.FormatFloat(medianInt(files), 'f', -1, 64), strconv.FormatFloat(medianInt(lines), 'f', -1, 64))
+	}
+	if len(toReview) > 0 {
+		fmt.Printf("median time to first review: %s (%d reviewed)\n", formatHours(median(toReview)), len(toReview))
+	}
+	fmt.Printf("median time to merge: %s\n", formatHours(median(toMerge)))
+	return nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The reviewers of a change are the people who know its files: who changed
+// them, and who changed other files of their directories, before the
+// change. With the forge, who reviewed the pull requests changing them
+// counts too, and the candidates are named by their handles. Every change
+// and review weighs its recency, halving every -half-life, so that people
+// who moved on fade out. The authors of the change are no candidates.
+
+const (
+	// nearbyWeight is what a change to another file of the directory of a
+	// changed file weighs, a change to the file itself weighing 1.
+	nearbyWeight = 0.5
+	// reviewerPulls is how many of the newest pull requests changing the
+	// files the forge is asked the reviews of.
+	reviewerPulls = 30
+)
+
+type reviewerCandidate struct {
+	// Reviewer is the forge handle, as @login, or else the author.
+	Reviewer string  `json:"reviewer"`
+	Score    float64 `json:"score"`
+	// Authored, Nearby and Reviewed are the recency-weighted changes to
+	// the files, to their directories and the reviews of their pull
+	// requests.
+	Authored float64 `json:"authored"`
+	Nearby   float64 `json:"nearby"`
+	Reviewed float64 `json:"reviewed"`
+}
+
+// splitRange returns the base of a range, what it is compared against,
+// HEAD when left out like git does.
+func splitRange(spec string) (string, error) {
+	base, _, ok := strings.Cut(spec, "..")
+	if !ok {
+		return "", fmt.Errorf("revision range %q: want base..head, e.g. origin/main..HEAD", spec)
+	}
+	if base == "" {
+		return "HEAD", nil
+	}
+	return base, nil
+}
+
+// noreplyPattern matches the addresses GitHub makes up for the users who
+// keep theirs private, which carry the handle.
+var noreplyPattern = regexp.MustCompile(`^(?:\d+\+)?([^@]+)@users\.noreply\.github\.com$`)
+
+// commitLogin is the handle of the forge user who authored commit, or ""
+// when the forge does not know the author.
+func (c *forgeClient) commitLogin(ctx context.Context, slug string, commit Commit) (string, error) {
+	if m := noreplyPattern.FindStringSubmatch(authorEmail(commitIdentity(commit))); m != nil {
+		return m[1], nil
+	}
+	login := ""
+	err := c.get(ctx, "/repos/"+slug+"/commits/"+commit.CommitHash(), func(body json.RawMessage) error {
+		var detail struct {
+			Author *forgeUser `json:"author"`
+		}
+		if err := json.Unmarshal(body, &detail); err != nil {
+			return err
+		}
+		if detail.Author != nil {
+			login = detail.Author.Login
+		}
+		return nil
+	})
+	return login, err
+}
+
+// pullReviewers lists the users who reviewed a pull request, once each.
+func (c *forgeClient) pullReviewers(ctx context.Context, slug string, number int) ([]string, error) {
+	logins := make([]string, 0)
+	seen := make(map[string]bool)
+	err := c.get(ctx, "/repos/"+slug+"/pulls/"+strconv.Itoa(number)+"/reviews?per_page=100", func(body json.RawMessage) error {
+		reviews := make([]forgeReview, 0)
+		if err := json.Unmarshal(body, &reviews); err != nil {
+			return err
+		}
+		for _, review := range reviews {
+			if review.User.Login != "" && !seen[review.User.Login] {
+				seen[review.User.Login] = true
+				logins = append(logins, review.User.Login)
+			}
+		}
+		return nil
+	})
+	return logins, err
+}
+
+// suggestReviewers ranks the candidates to review the commits of the
+// range, best first. Without a client, there are no handles nor reviews.
+func suggestReviewers(ctx context.Context, q *query, rangeSpec string, halfLife string, client *forgeClient, slug string) ([]reviewerCandidate, error) {
+	base, err := splitRange(rangeSpec)
+	if err != nil {
+		return nil, err
+	}
+	opt := q.listingOptions()
+	opt.GetCommits.Ref = rangeSpec
+	opt.GetCommits.Limit = math.MaxInt32
+	changes, err := q.backend.commits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	filters := q.anyFileFilters()
+	files := make(map[string]bool)
+	dirs := make(map[string]bool)
+	// changers is a commit of every author of the range.
+	changers := make(map[string]Commit)
+	for _, commit := range changes {
+		changed, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		changers[authorKey(commit.Author())] = commit
+		for _, file := range changed {
+			if satisfyFilters(file, filters) {
+				files[file.Name()] = true
+				dirs[path.Dir(file.Name())] = true
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file changed in %s", rangeSpec)
+	}
+
+	opt = q.listingOptions()
+	opt.GetCommits.Ref = base
+	opt.GetCommits.Subjects = true
+	history, err := q.backend.commits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	recency, err := recencyWeights(ctx, history, halfLife)
+	if err != nil {
+		return nil, fmt.Errorf("-half-life: %w", err)
+	}
+
+	candidates := make(map[string]*reviewerCandidate)
+	// bots are the candidates whose real identity or handle is a bot's.
+	bots := make(map[string]bool)
+	candidate := func(key, identity string) *reviewerCandidate {
+		c, ok := candidates[key]
+		if !ok {
+			c = &reviewerCandidate{Reviewer: displayAuthor(ctx, identity)}
+			candidates[key] = c
+			bots[key] = matchAuthor(botPatterns, strings.TrimPrefix(identity, "@"))
+		}
+		return c
+	}
+	// authored is a commit of every author, to ask the forge the handle of.
+	authored := make(map[string]Commit)
+	pulls := make([]int, 0)
+	pullWeights := make(map[int]float64)
+	addPull := func(commit Commit) {
+		if n := commit.PullRequest(); n > 0 {
+			if _, ok := pullWeights[n]; !ok {
+				pulls = append(pulls, n)
+				pullWeights[n] = recency[commit.CommitHash()]
+			}
+		}
+	}
+	for _, commit := range history {
+		changed, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		key := authorKey(commit.Author())
+		weight := recency[commit.CommitHash()]
+		touched := false
+		for _, file := range changed {
+			if !satisfyFilters(file, filters) {
+				continue
+			}
+			switch {
+			case files[file.Name()]:
+				candidate(key, commitIdentity(commit)).Authored += weight
+				touched = true
+			case dirs[path.Dir(file.Name())]:
+				candidate(key, commitIdentity(commit)).Nearby += weight
+			default:
+				continue
+			}
+			if _, ok := authored[key]; !ok {
+				authored[key] = commit
+			}
+		}
+		if touched {
+			addPull(commit)
+		}
+	}
+
+	if client != nil && opt.GetCommits.Merges != MergesExclude {
+		// Merges list nothing by default, their branch commits are walked;
+		// walked alone, they list what their pull request brought in.
+		opt.GetCommits.Merges = MergesOnly
+		merges, err := q.backend.commits(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, commit := range merges {
+			changed, err := commit.GetFiles(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range changed {
+				if files[file.Name()] && satisfyFilters(file, filters) {
+					addPull(commit)
+					break
+				}
+			}
+		}
+	}
+
+	// The newest weigh the most.
+	sort.SliceStable(pulls, func(i, j int) bool { return pullWeights[pulls[i]] > pullWeights[pulls[j]] })
+	if len(pulls) > reviewerPulls {
+		pulls = pulls[:reviewerPulls]
+	}
+
+	if client != nil {
+		logins := make(map[string]string)
+		for key, commit := range authored {
+			login, err := client.commitLogin(ctx, slug, commit)
+			if err != nil {
+				return nil, err
+			}
+			if login == "" {
+				continue
+			}
+			logins[key] = login
+			// The authors the forge knows go by their handle.
+			c := candidates[key]
+			delete(candidates, key)
+			merged := candidate("@"+strings.ToLower(login), "@"+login)
+			merged.Authored += c.Authored
+			merged.Nearby += c.Nearby
+		}
+		handles := make(map[string]Commit)
+		for key, commit := range changers {
+			login, ok := logins[key]
+			if !ok {
+				if login, err = client.commitLogin(ctx, slug, commit); err != nil {
+					return nil, err
+				}
+			}
+			if login != "" {
+				handles["@"+strings.ToLower(login)] = commit
+			}
+		}
+		for key, commit := range handles {
+			changers[key] = commit
+		}
+		for _, n := range pulls {
+			reviewers, err := client.pullReviewers(ctx, slug, n)
+			if err != nil {
+				return nil, err
+			}
+			for _, login := range reviewers {
+				candidate("@"+strings.ToLower(login), "@"+login).Reviewed += pullWeights[n]
+			}
+		}
+	}
+
+	res := make([]reviewerCandidate, 0, len(candidates))
+	for key, c := range candidates {
+		if _, ok := changers[key]; ok || bots[key] {
+			continue
+		}
+		c.Score = c.Authored + nearbyWeight*c.Nearby + c.Reviewed
+		res = append(res, *c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Reviewer < res[j].Reviewer
+	})
+	return res, q.err()
+}
+
+func runSuggestReviewers(args []string) error {
+	flags := flag.NewFlagSet("suggest-reviewers", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	rank := addRankFlags(flags, 5)
+	halfLife := flags.String("half-life", "90d", "halve the weight of changes and reviews every `age`: 30d, 6w, 3m, 1y")
+	api := flags.String("api", defaultForgeAPI, "forge API `url`, for GitHub Enterprise")
+	noForge := flags.Bool("no-forge", false, "do not ask the forge for handles and reviews even with a token")
+	asJSON := flags.Bool("json", false, "print the candidates as a JSON array")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: gitility suggest-reviewers [flags] <base..head>")
+	}
+	if err := rank.validate(); err != nil {
+		return err
+	}
+	if *queryFlags.token == "" {
+		*queryFlags.token = orEnv(os.Getenv(tokenEnv), "GITHUB_TOKEN")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+
+	// The forge is integrated when there is a token to ask it with and the
+	// repository is on it.
+	var client *forgeClient
+	slug := ""
+	if *queryFlags.token != "" && !*noForge {
+		if slug, err = repoSlug(ctx, *queryFlags.remote); err != nil {
+			fmt.Fprintf(os.Stderr, "gitility: %v; suggesting reviewers from the history alone\n", err)
+		} else {
+			client = newForgeClient(*api, *queryFlags.token)
+		}
+	}
+
+	candidates, err := suggestReviewers(ctx, q, flags.Arg(0), *halfLife, client, slug)
+	if err != nil {
+		return err
+	}
+	candidates = candidates[:rank.keep(len(candidates), func(i int) float64 { return candidates[i].Score })]
+	if *asJSON {
+		return printJSON(candidates)
+	}
+	if len(candidates) == 0 {
+		return errors.New("no one but the authors of the range changed its files or their directories")
+	}
+	for i, c := range candidates {
+		fmt.Printf("%3d. %-40s %6.2f  authored %.1f  nearby %.1f  reviewed %.1f\n", i+1, c.Reviewer, c.Score, c.Authored, c.Nearby, c.Reviewed)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The release risk of a file combines what makes its next change likely
+// to break, each measured between 0 and 1:
+//
+//   - churn, its changes relative to the most changed file;
+//   - trend, how far its changes in the newest window rose above the
+//     windows before, relative to the steepest rise;
+//   - fixes, the share of its changes whose subject names a fix;
+//   - coverage, the share of its statements the tests leave uncovered, from
+//     a Go cover profile;
+//   - ownership, the share of its changes its main author made.
+//
+// The score is their mean weighted by the weights, from 0 to 1. Custom
+// metrics join it when weighted, relative to the file measuring the most.
+var riskComponents = []string{"churn", "trend", "fixes", "coverage", "ownership"}
+
+// parseRiskWeights reads name=weight pairs, separated by commas, over the
+// weights of the scoring profile; the components left out of both weigh
+// 1, the custom metrics 0.
+func parseRiskWeights(spec string, profile map[string]float64, custom []Metric) (map[string]float64, error) {
+	weights := make(map[string]float64, len(riskComponents)+len(custom))
+	for _, c := range riskComponents {
+		weights[c] = 1
+	}
+	for _, m := range custom {
+		weights[m.Name()] = 0
+	}
+	return parseWeights(spec, profile, weights, "risk component", strings.Join(riskComponents, ", ")+" or a custom metric")
+}
+
+type riskFile struct {
+	Name       string             `json:"name"`
+	Score      float64            `json:"score"`
+	Components map[string]float64 `json:"components"`
+}
+
+// riskReport measures the components of every file the walk changed and
+// scores them, riskiest first. Without a cover profile the coverage
+// component weighs nothing.
+func riskReport(ctx context.Context, q *query, window string, fix *regexp.Regexp, coverage *coverageProfile, custom []Metric, weights map[string]float64) ([]riskFile, error) {
+	opt := q.listingOptions()
+	opt.GetCommits.Subjects = true
+	commits, err := q.backend.commits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	t, err := commitTrends(ctx, commits, q.filters, window, window, false)
+	if err != nil {
+		return nil, err
+	}
+
+	fixes := make(map[string]int)
+	o := newOwnership(false)
+	listed := make([]File, 0)
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		isFix := fix.MatchString(commit.Subject())
+		for _, file := range files {
+			if !satisfyFilters(file, q.filters) {
+				continue
+			}
+			if _, ok := o.files[file.Name()]; !ok {
+				listed = append(listed, file)
+			}
+			o.add(file)
+			if isFix {
+				fixes[file.Name()]++
+			}
+		}
+	}
+
+	maxChanges, maxRise := 1.0, 0.0
+	rises := make(map[string]float64, len(t.Series))
+	for _, s := range t.Series {
+		maxChanges = math.Max(maxChanges, s.Changes)
+		n := len(s.Series)
+		if n < 2 {
+			continue
+		}
+		mean, _ := baseline(s.Series[:n-1], anomalyZScore)
+		rises[s.Name] = math.Max(0, s.Series[n-1]-mean)
+		maxRise = math.Max(maxRise, rises[s.Name])
+	}
+	if coverage == nil {
+		weights["coverage"] = 0
+	}
+	components := append([]string{}, riskComponents...)
+	measures := make(map[string]map[string]float64)
+	for _, m := range custom {
+		if weights[m.Name()] == 0 {
+			continue
+		}
+		if err := m.Collect(ctx, commits, listed); err != nil {
+			return nil, fmt.Errorf("metric %s: %w", m.Name(), err)
+		}
+		values, max := make(map[string]float64), 0.0
+		for _, file := range listed {
+			if v, ok := m.Value(file.Name()); ok {
+				values[file.Name()] = v
+				max = math.Max(max, v)
+			}
+		}
+		for name, v := range values {
+			if max > 0 {
+				values[name] = math.Max(0, v/max)
+			} else {
+				values[name] = 0
+			}
+		}
+		components = append(components, m.Name())
+		measures[m.Name()] = values
+	}
+	total := 0.0
+	for _, c := range components {
+		total += weights[c]
+	}
+
+	res := make([]riskFile, 0, len(t.Series))
+	for _, s := range t.Series {
+		f := riskFile{Name: s.Name, Components: make(map[string]float64, len(riskComponents))}
+		f.Components["churn"] = s.Changes / maxChanges
+		if maxRise > 0 {
+			f.Components["trend"] = rises[s.Name] / maxRise
+		}
+		f.Components["fixes"] = float64(fixes[s.Name]) / s.Changes
+		if coverage != nil {
+			if c, ok := coverage.lookup(s.Name); ok {
+				f.Components["coverage"] = c.uncovered()
+			}
+		}
+		if shares := o.sorted(o.files[s.Name]); len(shares) > 0 {
+			f.Components["ownership"] = shares[0].Weight / s.Changes
+		}
+		for name, values := range measures {
+			f.Components[name] = values[s.Name]
+		}
+		if total > 0 {
+			for _, c := range components {
+				f.Score += weights[c] * f.Components[c] / total
+			}
+		}
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, q.err()
+}
+
+func runRisk(args []string) error {
+	flags := flag.NewFlagSet("risk", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	rank := addRankFlags(flags, 20)
+	window := flags.String("window", "30d", "measure the trend of the newest `age` against the windows as long before it")
+	fixPattern := flags.String("fix", defaultFixPattern, "regular `expression` matching the subjects of fix commits")
+	coveragePath := flags.String("coverage", "", "read the test coverage of the files from the Go cover profile `file`")
+	weightSpec := flags.String("weights", "", "`weights` of the components of the score as name=weight pairs, e.g. fixes=2,ownership=0.5 (default 1 each)")
+	profile := flags.String("profile", "", "start from the risk weights of the scoring profile `name` of "+configFileName+" (default the default profile)")
+	asJSON := flags.Bool("json", false, "print the files and their components as a JSON array")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if err := rank.validate(); err != nil {
+		return err
+	}
+	fix, err := regexp.Compile(*fixPattern)
+	if err != nil {
+		return fmt.Errorf("-fix: %w", err)
+	}
+	var coverage *coverageProfile
+	if *coveragePath != "" {
+		if coverage, err = loadCoverage(*coveragePath); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	custom, err := q.metrics()
+	if err != nil {
+		return err
+	}
+	scoring, err := q.config.scoringProfile(*profile)
+	if err != nil {
+		return err
+	}
+	weights, err := parseRiskWeights(*weightSpec, scoring.Risk, custom)
+	if err != nil {
+		return fmt.Errorf("-weights: %w", err)
+	}
+
+	files, err := riskReport(ctx, q, *window, fix, coverage, custom, weights)
+	if err != nil {
+		return err
+	}
+	files = files[:rank.keep(len(files), func(i int) float64 { return files[i].Score })]
+	if *asJSON {
+		return printJSON(files)
+	}
+	for _, f := range files {
+		fmt.Printf("%5.2f  churn %.2f  trend %.2f  fixes %.2f  uncovered %.2f  owner %.2f  ",
+			f.Score, f.Components["churn"], f.Components["trend"], f.Components["fixes"], f.Components["coverage"], f.Components["ownership"])
+		for _, m := range custom {
+			if weights[m.Name()] > 0 {
+				fmt.Printf("%s %.2f  ", m.Name(), f.Components[m.Name()])
+			}
+		}
+		fmt.Println(displayName(ctx, f.Name))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// A hosted server analyzing repositories it does not trust runs git in a
+// sandbox. The repository's own configuration can name commands git runs
+// while reading it: an fsmonitor, textconv and external diff drivers,
+// hooks. The sandbox turns those off, reads no system or user
+// configuration but an empty one of its own, never takes the optional
+// locks that let reads write, and bounds every git command in time, CPU
+// and memory. It does not isolate the file system: run the server as a
+// user with read-only access to the repositories.
+type sandbox struct {
+	// timeout bounds the wall time of every git command.
+	timeout time.Duration
+	// cpu and memory bound its CPU time and address space, in bytes.
+	cpu    time.Duration
+	memory int64
+	// home holds the empty configuration git reads instead of the user's.
+	home string
+}
+
+// sandboxConfig are the -c settings of every sandboxed git command, over
+// those of the repository.
+var sandboxConfig = []string{
+	"core.fsmonitor=false",
+	"core.hooksPath=" + os.DevNull,
+	"gc.auto=0",
+	"maintenance.auto=false",
+	"protocol.ext.allow=never",
+	"protocol.fd.allow=never",
+}
+
+// newSandbox makes the home of a sandbox; close removes it. The resource
+// limits are set by the shell git runs from.
+func newSandbox(timeout, cpu time.Duration, memory int64) (*sandbox, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("the sandbox sets resource limits with a Unix shell, it cannot run on Windows")
+	}
+	if timeout <= 0 || cpu <= 0 || memory <= 0 {
+		return nil, errors.New("the sandbox timeout, CPU time and memory must be positive")
+	}
+	home, err := os.MkdirTemp("", "gitility-sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), nil, 0o600); err != nil {
+		os.RemoveAll(home)
+		return nil, err
+	}
+	return &sandbox{timeout: timeout, cpu: cpu, memory: memory, home: home}, nil
+}
+
+func (sb *sandbox) close() {
+	os.RemoveAll(sb.home)
+}
+
+type sandboxKey struct{}
+
+// withSandbox makes the git commands run with ctx run in the sandbox.
+func withSandbox(ctx context.Context, sb *sandbox) context.Context {
+	return context.WithValue(ctx, sandboxKey{}, sb)
+}
+
+// sandboxOf is the sandbox of ctx, nil outside of one.
+func sandboxOf(ctx context.Context) *sandbox {
+	sb, _ := ctx.Value(sandboxKey{}).(*sandbox)
+	return sb
+}
+
+// env is the environment of a sandboxed git command, after the server's.
+func (sb *sandbox) env() []string {
+	return []string{
+		"HOME=" + sb.home,
+		"XDG_CONFIG_HOME=" + sb.home,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL=" + filepath.Join(sb.home, ".gitconfig"),
+		"GIT_ATTR_NOSYSTEM=1",
+		"GIT_OPTIONAL_LOCKS=0",
+		"GIT_TERMINAL_PROMPT=0",
+	}
+}
+
+// command is the program and arguments running git with args in the
+// sandbox: a shell setting the limits, then exec'ing git so the limits
+// and the kill at the timeout reach it.
+func (sb *sandbox) command(args []string) (string, []string) {
+	git := make([]string, 0, 2*len(sandboxConfig)+len(args)+2)
+	for _, setting := range sandboxConfig {
+		git = append(git, "-c", setting)
+	}
+	i := gitSubcommandIndex(args)
+	git = append(git, args[:i+1]...)
+	if i >= 0 {
+		switch args[i] {
+		case "log", "diff", "show":
+			// Drivers the repository configures are commands too.
+			git = append(git, "--no-textconv", "--no-ext-diff")
+		}
+	}
+	git = append(git, args[i+1:]...)
+
+	cpu := int64((sb.cpu + time.Second - 1) / time.Second)
+	script := fmt.Sprintf(`ulimit -t %d && ulimit -v %d && exec git "$@"`, cpu, sb.memory/1024)
+	return "sh", append([]string{"-c", script, "git"}, git...)
+}
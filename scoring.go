@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scoring profiles tune the composite scores per team, in .gitility.yaml:
+//
+//	scoring:
+//	  default:
+//	    half_life: 90d
+//	  payments:
+//	    risk:
+//	      fixes: 2
+//	      coverage: 2
+//	      trend: 0.5
+//	    half_life: 30d
+//
+// -profile picks one, the default profile when there is one otherwise.
+type scoringProfile struct {
+	// Risk weighs the components of the risk score and the custom metrics
+	// by name, like risk -weights, which still overrides it.
+	Risk map[string]float64 `json:"risk"`
+	// Health weighs the signals of the health score by name, like health
+	// -weights, which still overrides it.
+	Health map[string]float64 `json:"health"`
+	// HalfLife, an age like 30d, makes hotspots weigh every change by its
+	// recency: the newest walked change weighs 1, one HalfLife older 1/2.
+	HalfLife string `json:"half_life"`
+}
+
+const defaultProfile = "default"
+
+// scoringProfile is the profile of a -profile flag, the default profile or
+// none for an empty name.
+func (c config) scoringProfile(name string) (scoringProfile, error) {
+	if name == "" {
+		return c.Scoring[defaultProfile], nil
+	}
+	p, ok := c.Scoring[name]
+	if !ok {
+		names := make([]string, 0, len(c.Scoring))
+		for n := range c.Scoring {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return p, fmt.Errorf("no scoring profile %q in %s, have %q", name, configFileName, names)
+	}
+	return p, nil
+}
+
+// parseWeights reads name=weight pairs, separated by commas, over the
+// weights of the scoring profile, over the default weights. Only the names
+// of the defaults, the components of what, are known.
+func parseWeights(spec string, profile, weights map[string]float64, what, want string) (map[string]float64, error) {
+	set := func(name string, weight float64) error {
+		if weight < 0 {
+			return fmt.Errorf("weight %g of %s: must not be negative", weight, name)
+		}
+		if _, ok := weights[name]; !ok {
+			return fmt.Errorf("unknown %s %q, want %s", what, name, want)
+		}
+		weights[name] = weight
+		return nil
+	}
+	for name, weight := range profile {
+		if err := set(name, weight); err != nil {
+			return nil, fmt.Errorf("%s: %w", configFileName, err)
+		}
+	}
+	if spec == "" {
+		return weights, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		weight, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("weight %q: want name=weight", pair)
+		}
+		if err := set(name, weight); err != nil {
+			return nil, err
+		}
+	}
+	return weights, nil
+}
+
+// recencyWeights weighs the walked commits by their age relative to the
+// newest one, halving every halfLife.
+func recencyWeights(ctx context.Context, commits []Commit, halfLife string) (map[string]float64, error) {
+	if err := Preload(ctx, commits, CommitFieldTime); err != nil {
+		return nil, err
+	}
+	times := make([]time.Time, len(commits))
+	newest := time.Time{}
+	for i, commit := range commits {
+		var err error
+		if times[i], err = commit.CommitTime(ctx); err != nil {
+			return nil, err
+		}
+		if times[i].After(newest) {
+			newest = times[i]
+		}
+	}
+	cutoff, err := ageCutoff(newest, halfLife)
+	if err != nil {
+		return nil, fmt.Errorf("half life: %w", err)
+	}
+	half := newest.Sub(cutoff)
+	if half <= 0 {
+		return nil, fmt.Errorf("half life %s: must be positive", halfLife)
+	}
+	weights := make(map[string]float64, len(commits))
+	for i, commit := range commits {
+		weights[commit.CommitHash()] = math.Pow(0.5, float64(newest.Sub(times[i]))/float64(half))
+	}
+	return weights, nil
+}
+
+// recencyHotspots ranks the files like hotspots, every change weighing its
+// recency.
+func recencyHotspots(ctx context.Context, q *query, halfLife string) ([]fileChanges, error) {
+	commits, err := q.backend.commits(ctx, q.listingOptions())
+	if err != nil {
+		return nil, err
+	}
+	weights, err := recencyWeights(ctx, commits, halfLife)
+	if err != nil {
+		return nil, err
+	}
+	o := newOwnership(false)
+	o.weight = func(c Commit) float64 { return weights[c.CommitHash()] }
+	for _, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if satisfyFilters(file, q.filters) {
+				o.add(file)
+			}
+		}
+	}
+	return o.hotspots(), q.err()
+}
@@ -0,0 +1,727 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// gitility serve answers queries about several repositories over HTTP, each
+// registered under a name:
+//
+//	GET /repos                      the repositories and when they were analyzed
+//	GET /repos/{name}/files         the recent listing, in the -json format, ?limit=N&cursor=c
+//	GET /repos/{name}/hotspots      the files ranked by changes, ?top=N
+//	GET /repos/{name}/owners        the authors ranked by changes and the bus factor
+//
+// and, for admins:
+//
+//	POST   /repos                   register a repository, given as in the config
+//	DELETE /repos/{name}            unregister it
+//	POST   /repos/{name}/refresh    drop its results and analyze it again now
+//	POST   /tokens                  issue an API token, given {"name", "role"}
+//
+// Every repository is analyzed in the background, again every refresh
+// interval, and requests get the latest analysis. Builds with -tags grpc
+// also answer the GET endpoints over gRPC, see grpc.go.
+
+// serverConfig is the file given to serve -config, in the syntax of
+// .gitility.yaml:
+//
+//	refresh: 15m
+//	retention: 30d
+//	auth:
+//	  command: ./check-token
+//	repos:
+//	  - name: api
+//	    path: /srv/git/api
+//	    args: [-limit, 500, -no-bots]
+//	  - name: web
+//	    url: https://github.com/example/web
+//	    refresh: 1h
+type serverConfig struct {
+	Refresh string `json:"refresh"`
+	// Retention bounds how long what the server caches is kept, as an age.
+	Retention string       `json:"retention"`
+	Auth      *authCommand `json:"auth"`
+	Repos     []serverRepo `json:"repos"`
+}
+
+// serverRepo is a registered repository: a local checkout at Path, or a
+// remote at URL analyzed through a kept clone. Args are the query flags of
+// its analysis.
+type serverRepo struct {
+	Name    string        `json:"name"`
+	Path    string        `json:"path"`
+	URL     string        `json:"url"`
+	Args    []interface{} `json:"args"`
+	Refresh string        `json:"refresh"`
+}
+
+// authCommand is the authentication hook of the server: a command run for
+// every request, with the repository name, the role the request needs and
+// the Authorization header in its environment, which allows the request
+// when it exits successfully.
+type authCommand struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+const (
+	authRepoEnv   = "GITILITY_REPO"
+	authRoleEnv   = "GITILITY_ROLE"
+	authHeaderEnv = "GITILITY_AUTHORIZATION"
+)
+
+// authHook decides whether a request may do what role allows on the
+// repository named repo, the empty string for the server-wide endpoints.
+type authHook func(r *http.Request, repo string, need role) error
+
+func (a *authCommand) hook() authHook {
+	return func(r *http.Request, repo string, need role) error {
+		audit(r.Context(), "", append([]string{a.Command}, a.Args...), nil)
+		cmd := exec.CommandContext(r.Context(), a.Command, a.Args...)
+		cmd.Env = append(os.Environ(), authRepoEnv+"="+repo, authRoleEnv+"="+string(need), authHeaderEnv+"="+r.Header.Get("Authorization"))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("auth command %s: %w", a.Command, err)
+		}
+		return nil
+	}
+}
+
+func loadServerConfig(path string) (serverConfig, error) {
+	cfg := serverConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := decodeYAML(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// repoSnapshot is the latest analysis of a repository.
+type repoSnapshot struct {
+	Updated   time.Time
+	Files     []FileResult
+	Hotspots  []HotspotResult
+	Owners    []authorShare
+	BusFactor int
+}
+
+type servedRepo struct {
+	serverRepo
+	args    []string
+	refresh time.Duration
+
+	mu       sync.Mutex
+	snapshot *repoSnapshot
+	err      error
+	// ready is closed once the first analysis is over.
+	ready chan struct{}
+	// kick asks the refresh loop for an analysis now, for the request of
+	// the scope.
+	kick chan auditScope
+	stop context.CancelFunc
+}
+
+func newServedRepo(r serverRepo, refresh time.Duration) (*servedRepo, error) {
+	switch {
+	case r.Name == "" || strings.Contains(r.Name, "/"):
+		return nil, fmt.Errorf("repository name %q: want a non-empty name without slashes", r.Name)
+	case (r.Path == "") == (r.URL == ""):
+		return nil, fmt.Errorf("repository %s: want exactly one of path and url", r.Name)
+	}
+	if r.Refresh != "" {
+		var err error
+		if refresh, err = time.ParseDuration(r.Refresh); err != nil {
+			return nil, fmt.Errorf("repository %s: refresh: %w", r.Name, err)
+		}
+	}
+	// YAML reads bare numbers as numbers, -limit 500 among them.
+	args := make([]string, 0, len(r.Args))
+	for _, arg := range r.Args {
+		args = append(args, fmt.Sprint(arg))
+	}
+	s := &servedRepo{serverRepo: r, args: args, refresh: refresh, ready: make(chan struct{}), kick: make(chan auditScope, 1)}
+	// Reject bad flags now rather than at the first analysis.
+	q, err := s.queryFlags()
+	if err != nil {
+		return nil, err
+	}
+	if err := q.validate(); err != nil {
+		return nil, fmt.Errorf("repository %s: %w", s.Name, err)
+	}
+	return s, nil
+}
+
+func (s *servedRepo) queryFlags() (*queryFlags, error) {
+	flags := flag.NewFlagSet(s.Name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	q := addQueryFlags(flags, 1000)
+	if err := flags.Parse(s.args); err != nil {
+		return nil, fmt.Errorf("repository %s: %w", s.Name, err)
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("repository %s: unexpected argument %q", s.Name, flags.Arg(0))
+	}
+	if *q.stdin {
+		return nil, fmt.Errorf("repository %s: -stdin cannot be served, the server reads no commits from stdin", s.Name)
+	}
+	if s.URL != "" {
+		*q.remote = s.URL
+		*q.keepClone = true
+	}
+	return q, nil
+}
+
+// analyze walks the repository and replaces its snapshot, keeping the
+// previous one when the walk fails.
+func (s *servedRepo) analyze(ctx context.Context, timeout time.Duration) {
+	snapshot, err := s.walk(ctx, timeout)
+	if err != nil {
+		log.Printf("%s: %v", s.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	if err == nil {
+		s.snapshot = snapshot
+	}
+	select {
+	case <-s.ready:
+	default:
+		close(s.ready)
+	}
+}
+
+func (s *servedRepo) walk(ctx context.Context, timeout time.Duration) (*repoSnapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	queryFlags, err := s.queryFlags()
+	if err != nil {
+		return nil, err
+	}
+	if s.Path != "" {
+		ctx = withRepoDir(ctx, s.Path)
+	}
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer q.close()
+
+	files, err := getOrderFiles(q.backend.commits, ctx, q.listingOptions(), q.filters...)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.err(); err != nil {
+		return nil, err
+	}
+	results, err := fileResults(ctx, q.aggregate(files))
+	if err != nil {
+		return nil, err
+	}
+	o, err := collectOwnership(ctx, q, false)
+	if err != nil {
+		return nil, err
+	}
+	busFactor, _ := o.busFactor()
+	return &repoSnapshot{
+		Updated:   time.Now(),
+		Files:     results,
+		Hotspots:  hotspotResults(o.hotspots()),
+		Owners:    o.sorted(o.totals),
+		BusFactor: busFactor,
+	}, nil
+}
+
+// refreshLoop analyzes the repository every refresh interval and when
+// kicked, until ctx is done. The first analysis is audited under scope.
+func (s *servedRepo) refreshLoop(ctx context.Context, timeout time.Duration, scope auditScope) {
+	for {
+		scope.repo = s.Name
+		s.analyze(withAudit(ctx, scope), timeout)
+		var next <-chan time.Time
+		if s.refresh > 0 {
+			next = time.After(s.refresh)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-next:
+			scope.request, scope.client = "schedule", ""
+		case scope = <-s.kick:
+		}
+	}
+}
+
+// flush drops the results of the repository and analyzes it again, for
+// the request of scope; until that analysis is over, requests wait for it.
+func (s *servedRepo) flush(scope auditScope) {
+	s.mu.Lock()
+	s.snapshot = nil
+	s.err = nil
+	select {
+	case <-s.ready:
+		s.ready = make(chan struct{})
+	default:
+	}
+	s.mu.Unlock()
+	select {
+	case s.kick <- scope:
+	default:
+	}
+}
+
+// latest waits for the first analysis and returns the last good one.
+func (s *servedRepo) latest(ctx context.Context) (*repoSnapshot, error) {
+	s.mu.Lock()
+	ready := s.ready
+	s.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-ready:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot == nil {
+		return nil, s.err
+	}
+	return s.snapshot, nil
+}
+
+type server struct {
+	// ctx stops the refresh loops of the repositories.
+	ctx     context.Context
+	refresh time.Duration
+	timeout time.Duration
+	tokens  *tokenStore
+	auth    authHook
+	audit   *auditLog
+
+	mu    sync.Mutex
+	repos map[string]*servedRepo
+}
+
+// register starts analyzing a repository under its name, for the request
+// of scope. The repositories registered over HTTP may not run plugins:
+// only the command line and the configuration file trust them.
+func (srv *server) register(r serverRepo, scope auditScope, overHTTP bool) error {
+	repo, err := newServedRepo(r, srv.refresh)
+	if err != nil {
+		return err
+	}
+	if overHTTP {
+		q, err := repo.queryFlags()
+		if err != nil {
+			return err
+		}
+		if *q.trustPlugins {
+			return fmt.Errorf("repository %s: -trust-plugins is only allowed in the configuration file", r.Name)
+		}
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if _, ok := srv.repos[r.Name]; ok {
+		return fmt.Errorf("repository %s registered twice", r.Name)
+	}
+	ctx, stop := context.WithCancel(srv.ctx)
+	repo.stop = stop
+	srv.repos[r.Name] = repo
+	go repo.refreshLoop(ctx, srv.timeout, scope)
+	return nil
+}
+
+func (srv *server) repo(name string) (*servedRepo, bool) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	repo, ok := srv.repos[name]
+	return repo, ok
+}
+
+// route names the repository of a request and the role it needs, or
+// returns false for the requests of no endpoint.
+func route(method string, parts []string) (string, role, bool) {
+	switch {
+	case len(parts) == 1 && parts[0] == "tokens" && method == http.MethodPost:
+		return "", roleAdmin, true
+	case parts[0] != "repos":
+		return "", "", false
+	case len(parts) == 1 && method == http.MethodGet:
+		return "", roleRead, true
+	case len(parts) == 1 && method == http.MethodPost:
+		return "", roleAdmin, true
+	case len(parts) == 2 && method == http.MethodDelete:
+		return parts[1], roleAdmin, true
+	case len(parts) == 3 && parts[2] == "refresh" && method == http.MethodPost:
+		return parts[1], roleAdmin, true
+	case len(parts) == 3 && method == http.MethodGet:
+		return parts[1], roleRead, true
+	}
+	return "", "", false
+}
+
+// requestScope is the audit scope of the commands run for a request about
+// the repository name.
+func (srv *server) requestScope(r *http.Request, name string) auditScope {
+	return auditScope{log: srv.audit, repo: name, request: r.Method + " " + r.URL.Path, client: r.RemoteAddr}
+}
+
+// authorize checks a request with the tokens and the auth command, and
+// returns the HTTP status refusing it.
+func (srv *server) authorize(r *http.Request, name string, need role) (int, error) {
+	if need == roleAdmin && srv.tokens == nil && srv.auth == nil {
+		// Changing the server takes someone to check who asks.
+		return http.StatusForbidden, errors.New("the admin endpoints need -tokens or an auth command")
+	}
+	for _, auth := range []authHook{srv.tokens.hook(), srv.auth} {
+		if auth == nil {
+			continue
+		}
+		if err := auth(r, name, need); err != nil {
+			log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+			status := http.StatusUnauthorized
+			if errors.Is(err, errForbidden) {
+				status = http.StatusForbidden
+			}
+			return status, errors.New(strings.ToLower(http.StatusText(status)))
+		}
+	}
+	return 0, nil
+}
+
+func (srv *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	name, need, ok := route(r.Method, parts)
+	if !ok {
+		httpError(w, http.StatusNotFound, fmt.Errorf("no endpoint %s %s", r.Method, r.URL.Path))
+		return
+	}
+	r = r.WithContext(withAudit(r.Context(), srv.requestScope(r, name)))
+	if status, err := srv.authorize(r, name, need); err != nil {
+		httpError(w, status, err)
+		return
+	}
+
+	switch {
+	case parts[0] == "tokens":
+		srv.serveIssueToken(w, r)
+		return
+	case name == "" && r.Method == http.MethodGet:
+		srv.serveRepos(w)
+		return
+	case name == "":
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		repo := serverRepo{}
+		if err := json.NewDecoder(r.Body).Decode(&repo); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := srv.register(repo, srv.requestScope(r, ""), true); err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+		log.Printf("registered repository %s", repo.Name)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	repo, ok := srv.repo(name)
+	if !ok {
+		httpError(w, http.StatusNotFound, fmt.Errorf("no repository %q", name))
+		return
+	}
+	if r.Method == http.MethodDelete {
+		srv.mu.Lock()
+		delete(srv.repos, name)
+		srv.mu.Unlock()
+		repo.stop()
+		log.Printf("unregistered repository %s", name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if parts[2] == "refresh" {
+		repo.flush(srv.requestScope(r, name))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	snapshot, err := repo.latest(r.Context())
+	if err != nil {
+		httpError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	switch parts[2] {
+	case "files":
+		srv.serveFilesPage(w, r, snapshot.Files)
+	case "hotspots":
+		hotspots := snapshot.Hotspots
+		if top := r.URL.Query().Get("top"); top != "" {
+			n, err := strconv.Atoi(top)
+			if err != nil || n < 0 {
+				httpError(w, http.StatusBadRequest, fmt.Errorf("top %q: want a non-negative number", top))
+				return
+			}
+			if n > 0 && len(hotspots) > n {
+				hotspots = hotspots[:n]
+			}
+		}
+		writeJSON(w, hotspots)
+	case "owners":
+		writeJSON(w, struct {
+			BusFactor int           `json:"bus_factor"`
+			Owners    []authorShare `json:"owners"`
+		}{snapshot.BusFactor, snapshot.Owners})
+	default:
+		httpError(w, http.StatusNotFound, fmt.Errorf("no endpoint %s", r.URL.Path))
+	}
+}
+
+// serveFilesPage answers ?limit=N&cursor=c with a page of the files, and
+// links the next one in the Link header. Pages come out of the snapshot,
+// so fetching all of them walks nothing again.
+func (srv *server) serveFilesPage(w http.ResponseWriter, r *http.Request, files []FileResult) {
+	query := r.URL.Query()
+	size := 0
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			httpError(w, http.StatusBadRequest, fmt.Errorf("limit %q: want a non-negative number", limit))
+			return
+		}
+		size = n
+	}
+	start, end, next, err := pageBounds(query.Get("cursor"), size, len(files), func(i int) pagePosition {
+		return pagePosition{Commit: files[i].Hash, Name: files[i].Name}
+	})
+	switch {
+	case errors.Is(err, ErrStaleCursor):
+		httpError(w, http.StatusGone, err)
+		return
+	case err != nil:
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	if next != "" {
+		query.Set("cursor", next)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, query.Encode()))
+	}
+	writeJSON(w, files[start:end])
+}
+
+type repoStatus struct {
+	Name    string    `json:"name"`
+	Updated time.Time `json:"updated,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+func (srv *server) serveRepos(w http.ResponseWriter) {
+	writeJSON(w, srv.statuses())
+}
+
+// statuses are the registered repositories and when they were analyzed,
+// by name.
+func (srv *server) statuses() []repoStatus {
+	srv.mu.Lock()
+	statuses := make([]repoStatus, 0, len(srv.repos))
+	for name, repo := range srv.repos {
+		status := repoStatus{Name: name}
+		repo.mu.Lock()
+		if repo.snapshot != nil {
+			status.Updated = repo.snapshot.Updated
+		}
+		if repo.err != nil {
+			status.Error = repo.err.Error()
+		}
+		repo.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	srv.mu.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Print(err)
+	}
+}
+
+func httpError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "listen on `address`")
+	configPath := flags.String("config", "", "read the repositories, their flags and the auth hook from `file`")
+	var repoFlags stringsFlag
+	flags.Var(&repoFlags, "repo", "serve the repository checked out at `path` as name, given as name=path (repeatable)")
+	refresh := flags.Duration("refresh", 15*time.Minute, "analyze every repository again after `duration`, 0 to analyze once")
+	timeout := flags.Duration("timeout", 10*time.Minute, "give up on an analysis after `duration`")
+	tokensPath := flags.String("tokens", "", "only accept requests bearing an API token of `file`, made by gitility token")
+	sandboxed := flags.Bool("sandbox", false, "run git sandboxed, for repositories that are not trusted: no commands of their configuration, no writes, bounded resources")
+	sandboxTimeout := flags.Duration("sandbox-timeout", 5*time.Minute, "with -sandbox, kill a git command after `duration`")
+	sandboxCPU := flags.Duration("sandbox-cpu", 5*time.Minute, "with -sandbox, limit a git command to `duration` of CPU time")
+	sandboxMemory := flags.Int64("sandbox-memory", 4096, "with -sandbox, limit the address space of a git command to `MiB`")
+	auditPath := flags.String("audit-log", "", "append every command the server runs, with the request it ran for, to `file` as JSON lines")
+	retention := flags.String("retention", "", "keep what is cached about the repositories for at most `age`, e.g. 30d, and purge the rest every hour")
+	grpcAddr := flags.String("grpc-addr", "", "also serve the gRPC service of proto/gitility.proto on `address`, in builds with -tags grpc")
+	flags.Parse(args)
+	if *grpcAddr != "" && serveGRPC == nil {
+		return errors.New("-grpc-addr: gitility was built without gRPC, build it with -tags grpc")
+	}
+
+	cfg := serverConfig{}
+	if *configPath != "" {
+		var err error
+		if cfg, err = loadServerConfig(*configPath); err != nil {
+			return err
+		}
+		if cfg.Refresh != "" {
+			if *refresh, err = time.ParseDuration(cfg.Refresh); err != nil {
+				return fmt.Errorf("%s: refresh: %w", *configPath, err)
+			}
+		}
+		if cfg.Retention != "" && *retention == "" {
+			*retention = cfg.Retention
+		}
+	}
+	if *retention != "" {
+		var err error
+		if serverRetention, err = parseRetention(*retention); err != nil {
+			return fmt.Errorf("-retention: %w", err)
+		}
+	}
+	for _, repoFlag := range repoFlags {
+		name, path, ok := strings.Cut(repoFlag, "=")
+		if !ok {
+			return fmt.Errorf("-repo %q: want name=path", repoFlag)
+		}
+		cfg.Repos = append(cfg.Repos, serverRepo{Name: name, Path: path})
+	}
+	if len(cfg.Repos) == 0 && *tokensPath == "" {
+		return errors.New("usage: gitility serve [-config file] [-repo name=path]... [flags]")
+	}
+
+	// Stopping the server returns, for the spans to be flushed on the way
+	// out.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go defaultTracer.flushLoop(ctx)
+	if *sandboxed {
+		sb, err := newSandbox(*sandboxTimeout, *sandboxCPU, *sandboxMemory<<20)
+		if err != nil {
+			return err
+		}
+		defer sb.close()
+		ctx = withSandbox(ctx, sb)
+	}
+	var audits *auditLog
+	if *auditPath != "" {
+		var err error
+		if audits, err = openAuditLog(*auditPath); err != nil {
+			return err
+		}
+		defer audits.close()
+	}
+	srv := &server{ctx: ctx, audit: audits, refresh: *refresh, timeout: *timeout, repos: make(map[string]*servedRepo, len(cfg.Repos))}
+	if cfg.Auth != nil {
+		if cfg.Auth.Command == "" {
+			return fmt.Errorf("%s: auth: want a command", *configPath)
+		}
+		srv.auth = cfg.Auth.hook()
+	}
+	if *tokensPath != "" {
+		var err error
+		if srv.tokens, err = loadTokenStore(*tokensPath); err != nil {
+			return err
+		}
+	}
+	for _, r := range cfg.Repos {
+		if err := srv.register(r, auditScope{log: srv.audit, request: "startup"}, false); err != nil {
+			return err
+		}
+	}
+	if serverRetention > 0 {
+		go purgeLoop(ctx, serverRetention)
+	}
+	grpcDone := make(chan error, 1)
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			return err
+		}
+		log.Printf("serving gRPC on %s", lis.Addr())
+		go func() {
+			// Either server failing stops the other.
+			grpcDone <- serveGRPC(ctx, lis, srv)
+			cancel()
+		}()
+	} else {
+		grpcDone <- nil
+	}
+	log.Printf("serving %d repositories on %s", len(cfg.Repos), *addr)
+	httpServer := &http.Server{Addr: *addr, Handler: srv}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-grpcDone
+}
+
+// serveGRPC serves the gRPC service of proto/gitility.proto on lis until
+// ctx is done. Builds without the grpc tag leave it nil.
+var serveGRPC func(ctx context.Context, lis net.Listener, srv *server) error
+
+// purgeLoop purges what the server cached longer ago than retention, now
+// and every hour, until ctx is done: the repositories nobody queries no
+// longer purge it themselves.
+func purgeLoop(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if res, err := purgeCacheDir(time.Now().Add(-retention), false); err != nil {
+			log.Printf("purge: %v", err)
+		} else if res.Entries+res.Checkpoints+res.Clones > 0 {
+			log.Printf("purged %d cache entries, %d checkpoints and %d clones", res.Entries, res.Checkpoints, res.Clones)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// SignatureStatus is git's verdict on a commit signature, see %G? in
+// git-log(1) for the meaning of Code.
+type SignatureStatus struct {
+	Code   string
+	Signer string
+	Key    string
+}
+
+const SignatureUnknown = ""
+
+var signatureDescriptions = map[string]string{
+	"G": "good",
+	"B": "bad",
+	"U": "good, unknown validity",
+	"X": "good, expired",
+	"Y": "good, expired key",
+	"R": "good, revoked key",
+	"E": "cannot be checked",
+	"N": "unsigned",
+}
+
+func (s SignatureStatus) Valid() bool {
+	return s.Code == "G" || s.Code == "U"
+}
+
+func (s SignatureStatus) String() string {
+	if description, ok := signatureDescriptions[s.Code]; ok {
+		return description
+	}
+	return "unknown"
+}
+
+func isSignedCommit(file File) bool {
+	return file.GetCommit().SignatureStatus().Valid()
+}
+
+func runAuditSignatures(args []string) error {
+	flags := flag.NewFlagSet("audit-signatures", flag.ExitOnError)
+	limit := flags.Int("limit", 10, "number of commits to audit")
+	ref := flags.String("ref", "", "revision or range to audit, e.g. origin/main..HEAD")
+	output := addOutputFlags(flags)
+	flags.Parse(args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	opt := Options{}
+	opt.GetCommits.Limit = *limit
+	opt.GetCommits.Ref = *ref
+	if strings.Contains(*ref, "..") {
+		// Every commit of the range is audited: -limit only caps the walk
+		// when given.
+		limitSet := false
+		flags.Visit(func(f *flag.Flag) { limitSet = limitSet || f.Name == "limit" })
+		if !limitSet {
+			opt.GetCommits.Limit = math.MaxInt32
+		}
+	}
+	opt.GetCommits.Signatures = true
+
+	commits, err := getCommits(ctx, opt)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	violations := 0
+	annotations := make([]annotation, 0)
+	rows := make([][]string, 0)
+	for _, commit := range commits {
+		status := commit.SignatureStatus()
+		counts[status.String()]++
+		if !status.Valid() {
+			violations++
+			annotations = append(annotations, annotation{Level: "error", Title: "Signature", Message: fmt.Sprintf("%s %s: %s", commit.CommitHash(), commit.Author(), status)})
+			rows = append(rows, []string{commit.CommitHash(), commit.Author(), status.String()})
+		}
+		fmt.Printf("%s %-24s %-30s %s\n", commit.CommitHash(), status, status.Signer, commit.Author())
+	}
+
+	summary := fmt.Sprintf("%d commits audited:", len(commits))
+	for _, code := range []string{"G", "U", "X", "Y", "R", "E", "B", "N"} {
+		description := signatureDescriptions[code]
+		if counts[description] > 0 {
+			summary += fmt.Sprintf(" %d %s;", counts[description], description)
+		}
+	}
+	fmt.Printf("\n%s\n", summary)
+	if output.annotated() {
+		markdown := "### Signature audit\n\n" + summary + "\n"
+		if len(rows) > 0 {
+			markdown += "\n" + markdownTable([]string{"Commit", "Author", "Signature"}, rows)
+		}
+		if err := output.report(ctx, "Signature audit", violations > 0, annotations, markdown); err != nil {
+			return err
+		}
+	}
+	if violations > 0 {
+		return fmt.Errorf("%d commit(s) without a valid signature", violations)
+	}
+	return nil
+}
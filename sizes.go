@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Small changes review better and break less. The size report measures the
+// files and lines of every walked commit, or pull request, and sums them up
+// per author and per team with percentiles, so that a small-change policy
+// can be checked against what happens.
+
+// fileLines are the lines a change added and deleted in a file.
+type fileLines struct {
+	Name  string
+	Lines int
+}
+
+// sizedChange is a commit, or the merge or squash commit of a pull request,
+// with its files. A pull request merged with a merge commit is authored by
+// the author of its head, not whoever merged it.
+type sizedChange struct {
+	Commit Commit
+	Author string
+	Files  []fileLines
+}
+
+func (c sizedChange) lines() int {
+	lines := 0
+	for _, f := range c.Files {
+		lines += f.Lines
+	}
+	return lines
+}
+
+// measureChanges reads the line counts of the commits, with one git log per
+// batch of commits, keeping the files the query keeps. Merges count what
+// the merge diff lists; first-parent, they count what their pull request
+// brought in.
+func measureChanges(ctx context.Context, q *query, commits []Commit, mergeDiff MergeDiff) ([]sizedChange, error) {
+	res := make([]sizedChange, 0, len(commits))
+	for len(commits) > 0 {
+		n := len(commits)
+		if n > preloadBatch {
+			n = preloadBatch
+		}
+		batch, err := measureBatch(ctx, q, commits[:n], mergeDiff)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, batch...)
+		commits = commits[n:]
+	}
+	return res, nil
+}
+
+func measureBatch(ctx context.Context, q *query, commits []Commit, mergeDiff MergeDiff) ([]sizedChange, error) {
+	args := []string{"-c", "log.showRoot=true", "-c", "core.quotePath=off", "log", "--no-walk=unsorted", "--format=%x1e%h%x00%p", "--no-renames", "--numstat"}
+	if mergeDiff != MergeDiffAuto {
+		args = append(args, "--diff-merges="+string(mergeDiff))
+	}
+	for _, c := range commits {
+		args = append(args, c.CommitHash())
+	}
+	output, err := runGit(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string][]string, len(commits))
+	heads := make(map[string]string)
+	for _, record := range strings.Split(string(output), "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		hash, parents, ok := strings.Cut(lines[0], "\x00")
+		if !ok {
+			continue
+		}
+		if p := strings.Fields(parents); len(p) > 1 {
+			heads[hash] = p[1]
+		}
+		stats[hash] = append(stats[hash], lines[1:]...)
+	}
+	authors, err := commitAuthors(ctx, heads)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]sizedChange, 0, len(commits))
+	for _, commit := range commits {
+		change := sizedChange{Commit: commit, Author: commit.Author()}
+		if author, ok := authors[commit.CommitHash()]; ok {
+			change.Author = author
+		}
+		for _, line := range stats[commit.CommitHash()] {
+			stat := strings.SplitN(line, "\t", 3)
+			if len(stat) != 3 || !satisfyFilters(NewFile(commit, stat[2]), q.filters) {
+				continue
+			}
+			added, deleted, err := q.lineStats.numstat(ctx, stat[0], stat[1], stat[2], commit.CommitHash()+"^", commit.CommitHash())
+			if err != nil {
+				return nil, err
+			}
+			change.Files = append(change.Files, fileLines{Name: stat[2], Lines: added + deleted})
+		}
+		res = append(res, change)
+	}
+	return res, nil
+}
+
+// commitAuthors reads the authors of the heads of merges, keyed by merge.
+func commitAuthors(ctx context.Context, heads map[string]string) (map[string]string, error) {
+	authors := make(map[string]string, len(heads))
+	if len(heads) == 0 {
+		return authors, nil
+	}
+	args := []string{"log", "--no-walk=unsorted", "--format=%h%x00%an <%ae>"}
+	for _, head := range heads {
+		args = append(args, head)
+	}
+	output, err := runGit(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	byHead := make(map[string]string, len(heads))
+	for _, line := range strings.Split(string(output), "\n") {
+		if hash, author, ok := strings.Cut(line, "\x00"); ok {
+			byHead[hash] = displayAuthor(ctx, author)
+		}
+	}
+	for merge, head := range heads {
+		if author, ok := byHead[head]; ok {
+			authors[merge] = author
+		}
+	}
+	return authors, nil
+}
+
+// sizePercentiles are the nearest-rank percentiles of sizes.
+type sizePercentiles struct {
+	P50 int `json:"p50"`
+	P75 int `json:"p75"`
+	P90 int `json:"p90"`
+	Max int `json:"max"`
+}
+
+func percentiles(sizes []int) sizePercentiles {
+	sorted := append([]int{}, sizes...)
+	sort.Ints(sorted)
+	rank := func(p float64) int {
+		i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return sizePercentiles{P50: rank(50), P75: rank(75), P90: rank(90), Max: sorted[len(sorted)-1]}
+}
+
+type sizeStats struct {
+	// Group is the author or team, empty for every change.
+	Group   string          `json:"group"`
+	Changes int             `json:"changes"`
+	Files   sizePercentiles `json:"files"`
+	Lines   sizePercentiles `json:"lines"`
+	// Large counts the changes over the -large lines.
+	Large int `json:"large"`
+}
+
+// sizeGroups sums up the sizes of every group, largest p90 of lines first,
+// ties by name.
+func sizeGroups(files, lines map[string][]int, large int) []sizeStats {
+	res := make([]sizeStats, 0, len(lines))
+	for group, sizes := range lines {
+		s := sizeStats{Group: group, Changes: len(sizes), Files: percentiles(files[group]), Lines: percentiles(sizes)}
+		for _, n := range sizes {
+			if n > large {
+				s.Large++
+			}
+		}
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Lines.P90 != res[j].Lines.P90 {
+			return res[i].Lines.P90 > res[j].Lines.P90
+		}
+		return res[i].Group < res[j].Group
+	})
+	return res
+}
+
+// sizeUnits name the units of -unit.
+var sizeUnits = map[string]string{"commit": "commits", "pull": "pull requests"}
+
+type sizeReport struct {
+	Unit    string      `json:"unit"`
+	All     sizeStats   `json:"all"`
+	Authors []sizeStats `json:"authors"`
+	Teams   []sizeStats `json:"teams,omitempty"`
+}
+
+func collectSizes(ctx context.Context, q *query, unit string, teams map[string][]string, large int) (*sizeReport, error) {
+	opt := q.listingOptions()
+	opt.GetCommits.Subjects = unit == "pull"
+	commits, err := q.backend.commits(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	mergeDiff := opt.GetCommits.MergeDiff
+	if mergeDiff == MergeDiffAuto && (opt.GetCommits.FirstParent || opt.GetCommits.Merges == MergesOnly) {
+		mergeDiff = MergeDiffFirstParent
+	}
+	if unit == "pull" {
+		// The newest commit of a pull request is its merge or squash
+		// commit, diffed against the first parent.
+		pulls := make([]Commit, 0)
+		seen := make(map[int]bool)
+		for _, commit := range commits {
+			if n := commit.PullRequest(); n > 0 && !seen[n] {
+				seen[n] = true
+				pulls = append(pulls, commit)
+			}
+		}
+		commits, mergeDiff = pulls, MergeDiffFirstParent
+	}
+	changes, err := measureChanges(ctx, q, commits, mergeDiff)
+	if err != nil {
+		return nil, err
+	}
+
+	files, lines := make(map[string][]int), make(map[string][]int)
+	teamFiles, teamLines := make(map[string][]int), make(map[string][]int)
+	names := make(map[string]string)
+	for _, change := range changes {
+		if len(change.Files) == 0 {
+			continue
+		}
+		key := authorKey(change.Author)
+		if _, ok := names[key]; !ok {
+			names[key] = change.Author
+		}
+		files[""] = append(files[""], len(change.Files))
+		lines[""] = append(lines[""], change.lines())
+		files[key] = append(files[key], len(change.Files))
+		lines[key] = append(lines[key], change.lines())
+		if len(teams) == 0 {
+			continue
+		}
+		// A team counts the part of the change in its files.
+		changed := make([]File, 0, len(change.Files))
+		counts := make(map[string]int, len(change.Files))
+		for _, f := range change.Files {
+			changed = append(changed, NewFile(change.Commit, f.Name))
+			counts[f.Name] = f.Lines
+		}
+		groups, owned := groupByTeam(changed, teams)
+		for _, team := range groups {
+			if team == "" {
+				continue
+			}
+			n := 0
+			for _, file := range owned[team] {
+				n += counts[file.Name()]
+			}
+			teamFiles[team] = append(teamFiles[team], len(owned[team]))
+			teamLines[team] = append(teamLines[team], n)
+		}
+	}
+	if len(lines[""]) == 0 {
+		return nil, fmt.Errorf("no %s changed a file in the walked commits", sizeUnits[unit])
+	}
+
+	r := &sizeReport{Unit: unit}
+	all := map[string][]int{"": lines[""]}
+	r.All = sizeGroups(map[string][]int{"": files[""]}, all, large)[0]
+	delete(files, "")
+	delete(lines, "")
+	r.Authors = sizeGroups(files, lines, large)
+	for i := range r.Authors {
+		r.Authors[i].Group = names[r.Authors[i].Group]
+	}
+	r.Teams = sizeGroups(teamFiles, teamLines, large)
+	return r, q.err()
+}
+
+func (p sizePercentiles) String() string {
+	return fmt.Sprintf("%d/%d/%d/%d", p.P50, p.P75, p.P90, p.Max)
+}
+
+func printSizeStats(s sizeStats, name string) {
+	fmt.Printf("%-36s %13d %18s %22s %5.0f%%\n", name, s.Changes, s.Files, s.Lines, 100*float64(s.Large)/float64(s.Changes))
+}
+
+// sizeAdvice points out the groups whose changes often run over large
+// lines: one in ten of them or more.
+func sizeAdvice(r *sizeReport, large int) []string {
+	advice := make([]string, 0)
+	check := func(s sizeStats, name string) {
+		if s.Lines.P90 <= large {
+			return
+		}
+		advice = append(advice, fmt.Sprintf("%s: the largest tenth of the %s change %d lines or more, %d of %d over %d; split them into smaller changes", name, sizeUnits[r.Unit], s.Lines.P90, s.Large, s.Changes, large))
+	}
+	check(r.All, "overall")
+	for _, s := range r.Teams {
+		check(s, "team "+s.Group)
+	}
+	for _, s := range r.Authors {
+		check(s, s.Group)
+	}
+	return advice
+}
+
+func runSizes(args []string) error {
+	flags := flag.NewFlagSet("sizes", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 1000)
+	unit := flags.String("unit", "commit", "measure every `unit`: commit, or pull for the merged pull requests")
+	large := flags.Int("large", 400, "count the changes over `lines` lines as large, and advise when the largest tenth of a group is")
+	asJSON := flags.Bool("json", false, "print the statistics and the advice as a JSON object")
+	timeout := flags.Duration("timeout", 5*time.Minute, "give up after `duration`")
+	flags.Parse(args)
+	if *unit != "commit" && *unit != "pull" {
+		return fmt.Errorf("unknown -unit %q, want commit or pull", *unit)
+	}
+	if *large <= 0 {
+		return fmt.Errorf("-large %d: must be positive", *large)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	if q.backend.marker != gitBackend.marker {
+		return errors.New("sizes needs a git repository")
+	}
+	dir := q.topLevel
+	if *queryFlags.remote != "" {
+		dir = ""
+	}
+	teams, err := loadTeams(ctx, q.config, dir, "HEAD")
+	if err != nil {
+		return err
+	}
+
+	r, err := collectSizes(ctx, q, *unit, teams, *large)
+	if err != nil {
+		return err
+	}
+	advice := sizeAdvice(r, *large)
+	if *asJSON {
+		return printJSON(struct {
+			*sizeReport
+			Advice []string `json:"advice"`
+		}{r, advice})
+	}
+
+	fmt.Printf("%-36s %13s %18s %22s %6s\n", "", sizeUnits[r.Unit], "files p50/75/90/max", "lines p50/75/90/max", "large")
+	printSizeStats(r.All, "all")
+	if len(r.Teams) > 0 {
+		fmt.Println("\nteams")
+		for _, s := range r.Teams {
+			printSizeStats(s, s.Group)
+		}
+	}
+	fmt.Println("\nauthors")
+	for _, s := range r.Authors {
+		printSizeStats(s, s.Group)
+	}
+	if len(advice) > 0 {
+		fmt.Println()
+		for _, a := range advice {
+			fmt.Println(a)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func cmdListTree(ctx context.Context, rev string) ([]string, error) {
+	output, err := runGit(ctx, "ls-tree", "-r", "-z", "--name-only", rev, "--")
+	if err != nil {
+		return nil, err
+	}
+	names := strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00")
+	if len(names) == 1 && names[0] == "" {
+		return nil, nil
+	}
+	return names, nil
+}
+
+// ageCutoff returns the time age ago. Besides Go durations, age can count
+// days, weeks, months or years: 30d, 6w, 12m, 2y.
+func ageCutoff(now time.Time, age string) (time.Time, error) {
+	if len(age) > 1 {
+		if n, err := strconv.Atoi(age[:len(age)-1]); err == nil {
+			switch age[len(age)-1] {
+			case 'd':
+				return now.AddDate(0, 0, -n), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*n), nil
+			case 'm':
+				return now.AddDate(0, -n, 0), nil
+			case 'y':
+				return now.AddDate(-n, 0, 0), nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil {
+		return now, fmt.Errorf("bad age %q, want e.g. 30d, 6w, 12m or 2y", age)
+	}
+	return now.Add(-d), nil
+}
+
+// staleFiles lists the tracked files of rev whose last change is older than
+// cutoff, oldest first.
+func staleFiles(ctx context.Context, cache Cache, q *query, rev string, cutoff time.Time) ([]File, error) {
+	names, err := cmdListTree(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+	touched, err := loadLastTouch(ctx, cache, q, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]File, 0)
+	for _, name := range names {
+		commit, ok := touched[name]
+		if !ok || !commit.commitTime.Before(cutoff) {
+			continue
+		}
+		file := NewFile(commit, name)
+		if satisfyFilters(file, q.filters) {
+			files = append(files, file)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].GetCommit().(*commitObj).commitTime.Before(files[j].GetCommit().(*commitObj).commitTime)
+	})
+	return q.aggregate(files), nil
+}
+
+func runStale(args []string) error {
+	flags := flag.NewFlagSet("stale", flag.ExitOnError)
+	queryFlags := addQueryFlags(flags, 0)
+	olderThan := flags.String("older-than", "12m", "list files last changed longer than `age` ago: 30d, 6w, 12m, 2y or a Go duration")
+	timeout := flags.Duration("timeout", time.Minute, "give up after `duration`")
+	cacheSpec := flags.String("cache", "", "cache `backend` of the last-touch index: disk, memory or redis://host:port (default $"+cacheEnv+" or disk)")
+	flags.Parse(args)
+
+	cache, err := newCache(orEnv(*cacheSpec, cacheEnv))
+	if err != nil {
+		return err
+	}
+
+	cutoff, err := ageCutoff(time.Now(), *olderThan)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	ctx, q, err := queryFlags.build(ctx)
+	if err != nil {
+		return err
+	}
+	defer q.close()
+	if len(q.aggregates) > 0 {
+		return errors.New("stale only knows the last commit of every file, it cannot count the authors of -min-authors or -max-authors")
+	}
+
+	files, err := staleFiles(ctx, cache, q, q.rev(), cutoff)
+	if err != nil {
+		return err
+	}
+	if err := q.err(); err != nil {
+		return err
+	}
+	return printFiles(ctx, files, "")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgeCutoff(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		age  string
+		want time.Time
+		ok   bool
+	}{
+		{"30d", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), true},
+		{"2w", time.Date(2024, 3, 17, 12, 0, 0, 0, time.UTC), true},
+		{"1m", time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), true},
+		{"2y", time.Date(2022, 3, 31, 12, 0, 0, 0, time.UTC), true},
+		{"36h", time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC), true},
+		// m counts months, not minutes, unless the duration has more.
+		{"90m", time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC), true},
+		{"1h30m", time.Date(2024, 3, 31, 10, 30, 0, 0, time.UTC), true},
+		{"d", now, false},
+		{"30x", now, false},
+		{"", now, false},
+	}
+	for _, test := range tests {
+		got, err := ageCutoff(now, test.age)
+		if ok := err == nil; ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("ageCutoff(%q) = %v, %v, want %v, ok %v", test.age, got, err, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SVNRevision is where a commit imported or committed with git-svn lives
+// in Subversion, as its git-svn-id line records:
+//
+//	git-svn-id: https://svn.example.com/repo/trunk@1234 5e5b8a4c-3f0e-0410-9dd7-c1d22e3a9e0f
+type SVNRevision struct {
+	URL      string `json:"url"`
+	Revision int    `json:"revision"`
+	UUID     string `json:"uuid"`
+}
+
+// gitSVNIDKey is the git-svn-id line as a trailer key, which it reads as
+// since git-svn appends it to the message on a line of its own.
+const gitSVNIDKey = "Git-Svn-Id"
+
+func parseSVNID(value string) (SVNRevision, bool) {
+	location, uuid, _ := strings.Cut(strings.TrimSpace(value), " ")
+	i := strings.LastIndex(location, "@")
+	if i < 0 {
+		return SVNRevision{}, false
+	}
+	revision, err := strconv.Atoi(location[i+1:])
+	if err != nil || revision <= 0 {
+		return SVNRevision{}, false
+	}
+	return SVNRevision{URL: location[:i], Revision: revision, UUID: uuid}, true
+}
+
+func (c *commitObj) SVN() SVNRevision {
+	svn, _ := parseSVNID(c.trailers.Get(gitSVNIDKey))
+	return svn
+}
+
+// groupBySVNRevision groups files by the Subversion revision of their
+// commit, in the order of the listing; 0 collects the files of commits
+// git-svn did not make.
+func groupBySVNRevision(files []File) ([]int, map[int][]File) {
+	revisions := make([]int, 0)
+	groups := make(map[int][]File)
+	for _, file := range files {
+		revision := file.GetCommit().SVN().Revision
+		if _, ok := groups[revision]; !ok {
+			revisions = append(revisions, revision)
+		}
+		groups[revision] = append(groups[revision], file)
+	}
+	return revisions, groups
+}
+
+var svnRevPattern = regexp.MustCompile(`^r([0-9]+)$`)
+
+// resolveSVNRefs replaces the Subversion revisions, written r1234, of a
+// revision or range with the commits git-svn made of them, so ranges can be
+// given in the numbers a team mid-migration still uses. Names git knows
+// are left alone.
+func resolveSVNRefs(ctx context.Context, ref string) (string, error) {
+	if !strings.Contains(ref, "r") {
+		return ref, nil
+	}
+	sep := ".."
+	if strings.Contains(ref, "...") {
+		sep = "..."
+	}
+	parts := strings.Split(ref, sep)
+	for i, part := range parts {
+		m := svnRevPattern.FindStringSubmatch(part)
+		if m == nil {
+			continue
+		}
+		if _, err := runGit(ctx, "rev-parse", "--verify", "-q", part+"^{commit}"); err == nil {
+			continue
+		}
+		output, err := runGit(ctx, "log", "--all", "-1", "--format=%H", "--extended-regexp",
+			"--grep=^git-svn-id: [^ ]*@"+m[1]+"( |$)")
+		if err != nil {
+			return "", err
+		}
+		hash := strings.TrimSpace(string(output))
+		if hash == "" {
+			return "", fmt.Errorf("no git-svn commit of svn revision %s", part)
+		}
+		parts[i] = hash
+	}
+	return strings.Join(parts, sep), nil
+}
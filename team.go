@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Teams own paths. .gitility.yaml maps every team to gitignore-style
+// patterns; without teams there, they are read from CODEOWNERS, the last
+// rule matching a file naming its owners as on GitHub. A file belongs to
+// every team whose patterns match it.
+
+// codeownersPaths are where GitHub looks for CODEOWNERS, in its order.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// teamName is how -team names the owner of a CODEOWNERS rule: @org/payments
+// is payments, @alice alice.
+func teamName(owner string) string {
+	owner = strings.TrimPrefix(owner, "@")
+	if i := strings.LastIndex(owner, "/"); i >= 0 {
+		owner = owner[i+1:]
+	}
+	return owner
+}
+
+// parseCodeowners turns CODEOWNERS into the patterns of every owner. The
+// rules of other owners come in negated, so that, the last matching
+// pattern winning, a file belongs to the owners of its last rule.
+func parseCodeowners(data []byte) map[string][]string {
+	type rule struct {
+		pattern string
+		owners  []string
+	}
+	rules := make([]rule, 0)
+	teams := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		r := rule{pattern: fields[0]}
+		for _, owner := range fields[1:] {
+			if !strings.Contains(owner, "@") {
+				// Not an owner, a user, team or email.
+				continue
+			}
+			r.owners = append(r.owners, teamName(owner))
+			teams[teamName(owner)] = nil
+		}
+		rules = append(rules, r)
+	}
+	for team := range teams {
+		patterns := make([]string, 0, len(rules))
+		for _, r := range rules {
+			owned := false
+			for _, owner := range r.owners {
+				owned = owned || owner == team
+			}
+			if owned {
+				patterns = append(patterns, r.pattern)
+			} else {
+				patterns = append(patterns, "!"+r.pattern)
+			}
+		}
+		teams[team] = patterns
+	}
+	return teams
+}
+
+// loadTeams are the teams of the configuration, or of CODEOWNERS when it
+// has none.
+func loadTeams(ctx context.Context, cfg config, dir, rev string) (map[string][]string, error) {
+	if len(cfg.Teams) > 0 {
+		return cfg.Teams, nil
+	}
+	return loadCodeowners(ctx, dir, rev)
+}
+
+// loadCodeowners reads the first CODEOWNERS of dir, or of the tree at rev
+// when dir is empty; none is no team.
+func loadCodeowners(ctx context.Context, dir, rev string) (map[string][]string, error) {
+	for _, name := range codeownersPaths {
+		var data []byte
+		var err error
+		found := true
+		if dir != "" {
+			data, err = os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			if os.IsNotExist(err) {
+				found, err = false, nil
+			}
+		} else {
+			data, found, err = cmdReadFile(ctx, rev, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return parseCodeowners(data), nil
+		}
+	}
+	return nil, nil
+}
+
+// teamFilter keeps the files of any of the teams.
+func teamFilter(teams map[string][]string, names []string) (Filters, error) {
+	owned := make([]Filters, 0, len(names))
+	for _, name := range names {
+		patterns, ok := teams[teamName(name)]
+		if !ok {
+			known := make([]string, 0, len(teams))
+			for team := range teams {
+				known = append(known, team)
+			}
+			sort.Strings(known)
+			if len(known) == 0 {
+				return nil, fmt.Errorf("-team %s: no teams in %s nor CODEOWNERS", name, configFileName)
+			}
+			return nil, fmt.Errorf("unknown -team %q, want one of %s", name, strings.Join(known, ", "))
+		}
+		owned = append(owned, Exclude(patterns...))
+	}
+	return func(file File) bool {
+		for _, notOwned := range owned {
+			if !notOwned(file) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// groupByTeam groups the files by the teams owning them, in the order of
+// the team names; a file of several teams is in each group, and the files
+// of none are under "".
+func groupByTeam(files []File, teams map[string][]string) ([]string, map[string][]File) {
+	names := make([]string, 0, len(teams))
+	owners := make(map[string]Filters, len(teams))
+	for team, patterns := range teams {
+		names = append(names, team)
+		owners[team] = Exclude(patterns...)
+	}
+	sort.Strings(names)
+	groups := make(map[string][]File)
+	for _, file := range files {
+		owned := false
+		for _, team := range names {
+			if !owners[team](file) {
+				groups[team] = append(groups[team], file)
+				owned = true
+			}
+		}
+		if !owned {
+			groups[""] = append(groups[""], file)
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for _, team := range names {
+		if len(groups[team]) > 0 {
+			keys = append(keys, team)
+		}
+	}
+	if len(groups[""]) > 0 {
+		keys = append(keys, "")
+	}
+	return keys, groups
+}
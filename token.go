@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API tokens let gitility serve tell its clients apart. The tokens file
+// only keeps their SHA-256, so reading it does not give access; a token is
+// shown once, when issued. Requests bear it as "Authorization: Bearer".
+
+// role is what a token allows: readers query the repositories, admins
+// also register them, flush their results and issue tokens.
+type role string
+
+const (
+	roleRead  role = "read"
+	roleAdmin role = "admin"
+)
+
+func (r role) allows(need role) bool {
+	return r == roleAdmin || r == need
+}
+
+const tokenPrefix = "gty_"
+
+var errForbidden = errors.New("forbidden")
+
+type apiToken struct {
+	Name    string    `json:"name"`
+	Role    role      `json:"role"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+type tokenStore struct {
+	path string
+
+	mu     sync.Mutex
+	tokens []apiToken
+}
+
+func loadTokenStore(path string) (*tokenStore, error) {
+	s := &tokenStore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.tokens); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issue makes a token and stores its hash; the token itself is returned
+// and never kept.
+func (s *tokenStore) issue(name string, r role) (string, error) {
+	if r != roleRead && r != roleAdmin {
+		return "", fmt.Errorf("unknown role %q, want read or admin", r)
+	}
+	if name == "" {
+		return "", errors.New("a token needs a name")
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token := tokenPrefix + hex.EncodeToString(secret)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := append(s.tokens, apiToken{Name: name, Role: r, Hash: hashToken(token), Created: time.Now().UTC()})
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(s.path, data, 0o600); err != nil {
+		return "", err
+	}
+	s.tokens = tokens
+	return token, nil
+}
+
+// lookup finds the token of a request.
+func (s *tokenStore) lookup(r *http.Request) (apiToken, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return apiToken{}, false
+	}
+	hash := hashToken(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) == 1 {
+			return t, true
+		}
+	}
+	return apiToken{}, false
+}
+
+// hook checks the token of every request, when the server has tokens.
+func (s *tokenStore) hook() authHook {
+	if s == nil {
+		return nil
+	}
+	return func(r *http.Request, repo string, need role) error {
+		t, ok := s.lookup(r)
+		if !ok {
+			return errors.New("no valid API token")
+		}
+		if !t.Role.allows(need) {
+			return fmt.Errorf("token %s: %w: %s role needed", t.Name, errForbidden, need)
+		}
+		return nil
+	}
+}
+
+func (srv *server) serveIssueToken(w http.ResponseWriter, r *http.Request) {
+	if srv.tokens == nil {
+		httpError(w, http.StatusNotFound, errors.New("the server runs without -tokens"))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	req := struct {
+		Name string `json:"name"`
+		Role role   `json:"role"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	token, err := srv.tokens.issue(req.Name, req.Role)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, struct {
+		Token string `json:"token"`
+	}{token})
+}
+
+// runToken issues a token from the command line, the first admin token of
+// a server among them.
+func runToken(args []string) error {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	tokensPath := flags.String("tokens", "", "store the token in `file`, the -tokens of gitility serve")
+	r := flags.String("role", string(roleRead), "`role` of the token: read or admin")
+	flags.Parse(args)
+	if *tokensPath == "" || flags.NArg() != 1 {
+		return errors.New("usage: gitility token -tokens file [-role read|admin] <name>")
+	}
+
+	store, err := loadTokenStore(*tokensPath)
+	if err != nil {
+		return err
+	}
+	token, err := store.issue(flags.Arg(0), role(*r))
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
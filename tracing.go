@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans follow the OpenTelemetry data model and are exported as OTLP/HTTP
+// JSON, which keeps the binary free of the OTel SDK. Export is configured
+// with the standard OTEL_EXPORTER_OTLP_ENDPOINT (or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) and OTEL_SERVICE_NAME variables; without
+// an endpoint spans are only visible in `go tool trace`.
+
+type span struct {
+	task     *trace.Task
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+}
+
+type spanKey struct{}
+
+func startSpan(ctx context.Context, name string) (context.Context, *span) {
+	s := &span{name: name, start: time.Now()}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+
+	ctx, s.task = trace.NewTask(ctx, name)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *span) SetAttr(key string, value interface{}) {
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+func (s *span) SetError(err error) {
+	if err != nil {
+		s.err = err
+	}
+}
+
+func (s *span) End() {
+	s.end = time.Now()
+	s.task.End()
+	defaultTracer.record(s)
+}
+
+const maxBufferedSpans = 16384
+
+type tracer struct {
+	mu       sync.Mutex
+	endpoint string
+	service  string
+	spans    []*span
+	dropped  int
+}
+
+var defaultTracer = newTracerFromEnv()
+
+func newTracerFromEnv() *tracer {
+	t := &tracer{service: os.Getenv("OTEL_SERVICE_NAME")}
+	if t.service == "" {
+		t.service = "gitility"
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		t.endpoint = endpoint
+	} else if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		t.endpoint = strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+	return t
+}
+
+func (t *tracer) record(s *span) {
+	if t.endpoint == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) >= maxBufferedSpans {
+		t.dropped++
+		return
+	}
+	t.spans = append(t.spans, s)
+}
+
+// flush sends the buffered spans to the OTLP endpoint. The CLI calls it once
+// before exiting; serve and mcp also call it every flushInterval, through
+// flushLoop.
+func (t *tracer) flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans, dropped := t.spans, t.dropped
+	t.spans, t.dropped = nil, 0
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(otlpRequest(t.service, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export to %s: %s", t.endpoint, resp.Status)
+	}
+	if dropped > 0 {
+		return fmt.Errorf("otlp export: dropped %d spans over the buffer limit", dropped)
+	}
+	return nil
+}
+
+// flushInterval is how often the long-running modes send their spans.
+const flushInterval = 10 * time.Second
+
+// flushLoop flushes the spans every flushInterval until ctx is done. The
+// last ones are flushed as the CLI exits.
+func (t *tracer) flushLoop(ctx context.Context) {
+	if t.endpoint == "" {
+		return
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		flushCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		if err := t.flush(flushCtx); err != nil {
+			log.Print(err)
+		}
+		cancel()
+	}
+}
+
+type otlpAttr struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpAttrs(attrs map[string]interface{}) []otlpAttr {
+	res := make([]otlpAttr, 0, len(attrs))
+	for key, value := range attrs {
+		switch v := value.(type) {
+		case int:
+			res = append(res, otlpAttr{Key: key, Value: map[string]interface{}{"intValue": strconv.Itoa(v)}})
+		case bool:
+			res = append(res, otlpAttr{Key: key, Value: map[string]interface{}{"boolValue": v}})
+		default:
+			res = append(res, otlpAttr{Key: key, Value: map[string]interface{}{"stringValue": fmt.Sprint(v)}})
+		}
+	}
+	return res
+}
+
+func otlpRequest(service string, spans []*span) map[string]interface{} {
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		status := map[string]interface{}{"code": 1}
+		if s.err != nil {
+			status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+		otlpSpan := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttrs(s.attrs),
+			"status":            status,
+		}
+		if s.parentID != [8]byte{} {
+			otlpSpan["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		otlpSpans = append(otlpSpans, otlpSpan)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttrs(map[string]interface{}{"service.name": service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "github.com/shanenoi/gitility"},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+}
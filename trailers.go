@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// Trailers maps the trailer keys of a commit message (Reviewed-by,
+// Co-authored-by, Change-Id, ...) to their values. Like http.Header, keys
+// are stored in canonical form, so use Get and Values for lookups.
+type Trailers map[string][]string
+
+func (t Trailers) Get(key string) string {
+	values := t.Values(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (t Trailers) Values(key string) []string {
+	return t[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+func parseTrailers(raw string) Trailers {
+	trailers := make(Trailers)
+	for _, trailer := range strings.Split(raw, "\x01") {
+		key, value, ok := strings.Cut(trailer, ":")
+		if !ok {
+			continue
+		}
+		key = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(key))
+		trailers[key] = append(trailers[key], strings.TrimSpace(value))
+	}
+	return trailers
+}
+
+// HasTrailer keeps files from commits carrying the trailer key with a value
+// matching the case-insensitive pattern, e.g. HasTrailer("Reviewed-by",
+// "alice"). An empty pattern only requires the trailer to be present.
+func HasTrailer(key string, pattern string) Filters {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		re = regexp.MustCompile("(?i)" + regexp.QuoteMeta(pattern))
+	}
+	return func(file File) bool {
+		for _, value := range file.GetCommit().Trailers().Values(key) {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// groupByTrailer buckets files by the values of a trailer on their commit.
+// A commit with several values lands in every bucket, commits without the
+// trailer are grouped under "".
+func groupByTrailer(files []File, key string) ([]string, map[string][]File) {
+	keys := make([]string, 0)
+	groups := make(map[string][]File)
+	for _, file := range files {
+		values := file.GetCommit().Trailers().Values(key)
+		if len(values) == 0 {
+			values = []string{""}
+		}
+		for _, value := range values {
+			if _, ok := groups[value]; !ok {
+				keys = append(keys, value)
+			}
+			groups[value] = append(groups[value], file)
+		}
+	}
+	return keys, groups
+}
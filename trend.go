@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// Trends split the changes of hotspots into moving windows, so they tell
+// whether an area is heating up or cooling down rather than how hot it was
+// over the whole walk. The windows end at the newest walked commit and
+// every step before it, back to the oldest one; they overlap when the
+// window is longer than the step.
+
+type trendWindow struct {
+	// Start is excluded, End included.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (w trendWindow) contains(t time.Time) bool {
+	return t.After(w.Start) && !t.After(w.End)
+}
+
+// trendWindows lays out the windows covering newest back to oldest, oldest
+// first. window and step are ages, as ageCutoff reads them.
+func trendWindows(newest, oldest time.Time, window, step string) ([]trendWindow, error) {
+	windows := make([]trendWindow, 0)
+	for end := newest; !end.Before(oldest); {
+		start, err := ageCutoff(end, window)
+		if err != nil {
+			return nil, fmt.Errorf("-window: %w", err)
+		}
+		if !start.Before(end) {
+			return nil, fmt.Errorf("-window %s: must be positive", window)
+		}
+		windows = append(windows, trendWindow{Start: start, End: end})
+		next, err := ageCutoff(end, step)
+		if err != nil {
+			return nil, fmt.Errorf("-step: %w", err)
+		}
+		if !next.Before(end) {
+			return nil, fmt.Errorf("-step %s: must be positive", step)
+		}
+		end = next
+	}
+	for i, j := 0, len(windows)-1; i < j; i, j = i+1, j-1 {
+		windows[i], windows[j] = windows[j], windows[i]
+	}
+	return windows, nil
+}
+
+// trendSeries is the changes of a file or directory in every window,
+// oldest first, and over the whole walk.
+type trendSeries struct {
+	Name    string    `json:"name"`
+	Changes float64   `json:"changes"`
+	Series  []float64 `json:"series"`
+}
+
+type trends struct {
+	Windows []trendWindow  `json:"windows"`
+	Series  []*trendSeries `json:"series"`
+}
+
+// collectTrends counts the changes of every file, or of every directory
+// with byDir, in the windows of the walk, ranked by their changes over the
+// whole walk like hotspots.
+func collectTrends(ctx context.Context, q *query, window, step string, byDir bool) (*trends, error) {
+	commits, err := q.backend.commits(ctx, q.listingOptions())
+	if err != nil {
+		return nil, err
+	}
+	t, err := commitTrends(ctx, commits, q.filters, window, step, byDir)
+	if err != nil {
+		return nil, err
+	}
+	return t, q.err()
+}
+
+// commitTrends is collectTrends over walked commits.
+func commitTrends(ctx context.Context, commits []Commit, filters []Filters, window, step string, byDir bool) (*trends, error) {
+	if len(commits) == 0 {
+		return nil, errors.New("no commit walked")
+	}
+	if err := Preload(ctx, commits, CommitFieldTime, CommitFieldFiles); err != nil {
+		return nil, err
+	}
+	times := make([]time.Time, len(commits))
+	newest, oldest := time.Time{}, time.Time{}
+	for i, commit := range commits {
+		var err error
+		if times[i], err = commit.CommitTime(ctx); err != nil {
+			return nil, err
+		}
+		if newest.IsZero() || times[i].After(newest) {
+			newest = times[i]
+		}
+		if oldest.IsZero() || times[i].Before(oldest) {
+			oldest = times[i]
+		}
+	}
+	windows, err := trendWindows(newest, oldest, window, step)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &trends{Windows: windows}
+	series := make(map[string]*trendSeries)
+	for i, commit := range commits {
+		files, err := commit.GetFiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// A commit changes a directory once, whatever the number of its
+		// files it changed.
+		counted := make(map[string]bool)
+		for _, file := range files {
+			if !satisfyFilters(file, filters) {
+				continue
+			}
+			name := file.Name()
+			if byDir {
+				name = path.Dir(name)
+			}
+			if counted[name] {
+				continue
+			}
+			counted[name] = true
+			s, ok := series[name]
+			if !ok {
+				s = &trendSeries{Name: name, Series: make([]float64, len(windows))}
+				series[name] = s
+				t.Series = append(t.Series, s)
+			}
+			s.Changes++
+			for w, window := range windows {
+				if window.contains(times[i]) {
+					s.Series[w]++
+				}
+			}
+		}
+	}
+	sort.Slice(t.Series, func(i, j int) bool {
+		if t.Series[i].Changes != t.Series[j].Changes {
+			return t.Series[i].Changes > t.Series[j].Changes
+		}
+		return t.Series[i].Name < t.Series[j].Name
+	})
+	return t, nil
+}
+
+// print writes a row per series: its changes over the walk, then in every
+// window, oldest first.
+func (t *trends) print(ctx context.Context, w io.Writer) {
+	first, last := t.Windows[0], t.Windows[len(t.Windows)-1]
+	fmt.Fprintf(w, "%d windows ending %s to %s\n\n", len(t.Windows), first.End.Format("2006-01-02"), last.End.Format("2006-01-02"))
+	for _, s := range t.Series {
+		fmt.Fprintf(w, "%6.0f ", s.Changes)
+		for _, changes := range s.Series {
+			fmt.Fprintf(w, " %3.0f", changes)
+		}
+		fmt.Fprintf(w, "  %s\n", displayName(ctx, s.Name))
+	}
+}